@@ -20,12 +20,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antchfx/xmlquery"
@@ -36,6 +38,7 @@ import (
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -62,6 +65,7 @@ const (
 	configMapRemediationsProcessed = "compliance-remediations/processed"
 	configMapCompressed            = "openscap-scan-result/compressed"
 	apiserverOperatorName          = "openshift-apiserver"
+	clusterInfrastructureName      = "cluster"
 	tailoredProfileSuffix          = "-tp"
 )
 
@@ -80,6 +84,8 @@ type aggregatorConfig struct {
 	Content   string
 	ScanName  string
 	Namespace string
+	NDJSON    bool
+	Workers   int
 }
 
 type aggregatorCrClient interface {
@@ -111,6 +117,10 @@ func defineAggregatorFlags(cmd *cobra.Command) {
 	cmd.Flags().String("content", "", "The path to the OpenScap content")
 	cmd.Flags().String("scan", "", "The compliance scan that owns the configMap objects.")
 	cmd.Flags().String("namespace", "openshift-compliance", "Running pod namespace.")
+	cmd.Flags().Bool("ndjson", false, "Also print each ComplianceCheckResult to stdout as a single JSON line once it's "+
+		"created or updated.")
+	cmd.Flags().Int("concurrency", 1, "How many result ConfigMaps are parsed, and how many results are created "+
+		"or updated, at once.")
 
 	flags := cmd.Flags()
 
@@ -124,9 +134,16 @@ func parseAggregatorConfig(cmd *cobra.Command) *aggregatorConfig {
 	conf.Content = getValidStringArg(cmd, "content")
 	conf.ScanName = getValidStringArg(cmd, "scan")
 	conf.Namespace = getValidStringArg(cmd, "namespace")
+	conf.NDJSON, _ = cmd.Flags().GetBool("ndjson")
+	conf.Workers, _ = cmd.Flags().GetInt("concurrency")
 
 	logf.SetLogger(zap.New())
 
+	if conf.Workers < 1 {
+		cmdLog.Error(fmt.Errorf("got %d", conf.Workers), "The --concurrency must be at least 1")
+		os.Exit(1)
+	}
+
 	return &conf
 }
 
@@ -517,6 +534,11 @@ func getCheckResultLabels(pr *utils.ParseResult, resultLabels map[string]string,
 	if pr.Remediations != nil {
 		labels[compv1alpha1.ComplianceCheckResultHasRemediation] = ""
 	}
+	for _, ref := range pr.CheckResult.References {
+		if ref.Type != "" {
+			labels[compv1alpha1.ComplianceCheckResultReferenceLabelPrefix+ref.Type] = ""
+		}
+	}
 
 	for k, v := range resultLabels {
 		labels[k] = v
@@ -525,9 +547,24 @@ func getCheckResultLabels(pr *utils.ParseResult, resultLabels map[string]string,
 	return labels
 }
 
-func getCheckResultAnnotations(cr *compv1alpha1.ComplianceCheckResult, resultAnnotations map[string]string) map[string]string {
+func getCheckResultAnnotations(cr *compv1alpha1.ComplianceCheckResult, resultAnnotations map[string]string, scan *compv1alpha1.ComplianceScan, contentDigest string) map[string]string {
 	annotations := make(map[string]string)
 	annotations[compv1alpha1.ComplianceCheckResultRuleAnnotation] = utils.IDToDNSFriendlyName(cr.ID)
+	if contentDigest != "" {
+		annotations[compv1alpha1.ComplianceCheckResultContentDigestAnnotation] = contentDigest
+	}
+	// Only the resource collector of platform scans reads the tailoring
+	if scan.Status.TailoringDigest != "" {
+		annotations[compv1alpha1.ComplianceCheckResultTailoringDigestAnnotation] = scan.Status.TailoringDigest
+	}
+	if platform := scan.GetAnnotations()[compv1alpha1.ComplianceScanPlatformAnnotation]; platform != "" {
+		annotations[compv1alpha1.ComplianceCheckResultPlatformAnnotation] = platform
+	}
+	// Set by the parser, and only relevant as long as the result doesn't apply
+	if reason := cr.GetAnnotations()[compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation]; reason != "" &&
+		cr.Status == compv1alpha1.CheckResultNotApplicable {
+		annotations[compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation] = reason
+	}
 	for k, v := range resultAnnotations {
 		annotations[k] = v
 	}
@@ -535,21 +572,131 @@ func getCheckResultAnnotations(cr *compv1alpha1.ComplianceCheckResult, resultAnn
 	return annotations
 }
 
-func createResults(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceScan, consistentResults []*utils.ParseResultContextItem) error {
+// getInfrastructurePlatform returns the type of the platform the cluster runs
+// on from infrastructures/cluster, or an empty string if it isn't known, e.g.
+// on clusters other than OpenShift
+func getInfrastructurePlatform(crClient aggregatorCrClient) (string, error) {
+	infra := &ocpcfgv1.Infrastructure{}
+	key := types.NamespacedName{Name: clusterInfrastructureName}
+	if err := crClient.getClient().Get(context.TODO(), key, infra); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.Type != "" {
+		return string(infra.Status.PlatformStatus.Type), nil
+	}
+	// Older clusters only set the deprecated field
+	return string(infra.Status.Platform), nil
+}
+
+// annotateScanWithPlatform records the platform in an annotation of the scan,
+// which is also updated in place so the check results pick it up
+func annotateScanWithPlatform(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceScan, platform string) error {
+	if scan.GetAnnotations()[compv1alpha1.ComplianceScanPlatformAnnotation] == platform {
+		return nil
+	}
+	return patchScanAnnotations(context.TODO(), crClient.getClient(), scan, map[string]string{
+		compv1alpha1.ComplianceScanPlatformAnnotation: platform,
+	})
+}
+
+// ndjsonCheckResult is the line printed for each ComplianceCheckResult with
+// --ndjson, carrying the labels and annotations log pipelines filter on
+type ndjsonCheckResult struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Scan      string `json:"scan"`
+	Suite     string `json:"suite,omitempty"`
+	ID        string `json:"id"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Status    string `json:"status"`
+}
+
+// writeCheckResultLine writes the check result as a single JSON line
+func writeCheckResultLine(out io.Writer, cr *compv1alpha1.ComplianceCheckResult) error {
+	line, err := json.Marshal(ndjsonCheckResult{
+		Name:      cr.Name,
+		Namespace: cr.Namespace,
+		Scan:      cr.Labels[compv1alpha1.ComplianceScanLabel],
+		Suite:     cr.Labels[compv1alpha1.SuiteLabel],
+		ID:        cr.ID,
+		Rule:      cr.Annotations[compv1alpha1.ComplianceCheckResultRuleAnnotation],
+		Severity:  string(cr.Severity),
+		Status:    string(cr.Status),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", line)
+	return err
+}
+
+// orderedLines streams the lines of a list of results as they're produced,
+// holding each back until the lines of the results before it are written,
+// so they keep the order of the list however concurrently they're produced
+type orderedLines struct {
+	mutex sync.Mutex
+	out   io.Writer
+	lines [][]byte
+	done  []bool
+	next  int
+}
+
+func newOrderedLines(out io.Writer, n int) *orderedLines {
+	return &orderedLines{out: out, lines: make([][]byte, n), done: make([]bool, n)}
+}
+
+// finish records the line of the result at index i, which is empty if the
+// result isn't printed, and writes the lines that are now in order
+func (o *orderedLines) finish(i int, line []byte) {
+	if o == nil {
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.lines[i], o.done[i] = line, true
+	for ; o.next < len(o.done) && o.done[o.next]; o.next++ {
+		if o.out == nil {
+			continue
+		}
+		if _, err := o.out.Write(o.lines[o.next]); err != nil {
+			cmdLog.Error(err, "Cannot print the check results")
+			o.out = nil
+		}
+		o.lines[o.next] = nil
+	}
+}
+
+// createResults creates or updates the check results and their remediations,
+// handling up to concurrency results at once. If resultOut is set, each
+// created check result is also written to it as a JSON line as soon as the
+// results before it in consistentResults are. The lines of the results
+// following one that couldn't be created aren't written.
+func createResults(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceScan, contentDigest string, consistentResults []*utils.ParseResultContextItem, concurrency int, resultOut io.Writer) error {
 	cmdLog.Info("Will create result objects", "objects", len(consistentResults))
 	if len(consistentResults) == 0 {
 		cmdLog.Info("Nothing to create")
 		return nil
 	}
 
-	for _, pr := range consistentResults {
+	now := metav1.Now()
+	var lines *orderedLines
+	if resultOut != nil {
+		lines = newOrderedLines(resultOut, len(consistentResults))
+	}
+	return forEachConcurrently(len(consistentResults), concurrency, func(i int) error {
+		pr := consistentResults[i]
 		if pr == nil || pr.CheckResult == nil {
 			cmdLog.Info("nil result or result.check, this shouldn't happen")
-			continue
+			lines.finish(i, nil)
+			return nil
 		}
 
 		checkResultLabels := getCheckResultLabels(&pr.ParseResult, pr.Labels, scan)
-		checkResultAnnotations := getCheckResultAnnotations(pr.CheckResult, pr.Annotations)
+		checkResultAnnotations := getCheckResultAnnotations(pr.CheckResult, pr.Annotations, scan, contentDigest)
 
 		crkey := getObjKey(pr.CheckResult.GetName(), pr.CheckResult.GetNamespace())
 		foundCheckResult := &compv1alpha1.ComplianceCheckResult{}
@@ -558,26 +705,43 @@ func createResults(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceSca
 		cmdLog.Info("Getting ComplianceCheckResult", "ComplianceCheckResult.Name", crkey.Name,
 			"ComplianceCheckResult.Namespace", crkey.Namespace)
 		checkResultExists := getObjectIfFound(crClient, crkey, foundCheckResult)
+		if !checkResultExists {
+			foundCheckResult = nil
+		}
+		pr.CheckResult.FirstObservedFailure = firstObservedFailure(foundCheckResult, pr.CheckResult.Status, now)
+		pr.CheckResult.LastCheckedTime = now
+		if resultChanged(foundCheckResult, pr.CheckResult.Status) {
+			checkResultLabels[compv1alpha1.ComplianceCheckResultChangedLabel] = "true"
+		}
 		if checkResultExists {
+			carryRemediationHistory(checkResultAnnotations, foundCheckResult.GetAnnotations(), pr.CheckResult.Status, now)
 			// Copy resource version and other metadata needed for update
 			foundCheckResult.ObjectMeta.DeepCopyInto(&pr.CheckResult.ObjectMeta)
 		} else if !scan.Spec.ShowNotApplicable && pr.CheckResult.Status == compv1alpha1.CheckResultNotApplicable {
 			// If the result is not applicable we skip creation
 			// Note that updating a not-applicable result should still
 			// work in order to get older deployments to keep working.
-			continue
+			lines.finish(i, nil)
+			return nil
 		}
 		// check is owned by the scan
 		if err := createOrUpdateOneResult(crClient, scan, checkResultLabels, checkResultAnnotations, checkResultExists, pr.CheckResult); err != nil {
 			return fmt.Errorf("cannot create or update checkResult %s: %v", pr.CheckResult.Name, err)
 		}
+		if lines != nil {
+			var line bytes.Buffer
+			if err := writeCheckResultLine(&line, pr.CheckResult); err != nil {
+				cmdLog.Error(err, "Cannot print the check result", "ComplianceCheckResult.Name", pr.CheckResult.Name)
+			}
+			lines.finish(i, line.Bytes())
+		}
 
 		if pr.Remediations == nil ||
 			(pr.CheckResult.Status != compv1alpha1.CheckResultFail &&
 				pr.CheckResult.Status != compv1alpha1.CheckResultInfo &&
 				pr.CheckResult.Status != compv1alpha1.CheckResultPass && /* even passing remediations might need to be updated */
 				pr.CheckResult.Status != compv1alpha1.CheckResultInconsistent) {
-			continue
+			return nil
 		}
 
 		for idx := range pr.Remediations {
@@ -586,11 +750,140 @@ func createResults(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceSca
 				return remErr
 			}
 		}
+		return nil
+	})
+}
+
+// countCheckResults returns the number of results with each status
+func countCheckResults(results []*utils.ParseResultContextItem) compv1alpha1.ComplianceCheckCounts {
+	counts := compv1alpha1.ComplianceCheckCounts{}
+	for _, pr := range results {
+		if pr == nil || pr.CheckResult == nil {
+			continue
+		}
+		switch pr.CheckResult.Status {
+		case compv1alpha1.CheckResultPass:
+			counts.Pass++
+		case compv1alpha1.CheckResultFail:
+			counts.Fail++
+		case compv1alpha1.CheckResultError:
+			counts.Error++
+		case compv1alpha1.CheckResultInfo:
+			counts.Info++
+		case compv1alpha1.CheckResultManual:
+			counts.Manual++
+		case compv1alpha1.CheckResultNotApplicable:
+			counts.NotApplicable++
+		case compv1alpha1.CheckResultInconsistent:
+			counts.Inconsistent++
+		}
 	}
+	return counts
+}
 
+// recordCheckCounts sets the check counts on the status of the scan
+func recordCheckCounts(crClient aggregatorCrClient, scan *compv1alpha1.ComplianceScan,
+	counts compv1alpha1.ComplianceCheckCounts) error {
+	scanCopy := scan.DeepCopy()
+	scanCopy.Status.CheckCounts = &counts
+	if err := crClient.getClient().Status().Patch(context.TODO(), scanCopy, client.MergeFrom(scan)); err != nil {
+		return err
+	}
+	scan.Status.CheckCounts = scanCopy.Status.CheckCounts
 	return nil
 }
 
+// carryRemediationHistory keeps the remediation the remediation controller
+// recorded on the existing result in its new annotations, and records when a
+// scan first found the check passing once the remediation was applied
+func carryRemediationHistory(annotations, existing map[string]string, status compv1alpha1.ComplianceCheckStatus,
+	now metav1.Time) {
+	for _, key := range []string{
+		compv1alpha1.ComplianceCheckResultLastRemediationAnnotation,
+		compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation,
+		compv1alpha1.ComplianceCheckResultLastRemediationTimeAnnotation,
+		compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation,
+	} {
+		if value, ok := existing[key]; ok {
+			annotations[key] = value
+		}
+	}
+	if status != compv1alpha1.CheckResultPass {
+		delete(annotations, compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation)
+		return
+	}
+	applied := annotations[compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation] ==
+		string(compv1alpha1.RemediationApplied)
+	if applied && annotations[compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation] == "" {
+		annotations[compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation] = now.UTC().Format(time.RFC3339)
+	}
+}
+
+// firstObservedFailure returns when the check was first seen failing given
+// its new status: the time of the existing result if it was failing already,
+// now if it just started failing, and no time if it doesn't fail
+func firstObservedFailure(existing *compv1alpha1.ComplianceCheckResult, status compv1alpha1.ComplianceCheckStatus,
+	now metav1.Time) metav1.Time {
+	failing := func(status compv1alpha1.ComplianceCheckStatus) bool {
+		return status == compv1alpha1.CheckResultFail || status == compv1alpha1.CheckResultError
+	}
+	if !failing(status) {
+		return metav1.Time{}
+	}
+	if existing != nil && failing(existing.Status) && !existing.FirstObservedFailure.IsZero() {
+		return existing.FirstObservedFailure
+	}
+	return now
+}
+
+// resultChanged tells whether the status of the check differs from the one
+// of its existing result. A check without a result didn't change.
+func resultChanged(existing *compv1alpha1.ComplianceCheckResult, status compv1alpha1.ComplianceCheckStatus) bool {
+	return existing != nil && existing.Status != status
+}
+
+// forEachConcurrently calls do for every index below n, with at most
+// concurrency calls running at once, and returns the first error. Once a
+// call failed, the indexes that weren't started yet are skipped.
+func forEachConcurrently(n, concurrency int, do func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		return firstErr != nil
+	}
+
+	slots := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		if failed() {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := do(i); err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
 func handleRemediation(crClient aggregatorCrClient, rem *compv1alpha1.ComplianceRemediation, cr *compv1alpha1.ComplianceCheckResult, scan *compv1alpha1.ComplianceScan) error {
 	crkey := getObjKey(cr.GetName(), cr.GetNamespace())
 	remTargetObj := rem.Spec.Current.Object
@@ -751,6 +1044,17 @@ func aggregator(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	platform, err := getInfrastructurePlatform(crclient)
+	if err != nil {
+		cmdLog.Info("Couldn't read the infrastructure platform, not annotating the results with it",
+			"error", err.Error())
+	} else if platform != "" {
+		if err := annotateScanWithPlatform(crclient, scan, platform); err != nil {
+			cmdLog.Error(err, "Cannot annotate the scan with the platform",
+				"ComplianceScan.Name", scan.Name, "Platform", platform)
+		}
+	}
+
 	// Find all the configmaps for a scan
 	configMaps, err := getScanConfigMaps(crclient, aggregatorConf.ScanName, common.GetComplianceOperatorNamespace())
 	if err != nil {
@@ -766,7 +1070,7 @@ func aggregator(cmd *cobra.Command, args []string) {
 	// #nosec
 	defer contentFile.Close()
 	bufContentFile := bufio.NewReader(contentFile)
-	contentDom, err := utils.ParseContent(bufContentFile)
+	contentDom, contentDigest, err := utils.ParseContentWithDigest(bufContentFile)
 	if err != nil {
 		cmdLog.Error(err, "Cannot parse the content")
 		os.Exit(1)
@@ -774,12 +1078,26 @@ func aggregator(cmd *cobra.Command, args []string) {
 
 	prCtx := utils.NewParseResultContext()
 
-	// For each configmap, create a list of remediations
-	for i := range configMaps {
+	// The ConfigMaps are parsed concurrently, but their results are added in
+	// order once they're all parsed, as the first batch is the reference
+	// the others are checked for consistency against
+	type parsedConfigMap struct {
+		results []*utils.ParseResult
+		source  string
+		err     error
+	}
+	parsed := make([]parsedConfigMap, len(configMaps))
+	_ = forEachConcurrently(len(configMaps), aggregatorConf.Workers, func(i int) error {
 		cm := &configMaps[i]
 		cmdLog.Info("processing ConfigMap", "ConfigMap.Name", cm.Name)
+		parsed[i].results, parsed[i].source, parsed[i].err = parseResultRemediations(crclient.getClient(), crclient.getScheme(), aggregatorConf.ScanName, aggregatorConf.Namespace, contentDom, cm)
+		return nil
+	})
 
-		cmParsedResults, source, err := parseResultRemediations(crclient.getClient(), crclient.getScheme(), aggregatorConf.ScanName, aggregatorConf.Namespace, contentDom, cm)
+	// For each configmap, create a list of remediations
+	for i := range configMaps {
+		cm := &configMaps[i]
+		cmParsedResults, source, err := parsed[i].results, parsed[i].source, parsed[i].err
 		if err != nil {
 			cmdLog.Error(err, "Cannot parse ConfigMap into remediations", "ConfigMap.Name", cm.Name)
 		} else if cmParsedResults == nil {
@@ -800,10 +1118,21 @@ func aggregator(cmd *cobra.Command, args []string) {
 	// of remediations for this scan
 	// Create the remediations
 	cmdLog.Info("Creating result objects")
-	if err := createResults(crclient, scan, consistentParsedResults); err != nil {
+	var resultOut io.Writer
+	if aggregatorConf.NDJSON {
+		resultOut = os.Stdout
+	}
+	if err := createResults(crclient, scan, contentDigest, consistentParsedResults, aggregatorConf.Workers, resultOut); err != nil {
 		cmdLog.Error(err, "Could not create remediation objects")
 		os.Exit(1)
 	}
+	// Nothing is parsed if the ConfigMaps were processed by an earlier run,
+	// which already recorded the counts
+	if len(consistentParsedResults) > 0 {
+		if err := recordCheckCounts(crclient, scan, countCheckResults(consistentParsedResults)); err != nil {
+			cmdLog.Error(err, "Cannot record the check counts on the scan", "ComplianceScan.Name", scan.Name)
+		}
+	}
 
 	// Annotate configMaps, so we don't need to re-parse them
 	cmdLog.Info("Annotating ConfigMaps")
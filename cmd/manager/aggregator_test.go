@@ -1,8 +1,13 @@
 package manager
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
 	. "github.com/onsi/ginkgo"
@@ -10,6 +15,7 @@ import (
 	ocpcfgv1 "github.com/openshift/api/config/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/discovery"
@@ -21,6 +27,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
 )
 
 type aggregatorCrClientFake struct {
@@ -291,4 +298,585 @@ var _ = Describe("Aggregator Tests", func() {
 			})
 		})
 	})
+
+	Context("Printing the results as NDJSON", func() {
+		It("Prints a line per created result", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+					Labels:    map[string]string{compv1alpha1.SuiteLabel: "cis"},
+				},
+			}
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      fake.NewFakeClientWithScheme(getScheme(), scan),
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			newResult := func(name, rule string, status compv1alpha1.ComplianceCheckStatus) *utils.ParseResultContextItem {
+				return &utils.ParseResultContextItem{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_" + rule,
+							Status:     status,
+							Severity:   compv1alpha1.CheckResultSeverityHigh,
+						},
+					},
+				}
+			}
+
+			out := &bytes.Buffer{}
+			err := createResults(crClient, scan, "", []*utils.ParseResultContextItem{
+				newResult("ocp4-cis-audit-log-forwarding-enabled", "audit_log_forwarding_enabled", compv1alpha1.CheckResultFail),
+				// Not applicable results aren't created, so they aren't printed
+				newResult("ocp4-cis-scc-limit-ipc", "scc_limit_ipc", compv1alpha1.CheckResultNotApplicable),
+			}, 1, out)
+			Expect(err).To(BeNil())
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			Expect(lines).To(HaveLen(1))
+			var line ndjsonCheckResult
+			Expect(json.Unmarshal([]byte(lines[0]), &line)).To(Succeed())
+			Expect(line).To(Equal(ndjsonCheckResult{
+				Name:      "ocp4-cis-audit-log-forwarding-enabled",
+				Namespace: "openshift-compliance",
+				Scan:      "ocp4-cis",
+				Suite:     "cis",
+				ID:        "xccdf_org.ssgproject.content_rule_audit_log_forwarding_enabled",
+				Rule:      "audit-log-forwarding-enabled",
+				Severity:  "high",
+				Status:    "FAIL",
+			}))
+		})
+	})
+
+	Context("Recording when the checks started failing", func() {
+		It("Keeps the time while the check keeps failing", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			aggregate := func(status compv1alpha1.ComplianceCheckStatus) *compv1alpha1.ComplianceCheckResult {
+				Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: "ocp4-cis-rule", Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_rule",
+							Status:     status,
+						},
+					},
+				}}, 1, nil)).To(Succeed())
+				created := &compv1alpha1.ComplianceCheckResult{}
+				Expect(client.Get(context.TODO(), getObjKey("ocp4-cis-rule", "openshift-compliance"), created)).To(Succeed())
+				return created
+			}
+
+			Expect(aggregate(compv1alpha1.CheckResultPass).FirstObservedFailure.IsZero()).To(BeTrue())
+			firstFailure := aggregate(compv1alpha1.CheckResultFail).FirstObservedFailure
+			Expect(firstFailure.IsZero()).To(BeFalse())
+
+			// Pretend the failure was seen a while ago
+			seen := aggregate(compv1alpha1.CheckResultFail)
+			seen.FirstObservedFailure = metav1.NewTime(firstFailure.Add(-time.Hour))
+			Expect(client.Update(context.TODO(), seen)).To(Succeed())
+			Expect(aggregate(compv1alpha1.CheckResultError).FirstObservedFailure.Equal(&seen.FirstObservedFailure)).To(BeTrue())
+
+			Expect(aggregate(compv1alpha1.CheckResultPass).FirstObservedFailure.IsZero()).To(BeTrue())
+		})
+
+		It("Labels the results with the types of their references", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			result := func(name string, refs ...compv1alpha1.ComplianceCheckReference) *utils.ParseResultContextItem {
+				return &utils.ParseResultContextItem{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_" + name,
+							Status:     compv1alpha1.CheckResultFail,
+							References: refs,
+						},
+					},
+				}
+			}
+			Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{
+				result("nist-and-pci",
+					compv1alpha1.ComplianceCheckReference{Type: "nist", ID: "CM-6(a)"},
+					compv1alpha1.ComplianceCheckReference{Type: "pcidss", ID: "Req-2.2"}),
+				result("nist-only", compv1alpha1.ComplianceCheckReference{Type: "nist", ID: "AC-6"}),
+				result("untyped", compv1alpha1.ComplianceCheckReference{ID: "5.4.2"}),
+			}, 1, nil)).To(Succeed())
+
+			selected := func(selector string) []string {
+				parsed, err := labels.Parse(selector)
+				Expect(err).To(BeNil())
+				list := &compv1alpha1.ComplianceCheckResultList{}
+				Expect(client.List(context.TODO(), list, runtimeclient.MatchingLabelsSelector{Selector: parsed})).To(Succeed())
+				names := []string{}
+				for _, cr := range list.Items {
+					names = append(names, cr.Name)
+				}
+				return names
+			}
+			Expect(selected(compv1alpha1.ComplianceCheckResultReferenceLabelPrefix + "nist")).
+				To(ConsistOf("nist-and-pci", "nist-only"))
+			Expect(selected(compv1alpha1.ComplianceCheckResultReferenceLabelPrefix + "pcidss")).
+				To(ConsistOf("nist-and-pci"))
+			Expect(selected("!" + compv1alpha1.ComplianceCheckResultReferenceLabelPrefix + "nist")).
+				To(ConsistOf("untyped"))
+		})
+
+		It("Refreshes the time the check was last checked on every scan", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			aggregate := func(status compv1alpha1.ComplianceCheckStatus) *compv1alpha1.ComplianceCheckResult {
+				Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: "ocp4-cis-rule", Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_rule",
+							Status:     status,
+						},
+					},
+				}}, 1, nil)).To(Succeed())
+				created := &compv1alpha1.ComplianceCheckResult{}
+				Expect(client.Get(context.TODO(), getObjKey("ocp4-cis-rule", "openshift-compliance"), created)).To(Succeed())
+				return created
+			}
+
+			checked := aggregate(compv1alpha1.CheckResultPass)
+			Expect(checked.LastCheckedTime.IsZero()).To(BeFalse())
+
+			// Pretend the last scan ran a while ago
+			checked.LastCheckedTime = metav1.NewTime(checked.LastCheckedTime.Add(-time.Hour))
+			Expect(client.Update(context.TODO(), checked)).To(Succeed())
+			rechecked := aggregate(compv1alpha1.CheckResultPass)
+			Expect(rechecked.LastCheckedTime.After(checked.LastCheckedTime.Time)).To(BeTrue())
+
+			checked = rechecked.DeepCopy()
+			checked.LastCheckedTime = metav1.NewTime(checked.LastCheckedTime.Add(-time.Hour))
+			Expect(client.Update(context.TODO(), checked)).To(Succeed())
+			Expect(aggregate(compv1alpha1.CheckResultFail).LastCheckedTime.After(checked.LastCheckedTime.Time)).To(BeTrue())
+		})
+
+		It("Only sets a time for the failing checks", func() {
+			now := metav1.Now()
+			earlier := metav1.NewTime(now.Add(-time.Hour))
+			failing := &compv1alpha1.ComplianceCheckResult{Status: compv1alpha1.CheckResultFail, FirstObservedFailure: earlier}
+			passing := &compv1alpha1.ComplianceCheckResult{Status: compv1alpha1.CheckResultPass}
+
+			Expect(firstObservedFailure(nil, compv1alpha1.CheckResultFail, now)).To(Equal(now))
+			Expect(firstObservedFailure(failing, compv1alpha1.CheckResultFail, now)).To(Equal(earlier))
+			Expect(firstObservedFailure(passing, compv1alpha1.CheckResultFail, now)).To(Equal(now))
+			// Failing, but created before the time was recorded
+			Expect(firstObservedFailure(&compv1alpha1.ComplianceCheckResult{Status: compv1alpha1.CheckResultFail},
+				compv1alpha1.CheckResultError, now)).To(Equal(now))
+			for _, status := range []compv1alpha1.ComplianceCheckStatus{
+				compv1alpha1.CheckResultPass, compv1alpha1.CheckResultInconsistent, compv1alpha1.CheckResultManual,
+			} {
+				Expect(firstObservedFailure(failing, status, now)).To(Equal(metav1.Time{}), string(status))
+			}
+		})
+	})
+
+	Context("Labeling the results that changed", func() {
+		It("Labels the results whose status differs from the previous scan's", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			aggregate := func(status compv1alpha1.ComplianceCheckStatus) map[string]string {
+				Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: "ocp4-cis-rule", Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_rule",
+							Status:     status,
+						},
+					},
+				}}, 1, nil)).To(Succeed())
+				created := &compv1alpha1.ComplianceCheckResult{}
+				Expect(client.Get(context.TODO(), getObjKey("ocp4-cis-rule", "openshift-compliance"), created)).To(Succeed())
+				return created.GetLabels()
+			}
+
+			Expect(aggregate(compv1alpha1.CheckResultPass)).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultChangedLabel))
+			Expect(aggregate(compv1alpha1.CheckResultFail)).To(
+				HaveKeyWithValue(compv1alpha1.ComplianceCheckResultChangedLabel, "true"))
+			Expect(aggregate(compv1alpha1.CheckResultFail)).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultChangedLabel))
+			Expect(aggregate(compv1alpha1.CheckResultPass)).To(
+				HaveKeyWithValue(compv1alpha1.ComplianceCheckResultChangedLabel, "true"))
+		})
+	})
+
+	Context("Ordering the results", func() {
+		It("Prints the same lines in the order of the IDs on every run", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			parsed := []*utils.ParseResult{}
+			for i := 0; i < 30; i++ {
+				id := fmt.Sprintf("xccdf_org.ssgproject.content_rule_%02d", (i*7)%30)
+				parsed = append(parsed, &utils.ParseResult{
+					Id: id,
+					CheckResult: &compv1alpha1.ComplianceCheckResult{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      fmt.Sprintf("ocp4-cis-rule-%02d", (i*7)%30),
+							Namespace: "openshift-compliance",
+						},
+						ID:     id,
+						Status: compv1alpha1.CheckResultPass,
+					},
+				})
+			}
+			aggregate := func() string {
+				prCtx := utils.NewParseResultContext()
+				prCtx.AddResults("", parsed)
+				crClient := &aggregatorCrClientFake{
+					scheme:      getScheme(),
+					client:      fake.NewFakeClientWithScheme(getScheme(), scan),
+					recorder:    fakerec.NewFakeRecorder(1),
+					fakevgetter: &fakeversionget{},
+				}
+				out := &bytes.Buffer{}
+				Expect(createResults(crClient, scan, "", prCtx.GetConsistentResults(), 8, out)).To(Succeed())
+				return out.String()
+			}
+
+			first := aggregate()
+			Expect(aggregate()).To(Equal(first))
+			lines := strings.Split(strings.TrimSpace(first), "\n")
+			Expect(lines).To(HaveLen(30))
+			for i, l := range lines {
+				var line ndjsonCheckResult
+				Expect(json.Unmarshal([]byte(l), &line)).To(Succeed())
+				Expect(line.ID).To(Equal(fmt.Sprintf("xccdf_org.ssgproject.content_rule_%02d", i)))
+			}
+		})
+	})
+
+	Context("Aggregating concurrently", func() {
+		It("Bounds the number of calls running at once", func() {
+			var mutex sync.Mutex
+			running, maxRunning, calls := 0, 0, 0
+			err := forEachConcurrently(20, 3, func(i int) error {
+				mutex.Lock()
+				running++
+				calls++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mutex.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+				return nil
+			})
+			Expect(err).To(BeNil())
+			Expect(calls).To(Equal(20))
+			Expect(maxRunning).To(BeNumerically("<=", 3))
+		})
+
+		It("Stops starting calls once one failed", func() {
+			calls := 0
+			err := forEachConcurrently(10, 1, func(i int) error {
+				calls++
+				if i == 2 {
+					return fmt.Errorf("failed %d", i)
+				}
+				return nil
+			})
+			Expect(err).To(MatchError("failed 2"))
+			Expect(calls).To(Equal(3))
+		})
+
+		It("Creates every result", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			var results []*utils.ParseResultContextItem
+			for i := 0; i < 25; i++ {
+				results = append(results, &utils.ParseResultContextItem{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      fmt.Sprintf("ocp4-cis-rule-%d", i),
+								Namespace: "openshift-compliance",
+							},
+							ID:     fmt.Sprintf("xccdf_org.ssgproject.content_rule_%d", i),
+							Status: compv1alpha1.CheckResultPass,
+						},
+					},
+				})
+			}
+
+			out := &bytes.Buffer{}
+			Expect(createResults(crClient, scan, "", results, 4, out)).To(Succeed())
+			created := &compv1alpha1.ComplianceCheckResultList{}
+			Expect(client.List(context.TODO(), created)).To(Succeed())
+			Expect(created.Items).To(HaveLen(25))
+			Expect(strings.Count(out.String(), "\n")).To(Equal(25))
+		})
+
+		It("Streams each line once the lines before it are written", func() {
+			out := &bytes.Buffer{}
+			lines := newOrderedLines(out, 4)
+			lines.finish(1, []byte("1\n"))
+			Expect(out.String()).To(BeEmpty())
+			lines.finish(0, []byte("0\n"))
+			Expect(out.String()).To(Equal("0\n1\n"))
+			lines.finish(3, []byte("3\n"))
+			Expect(out.String()).To(Equal("0\n1\n"))
+			lines.finish(2, nil)
+			Expect(out.String()).To(Equal("0\n1\n3\n"))
+		})
+	})
+
+	Context("Annotating the results with the platform", func() {
+		newCrClient := func(objs ...runtime.Object) *aggregatorCrClientFake {
+			return &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      fake.NewFakeClientWithScheme(getScheme(), objs...),
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+		}
+		newInfrastructure := func(status ocpcfgv1.InfrastructureStatus) *ocpcfgv1.Infrastructure {
+			return &ocpcfgv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+				Status:     status,
+			}
+		}
+
+		It("Reads the platform of the cluster", func() {
+			platform, err := getInfrastructurePlatform(newCrClient(newInfrastructure(ocpcfgv1.InfrastructureStatus{
+				Platform:       ocpcfgv1.AWSPlatformType,
+				PlatformStatus: &ocpcfgv1.PlatformStatus{Type: ocpcfgv1.GCPPlatformType},
+			})))
+			Expect(err).To(BeNil())
+			Expect(platform).To(Equal("GCP"))
+
+			platform, err = getInfrastructurePlatform(newCrClient(newInfrastructure(ocpcfgv1.InfrastructureStatus{
+				Platform: ocpcfgv1.AWSPlatformType,
+			})))
+			Expect(err).To(BeNil())
+			Expect(platform).To(Equal("AWS"))
+
+			platform, err = getInfrastructurePlatform(newCrClient())
+			Expect(err).To(BeNil())
+			Expect(platform).To(BeEmpty())
+		})
+
+		It("Annotates the scan and its check results", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			crClient := newCrClient(scan)
+
+			Expect(annotateScanWithPlatform(crClient, scan, "None")).To(Succeed())
+			saved := &compv1alpha1.ComplianceScan{}
+			Expect(crClient.client.Get(context.TODO(), getObjKey("ocp4-cis", "openshift-compliance"), saved)).To(Succeed())
+			Expect(saved.Annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceScanPlatformAnnotation, "None"))
+
+			Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{{
+				ParseResult: utils.ParseResult{
+					CheckResult: &compv1alpha1.ComplianceCheckResult{
+						ObjectMeta: metav1.ObjectMeta{Name: "ocp4-cis-rule", Namespace: "openshift-compliance"},
+						ID:         "xccdf_org.ssgproject.content_rule_rule",
+						Status:     compv1alpha1.CheckResultPass,
+					},
+				},
+			}}, 1, nil)).To(Succeed())
+			created := &compv1alpha1.ComplianceCheckResult{}
+			Expect(crClient.client.Get(context.TODO(), getObjKey("ocp4-cis-rule", "openshift-compliance"), created)).To(Succeed())
+			Expect(created.Annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultPlatformAnnotation, "None"))
+		})
+	})
+
+	Context("Explaining the not applicable results", func() {
+		It("Only keeps the reason while the result doesn't apply", func() {
+			scan := &compv1alpha1.ComplianceScan{}
+			cr := &compv1alpha1.ComplianceCheckResult{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+					compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation: compv1alpha1.NotApplicableReasonPlatformMismatch,
+				}},
+				ID:     "xccdf_org.ssgproject.content_rule_rule",
+				Status: compv1alpha1.CheckResultNotApplicable,
+			}
+			Expect(getCheckResultAnnotations(cr, nil, scan, "")).To(HaveKeyWithValue(
+				compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation, compv1alpha1.NotApplicableReasonPlatformMismatch))
+
+			cr.Status = compv1alpha1.CheckResultInconsistent
+			Expect(getCheckResultAnnotations(cr, nil, scan, "")).ToNot(HaveKey(
+				compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation))
+		})
+	})
+
+	Context("Keeping the remediation history", func() {
+		It("Confirms the applied remediation once the check passes", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			existing := &compv1alpha1.ComplianceCheckResult{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis-rule",
+					Namespace: "openshift-compliance",
+					Annotations: map[string]string{
+						compv1alpha1.ComplianceCheckResultLastRemediationAnnotation:      "ocp4-cis-rule",
+						compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation: string(compv1alpha1.RemediationApplied),
+						compv1alpha1.ComplianceCheckResultLastRemediationTimeAnnotation:  "2022-10-25T10:00:00Z",
+					},
+				},
+				ID:     "xccdf_org.ssgproject.content_rule_rule",
+				Status: compv1alpha1.CheckResultFail,
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan, existing)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			aggregate := func(status compv1alpha1.ComplianceCheckStatus) map[string]string {
+				Expect(createResults(crClient, scan, "", []*utils.ParseResultContextItem{{
+					ParseResult: utils.ParseResult{
+						CheckResult: &compv1alpha1.ComplianceCheckResult{
+							ObjectMeta: metav1.ObjectMeta{Name: "ocp4-cis-rule", Namespace: "openshift-compliance"},
+							ID:         "xccdf_org.ssgproject.content_rule_rule",
+							Status:     status,
+						},
+					},
+				}}, 1, nil)).To(Succeed())
+				updated := &compv1alpha1.ComplianceCheckResult{}
+				Expect(client.Get(context.TODO(), getObjKey("ocp4-cis-rule", "openshift-compliance"), updated)).To(Succeed())
+				return updated.Annotations
+			}
+
+			annotations := aggregate(compv1alpha1.CheckResultFail)
+			Expect(annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationAnnotation, "ocp4-cis-rule"))
+			Expect(annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationTimeAnnotation,
+				"2022-10-25T10:00:00Z"))
+			Expect(annotations).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation))
+
+			verified := aggregate(compv1alpha1.CheckResultPass)[compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation]
+			_, err := time.Parse(time.RFC3339, verified)
+			Expect(err).To(BeNil())
+			Expect(aggregate(compv1alpha1.CheckResultPass)).To(HaveKeyWithValue(
+				compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation, verified))
+
+			Expect(aggregate(compv1alpha1.CheckResultFail)).ToNot(HaveKey(
+				compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation))
+		})
+
+		It("Doesn't confirm a remediation that failed to apply", func() {
+			annotations := map[string]string{}
+			carryRemediationHistory(annotations, map[string]string{
+				compv1alpha1.ComplianceCheckResultLastRemediationAnnotation:      "ocp4-cis-rule",
+				compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation: string(compv1alpha1.RemediationError),
+			}, compv1alpha1.CheckResultPass, metav1.Now())
+			Expect(annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation,
+				string(compv1alpha1.RemediationError)))
+			Expect(annotations).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation))
+		})
+	})
+
+	Context("Counting the results on the scan", func() {
+		It("Records the number of checks with each result", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ocp4-cis",
+					Namespace: "openshift-compliance",
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			crClient := &aggregatorCrClientFake{
+				scheme:      getScheme(),
+				client:      client,
+				recorder:    fakerec.NewFakeRecorder(1),
+				fakevgetter: &fakeversionget{},
+			}
+			results := []*utils.ParseResultContextItem{nil}
+			for _, status := range []compv1alpha1.ComplianceCheckStatus{
+				compv1alpha1.CheckResultPass, compv1alpha1.CheckResultPass, compv1alpha1.CheckResultFail,
+				compv1alpha1.CheckResultError, compv1alpha1.CheckResultInfo, compv1alpha1.CheckResultManual,
+				compv1alpha1.CheckResultNotApplicable, compv1alpha1.CheckResultInconsistent,
+				compv1alpha1.CheckResultNoResult,
+			} {
+				results = append(results, &utils.ParseResultContextItem{
+					ParseResult: utils.ParseResult{CheckResult: &compv1alpha1.ComplianceCheckResult{Status: status}},
+				})
+			}
+			expected := compv1alpha1.ComplianceCheckCounts{
+				Pass: 2, Fail: 1, Error: 1, Info: 1, Manual: 1, NotApplicable: 1, Inconsistent: 1,
+			}
+			Expect(countCheckResults(results)).To(Equal(expected))
+
+			Expect(recordCheckCounts(crClient, scan, countCheckResults(results))).To(Succeed())
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), getObjKey("ocp4-cis", "openshift-compliance"), updated)).To(Succeed())
+			Expect(updated.Status.CheckCounts).To(Equal(&expected))
+		})
+	})
 })
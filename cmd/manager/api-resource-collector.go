@@ -16,8 +16,23 @@ limitations under the License.
 package manager
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/spf13/cobra"
@@ -25,6 +40,21 @@ import (
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
+	"github.com/ComplianceAsCode/compliance-operator/version"
+)
+
+// cancellationPollInterval is how often the collector checks whether its
+// scan was cancelled.
+var cancellationPollInterval = 5 * time.Second
+
+// Where the platform scan pod mounts the content and the tailoring of its
+// scan
+const (
+	scanContentDir    = "/content"
+	scanTailoringPath = "/tailoring/tailoring.xml"
 )
 
 var ApiResourceCollectorCmd = &cobra.Command{
@@ -47,29 +77,205 @@ type ResourceFetcher interface {
 	LoadTailoring(path string) error
 	// Search the decoded data for the resources we need under a particular profile.
 	FigureResources(profile string) error
-	// Fetch the resources.
-	FetchResources() ([]string, error)
+	// The digests of the loaded content and tailoring, available after loading them.
+	ContentDigests() (string, string)
+	// The detected OpenShift and Kubernetes versions, available after FetchResources.
+	DetectedVersions() (string, string)
+	// The XCCDF values set by the profile and tailoring in use, available after FigureResources.
+	EffectiveValues() map[string]string
+	// The rules the profile selects that the content doesn't define, available after FigureResources.
+	UndefinedRules() []string
+	// The filter errors of the fetch by kind and dump path, available after FetchResources.
+	FilterErrors() map[string]map[string]int
+	// Fetch the resources. Fetching stops early if the context is cancelled.
+	FetchResources(ctx context.Context) ([]fetchWarning, error)
 	// Save warnings
-	SaveWarningsIfAny([]string, string) error
+	SaveWarningsIfAny([]fetchWarning, string) error
+	// Save the warnings, a manifest of the collected resources and the fetch timing as one archive
+	SaveMetadataArchive([]fetchWarning, fetchTiming, string) error
 	// Save the resources.
 	SaveResources(to string) error
+	// Write the resources as a tar stream, optionally gzipped.
+	StreamResources(out io.Writer, compress bool) error
+	// Sum up what was fetched and the warnings raised.
+	Summary(warnings []fetchWarning) collectionSummary
 }
 
 type fetcherConfig struct {
 	Content            string
 	Tailoring          string
+	ContentDigest      string
+	TailoringDigest    string
+	ContentTimeout     time.Duration
+	ContentPollPeriod  time.Duration
 	ResultDir          string
 	Profile            string
 	ExitCodeFile       string
 	WarningsOutputFile string
+	MetadataArchive    string
+	ScanName           string
+	NodeSelector       string
+	Nodes              []string
+	NodesMatching      string
+	NodeRoles          []nodeRole
+	SkipKubeletConfig  bool
+	SkipStaged         []string
+	KeepUnreadyNodes   bool
+	MinNodeCoverage    int
+	KubeletAPIVersion  string
+	DumpPathScheme     string
+	VersionCheck       string
+	VersionDetection   string
+	ValueOverrides     map[string]string
+	KeepNodeKubelets   bool
+	ConsistentSnapshot bool
+	PreferProtobuf     bool
+	BatchConfigFetch   bool
+	FetchConcurrency   int
+	FetchRetries       int
+	FetchRetryDelay    time.Duration
+	MachineConfigPools []string
+	MCsToDisk          bool
+	MCConfigSections   []string
+	FetchCacheDir      string
+	FetchCacheTTL      time.Duration
+	RedactBinaryData   bool
+	ImpersonateUser    string
+	ImpersonateGroups  []string
+	UserAgentScan      string
+	FileMode           os.FileMode
+	DirMode            os.FileMode
+	TarToStdout        bool
+	Gzip               bool
+	CompressResources  bool
+	SummaryFile        string
+	FailOnEmpty        bool
+	InputsFromScan     bool
+	Contexts           []string
+	// The kubeconfig context of one of the clusters of Contexts
+	KubeContext string
+	// The URL of the API server the resources are fetched from, known once
+	// the REST config of the cluster is loaded
+	APIServer string
 }
 
 func defineAPIResourceCollectorFlags(cmd *cobra.Command) {
-	cmd.Flags().String("content", "", "The path to the OpenSCAP content file.")
-	cmd.Flags().String("tailoring", "", "The path to the OpenSCAP tailoring file.")
+	cmd.Flags().String("content", "", "The path to the OpenSCAP content file, an http(s):// URL, or "+
+		"configmap://<namespace>/<name>/<key>.")
+	cmd.Flags().String("tailoring", "", "The path to the OpenSCAP tailoring file, an http(s):// URL, or "+
+		"configmap://<namespace>/<name>/<key>.")
+	cmd.Flags().String("content-digest", "", "The SHA-256 the content file must have, as sha256:<hex>. "+
+		"The content isn't verified if unset.")
+	cmd.Flags().String("tailoring-digest", "", "The SHA-256 the tailoring file must have, as sha256:<hex>. "+
+		"The tailoring isn't verified if unset.")
+	cmd.Flags().Duration("content-timeout", defaultContentTimeout, "How long to wait for the content and "+
+		"tailoring files to be written by another container, and for their downloads.")
+	cmd.Flags().Duration("content-poll-interval", defaultContentPollPeriod, "How often to check whether the "+
+		"content and tailoring files were written.")
 	cmd.Flags().String("resultdir", "", "The directory to write the collected object files to.")
 	cmd.Flags().String("profile", "", "The scan profile.")
 	cmd.Flags().String("warnings-output-file", "", "A file containing the warnings output.")
+	cmd.Flags().String("metadata-archive", "", "If set, the warnings, a manifest of the collected "+
+		"resources and timing data are also written to this file as a gzip-compressed tarball.")
+	cmd.Flags().String("scan", "", "The compliance scan the resources are collected for. "+
+		"If set, collection is aborted when the scan is cancelled.")
+	cmd.Flags().Bool("inputs-from-scan", false, "Read the content, profile and tailoring that aren't set "+
+		"from the spec of the --scan ComplianceScan, as its scan pod mounts them.")
+	cmd.Flags().String("node-selector", "", "A label selector limiting which nodes are "+
+		"listed to discover node roles, e.g. 'node-role.kubernetes.io/worker'. Defaults to all nodes.")
+	cmd.Flags().StringSlice("nodes", nil, "Restricts the node list and the KubeletConfig collection "+
+		"to these nodes, e.g. when only some of the nodes need to be rescanned. Can be repeated.")
+	cmd.Flags().String("nodes-matching", "", "Restricts the node list and the KubeletConfig collection "+
+		"to the nodes matching this label selector. Combined with --nodes, nodes must match both.")
+	cmd.Flags().StringArray("node-role", nil, "Maps the nodes matching a label selector to a role, as "+
+		"role=selector, e.g. 'infra=custom.example.com/pool=infra'. If set, the KubeletConfigs are only "+
+		"collected from the nodes matching a role and aggregated under their roles, instead of those of "+
+		"their node-role.kubernetes.io labels. Can be repeated.")
+	cmd.Flags().StringArray("set-value", nil, "Overrides a value of the content and tailoring with a "+
+		"name=value pair before it's substituted in the resource paths, to test how the checks behave "+
+		"with it. Adds a warning listing the overridden values. Can be repeated.")
+	cmd.Flags().Bool("skip-kubelet-config", false, "Skips discovering node roles and "+
+		"collecting the nodes' KubeletConfigs, which platform-only profiles don't need.")
+	cmd.Flags().StringSlice("skip-staged", nil, "The dump path of a resource every scan fetches, like "+
+		"/version or /apis/config.openshift.io/v1/networks/cluster, not to fetch unless a check of the "+
+		"profile reads it. Can be repeated.")
+	cmd.Flags().Bool("keep-unready-nodes", false, "Also collects the KubeletConfigs of the nodes that aren't "+
+		"ready or are unschedulable, which are skipped during role discovery by default.")
+	cmd.Flags().Int("min-kubelet-node-coverage", 0, "The percentage of the nodes of a role that must return "+
+		"a KubeletConfig for the KubeletConfig of the role to be saved. Below it, the role's is saved as an error, "+
+		"with a warning, instead of being computed from the nodes that returned one. Not checked if 0.")
+	cmd.Flags().Bool("consistent-snapshot", false, "Fetches all lists at the resourceVersion of the "+
+		"first list fetched, so the resources reflect a single point in time instead of the whole fetch window.")
+	cmd.Flags().Bool("prefer-protobuf", false, "Requests the resources as protobuf, which is smaller and faster "+
+		"to decode than JSON for large lists, and converts them to JSON before filtering them. Resources that aren't "+
+		"served as protobuf, like custom resources, are fetched as JSON. Ignored with --consistent-snapshot.")
+	cmd.Flags().Bool("batch-config-fetch", false, "Fetches the config.openshift.io objects the content needs "+
+		"before the other resources, concurrently, and from a single list request for the objects of the same kind. "+
+		"They are still saved under their own paths.")
+	cmd.Flags().Int("fetch-concurrency", 1, "How many resources are fetched at a time. The results and "+
+		"warnings are the same as when they're fetched one by one. Ignored with --consistent-snapshot.")
+	cmd.Flags().Int("fetch-retries", defaultFetchRetries, "How many times the fetch of a resource is retried "+
+		"when the API server is overloaded or fails. Once they're used up, the resource is skipped with a warning.")
+	cmd.Flags().Duration("fetch-retry-delay", defaultFetchRetryDelay, "The delay before the first retry of a "+
+		"fetch, doubled on each of the next ones and randomized. A Retry-After returned by the API server is "+
+		"honored instead.")
+	cmd.Flags().StringSlice("machine-config-pools", nil, "Only fetches the MachineConfigs selected by the "+
+		"machineConfigSelector of these MachineConfigPools, instead of all of them. Can be repeated.")
+	cmd.Flags().Bool("machine-configs-to-disk", false, "Writes the MachineConfigs to a temporary file as "+
+		"they're fetched, instead of holding all of them in memory. The saved resources are the same.")
+	cmd.Flags().StringSlice("machine-config-sections", nil, "The Ignition sections of the MachineConfigs to "+
+		"keep, among passwd, storage and systemd. All of them are kept by default, without the files. Can be repeated.")
+	cmd.Flags().String("fetch-cache-dir", "", "A directory the filtered resources are cached in, so the "+
+		"next runs within --fetch-cache-ttl don't fetch them again. Needs --fetch-cache-ttl to be set.")
+	cmd.Flags().Duration("fetch-cache-ttl", 0, "How long the cached resources are used for. The resources "+
+		"cached for other content, or with other options, are never used. Ignored with --consistent-snapshot.")
+	cmd.Flags().Bool("redact-configmap-binary-data", false, "Replaces the binary data of the ConfigMaps "+
+		"referenced by name in the content with a placeholder, keeping only their keys.")
+	cmd.Flags().String("kubelet-config-api-version", defaultKubeletConfigAPIVersion, "The apiVersion the "+
+		"collected KubeletConfigs are labeled with. With 'auto', the apiVersion returned by the kubelet is kept if it "+
+		"returns one.")
+	cmd.Flags().String("dump-path-scheme", defaultDumpPathScheme, "The layout of the saved resources, for "+
+		"scanners that expect an older one. 'v1' only saves the KubeletConfig of each node, 'v2' also saves the "+
+		"KubeletConfig the nodes of each role share under /kubeletconfig/role/.")
+	cmd.Flags().String("content-version-check", "", "Compares the cluster's version with the versions the "+
+		"content declares it targets in the metadata of its benchmark. 'warn' adds a warning if they don't "+
+		"match, 'fail' also fails the collection. Not checked by default.")
+	cmd.Flags().String("version-detection", defaultVersionDetection, "What to do if the OpenShift version can't "+
+		"be detected from the openshift-apiserver clusteroperator. 'warn' adds a warning, 'fail' fails the "+
+		"collection, 'version-only' doesn't fetch the clusteroperator and only detects the Kubernetes version "+
+		"from /version.")
+	cmd.Flags().Bool("keep-node-kubelet-configs", false, "Adds the KubeletConfig of every node, along with "+
+		"the role summaries, to the --metadata-archive, so inconsistencies between nodes can be inspected after the scan.")
+	cmd.Flags().String("impersonate-user", "", "If set, the resources are fetched as this user or "+
+		"service account (system:serviceaccount:<namespace>:<name>) instead of the collector's own identity.")
+	cmd.Flags().StringSlice("impersonate-group", nil, "A group to impersonate along with --impersonate-user. "+
+		"Can be repeated.")
+	cmd.Flags().String("user-agent-scan", "", "The scan-identifying part of the User-Agent the resources "+
+		"are fetched with, e.g. 'scan/ocp4-cis'. Defaults to 'scan/' followed by the --scan flag.")
+	cmd.Flags().String("file-mode", fmt.Sprintf("%04o", defaultResourceFileMode), "The octal permissions of the "+
+		"saved resource files. They must be readable and writable by the owner and not world-writable.")
+	cmd.Flags().String("dir-mode", fmt.Sprintf("%04o", defaultResourceDirMode), "The octal permissions of the "+
+		"directories holding the saved resources. They must be fully accessible by the owner and not world-writable.")
+	cmd.Flags().Bool("tar-to-stdout", false, "Write the collected object files to stdout as a tar stream "+
+		"instead of saving them under --resultdir. The entries are named after the paths the files would be saved as.")
+	cmd.Flags().Bool("gzip", false, "Compress the tar stream written with --tar-to-stdout.")
+	cmd.Flags().Bool("compress-resources", false, "Gzip each of the resources saved under --resultdir, "+
+		"adding the .gz suffix to its name. The empty resources and the placeholders of those that couldn't be "+
+		"fetched are saved uncompressed. OpenSCAP can't read them directly, the scanner of a scan and the evaluate "+
+		"command decompress them first.")
+	cmd.Flags().String("summary-file", "", "If set, the summary of the collection that is logged at the end "+
+		"is also written to this file as JSON.")
+	cmd.Flags().String("output-prefix", "", "If set, the names of the --warnings-output-file, "+
+		"--metadata-archive and --summary-file files are prefixed with this token and a dash, so the "+
+		"collections of several scans can share a directory.")
+	cmd.Flags().Bool("prefix-outputs-with-scan", false, "Prefix the names of the output files with the "+
+		"--scan name, like --output-prefix does.")
+	cmd.Flags().StringSlice("contexts", nil, "Collects the resources of the clusters of these kubeconfig "+
+		"contexts concurrently instead of the current one. The resources of each cluster are saved under a "+
+		"subdirectory of --resultdir named after its context, and its output files are prefixed with that "+
+		"name. Can't be combined with --scan or --tar-to-stdout.")
+	cmd.Flags().Bool("fail-on-empty", false, "Fail the collection if no resources were fetched, which "+
+		"usually means the profile, the permissions or the platform are wrong.")
 	cmd.Flags().Bool("debug", false, "Print debug messages.")
 
 	flags := cmd.Flags()
@@ -81,15 +287,186 @@ func defineAPIResourceCollectorFlags(cmd *cobra.Command) {
 
 func parseAPIResourceCollectorConfig(cmd *cobra.Command) *fetcherConfig {
 	var conf fetcherConfig
-	conf.Content = getValidStringArg(cmd, "content")
-	conf.ResultDir = getValidStringArg(cmd, "resultdir")
-	conf.Profile = getValidStringArg(cmd, "profile")
+	conf.ScanName, _ = cmd.Flags().GetString("scan")
+	conf.InputsFromScan, _ = cmd.Flags().GetBool("inputs-from-scan")
+	if conf.InputsFromScan {
+		if conf.ScanName == "" {
+			FATAL("--inputs-from-scan requires --scan to be set")
+		}
+		// Whatever isn't set is read from the scan once the client is built
+		conf.Content, _ = cmd.Flags().GetString("content")
+		conf.Profile, _ = cmd.Flags().GetString("profile")
+	} else {
+		conf.Content = getValidStringArg(cmd, "content")
+		conf.Profile = getValidStringArg(cmd, "profile")
+	}
+	conf.TarToStdout, _ = cmd.Flags().GetBool("tar-to-stdout")
+	conf.Gzip, _ = cmd.Flags().GetBool("gzip")
+	conf.FailOnEmpty, _ = cmd.Flags().GetBool("fail-on-empty")
+	if conf.Gzip && !conf.TarToStdout {
+		FATAL("--gzip requires --tar-to-stdout to be set")
+	}
+	conf.CompressResources, _ = cmd.Flags().GetBool("compress-resources")
+	if conf.CompressResources && conf.TarToStdout {
+		FATAL("--compress-resources can't be used with --tar-to-stdout, use --gzip instead")
+	}
+	if conf.TarToStdout {
+		conf.ResultDir, _ = cmd.Flags().GetString("resultdir")
+	} else {
+		conf.ResultDir = getValidStringArg(cmd, "resultdir")
+	}
 	conf.WarningsOutputFile = getValidStringArg(cmd, "warnings-output-file")
 	debugLog, _ = cmd.Flags().GetBool("debug")
 	conf.Tailoring, _ = cmd.Flags().GetString("tailoring")
+	conf.ContentTimeout, _ = cmd.Flags().GetDuration("content-timeout")
+	if conf.ContentTimeout <= 0 {
+		FATAL("Invalid --content-timeout: %s, it must be positive", conf.ContentTimeout)
+	}
+	conf.ContentPollPeriod, _ = cmd.Flags().GetDuration("content-poll-interval")
+	if conf.ContentPollPeriod <= 0 {
+		FATAL("Invalid --content-poll-interval: %s, it must be positive", conf.ContentPollPeriod)
+	}
+	conf.MetadataArchive, _ = cmd.Flags().GetString("metadata-archive")
+	conf.SummaryFile, _ = cmd.Flags().GetString("summary-file")
+	conf.NodeSelector, _ = cmd.Flags().GetString("node-selector")
+	conf.Nodes, _ = cmd.Flags().GetStringSlice("nodes")
+	conf.NodesMatching, _ = cmd.Flags().GetString("nodes-matching")
+	conf.SkipKubeletConfig, _ = cmd.Flags().GetBool("skip-kubelet-config")
+	conf.SkipStaged, _ = cmd.Flags().GetStringSlice("skip-staged")
+	if err := validateSkipStaged(conf.SkipStaged); err != nil {
+		FATAL("Invalid --skip-staged: %v", err)
+	}
+	conf.KeepUnreadyNodes, _ = cmd.Flags().GetBool("keep-unready-nodes")
+	conf.MinNodeCoverage, _ = cmd.Flags().GetInt("min-kubelet-node-coverage")
+	if err := validateKubeletNodeCoverage(conf.MinNodeCoverage); err != nil {
+		FATAL("Invalid --min-kubelet-node-coverage: %v", err)
+	}
+	conf.KubeletAPIVersion, _ = cmd.Flags().GetString("kubelet-config-api-version")
+	if err := validateKubeletConfigAPIVersion(conf.KubeletAPIVersion); err != nil {
+		FATAL("Invalid --kubelet-config-api-version: %v", err)
+	}
+	conf.DumpPathScheme, _ = cmd.Flags().GetString("dump-path-scheme")
+	if err := validateDumpPathScheme(conf.DumpPathScheme); err != nil {
+		FATAL("Invalid --dump-path-scheme: %v", err)
+	}
+	conf.VersionCheck, _ = cmd.Flags().GetString("content-version-check")
+	if err := validateVersionCheck(conf.VersionCheck); err != nil {
+		FATAL("Invalid --content-version-check: %v", err)
+	}
+	conf.VersionDetection, _ = cmd.Flags().GetString("version-detection")
+	if err := validateVersionDetection(conf.VersionDetection); err != nil {
+		FATAL("Invalid --version-detection: %v", err)
+	}
+	conf.KeepNodeKubelets, _ = cmd.Flags().GetBool("keep-node-kubelet-configs")
+	if conf.KeepNodeKubelets && conf.MetadataArchive == "" {
+		FATAL("--keep-node-kubelet-configs requires --metadata-archive to be set")
+	}
+	conf.ConsistentSnapshot, _ = cmd.Flags().GetBool("consistent-snapshot")
+	conf.PreferProtobuf, _ = cmd.Flags().GetBool("prefer-protobuf")
+	if conf.PreferProtobuf && conf.ConsistentSnapshot {
+		LOG("--prefer-protobuf is ignored with --consistent-snapshot")
+	}
+	conf.BatchConfigFetch, _ = cmd.Flags().GetBool("batch-config-fetch")
+	conf.FetchConcurrency, _ = cmd.Flags().GetInt("fetch-concurrency")
+	if conf.FetchConcurrency < 1 {
+		FATAL("Invalid --fetch-concurrency: %d, it must be at least 1", conf.FetchConcurrency)
+	}
+	if conf.FetchConcurrency > 1 && conf.ConsistentSnapshot {
+		LOG("--fetch-concurrency is ignored with --consistent-snapshot")
+	}
+	conf.FetchRetries, _ = cmd.Flags().GetInt("fetch-retries")
+	if conf.FetchRetries < 0 {
+		FATAL("Invalid --fetch-retries: %d, it can't be negative", conf.FetchRetries)
+	}
+	conf.FetchRetryDelay, _ = cmd.Flags().GetDuration("fetch-retry-delay")
+	conf.MachineConfigPools, _ = cmd.Flags().GetStringSlice("machine-config-pools")
+	conf.MCsToDisk, _ = cmd.Flags().GetBool("machine-configs-to-disk")
+	conf.MCConfigSections, _ = cmd.Flags().GetStringSlice("machine-config-sections")
+	if err := validateMCConfigSections(conf.MCConfigSections); err != nil {
+		FATAL("Invalid --machine-config-sections: %v", err)
+	}
+	conf.FetchCacheDir, _ = cmd.Flags().GetString("fetch-cache-dir")
+	conf.FetchCacheTTL, _ = cmd.Flags().GetDuration("fetch-cache-ttl")
+	if conf.FetchCacheTTL < 0 {
+		FATAL("Invalid --fetch-cache-ttl: %s, it can't be negative", conf.FetchCacheTTL)
+	}
+	if (conf.FetchCacheDir == "") != (conf.FetchCacheTTL == 0) {
+		FATAL("--fetch-cache-dir and --fetch-cache-ttl must be set together")
+	}
+	if conf.FetchCacheDir != "" && conf.ConsistentSnapshot {
+		LOG("--fetch-cache-dir is ignored with --consistent-snapshot")
+	}
+	if conf.FetchRetryDelay < 0 {
+		FATAL("Invalid --fetch-retry-delay: %s, it can't be negative", conf.FetchRetryDelay)
+	}
+	conf.RedactBinaryData, _ = cmd.Flags().GetBool("redact-configmap-binary-data")
+	conf.ImpersonateUser, _ = cmd.Flags().GetString("impersonate-user")
+	conf.ImpersonateGroups, _ = cmd.Flags().GetStringSlice("impersonate-group")
+	if len(conf.ImpersonateGroups) > 0 && conf.ImpersonateUser == "" {
+		FATAL("--impersonate-group requires --impersonate-user to be set")
+	}
+	if cmd.Flags().Changed("user-agent-scan") {
+		conf.UserAgentScan, _ = cmd.Flags().GetString("user-agent-scan")
+	} else if conf.ScanName != "" {
+		conf.UserAgentScan = "scan/" + conf.ScanName
+	}
+	if strings.ContainsAny(conf.UserAgentScan, "\r\n") {
+		FATAL("Invalid --user-agent-scan: it can't span several lines")
+	}
+	outputPrefix, _ := cmd.Flags().GetString("output-prefix")
+	if prefixWithScan, _ := cmd.Flags().GetBool("prefix-outputs-with-scan"); prefixWithScan {
+		if outputPrefix != "" || conf.ScanName == "" {
+			FATAL("--prefix-outputs-with-scan requires --scan to be set, and can't be combined with --output-prefix")
+		}
+		outputPrefix = conf.ScanName
+	}
+	if strings.ContainsAny(outputPrefix, "/\x00") || outputPrefix == "." || outputPrefix == ".." {
+		FATAL("Invalid --output-prefix: it can't be a path")
+	}
+	conf.WarningsOutputFile = prefixedOutputPath(conf.WarningsOutputFile, outputPrefix)
+	conf.MetadataArchive = prefixedOutputPath(conf.MetadataArchive, outputPrefix)
+	conf.SummaryFile = prefixedOutputPath(conf.SummaryFile, outputPrefix)
+	conf.Contexts, _ = cmd.Flags().GetStringSlice("contexts")
+	if len(conf.Contexts) > 0 && (conf.ScanName != "" || conf.TarToStdout) {
+		FATAL("--contexts can't be combined with --scan or --tar-to-stdout")
+	}
+	var err error
+	valueOverrides, _ := cmd.Flags().GetStringArray("set-value")
+	if conf.ValueOverrides, err = parseValueOverrides(valueOverrides); err != nil {
+		FATAL("Invalid --set-value: %v", err)
+	}
+	nodeRoles, _ := cmd.Flags().GetStringArray("node-role")
+	if conf.NodeRoles, err = parseNodeRoles(nodeRoles); err != nil {
+		FATAL("Invalid --node-role: %v", err)
+	}
+	contentDigest, _ := cmd.Flags().GetString("content-digest")
+	if conf.ContentDigest, err = parseContentDigest(contentDigest); err != nil {
+		FATAL("Invalid --content-digest: %v", err)
+	}
+	tailoringDigest, _ := cmd.Flags().GetString("tailoring-digest")
+	if conf.TailoringDigest, err = parseContentDigest(tailoringDigest); err != nil {
+		FATAL("Invalid --tailoring-digest: %v", err)
+	}
+	fileMode, _ := cmd.Flags().GetString("file-mode")
+	if conf.FileMode, err = parseResourceMode(fileMode, 0600); err != nil {
+		FATAL("Invalid --file-mode: %v", err)
+	}
+	dirMode, _ := cmd.Flags().GetString("dir-mode")
+	if conf.DirMode, err = parseResourceMode(dirMode, 0700); err != nil {
+		FATAL("Invalid --dir-mode: %v", err)
+	}
 	return &conf
 }
 
+// prefixedOutputPath prefixes the name of the output file at path with the
+// prefix, keeping its directory. Paths that aren't set are left empty.
+func prefixedOutputPath(path, prefix string) string {
+	if path == "" || prefix == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), prefix+"-"+filepath.Base(path))
+}
+
 func getConfig() *rest.Config {
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -98,6 +475,52 @@ func getConfig() *rest.Config {
 	return cfg
 }
 
+// fetchUserAgent returns the User-Agent identifying the requests of the
+// collector, e.g. "compliance-operator/0.1.56 scan/ocp4-cis"
+func fetchUserAgent(conf *fetcherConfig) string {
+	userAgent := "compliance-operator/" + version.Version
+	if conf.UserAgentScan == "" {
+		return userAgent
+	}
+	return userAgent + " " + conf.UserAgentScan
+}
+
+// parseResourceMode parses the octal permissions in mode, which must grant at
+// least the required permissions and must not make the resources
+// world-writable.
+func parseResourceMode(mode string, required os.FileMode) (os.FileMode, error) {
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not an octal number", mode)
+	}
+	perm := os.FileMode(parsed)
+	if perm&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("%04o has bits other than the permission bits set", parsed)
+	}
+	if perm&required != required {
+		return 0, fmt.Errorf("%04o must include %04o", perm, required)
+	}
+	if perm&0002 != 0 {
+		return 0, fmt.Errorf("%04o is world-writable", perm)
+	}
+	return perm, nil
+}
+
+// getFetchConfig returns the config to fetch the resources with, which
+// impersonates the configured user if any.
+func getFetchConfig(cfg *rest.Config, conf *fetcherConfig) *rest.Config {
+	if conf.ImpersonateUser == "" {
+		return cfg
+	}
+	LOG("Fetching resources impersonating %s", conf.ImpersonateUser)
+	fetchConfig := rest.CopyConfig(cfg)
+	fetchConfig.Impersonate = rest.ImpersonationConfig{
+		UserName: conf.ImpersonateUser,
+		Groups:   conf.ImpersonateGroups,
+	}
+	return fetchConfig
+}
+
 func getApiCollectorClient(config *rest.Config, scheme *runtime.Scheme) (runtimeclient.Client, error) {
 	client, err := runtimeclient.New(config, runtimeclient.Options{
 		Scheme: scheme,
@@ -109,42 +532,314 @@ func getApiCollectorClient(config *rest.Config, scheme *runtime.Scheme) (runtime
 }
 
 func runAPIResourceCollector(cmd *cobra.Command, args []string) {
+	runStart := time.Now()
 	fetcherConf := parseAPIResourceCollectorConfig(cmd)
+	// The tar stream owns stdout, so everything else is logged to stderr
+	resourceOut := os.Stdout
+	if fetcherConf.TarToStdout {
+		logOut = os.Stderr
+	}
+	if len(fetcherConf.Contexts) > 0 {
+		runMultiClusterCollection(fetcherConf, runStart)
+		return
+	}
 	restConfig := getConfig()
+	restConfig.UserAgent = fetchUserAgent(fetcherConf)
 	scheme := getScheme()
 
-	kubeClientSet, err := kubernetes.NewForConfig(restConfig)
+	// The collector's own identity is still used to access the scan itself
+	client, err := getApiCollectorClient(restConfig, scheme)
 	if err != nil {
-		FATAL("Error building kubeClientSet: %v", err)
+		FATAL("Error building the runtime client: %v", err)
+	}
+	if fetcherConf.InputsFromScan {
+		if err := setInputsFromScan(context.TODO(), client, fetcherConf); err != nil {
+			FATAL("Error reading the inputs of scan %s: %v", fetcherConf.ScanName, err)
+		}
 	}
 
-	client, err := getApiCollectorClient(restConfig, scheme)
+	fetcher, err := newFetcherForConfig(restConfig, scheme, fetcherConf)
+	if err != nil {
+		FATAL("Error %v", err)
+	}
+	summary, err := collectResources(context.Background(), fetcher, client, fetcherConf, resourceOut)
+	logCollectionSummary(summary, runStart, fetcherConf.SummaryFile)
 	if err != nil {
-		FATAL("Error building kubeClientSet: %v", err)
+		FATAL("Error %v", err)
 	}
+}
 
-	fetcher := NewDataStreamResourceFetcher(scheme, client, kubeClientSet)
+// newFetcherForConfig builds a fetcher from the REST config of a cluster,
+// with the impersonation and rate limits of conf
+func newFetcherForConfig(restConfig *rest.Config, scheme *runtime.Scheme, conf *fetcherConfig) (ResourceFetcher, error) {
+	conf.APIServer = restConfig.Host
+	fetchConfig := getFetchConfig(restConfig, conf)
+	kubeClientSet, err := kubernetes.NewForConfig(fetchConfig)
+	if err != nil {
+		return nil, fmt.Errorf("building kubeClientSet: %w", err)
+	}
+	fetchClient, err := getApiCollectorClient(fetchConfig, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("building the runtime client: %w", err)
+	}
+	return NewDataStreamResourceFetcher(scheme, fetchClient, kubeClientSet, conf), nil
+}
+
+// collectResources fetches the resources the content needs with the fetcher
+// and saves them, or streams them to out, along with the warnings and the
+// metadata archive. If conf names a scan, client records what was collected
+// on it, and the collection is cancelled along with the scan. A cancelled
+// collection removes its partial output and reports it in the summary.
+func collectResources(ctx context.Context, fetcher ResourceFetcher, client runtimeclient.Client, conf *fetcherConfig,
+	out io.Writer) (collectionSummary, error) {
+	if err := fetcher.LoadSource(conf.Content); err != nil {
+		return collectionSummary{}, fmt.Errorf("loading source data: %w", err)
+	}
+	if conf.Tailoring != "" {
+		if err := fetcher.LoadTailoring(conf.Tailoring); err != nil {
+			return collectionSummary{}, fmt.Errorf("loading tailoring data: %w", err)
+		}
+	}
+	if err := fetcher.FigureResources(conf.Profile); err != nil {
+		return collectionSummary{}, fmt.Errorf("finding resources: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	key := types.NamespacedName{Name: conf.ScanName, Namespace: common.GetComplianceOperatorNamespace()}
+	if conf.ScanName != "" {
+		go watchForCancellation(ctx, cancel, client, key)
+	}
+
+	fetchStart := time.Now()
+	warnings, err := fetcher.FetchResources(ctx)
+	timing := newFetchTiming(fetchStart, time.Now())
+	summary := fetcher.Summary(warnings)
+	summary.FetchDurationSeconds = timing.DurationSeconds
+	if err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil) {
+		LOG("Resource collection was cancelled, removing partial output")
+		if cleanupErr := cleanupCollectorOutput(conf); cleanupErr != nil {
+			return summary, fmt.Errorf("removing partial output: %w", cleanupErr)
+		}
+		summary.Cancelled = true
+		summary.Saved = 0
+		summary.BytesWritten = 0
+		return summary, nil
+	}
+	if conf.ScanName != "" {
+		// Also recorded if the fetch failed, since a filter error fails it.
+		// Not being able to record the collection shouldn't fail the scan
+		if recordErr := recordCollection(ctx, client, key, fetcher, timing.End.Sub(timing.Start)); recordErr != nil {
+			LOG("Couldn't record the collection on scan %s: %v", key, recordErr)
+		}
+	}
+	if warnErr := fetcher.SaveWarningsIfAny(warnings, conf.WarningsOutputFile); warnErr != nil {
+		return summary, fmt.Errorf("writing warnings output file: %w", warnErr)
+	}
+	if err != nil {
+		return summary, fmt.Errorf("fetching resources: %w", err)
+	}
+	if conf.FailOnEmpty {
+		if emptyErr := emptyCollectionError(summary); emptyErr != nil {
+			return summary, fmt.Errorf("fetching resources: %w", emptyErr)
+		}
+	}
+	if conf.MetadataArchive != "" {
+		if archiveErr := fetcher.SaveMetadataArchive(warnings, timing, conf.MetadataArchive); archiveErr != nil {
+			return summary, fmt.Errorf("writing metadata archive: %w", archiveErr)
+		}
+	}
+
+	if conf.TarToStdout {
+		if err := fetcher.StreamResources(out, conf.Gzip); err != nil {
+			return summary, fmt.Errorf("streaming resources: %w", err)
+		}
+	} else if err := fetcher.SaveResources(conf.ResultDir); err != nil {
+		return summary, fmt.Errorf("saving resources: %w", err)
+	}
+	return summary, nil
+}
+
+// setInputsFromScan fills the content, profile and tailoring that weren't
+// set from the spec of the scan the resources are collected for
+func setInputsFromScan(ctx context.Context, client runtimeclient.Client, conf *fetcherConfig) error {
+	scan := &compv1alpha1.ComplianceScan{}
+	key := types.NamespacedName{Name: conf.ScanName, Namespace: common.GetComplianceOperatorNamespace()}
+	if err := client.Get(ctx, key, scan); err != nil {
+		return err
+	}
+	if conf.Content == "" {
+		if scan.Spec.Content == "" {
+			return fmt.Errorf("the scan sets no content")
+		}
+		conf.Content = filepath.Join(scanContentDir, scan.Spec.Content)
+	}
+	if conf.Profile == "" {
+		if scan.Spec.Profile == "" {
+			return fmt.Errorf("the scan sets no profile")
+		}
+		conf.Profile = scan.Spec.Profile
+	}
+	if conf.Tailoring == "" && scan.Spec.TailoringConfigMap != nil {
+		conf.Tailoring = scanTailoringPath
+	}
+	return nil
+}
 
-	if err := fetcher.LoadSource(fetcherConf.Content); err != nil {
-		FATAL("Error loading source data: %v", err)
+// emptyCollectionError returns an error telling why nothing was fetched, or
+// nil if some resources were
+func emptyCollectionError(summary collectionSummary) error {
+	if summary.Saved > 0 {
+		return nil
 	}
-	if fetcherConf.Tailoring != "" {
-		if err := fetcher.LoadTailoring(fetcherConf.Tailoring); err != nil {
-			FATAL("Error loading tailoring data: %v", err)
+	var reason string
+	if summary.Attempted == 0 {
+		reason = "the profile selects no checks that need API resources"
+		if summary.UndefinedRules > 0 {
+			reason += fmt.Sprintf(", and %d of the rules it selects aren't defined in the content", summary.UndefinedRules)
+		}
+	} else {
+		reason = fmt.Sprintf("none of the %d resources the content needs could be fetched", summary.Attempted)
+		categories := make([]string, 0, len(summary.Warnings))
+		for category, count := range summary.Warnings {
+			categories = append(categories, fmt.Sprintf("%s: %d", category, count))
+		}
+		if len(categories) > 0 {
+			sort.Strings(categories)
+			reason += fmt.Sprintf(" (warnings: %s)", strings.Join(categories, ", "))
 		}
 	}
-	if err := fetcher.FigureResources(fetcherConf.Profile); err != nil {
-		FATAL("Error finding resources: %v", err)
+	return fmt.Errorf("no resources were fetched: %s", reason)
+}
+
+// logCollectionSummary logs the summary as a single JSON line, and writes it
+// to summaryFile if set. Failing to write it doesn't fail the collection.
+func logCollectionSummary(summary collectionSummary, runStart time.Time, summaryFile string) {
+	summary.DurationSeconds = time.Since(runStart).Seconds()
+	out, err := json.Marshal(summary)
+	if err != nil {
+		LOG("Couldn't marshal the collection summary: %v", err)
+		return
 	}
-	warnings, err := fetcher.FetchResources()
-	if warnErr := fetcher.SaveWarningsIfAny(warnings, fetcherConf.WarningsOutputFile); warnErr != nil {
-		FATAL("Error writing warnings output file: %v", warnErr)
+	LOG("Collection summary: %s", out)
+	if summaryFile == "" {
+		return
+	}
+	if err := ioutil.WriteFile(summaryFile, out, 0600); err != nil {
+		LOG("Couldn't write the collection summary to %s: %v", summaryFile, err)
+	}
+}
+
+// collectionAnnotations returns the annotations that record what the
+// fetcher collected on its ComplianceScan, for the operator to expose as
+// metrics once the scan is done: the XCCDF values in effect and the filter
+// errors by kind and dump path as JSON objects, how many of the selected
+// rules aren't defined in the content, and how long the fetch took.
+func collectionAnnotations(fetcher ResourceFetcher, fetchDuration time.Duration) (map[string]string, error) {
+	values := fetcher.EffectiveValues()
+	if values == nil {
+		values = map[string]string{}
 	}
+	encodedValues, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	filterErrors := fetcher.FilterErrors()
+	if filterErrors == nil {
+		filterErrors = map[string]map[string]int{}
+	}
+	encodedFilterErrors, err := json.Marshal(filterErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		compv1alpha1.ComplianceScanEffectiveValuesAnnotation: string(encodedValues),
+		compv1alpha1.ComplianceScanUndefinedRulesAnnotation:  strconv.Itoa(len(fetcher.UndefinedRules())),
+		compv1alpha1.ComplianceScanFilterErrorsAnnotation:    string(encodedFilterErrors),
+		compv1alpha1.ComplianceScanFetchDurationAnnotation:   fetchDuration.Round(time.Millisecond).String(),
+	}, nil
+}
+
+// recordCollection records what the fetcher collected on the given
+// ComplianceScan with a single patch of its annotations, and stores the
+// digests of the scanned content and tailoring and the versions the fetcher
+// detected in its status.
+func recordCollection(ctx context.Context, client runtimeclient.Client, key types.NamespacedName,
+	fetcher ResourceFetcher, fetchDuration time.Duration) error {
+	annotations, err := collectionAnnotations(fetcher, fetchDuration)
 	if err != nil {
-		FATAL("Error fetching resources: %v", err)
+		return err
+	}
+	scan := &compv1alpha1.ComplianceScan{}
+	if err := client.Get(ctx, key, scan); err != nil {
+		return err
+	}
+	if err := patchScanAnnotations(ctx, client, scan, annotations); err != nil {
+		return err
 	}
 
-	if err := fetcher.SaveResources(fetcherConf.ResultDir); err != nil {
-		FATAL("Error saving resources: %v", err)
+	patch := runtimeclient.MergeFrom(scan.DeepCopy())
+	scan.Status.ContentDigest, scan.Status.TailoringDigest = fetcher.ContentDigests()
+	scan.Status.OpenShiftVersion, scan.Status.KubernetesVersion = fetcher.DetectedVersions()
+	return client.Status().Patch(ctx, scan, patch)
+}
+
+// watchForCancellation polls the given ComplianceScan and cancels the context
+// once the scan has been annotated for cancellation or was deleted.
+func watchForCancellation(ctx context.Context, cancel context.CancelFunc, client runtimeclient.Client, key types.NamespacedName) {
+	ticker := time.NewTicker(cancellationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			scan := &compv1alpha1.ComplianceScan{}
+			err := client.Get(ctx, key, scan)
+			if kerrors.IsNotFound(err) {
+				LOG("The scan %s no longer exists, stopping", key)
+				cancel()
+				return
+			} else if err != nil {
+				DBG("Couldn't check whether the scan %s was cancelled: %v", key, err)
+				continue
+			}
+			if scan.IsCancelled() {
+				LOG("The scan %s was cancelled, stopping", key)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// cleanupCollectorOutput removes whatever the collector already wrote, so a
+// cancelled run doesn't leave partial results behind. The result directory
+// itself is usually a volume mount, so only its contents are removed.
+func cleanupCollectorOutput(conf *fetcherConfig) error {
+	for _, f := range []string{conf.WarningsOutputFile, conf.MetadataArchive} {
+		if f == "" {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if conf.ResultDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(conf.ResultDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(conf.ResultDir, entry.Name())); err != nil {
+			return err
+		}
 	}
+	return nil
 }
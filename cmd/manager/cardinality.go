@@ -0,0 +1,297 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/metrics"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var CardinalityCmd = &cobra.Command{
+	Use:   "cardinality",
+	Short: "Estimates the number of time series of the compliance metrics.",
+	Long: "Reads ScanSettingBindings, ScanSettings, Profiles and TailoredProfiles from files, e.g. " +
+		"the output of 'oc get -o yaml', and estimates how many time series the compliance metrics " +
+		"would have once the bindings are scanned. Exits with an error if the total exceeds the threshold.",
+	Run: runCardinality,
+}
+
+func init() {
+	defineCardinalityFlags(CardinalityCmd)
+}
+
+const (
+	defaultCardinalityThreshold = 10000
+	defaultScanSettingName      = "default"
+)
+
+// The roles of the default ScanSetting, used when a binding's ScanSetting
+// isn't among the inputs
+var defaultScanSettingRoles = []string{"master", "worker"}
+
+type cardinalityObjects struct {
+	bindings         []compv1alpha1.ScanSettingBinding
+	settings         map[string]*compv1alpha1.ScanSetting
+	profiles         map[string]*compv1alpha1.Profile
+	tailoredProfiles map[string]*compv1alpha1.TailoredProfile
+}
+
+func newCardinalityObjects() *cardinalityObjects {
+	return &cardinalityObjects{
+		settings:         map[string]*compv1alpha1.ScanSetting{},
+		profiles:         map[string]*compv1alpha1.Profile{},
+		tailoredProfiles: map[string]*compv1alpha1.TailoredProfile{},
+	}
+}
+
+// cardinalityEstimate is the outcome of resolving the bindings into the
+// suites and scans the operator would create
+type cardinalityEstimate struct {
+	input  metrics.CardinalityInput
+	series map[string]int
+	// Problems resolving the bindings, which make the estimate less accurate
+	warnings []string
+}
+
+func (e *cardinalityEstimate) total() int {
+	total := 0
+	for _, n := range e.series {
+		total += n
+	}
+	return total
+}
+
+func defineCardinalityFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("file", nil, "A YAML or JSON file holding the objects to estimate the series for. Can be repeated.")
+	cmd.Flags().Int("threshold", defaultCardinalityThreshold, "The total number of time series above which the estimate fails.")
+	cmd.Flags().Float64Slice("metrics-histogram-buckets", metrics.DefaultHistogramBuckets,
+		"The buckets the operator's histograms are configured with, as in the operator flag of the same name.")
+	cmd.Flags().Bool("metrics-remediation-transitions", false,
+		"Whether the operator counts the changes of the remediations' state, as in the operator flag of the same name.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func runCardinality(cmd *cobra.Command, args []string) {
+	files, _ := cmd.Flags().GetStringSlice("file")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	if len(files) == 0 {
+		FATAL("At least one --file is required")
+	}
+	histogramBuckets, _ := cmd.Flags().GetFloat64Slice("metrics-histogram-buckets")
+	if err := metrics.ValidateHistogramBuckets(histogramBuckets); err != nil {
+		FATAL("Invalid --metrics-histogram-buckets: %v", err)
+	}
+	met := metrics.NewWithBuckets(histogramBuckets)
+	if countTransitions, _ := cmd.Flags().GetBool("metrics-remediation-transitions"); countTransitions {
+		met.EnableRemediationTransitions()
+	}
+
+	objs := newCardinalityObjects()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			FATAL("Error opening %s: %v", file, err)
+		}
+		err = objs.read(f)
+		f.Close()
+		if err != nil {
+			FATAL("Error reading %s: %v", file, err)
+		}
+	}
+
+	estimate := estimateCardinality(objs, met)
+	writeCardinalityEstimate(os.Stdout, estimate)
+	if total := estimate.total(); total > threshold {
+		FATAL("The metrics would have %d time series, which exceeds the threshold of %d", total, threshold)
+	}
+}
+
+// read adds the objects found in r, unwrapping lists
+func (o *cardinalityObjects) read(r io.Reader) error {
+	docs, err := utils.ReadObjectsFromYAML(r)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if !doc.IsList() {
+			if err := o.add(doc); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := doc.EachListItem(func(item runtime.Object) error {
+			u, ok := item.(*unstructured.Unstructured)
+			if !ok {
+				return fmt.Errorf("unexpected list item type %T", item)
+			}
+			return o.add(u)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *cardinalityObjects) add(u *unstructured.Unstructured) error {
+	var err error
+	switch u.GetKind() {
+	case "ScanSettingBinding":
+		ssb := compv1alpha1.ScanSettingBinding{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &ssb); err == nil {
+			o.bindings = append(o.bindings, ssb)
+		}
+	case "ScanSetting":
+		ss := &compv1alpha1.ScanSetting{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, ss); err == nil {
+			o.settings[ss.Name] = ss
+		}
+	case "Profile":
+		p := &compv1alpha1.Profile{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, p); err == nil {
+			o.profiles[p.Name] = p
+		}
+	case "TailoredProfile":
+		tp := &compv1alpha1.TailoredProfile{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, tp); err == nil {
+			o.tailoredProfiles[tp.Name] = tp
+		}
+	default:
+		DBG("Ignoring %s %s", u.GetKind(), u.GetName())
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't parse %s %s: %w", u.GetKind(), u.GetName(), err)
+	}
+	return nil
+}
+
+// estimateCardinality resolves every binding into a suite holding a scan per
+// profile, or per profile and node role for node profiles, the way the
+// ScanSettingBinding controller does, and estimates the series of the given
+// metrics for them.
+func estimateCardinality(objs *cardinalityObjects, met *metrics.Metrics) *cardinalityEstimate {
+	estimate := &cardinalityEstimate{}
+	for i := range objs.bindings {
+		ssb := &objs.bindings[i]
+		estimate.input.Suites++
+
+		roles := defaultScanSettingRoles
+		settingName := defaultScanSettingName
+		if ssb.SettingsRef != nil && ssb.SettingsRef.Name != "" {
+			settingName = ssb.SettingsRef.Name
+		}
+		if setting, ok := objs.settings[settingName]; ok {
+			roles = setting.Roles
+		} else {
+			estimate.warnings = append(estimate.warnings, fmt.Sprintf("ScanSettingBinding %s: ScanSetting %s not found, "+
+				"assuming the roles %s", ssb.Name, settingName, strings.Join(defaultScanSettingRoles, ",")))
+		}
+
+		for _, ref := range ssb.Profiles {
+			productType, rules, err := objs.resolveProfile(ref)
+			if err != nil {
+				estimate.warnings = append(estimate.warnings, fmt.Sprintf("ScanSettingBinding %s: %v", ssb.Name, err))
+				continue
+			}
+			scans := 1
+			if strings.EqualFold(productType, string(compv1alpha1.ScanTypeNode)) {
+				scans = len(roles)
+			}
+			estimate.input.Scans += scans
+			estimate.input.Remediations += scans * rules
+		}
+	}
+	estimate.series = met.EstimateCardinality(estimate.input)
+	return estimate
+}
+
+// resolveProfile returns the product type and the number of rules of the
+// referenced Profile or TailoredProfile
+func (o *cardinalityObjects) resolveProfile(ref compv1alpha1.NamedObjectReference) (string, int, error) {
+	switch ref.Kind {
+	case "Profile":
+		p, ok := o.profiles[ref.Name]
+		if !ok {
+			return "", 0, fmt.Errorf("Profile %s not found", ref.Name)
+		}
+		return p.Annotations[compv1alpha1.ProductTypeAnnotation], len(p.Rules), nil
+	case "TailoredProfile":
+		tp, ok := o.tailoredProfiles[ref.Name]
+		if !ok {
+			return "", 0, fmt.Errorf("TailoredProfile %s not found", ref.Name)
+		}
+		productType := tp.Annotations[compv1alpha1.ProductTypeAnnotation]
+		rules := map[string]bool{}
+		if tp.Spec.Extends != "" {
+			p, ok := o.profiles[tp.Spec.Extends]
+			if !ok {
+				return "", 0, fmt.Errorf("Profile %s extended by TailoredProfile %s not found", tp.Spec.Extends, tp.Name)
+			}
+			if productType == "" {
+				productType = p.Annotations[compv1alpha1.ProductTypeAnnotation]
+			}
+			for _, rule := range p.Rules {
+				rules[string(rule)] = true
+			}
+		}
+		for _, rule := range tp.Spec.EnableRules {
+			rules[rule.Name] = true
+		}
+		for _, rule := range tp.Spec.ManualRules {
+			rules[rule.Name] = true
+		}
+		for _, rule := range tp.Spec.DisableRules {
+			delete(rules, rule.Name)
+		}
+		return productType, len(rules), nil
+	default:
+		return "", 0, fmt.Errorf("unsupported profile kind %s", ref.Kind)
+	}
+}
+
+func writeCardinalityEstimate(out io.Writer, estimate *cardinalityEstimate) {
+	for _, warning := range estimate.warnings {
+		fmt.Fprintf(out, "warning: %s\n", warning)
+	}
+	fmt.Fprintf(out, "%d suites, %d scans, at most %d remediations\n",
+		estimate.input.Suites, estimate.input.Scans, estimate.input.Remediations)
+
+	names := make([]string, 0, len(estimate.series))
+	for name := range estimate.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "%s: %d\n", name, estimate.series[name])
+	}
+	fmt.Fprintf(out, "total: %d\n", estimate.total())
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/metrics"
+)
+
+const cardinalityTestObjects = `
+apiVersion: compliance.openshift.io/v1alpha1
+kind: ScanSettingBinding
+metadata:
+  name: cis
+profiles:
+- apiGroup: compliance.openshift.io/v1alpha1
+  kind: Profile
+  name: ocp4-cis
+- apiGroup: compliance.openshift.io/v1alpha1
+  kind: TailoredProfile
+  name: cis-node-tailored
+settingsRef:
+  apiGroup: compliance.openshift.io/v1alpha1
+  kind: ScanSetting
+  name: three-roles
+---
+apiVersion: compliance.openshift.io/v1alpha1
+kind: ScanSetting
+metadata:
+  name: three-roles
+roles:
+- master
+- worker
+- infra
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: compliance.openshift.io/v1alpha1
+  kind: Profile
+  metadata:
+    name: ocp4-cis
+    annotations:
+      compliance.openshift.io/product-type: Platform
+  rules:
+  - ocp4-api-server-audit-log-path
+  - ocp4-api-server-audit-log-maxsize
+- apiVersion: compliance.openshift.io/v1alpha1
+  kind: Profile
+  metadata:
+    name: ocp4-cis-node
+    annotations:
+      compliance.openshift.io/product-type: Node
+  rules:
+  - ocp4-kubelet-anonymous-auth
+  - ocp4-kubelet-configure-tls-cipher-suites
+  - ocp4-file-owner-kubelet-conf
+---
+apiVersion: compliance.openshift.io/v1alpha1
+kind: TailoredProfile
+metadata:
+  name: cis-node-tailored
+spec:
+  extends: ocp4-cis-node
+  title: Tailored CIS node
+  description: Tailored CIS node
+  disableRules:
+  - name: ocp4-file-owner-kubelet-conf
+    rationale: not needed
+  enableRules:
+  - name: ocp4-kubelet-enable-protect-kernel-defaults
+    rationale: needed
+  - name: ocp4-kubelet-anonymous-auth
+    rationale: already selected
+`
+
+var _ = Describe("Testing the metrics cardinality estimate", func() {
+	var objs *cardinalityObjects
+
+	BeforeEach(func() {
+		objs = newCardinalityObjects()
+		Expect(objs.read(strings.NewReader(cardinalityTestObjects))).To(Succeed())
+	})
+
+	It("Reads the objects, including list items", func() {
+		Expect(objs.bindings).To(HaveLen(1))
+		Expect(objs.settings).To(HaveKey("three-roles"))
+		Expect(objs.profiles).To(HaveKey("ocp4-cis"))
+		Expect(objs.profiles).To(HaveKey("ocp4-cis-node"))
+		Expect(objs.tailoredProfiles).To(HaveKey("cis-node-tailored"))
+	})
+
+	It("Creates a scan per role for node profiles", func() {
+		estimate := estimateCardinality(objs, metrics.New())
+		Expect(estimate.warnings).To(BeEmpty())
+		Expect(estimate.input.Suites).To(Equal(1))
+		// One platform scan and one node scan per role
+		Expect(estimate.input.Scans).To(Equal(4))
+		// Two platform rules, and three tailored node rules on three roles
+		Expect(estimate.input.Remediations).To(Equal(2 + 3*3))
+		Expect(estimate.series).To(HaveKeyWithValue("compliance_operator_compliance_state", 1))
+	})
+
+	It("Warns about the objects it couldn't resolve", func() {
+		delete(objs.settings, "three-roles")
+		delete(objs.tailoredProfiles, "cis-node-tailored")
+		estimate := estimateCardinality(objs, metrics.New())
+		Expect(estimate.warnings).To(ConsistOf(
+			ContainSubstring("ScanSetting three-roles not found"),
+			ContainSubstring("TailoredProfile cis-node-tailored not found"),
+		))
+		Expect(estimate.input.Scans).To(Equal(1))
+
+		var buf bytes.Buffer
+		writeCardinalityEstimate(&buf, estimate)
+		Expect(buf.String()).To(ContainSubstring("warning: ScanSettingBinding cis: ScanSetting three-roles not found"))
+		Expect(buf.String()).To(ContainSubstring("1 suites, 1 scans, at most 2 remediations"))
+	})
+})
@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"fmt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/discovery"
@@ -21,6 +22,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	compapis "github.com/ComplianceAsCode/compliance-operator/pkg/apis"
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 )
 
@@ -184,3 +186,18 @@ func populateEndpointsFromServicePorts(s *corev1.Service) []monitoringv1.Endpoin
 	}
 	return endpoints
 }
+
+// patchScanAnnotations sets the given annotations on the ComplianceScan with
+// a single merge patch, keeping the others it has.
+func patchScanAnnotations(ctx context.Context, c runtimeclient.Client, scan *compv1alpha1.ComplianceScan, annotations map[string]string) error {
+	patch := runtimeclient.MergeFrom(scan.DeepCopy())
+	merged := scan.GetAnnotations()
+	if merged == nil {
+		merged = make(map[string]string, len(annotations))
+	}
+	for key, value := range annotations {
+		merged[key] = value
+	}
+	scan.SetAnnotations(merged)
+	return c.Patch(ctx, scan, patch)
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var ContentDiffCmd = &cobra.Command{
+	Use:   "content-diff",
+	Short: "Compares the resources two contents collect for a profile.",
+	Long: "Resolves the resources a profile would collect with an old and a new content, and " +
+		"prints the resources added, removed or fetched differently, and the permissions the " +
+		"collector gains or loses. It exits with 1 if anything changed.",
+	Run: runContentDiff,
+}
+
+func init() {
+	defineContentDiffFlags(ContentDiffCmd)
+}
+
+type resourcePathChange string
+
+const (
+	resourcePathAdded   resourcePathChange = "+"
+	resourcePathRemoved resourcePathChange = "-"
+	resourcePathChanged resourcePathChange = "~"
+)
+
+// resourcePathDiff is a resource collected differently by the new content,
+// identified by the path it's dumped to. old or new is nil if the resource
+// was added or removed.
+type resourcePathDiff struct {
+	change   resourcePathChange
+	dumpPath string
+	old      *utils.ResourcePath
+	new      *utils.ResourcePath
+}
+
+func defineContentDiffFlags(cmd *cobra.Command) {
+	cmd.Flags().String("old-content", "", "The path to the OpenSCAP content file rolled out.")
+	cmd.Flags().String("new-content", "", "The path to the OpenSCAP content file to compare with.")
+	cmd.Flags().String("old-tailoring", "", "The path to the OpenSCAP tailoring file of the old content.")
+	cmd.Flags().String("new-tailoring", "", "The path to the OpenSCAP tailoring file of the new content.")
+	cmd.Flags().String("profile", "", "The scan profile.")
+	cmd.Flags().Bool("debug", false, "Print debug messages.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func runContentDiff(cmd *cobra.Command, args []string) {
+	oldContent := getValidStringArg(cmd, "old-content")
+	newContent := getValidStringArg(cmd, "new-content")
+	profile := getValidStringArg(cmd, "profile")
+	oldTailoring, _ := cmd.Flags().GetString("old-tailoring")
+	newTailoring, _ := cmd.Flags().GetString("new-tailoring")
+	debugLog, _ = cmd.Flags().GetBool("debug")
+	// The diff is written to stdout, so everything else is logged to stderr
+	out := os.Stdout
+	logOut = os.Stderr
+
+	oldResources, err := resolveProfileResources(oldContent, oldTailoring, profile)
+	if err != nil {
+		FATAL("Error resolving the resources of the old content: %v", err)
+	}
+	newResources, err := resolveProfileResources(newContent, newTailoring, profile)
+	if err != nil {
+		FATAL("Error resolving the resources of the new content: %v", err)
+	}
+
+	diffs := diffResourcePaths(oldResources, newResources)
+	added, removed := diffPolicyRules(policyRulesForResources(oldResources, true),
+		policyRulesForResources(newResources, true))
+	if err := writeContentDiff(out, diffs, added, removed); err != nil {
+		FATAL("Error writing the diff: %v", err)
+	}
+	if len(diffs) > 0 || len(added) > 0 || len(removed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// resolveProfileResources returns the resources a profile of the content,
+// or of the tailoring if set, collects. The KubeletConfigs are left out, as
+// the nodes aren't known without contacting the cluster.
+func resolveProfileResources(content, tailoring, profile string) ([]utils.ResourcePath, error) {
+	fetcher := &scapContentDataStream{skipKubeletConfig: true}
+	if err := fetcher.LoadSource(content); err != nil {
+		return nil, fmt.Errorf("loading source data: %w", err)
+	}
+	if tailoring != "" {
+		if err := fetcher.LoadTailoring(tailoring); err != nil {
+			return nil, fmt.Errorf("loading tailoring data: %w", err)
+		}
+	}
+	if err := fetcher.FigureResources(profile); err != nil {
+		return nil, fmt.Errorf("finding resources: %w", err)
+	}
+	return fetcher.resources, nil
+}
+
+// diffResourcePaths returns the resources added, removed or fetched
+// differently between the old and the new ones, sorted by dump path
+func diffResourcePaths(oldResources, newResources []utils.ResourcePath) []resourcePathDiff {
+	byDumpPath := func(resources []utils.ResourcePath) map[string]*utils.ResourcePath {
+		m := make(map[string]*utils.ResourcePath, len(resources))
+		for i := range resources {
+			m[resources[i].DumpPath] = &resources[i]
+		}
+		return m
+	}
+	oldPaths := byDumpPath(oldResources)
+	newPaths := byDumpPath(newResources)
+
+	diffs := []resourcePathDiff{}
+	for dumpPath, oldPath := range oldPaths {
+		newPath, ok := newPaths[dumpPath]
+		switch {
+		case !ok:
+			diffs = append(diffs, resourcePathDiff{change: resourcePathRemoved, dumpPath: dumpPath, old: oldPath})
+		case *oldPath != *newPath:
+			diffs = append(diffs, resourcePathDiff{change: resourcePathChanged, dumpPath: dumpPath,
+				old: oldPath, new: newPath})
+		}
+	}
+	for dumpPath, newPath := range newPaths {
+		if _, ok := oldPaths[dumpPath]; !ok {
+			diffs = append(diffs, resourcePathDiff{change: resourcePathAdded, dumpPath: dumpPath, new: newPath})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].dumpPath < diffs[j].dumpPath
+	})
+	return diffs
+}
+
+// diffPolicyRules returns the rules only in the new ones, and those only in
+// the old ones
+func diffPolicyRules(oldRules, newRules []rbacv1.PolicyRule) ([]string, []string) {
+	toSet := func(rules []rbacv1.PolicyRule) map[string]bool {
+		set := make(map[string]bool, len(rules))
+		for _, rule := range rules {
+			set[policyRuleString(rule)] = true
+		}
+		return set
+	}
+	oldSet := toSet(oldRules)
+	newSet := toSet(newRules)
+	added := []string{}
+	removed := []string{}
+	for rule := range newSet {
+		if !oldSet[rule] {
+			added = append(added, rule)
+		}
+	}
+	for rule := range oldSet {
+		if !newSet[rule] {
+			removed = append(removed, rule)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// policyRuleString renders a rule on one line, e.g.
+// "get config.openshift.io/networks cluster"
+func policyRuleString(rule rbacv1.PolicyRule) string {
+	verbs := strings.Join(rule.Verbs, ",")
+	if len(rule.NonResourceURLs) > 0 {
+		return fmt.Sprintf("%s %s", verbs, strings.Join(rule.NonResourceURLs, ","))
+	}
+	resources := strings.Join(rule.Resources, ",")
+	if group := strings.Join(rule.APIGroups, ","); group != "" {
+		resources = group + "/" + resources
+	}
+	if len(rule.ResourceNames) == 0 {
+		return fmt.Sprintf("%s %s", verbs, resources)
+	}
+	return fmt.Sprintf("%s %s %s", verbs, resources, strings.Join(rule.ResourceNames, ","))
+}
+
+func describeResourcePath(rpath *utils.ResourcePath) string {
+	desc := rpath.ObjPath
+	if rpath.Filter != "" {
+		desc += fmt.Sprintf(" filtered with '%s'", rpath.Filter)
+	}
+	if rpath.AllowMultiple {
+		desc += " keeping all the results"
+	}
+	if rpath.OCPVersion != "" {
+		desc += fmt.Sprintf(" on OpenShift %s", rpath.OCPVersion)
+	}
+	if rpath.K8SVersion != "" {
+		desc += fmt.Sprintf(" on Kubernetes %s", rpath.K8SVersion)
+	}
+	return desc
+}
+
+func writeContentDiff(out io.Writer, diffs []resourcePathDiff, addedRules, removedRules []string) error {
+	for _, diff := range diffs {
+		var line string
+		switch diff.change {
+		case resourcePathAdded:
+			line = fmt.Sprintf("+ %s: %s", diff.dumpPath, describeResourcePath(diff.new))
+		case resourcePathRemoved:
+			line = fmt.Sprintf("- %s: %s", diff.dumpPath, describeResourcePath(diff.old))
+		case resourcePathChanged:
+			line = fmt.Sprintf("~ %s: %s -> %s", diff.dumpPath, describeResourcePath(diff.old),
+				describeResourcePath(diff.new))
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	for _, rule := range addedRules {
+		if _, err := fmt.Fprintf(out, "+ rule: %s\n", rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range removedRules {
+		if _, err := fmt.Fprintf(out, "- rule: %s\n", rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var _ = Describe("Testing the content diff", func() {
+	oldResources := []utils.ResourcePath{
+		{ObjPath: "/version", DumpPath: "/version"},
+		{ObjPath: "/apis/config.openshift.io/v1/networks/cluster", DumpPath: "/networks", Filter: ".spec"},
+		{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/a", DumpPath: "/a"},
+	}
+	newResources := []utils.ResourcePath{
+		{ObjPath: "/version", DumpPath: "/version"},
+		{ObjPath: "/apis/config.openshift.io/v1/networks/cluster", DumpPath: "/networks", Filter: ".status"},
+		{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/b", DumpPath: "/b", OCPVersion: ">=4.14.0"},
+	}
+
+	It("Finds the resources added, removed and fetched differently", func() {
+		diffs := diffResourcePaths(oldResources, newResources)
+		Expect(diffs).To(Equal([]resourcePathDiff{
+			{change: resourcePathRemoved, dumpPath: "/a", old: &oldResources[2]},
+			{change: resourcePathAdded, dumpPath: "/b", new: &newResources[2]},
+			{change: resourcePathChanged, dumpPath: "/networks", old: &oldResources[1], new: &newResources[1]},
+		}))
+	})
+
+	It("Finds nothing between the same resources", func() {
+		Expect(diffResourcePaths(oldResources, oldResources)).To(BeEmpty())
+		added, removed := diffPolicyRules(policyRulesForResources(oldResources, true),
+			policyRulesForResources(oldResources, true))
+		Expect(added).To(BeEmpty())
+		Expect(removed).To(BeEmpty())
+	})
+
+	It("Finds the permissions gained and lost", func() {
+		added, removed := diffPolicyRules(policyRulesForResources(oldResources, false),
+			policyRulesForResources(newResources, false))
+		Expect(added).To(Equal([]string{"get configmaps b"}))
+		Expect(removed).To(Equal([]string{"get configmaps a"}))
+	})
+
+	It("Renders the rules on one line", func() {
+		Expect(policyRuleString(rbacv1.PolicyRule{APIGroups: []string{"config.openshift.io"},
+			Resources: []string{"networks"}, Verbs: []string{"get"}, ResourceNames: []string{"cluster"}})).To(
+			Equal("get config.openshift.io/networks cluster"))
+		Expect(policyRuleString(rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"},
+			Verbs: []string{"list"}})).To(Equal("list nodes"))
+		Expect(policyRuleString(rbacv1.PolicyRule{NonResourceURLs: []string{"/version"},
+			Verbs: []string{"get"}})).To(Equal("get /version"))
+	})
+
+	It("Writes the diff", func() {
+		added, removed := diffPolicyRules(policyRulesForResources(oldResources, false),
+			policyRulesForResources(newResources, false))
+		var out bytes.Buffer
+		Expect(writeContentDiff(&out, diffResourcePaths(oldResources, newResources), added, removed)).To(Succeed())
+		Expect(out.String()).To(Equal(
+			"- /a: /api/v1/namespaces/openshift-etcd/configmaps/a\n" +
+				"+ /b: /api/v1/namespaces/openshift-etcd/configmaps/b on OpenShift >=4.14.0\n" +
+				"~ /networks: /apis/config.openshift.io/v1/networks/cluster filtered with '.spec' -> " +
+				"/apis/config.openshift.io/v1/networks/cluster filtered with '.status'\n" +
+				"+ rule: get configmaps b\n" +
+				"- rule: get configmaps a\n"))
+	})
+})
@@ -0,0 +1,232 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+// The prefix of a content stored in a ConfigMap, followed by
+// <namespace>/<name>/<key>
+const configMapContentPrefix = "configmap://"
+
+const (
+	defaultContentTimeout    = time.Hour
+	defaultContentPollPeriod = time.Second
+)
+
+// contentWait is how long to wait for a content file to be written by
+// another container, and how often to check whether it was. The defaults
+// are used for what isn't set.
+type contentWait struct {
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+func (w contentWait) withDefaults() contentWait {
+	if w.timeout <= 0 {
+		w.timeout = defaultContentTimeout
+	}
+	if w.pollInterval <= 0 {
+		w.pollInterval = defaultContentPollPeriod
+	}
+	return w
+}
+
+// ContentSource is where a datastream or a tailoring is read from
+type ContentSource interface {
+	// Open returns a reader of the content, which the caller closes
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// String describes the source in errors
+	String() string
+}
+
+// fileContentSource reads the content from a file, once another container
+// wrote it
+type fileContentSource struct {
+	path string
+	wait contentWait
+}
+
+func (s *fileContentSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	f, err := openNonEmptyFile(ctx, s.path, s.wait)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *fileContentSource) String() string {
+	return s.path
+}
+
+// urlContentSource downloads the content over HTTP or HTTPS
+type urlContentSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *urlContentSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", s.url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (s *urlContentSource) String() string {
+	return s.url
+}
+
+// configMapContentSource reads the content from a key of a ConfigMap, in
+// its data or its binary data
+type configMapContentSource struct {
+	namespace string
+	name      string
+	key       string
+	clientset kubernetes.Interface
+}
+
+func (s *configMapContentSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if s.clientset == nil {
+		return nil, fmt.Errorf("reading %s needs a connection to the cluster", s)
+	}
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := cm.Data[s.key]; ok {
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+	if data, ok := cm.BinaryData[s.key]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil, fmt.Errorf("ConfigMap %s/%s has no key %s", s.namespace, s.name, s.key)
+}
+
+func (s *configMapContentSource) String() string {
+	return fmt.Sprintf("%s%s/%s/%s", configMapContentPrefix, s.namespace, s.name, s.key)
+}
+
+// newContentSource returns the source of the content at location: a URL if
+// it starts with http:// or https://, a ConfigMap key if it starts with
+// configmap://, and a file otherwise. The clientset is only needed to read
+// ConfigMaps, and the files are waited for as long as the wait says. Its
+// timeout also bounds the downloads.
+func newContentSource(location string, clientset kubernetes.Interface, wait contentWait) (ContentSource, error) {
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return &urlContentSource{
+			url:    location,
+			client: &http.Client{Timeout: wait.withDefaults().timeout},
+		}, nil
+	case strings.HasPrefix(location, configMapContentPrefix):
+		parts := strings.Split(strings.TrimPrefix(location, configMapContentPrefix), "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid ConfigMap content %s, expected %s<namespace>/<name>/<key>",
+				location, configMapContentPrefix)
+		}
+		return &configMapContentSource{
+			namespace: parts[0],
+			name:      parts[1],
+			key:       parts[2],
+			clientset: clientset,
+		}, nil
+	default:
+		return &fileContentSource{path: location, wait: wait}, nil
+	}
+}
+
+// loadContent parses the content of the source and returns it along with
+// its digest
+func loadContent(ctx context.Context, source ContentSource) (*xmlquery.Node, string, error) {
+	r, err := source.Open(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening %s: %w", source, err)
+	}
+	// #nosec
+	defer r.Close()
+	return utils.ParseContentWithDigest(bufio.NewReader(r))
+}
+
+// The prefix of the content digests, which are all SHA-256
+const contentDigestPrefix = "sha256:"
+
+// parseContentDigest returns the expected digest of a content file in the
+// form loadContent returns it. It can be given as sha256:<hex> or only as the
+// hex-encoded SHA-256.
+func parseContentDigest(digest string) (string, error) {
+	if digest == "" {
+		return "", nil
+	}
+	hexDigest := strings.ToLower(strings.TrimPrefix(digest, contentDigestPrefix))
+	if decoded, err := hex.DecodeString(hexDigest); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid digest %s, expected %s<hex-encoded SHA-256>", digest, contentDigestPrefix)
+	}
+	return contentDigestPrefix + hexDigest, nil
+}
+
+// loadVerifiedContent is loadContent failing if the digest of the content
+// isn't the expected one, if there's one. The content is read in full and
+// only parsed once its digest matches.
+func loadVerifiedContent(ctx context.Context, source ContentSource, expected string) (*xmlquery.Node, string, error) {
+	if expected == "" {
+		return loadContent(ctx, source)
+	}
+	r, err := source.Open(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening %s: %w", source, err)
+	}
+	// #nosec
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", source, err)
+	}
+	sum := sha256.Sum256(data)
+	digest := contentDigestPrefix + hex.EncodeToString(sum[:])
+	if digest != expected {
+		return nil, "", fmt.Errorf("the digest of %s is %s, expected %s", source, digest, expected)
+	}
+	xml, err := utils.ParseContent(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return xml, digest, nil
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Testing the content sources", func() {
+	const tailoringFile = "../../tests/data/tailored-profile.xml"
+	var (
+		tailoring []byte
+		digest    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tailoring, err = ioutil.ReadFile(tailoringFile)
+		Expect(err).To(BeNil())
+		_, digest, err = loadContent(context.TODO(), &fileContentSource{path: tailoringFile})
+		Expect(err).To(BeNil())
+	})
+
+	It("Picks the source from the location", func() {
+		source, err := newContentSource(tailoringFile, nil, contentWait{})
+		Expect(err).To(BeNil())
+		Expect(source).To(Equal(&fileContentSource{path: tailoringFile}))
+
+		source, err = newContentSource("https://example.com/ssg-ocp4-ds.xml", nil, contentWait{})
+		Expect(err).To(BeNil())
+		Expect(source).To(BeAssignableToTypeOf(&urlContentSource{}))
+		Expect(source.String()).To(Equal("https://example.com/ssg-ocp4-ds.xml"))
+
+		source, err = newContentSource("configmap://openshift-compliance/tailoring/tailoring.xml", nil, contentWait{})
+		Expect(err).To(BeNil())
+		Expect(source).To(Equal(&configMapContentSource{
+			namespace: "openshift-compliance",
+			name:      "tailoring",
+			key:       "tailoring.xml",
+		}))
+		Expect(source.String()).To(Equal("configmap://openshift-compliance/tailoring/tailoring.xml"))
+	})
+
+	It("Rejects ConfigMap references that aren't a namespace, a name and a key", func() {
+		for _, location := range []string{
+			"configmap://openshift-compliance/tailoring",
+			"configmap://openshift-compliance//tailoring.xml",
+			"configmap://openshift-compliance/tailoring/tailoring.xml/more",
+		} {
+			_, err := newContentSource(location, nil, contentWait{})
+			Expect(err).ToNot(BeNil(), location)
+		}
+	})
+
+	It("Downloads the content from a URL", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/tailoring.xml" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(tailoring)
+		}))
+		defer server.Close()
+
+		source, err := newContentSource(server.URL+"/tailoring.xml", nil, contentWait{})
+		Expect(err).To(BeNil())
+		_, urlDigest, err := loadContent(context.TODO(), source)
+		Expect(err).To(BeNil())
+		Expect(urlDigest).To(Equal(digest))
+
+		source, err = newContentSource(server.URL+"/missing.xml", nil, contentWait{})
+		Expect(err).To(BeNil())
+		_, _, err = loadContent(context.TODO(), source)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("404 Not Found"))
+	})
+
+	It("Reads the content from a ConfigMap", func() {
+		clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "tailoring", Namespace: "openshift-compliance"},
+			Data:       map[string]string{"tailoring.xml": string(tailoring)},
+			BinaryData: map[string][]byte{"tailoring.xml.bin": tailoring},
+		})
+		for _, key := range []string{"tailoring.xml", "tailoring.xml.bin"} {
+			source, err := newContentSource("configmap://openshift-compliance/tailoring/"+key, clientset, contentWait{})
+			Expect(err).To(BeNil())
+			_, cmDigest, err := loadContent(context.TODO(), source)
+			Expect(err).To(BeNil(), key)
+			Expect(cmDigest).To(Equal(digest), key)
+		}
+
+		source, err := newContentSource("configmap://openshift-compliance/tailoring/missing.xml", clientset, contentWait{})
+		Expect(err).To(BeNil())
+		_, _, err = loadContent(context.TODO(), source)
+		Expect(err).To(MatchError(ContainSubstring("has no key missing.xml")))
+	})
+
+	It("Waits for the file to be written", func() {
+		dir, err := ioutil.TempDir("", "contentsource")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		contentFile := filepath.Join(dir, "tailoring.xml")
+		// Empty files are still being written
+		Expect(ioutil.WriteFile(contentFile, nil, 0600)).To(Succeed())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = ioutil.WriteFile(contentFile, tailoring, 0600)
+		}()
+
+		source, err := newContentSource(contentFile, nil,
+			contentWait{timeout: 10 * time.Second, pollInterval: 10 * time.Millisecond})
+		Expect(err).To(BeNil())
+		_, fileDigest, err := loadContent(context.TODO(), source)
+		Expect(err).To(BeNil())
+		Expect(fileDigest).To(Equal(digest))
+	})
+
+	It("Fails once the file wasn't written in time", func() {
+		missing := filepath.Join(os.TempDir(), "contentsource-missing.xml")
+		source, err := newContentSource(missing, nil,
+			contentWait{timeout: 50 * time.Millisecond, pollInterval: 10 * time.Millisecond})
+		Expect(err).To(BeNil())
+		_, _, err = loadContent(context.TODO(), source)
+		Expect(err).To(MatchError(ContainSubstring("timed out after 50ms")))
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		source, err = newContentSource(missing, nil, contentWait{timeout: time.Hour})
+		Expect(err).To(BeNil())
+		_, _, err = loadContent(ctx, source)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("Only loads the content with the expected digest", func() {
+		source := &fileContentSource{path: tailoringFile}
+		_, verified, err := loadVerifiedContent(context.TODO(), source, digest)
+		Expect(err).To(BeNil())
+		Expect(verified).To(Equal(digest))
+
+		other := contentDigestPrefix + strings.Repeat("0", 64)
+		_, _, err = loadVerifiedContent(context.TODO(), source, other)
+		Expect(err).To(MatchError(ContainSubstring("expected " + other)))
+
+		fetcher := &scapContentDataStream{expectedTailoringDigest: other}
+		Expect(fetcher.LoadTailoring(tailoringFile)).ToNot(Succeed())
+		Expect(fetcher.tailoring).To(BeNil())
+	})
+
+	It("Parses the expected digests", func() {
+		parsed, err := parseContentDigest(strings.ToUpper(strings.TrimPrefix(digest, contentDigestPrefix)))
+		Expect(err).To(BeNil())
+		Expect(parsed).To(Equal(digest))
+		parsed, err = parseContentDigest(digest)
+		Expect(err).To(BeNil())
+		Expect(parsed).To(Equal(digest))
+		parsed, err = parseContentDigest("")
+		Expect(err).To(BeNil())
+		Expect(parsed).To(BeEmpty())
+		for _, invalid := range []string{"sha256:abc", "md5:" + strings.Repeat("0", 64), strings.Repeat("z", 64)} {
+			_, err := parseContentDigest(invalid)
+			Expect(err).ToNot(BeNil(), invalid)
+		}
+	})
+
+	It("Needs a clientset to read a ConfigMap", func() {
+		fetcher := &scapContentDataStream{}
+		err := fetcher.LoadTailoring("configmap://openshift-compliance/tailoring/tailoring.xml")
+		Expect(err).To(MatchError(ContainSubstring("needs a connection to the cluster")))
+	})
+})
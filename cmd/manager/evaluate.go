@@ -0,0 +1,419 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/xccdf"
+)
+
+var EvaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Evaluates a profile against previously collected resources.",
+	Long: "Runs the OpenSCAP scanner on the resources the api-resource-collector saved, e.g. on a host " +
+		"that can't reach the cluster, and writes the resulting ComplianceCheckResults and " +
+		"ComplianceRemediations as a list.",
+	Run: runEvaluate,
+}
+
+func init() {
+	defineEvaluateFlags(EvaluateCmd)
+}
+
+const (
+	// The XCCDF value the content reads the collected resources from
+	ocpDataRootValueID = "xccdf_org.ssgproject.content_value_ocp_data_root"
+	// The name of the TailoredProfile pointing the content to the resources
+	offlineTailoringName = "offline-evaluation"
+)
+
+type evaluateConfig struct {
+	Content   string
+	Tailoring string
+	Profile   string
+	ResultDir string
+	ScanName  string
+	Namespace string
+	Oscap     string
+	ArfFile   string
+	Output    string
+	Format    string
+}
+
+func defineEvaluateFlags(cmd *cobra.Command) {
+	cmd.Flags().String("content", "", "The path to the OpenSCAP content file.")
+	cmd.Flags().String("tailoring", "", "The path to the OpenSCAP tailoring file.")
+	cmd.Flags().String("profile", "", "The scan profile.")
+	cmd.Flags().String("resultdir", "", "The directory the api-resource-collector saved the resources to.")
+	cmd.Flags().String("scan", "offline", "The name of the scan the results are named after.")
+	cmd.Flags().String("namespace", "openshift-compliance", "The namespace of the results.")
+	cmd.Flags().String("oscap", "oscap", "The OpenSCAP scanner to run.")
+	cmd.Flags().String("arf", "", "If set, the ARF report of the scanner is also written to this file.")
+	cmd.Flags().String("output", "", "The file to write the results to. Defaults to stdout.")
+	cmd.Flags().String("format", "yaml", "The format of the results, either 'yaml' or 'json'.")
+	cmd.Flags().Bool("debug", false, "Print debug messages.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func parseEvaluateConfig(cmd *cobra.Command) *evaluateConfig {
+	var conf evaluateConfig
+	conf.Content = getValidStringArg(cmd, "content")
+	conf.Profile = getValidStringArg(cmd, "profile")
+	conf.ResultDir = getValidStringArg(cmd, "resultdir")
+	conf.Tailoring, _ = cmd.Flags().GetString("tailoring")
+	conf.ScanName, _ = cmd.Flags().GetString("scan")
+	conf.Namespace, _ = cmd.Flags().GetString("namespace")
+	conf.Oscap, _ = cmd.Flags().GetString("oscap")
+	conf.ArfFile, _ = cmd.Flags().GetString("arf")
+	conf.Output, _ = cmd.Flags().GetString("output")
+	conf.Format, _ = cmd.Flags().GetString("format")
+	if conf.Format != "yaml" && conf.Format != "json" {
+		FATAL("Invalid --format '%s', expected 'yaml' or 'json'", conf.Format)
+	}
+	debugLog, _ = cmd.Flags().GetBool("debug")
+
+	// The content is expected to be there already, so don't wait for it
+	// like the collector does
+	for _, file := range []string{conf.Content, conf.Tailoring} {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			FATAL("Error reading %s: %v", file, err)
+		}
+	}
+	if info, err := os.Stat(conf.ResultDir); err != nil || !info.IsDir() {
+		FATAL("--resultdir %s is not a directory", conf.ResultDir)
+	}
+	return &conf
+}
+
+func runEvaluate(cmd *cobra.Command, args []string) {
+	conf := parseEvaluateConfig(cmd)
+	// The results may be written to stdout, so everything else is logged to
+	// stderr
+	resultOut := os.Stdout
+	logOut = os.Stderr
+
+	// The nodes aren't known offline, so their KubeletConfigs can't be
+	// checked for
+	ds := &scapContentDataStream{skipKubeletConfig: true}
+	if err := ds.LoadSource(conf.Content); err != nil {
+		FATAL("Error loading source data: %v", err)
+	}
+	if conf.Tailoring != "" {
+		if err := ds.LoadTailoring(conf.Tailoring); err != nil {
+			FATAL("Error loading tailoring data: %v", err)
+		}
+	}
+	if err := ds.FigureResources(conf.Profile); err != nil {
+		FATAL("Error figuring resources: %v", err)
+	}
+	for _, missing := range missingResources(ds.resources, conf.ResultDir) {
+		LOG("Warning: %s wasn't collected, the checks using it may not be accurate", missing)
+	}
+
+	workDir, err := ioutil.TempDir("", "evaluate")
+	if err != nil {
+		FATAL("Error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	resourceDir, err := decompressedResources(conf.ResultDir, filepath.Join(workDir, "resources"))
+	if err != nil {
+		FATAL("Error decompressing the resources: %v", err)
+	}
+	dataRoot, err := filepath.Abs(resourceDir)
+	if err != nil {
+		FATAL("Error resolving %s: %v", resourceDir, err)
+	}
+	tailoring, profile, err := offlineTailoring(ds.tailoring, conf.Profile, dataRoot, conf.Content)
+	if err != nil {
+		FATAL("Error tailoring the profile: %v", err)
+	}
+	tailoringFile := filepath.Join(workDir, "tailoring.xml")
+	if err := ioutil.WriteFile(tailoringFile, []byte(tailoring), 0600); err != nil {
+		FATAL("Error writing the tailoring: %v", err)
+	}
+	arfFile := conf.ArfFile
+	if arfFile == "" {
+		arfFile = filepath.Join(workDir, "report-arf.xml")
+	}
+
+	exitCode, err := runOscap(conf.Oscap, conf.Content, tailoringFile, profile, arfFile)
+	if err != nil {
+		FATAL("Error running %s: %v", conf.Oscap, err)
+	}
+	if exitCode != common.OpenSCAPExitCodeCompliant && exitCode != common.OpenSCAPExitCodeNonCompliant {
+		FATAL("The scanner failed with exit code %s", exitCode)
+	}
+
+	results, err := evaluationResults(getScheme(), conf, ds.dataStream, arfFile)
+	if err != nil {
+		FATAL("Error parsing the results: %v", err)
+	}
+	out := resultOut
+	if conf.Output != "" {
+		f, err := os.OpenFile(conf.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			FATAL("Error opening %s: %v", conf.Output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeEvaluationResults(out, results, conf.Format); err != nil {
+		FATAL("Error writing the results: %v", err)
+	}
+
+	result := compv1alpha1.ResultCompliant
+	if exitCode == common.OpenSCAPExitCodeNonCompliant {
+		result = compv1alpha1.ResultNonCompliant
+	}
+	LOG("The scan is %s, %d results were written", result, len(results))
+}
+
+// missingResources returns the paths of the resources the profile uses that
+// aren't in the directory. The collector doesn't save the resources it can't
+// fetch, so some are expected to be missing.
+func missingResources(resources []utils.ResourcePath, dir string) []string {
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, rpath := range resources {
+		if seen[rpath.DumpPath] {
+			continue
+		}
+		seen[rpath.DumpPath] = true
+		saveDir, fileName, err := getSaveDirectoryAndFileName(dir, rpath.DumpPath)
+		if err != nil {
+			continue
+		}
+		savePath := filepath.Join(saveDir, fileName)
+		if _, err := os.Stat(savePath); err == nil {
+			continue
+		}
+		if _, err := os.Stat(savePath + savedResourceGzipSuffix); err != nil {
+			missing = append(missing, rpath.DumpPath)
+		}
+	}
+	return missing
+}
+
+// decompressedResources returns the directory OpenSCAP can read the
+// resources saved in dir from. If any were saved with --compress-resources,
+// the resources are copied to workDir with those decompressed, otherwise dir
+// is read as it is.
+func decompressedResources(dir, workDir string) (string, error) {
+	compressed := false
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, savedResourceGzipSuffix) {
+			compressed = true
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if !compressed {
+		return dir, nil
+	}
+
+	LOG("Decompressing the resources to %s", workDir)
+	return workDir, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(workDir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		// #nosec
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(target, savedResourceGzipSuffix) {
+			target = strings.TrimSuffix(target, savedResourceGzipSuffix)
+			if data, err = gunzipResource(data); err != nil {
+				return fmt.Errorf("decompressing %s: %w", path, err)
+			}
+		}
+		return ioutil.WriteFile(target, data, 0600)
+	})
+}
+
+// offlineTailoring returns a tailoring pointing the content to the collected
+// resources in dataRoot, along with the profile to evaluate. The given
+// tailoring, if any, is kept and only gets the data root set.
+func offlineTailoring(tailoring *xmlquery.Node, profile, dataRoot, content string) (string, string, error) {
+	if tailoring != nil {
+		node := xmlquery.FindOne(tailoring, fmt.Sprintf("//xccdf-1.2:Profile[@id='%s']", profile))
+		if node == nil {
+			return "", "", fmt.Errorf("profile %s not found in the tailoring", profile)
+		}
+		setValue := &xmlquery.Node{Type: xmlquery.ElementNode, Prefix: "xccdf-1.2", Data: "set-value"}
+		xmlquery.AddAttr(setValue, "idref", ocpDataRootValueID)
+		xmlquery.AddChild(setValue, &xmlquery.Node{Type: xmlquery.TextNode, Data: dataRoot})
+		xmlquery.AddChild(node, setValue)
+		return xccdf.XMLHeader + "\n" + tailoring.OutputXML(false), profile, nil
+	}
+
+	tp := &compv1alpha1.TailoredProfile{}
+	tp.Name = offlineTailoringName
+	dataRootValue := &compv1alpha1.Variable{}
+	dataRootValue.ID = ocpDataRootValueID
+	dataRootValue.Value = dataRoot
+	out, err := xccdf.TailoredProfileToXML(tp, &compv1alpha1.Profile{ProfilePayload: compv1alpha1.ProfilePayload{ID: profile}},
+		&compv1alpha1.ProfileBundle{Spec: compv1alpha1.ProfileBundleSpec{ContentFile: filepath.Base(content)}},
+		nil, []*compv1alpha1.Variable{dataRootValue})
+	if err != nil {
+		return "", "", err
+	}
+	return out, xccdf.GetXCCDFProfileID(tp), nil
+}
+
+// runOscap evaluates the profile and returns the scanner's exit code, which
+// tells whether the scan is compliant
+func runOscap(oscap, content, tailoringFile, profile, arfFile string) (string, error) {
+	// #nosec
+	scanner := exec.Command(oscap, "xccdf", "eval",
+		"--tailoring-file", tailoringFile,
+		"--profile", profile,
+		"--results-arf", arfFile,
+		content)
+	scanner.Stdout = os.Stderr
+	scanner.Stderr = os.Stderr
+	LOG("Running %s", strings.Join(scanner.Args, " "))
+	err := scanner.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return strconv.Itoa(exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return common.OpenSCAPExitCodeCompliant, nil
+}
+
+// evaluationResults parses the check results and remediations out of the ARF
+// report, the way the aggregator does for the results of a scan
+func evaluationResults(scheme *runtime.Scheme, conf *evaluateConfig, dataStream *xmlquery.Node, arfFile string) ([]runtime.Object, error) {
+	f, err := os.Open(filepath.Clean(arfFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	xccdfResults, err := testResultFromARF(f)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := utils.ParseResultsFromContentAndXccdf(scheme, conf.ScanName, conf.Namespace, dataStream,
+		strings.NewReader(xccdfResults), nil)
+	if err != nil {
+		// Like the aggregator, keep the results whose remediations parsed
+		LOG("Warning: %v", err)
+	}
+
+	// Like the aggregator's, the results are listed in the order of their
+	// IDs, with each check result followed by its remediations
+	sort.SliceStable(parsed, func(i, j int) bool {
+		return parsed[i] != nil && (parsed[j] == nil || parsed[i].Id < parsed[j].Id)
+	})
+	scan := &compv1alpha1.ComplianceScan{}
+	scan.Name = conf.ScanName
+	scan.Namespace = conf.Namespace
+	objs := []runtime.Object{}
+	for _, pr := range parsed {
+		if pr == nil || pr.CheckResult == nil {
+			continue
+		}
+		pr.CheckResult.TypeMeta.SetGroupVersionKind(compv1alpha1.SchemeGroupVersion.WithKind("ComplianceCheckResult"))
+		pr.CheckResult.Labels = getCheckResultLabels(pr, nil, scan)
+		pr.CheckResult.Annotations = getCheckResultAnnotations(pr.CheckResult, nil, scan, "")
+		objs = append(objs, pr.CheckResult)
+		for _, rem := range pr.Remediations {
+			rem.TypeMeta.SetGroupVersionKind(compv1alpha1.SchemeGroupVersion.WithKind("ComplianceRemediation"))
+			rem.Labels = getRemediationLabels(scan, rem)
+			objs = append(objs, rem)
+		}
+	}
+	return objs, nil
+}
+
+// testResultFromARF returns the XCCDF TestResult of an ARF report. The
+// report also embeds the data stream, whose profiles would otherwise be
+// mistaken for the values the scan used.
+func testResultFromARF(r io.Reader) (string, error) {
+	arf, err := xmlquery.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	node := xmlquery.FindOne(arf, "//TestResult")
+	if node == nil {
+		return "", errors.New("the report has no TestResult")
+	}
+	return node.OutputXML(true), nil
+}
+
+func writeEvaluationResults(out io.Writer, objs []runtime.Object, format string) error {
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      objs,
+	}
+	var data []byte
+	var err error
+	if format == "json" {
+		data, err = json.MarshalIndent(list, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(list)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,231 @@
+package manager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+const evaluateTestProfile = "xccdf_org.ssgproject.content_profile_moderate"
+
+const evaluateTestTailoring = `<?xml version="1.0" encoding="UTF-8"?>
+<xccdf-1.2:Tailoring xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2" id="xccdf_compliance.openshift.io_tailoring_moderate-tailored">
+  <xccdf-1.2:benchmark href="/content/ssg-ocp4-ds.xml"></xccdf-1.2:benchmark>
+  <xccdf-1.2:version time="2022-10-01T00:00:00Z">1</xccdf-1.2:version>
+  <xccdf-1.2:Profile id="xccdf_compliance.openshift.io_profile_moderate-tailored" extends="xccdf_org.ssgproject.content_profile_moderate">
+    <xccdf-1.2:select idref="xccdf_org.ssgproject.content_rule_selinux_policytype" selected="false"></xccdf-1.2:select>
+  </xccdf-1.2:Profile>
+</xccdf-1.2:Tailoring>`
+
+// evaluateTestARF wraps the XCCDF results in an ARF report that also embeds
+// a profile setting other values than the scan used
+func evaluateTestARF(xccdfResults string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<arf:asset-report-collection xmlns:arf="http://scap.nist.gov/schema/asset-reporting-format/1.1">
+  <arf:report-requests>
+    <arf:report-request id="collection1">
+      <arf:content>
+        <ds:data-stream-collection xmlns:ds="http://scap.nist.gov/schema/scap/source/1.2"
+            xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+          <xccdf-1.2:Profile id="xccdf_org.ssgproject.content_profile_other">
+            <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_unrelated">42</xccdf-1.2:set-value>
+          </xccdf-1.2:Profile>
+        </ds:data-stream-collection>
+      </arf:content>
+    </arf:report-request>
+  </arf:report-requests>
+  <arf:reports>
+    <arf:report id="xccdf1">
+      <arf:content>` + strings.TrimPrefix(xccdfResults, `<?xml version="1.0" encoding="UTF-8"?>`) + `</arf:content>
+    </arf:report>
+  </arf:reports>
+</arf:asset-report-collection>`
+}
+
+var _ = Describe("Testing offline evaluation", func() {
+	var workDir string
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "evaluate-test")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(workDir)
+	})
+
+	Context("Tailoring the profile", func() {
+		It("Extends the profile with the data root set", func() {
+			out, profile, err := offlineTailoring(nil, evaluateTestProfile, "/srv/resources", "/tmp/ssg-ocp4-ds.xml")
+			Expect(err).To(BeNil())
+			Expect(profile).To(Equal("xccdf_compliance.openshift.io_profile_offline-evaluation"))
+
+			tailoring, err := xmlquery.Parse(strings.NewReader(out))
+			Expect(err).To(BeNil())
+			node := xmlquery.FindOne(tailoring, "//xccdf-1.2:Profile")
+			Expect(node.SelectAttr("id")).To(Equal(profile))
+			Expect(node.SelectAttr("extends")).To(Equal(evaluateTestProfile))
+			value := xmlquery.FindOne(node, "xccdf-1.2:set-value")
+			Expect(value.SelectAttr("idref")).To(Equal(ocpDataRootValueID))
+			Expect(value.InnerText()).To(Equal("/srv/resources"))
+		})
+
+		It("Keeps the given tailoring", func() {
+			given, err := xmlquery.Parse(strings.NewReader(evaluateTestTailoring))
+			Expect(err).To(BeNil())
+			tailoredProfile := "xccdf_compliance.openshift.io_profile_moderate-tailored"
+			out, profile, err := offlineTailoring(given, tailoredProfile, "/srv/resources", "/tmp/ssg-ocp4-ds.xml")
+			Expect(err).To(BeNil())
+			Expect(profile).To(Equal(tailoredProfile))
+
+			tailoring, err := xmlquery.Parse(strings.NewReader(out))
+			Expect(err).To(BeNil())
+			node := xmlquery.FindOne(tailoring, "//xccdf-1.2:Profile")
+			Expect(node.SelectAttr("extends")).To(Equal(evaluateTestProfile))
+			Expect(xmlquery.Find(node, "xccdf-1.2:select")).To(HaveLen(1))
+			value := xmlquery.FindOne(node, "xccdf-1.2:set-value")
+			Expect(value.SelectAttr("idref")).To(Equal(ocpDataRootValueID))
+			Expect(value.InnerText()).To(Equal("/srv/resources"))
+			Expect(out).To(ContainSubstring(`xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2"`))
+		})
+
+		It("Fails if the tailoring lacks the profile", func() {
+			given, err := xmlquery.Parse(strings.NewReader(evaluateTestTailoring))
+			Expect(err).To(BeNil())
+			_, _, err = offlineTailoring(given, evaluateTestProfile, "/srv/resources", "/tmp/ssg-ocp4-ds.xml")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	It("Lists the resources that weren't collected", func() {
+		Expect(os.MkdirAll(filepath.Join(workDir, "api", "v1"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(workDir, "api", "v1", "nodes"), []byte("{}"), 0600)).To(Succeed())
+
+		missing := missingResources([]utils.ResourcePath{
+			{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+			{ObjPath: "/api/v1/namespaces", DumpPath: "/api/v1/namespaces"},
+			{ObjPath: "/api/v1/namespaces?limit=500", DumpPath: "/api/v1/namespaces"},
+		}, workDir)
+		Expect(missing).To(Equal([]string{"/api/v1/namespaces"}))
+	})
+
+	It("Decompresses the resources saved gzipped", func() {
+		resultDir := filepath.Join(workDir, "results")
+		Expect(saveResources(resultDir, map[string][]byte{"/api/v1/nodes": []byte("{}")}, 0, 0, false)).To(Succeed())
+		dir, err := decompressedResources(resultDir, filepath.Join(workDir, "decompressed"))
+		Expect(err).To(BeNil())
+		Expect(dir).To(Equal(resultDir))
+
+		Expect(saveResources(resultDir, map[string][]byte{
+			"/api/v1/nodes":                    []byte(`{"items":[]}`),
+			"/api/v1/namespaces/a/pods/absent": []byte("# kube-api-error=NotFound"),
+		}, 0, 0, true)).To(Succeed())
+		Expect(missingResources([]utils.ResourcePath{
+			{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+		}, resultDir)).To(BeEmpty())
+		dir, err = decompressedResources(resultDir, filepath.Join(workDir, "decompressed"))
+		Expect(err).To(BeNil())
+		Expect(dir).To(Equal(filepath.Join(workDir, "decompressed")))
+		nodes, err := ioutil.ReadFile(filepath.Join(dir, "api", "v1", "nodes"))
+		Expect(err).To(BeNil())
+		Expect(string(nodes)).To(Equal(`{"items":[]}`))
+		absent, err := ioutil.ReadFile(filepath.Join(dir, "api", "v1", "namespaces", "a", "pods", "absent"))
+		Expect(err).To(BeNil())
+		Expect(string(absent)).To(Equal("# kube-api-error=NotFound"))
+	})
+
+	It("Evaluates the saved resources and parses the results", func() {
+		xccdfResults, err := ioutil.ReadFile("../../tests/data/xccdf-result.xml")
+		Expect(err).To(BeNil())
+		arfFixture := filepath.Join(workDir, "fixture-arf.xml")
+		Expect(ioutil.WriteFile(arfFixture, []byte(evaluateTestARF(string(xccdfResults))), 0600)).To(Succeed())
+
+		// Stands in for oscap, writing the fixture as the ARF report and
+		// recording its arguments
+		argsFile := filepath.Join(workDir, "args")
+		oscap := filepath.Join(workDir, "oscap")
+		Expect(ioutil.WriteFile(oscap, []byte(`#!/bin/sh
+echo "$@" > `+argsFile+`
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--results-arf" ]; then
+		cp `+arfFixture+` "$2"
+	fi
+	shift
+done
+exit 2
+`), 0700)).To(Succeed())
+
+		arfFile := filepath.Join(workDir, "report-arf.xml")
+		exitCode, err := runOscap(oscap, "/content/ds.xml", "/tmp/tailoring.xml", "offline-profile", arfFile)
+		Expect(err).To(BeNil())
+		Expect(exitCode).To(Equal("2"))
+		args, err := ioutil.ReadFile(argsFile)
+		Expect(err).To(BeNil())
+		Expect(strings.TrimSpace(string(args))).To(Equal("xccdf eval --tailoring-file /tmp/tailoring.xml " +
+			"--profile offline-profile --results-arf " + arfFile + " /content/ds.xml"))
+
+		ds := &scapContentDataStream{}
+		Expect(ds.LoadSource("../../tests/data/ds-input.xml")).To(Succeed())
+		conf := &evaluateConfig{ScanName: "offline", Namespace: "openshift-compliance"}
+		objs, err := evaluationResults(getScheme(), conf, ds.dataStream, arfFile)
+		Expect(err).To(BeNil())
+
+		checks, remediations := 0, 0
+		lastID := ""
+		for _, obj := range objs {
+			switch o := obj.(type) {
+			case *compv1alpha1.ComplianceCheckResult:
+				checks++
+				Expect(o.ID > lastID).To(BeTrue(), "results not sorted by ID")
+				lastID = o.ID
+				Expect(o.Kind).To(Equal("ComplianceCheckResult"))
+				Expect(o.Namespace).To(Equal("openshift-compliance"))
+				Expect(o.Labels[compv1alpha1.ComplianceScanLabel]).To(Equal("offline"))
+				Expect(o.Labels[compv1alpha1.ComplianceCheckResultStatusLabel]).To(Equal(string(o.Status)))
+			case *compv1alpha1.ComplianceRemediation:
+				remediations++
+				Expect(o.Kind).To(Equal("ComplianceRemediation"))
+			}
+		}
+		Expect(checks).To(BeNumerically(">", 0))
+		Expect(remediations).To(BeNumerically(">", 0))
+
+		out := &bytes.Buffer{}
+		Expect(writeEvaluationResults(out, objs[:1], "yaml")).To(Succeed())
+		listed, err := utils.ReadObjectsFromYAML(out)
+		Expect(err).To(BeNil())
+		Expect(listed).To(HaveLen(1))
+		Expect(listed[0].IsList()).To(BeTrue())
+		Expect(listed[0].EachListItem(func(item runtime.Object) error {
+			Expect(item.GetObjectKind().GroupVersionKind().Kind).To(Equal("ComplianceCheckResult"))
+			return nil
+		})).To(Succeed())
+	})
+
+	It("Only keeps the results of the report", func() {
+		results, err := testResultFromARF(strings.NewReader(evaluateTestARF(`<TestResult xmlns="http://checklists.nist.gov/xccdf/1.2" id="result">
+  <set-value idref="xccdf_org.ssgproject.content_value_used">1</set-value>
+  <rule-result idref="xccdf_org.ssgproject.content_rule_checked"><result>pass</result></rule-result>
+</TestResult>`)))
+		Expect(err).To(BeNil())
+		Expect(results).To(ContainSubstring("content_value_used"))
+		Expect(results).To(ContainSubstring("content_rule_checked"))
+		Expect(results).ToNot(ContainSubstring("content_value_unrelated"))
+	})
+
+	It("Fails if the report has no results", func() {
+		_, err := testResultFromARF(strings.NewReader(evaluateTestARF("")))
+		Expect(err).ToNot(BeNil())
+	})
+})
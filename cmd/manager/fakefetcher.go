@@ -0,0 +1,171 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+var _ ResourceFetcher = &FakeResourceFetcher{}
+
+// FakeResourceFetcher is a ResourceFetcher serving resources from memory
+// instead of fetching the ones a datastream needs from a cluster, so the code
+// using a fetcher can be tested without a content file or an API server. The
+// resources are only saved, streamed and summed up once FetchResources was
+// called, like with the datastream fetcher.
+type FakeResourceFetcher struct {
+	// The resources FetchResources returns, by dump path
+	Resources map[string][]byte
+	// The warnings FetchResources returns
+	Warnings []fetchWarning
+	// The errors returned by the methods, by method name, e.g.
+	// "FetchResources". The methods without an error succeed.
+	Errors map[string]error
+
+	// What the getters return
+	ContentDigest     string
+	TailoringDigest   string
+	OpenShiftVersion  string
+	KubernetesVersion string
+	Values            map[string]string
+	Undefined         []string
+	FilterErrorCounts map[string]map[string]int
+
+	// What the fetcher was called with
+	Source    string
+	Tailoring string
+	Profile   string
+
+	fetched map[string][]byte
+}
+
+// NewFakeResourceFetcher returns a fetcher serving the resources by dump path
+func NewFakeResourceFetcher(resources map[string][]byte) *FakeResourceFetcher {
+	return &FakeResourceFetcher{Resources: resources, Errors: map[string]error{}}
+}
+
+func (f *FakeResourceFetcher) err(method string) error {
+	return f.Errors[method]
+}
+
+func (f *FakeResourceFetcher) LoadSource(path string) error {
+	f.Source = path
+	return f.err("LoadSource")
+}
+
+func (f *FakeResourceFetcher) LoadTailoring(path string) error {
+	f.Tailoring = path
+	return f.err("LoadTailoring")
+}
+
+func (f *FakeResourceFetcher) FigureResources(profile string) error {
+	f.Profile = profile
+	return f.err("FigureResources")
+}
+
+func (f *FakeResourceFetcher) ContentDigests() (string, string) {
+	return f.ContentDigest, f.TailoringDigest
+}
+
+func (f *FakeResourceFetcher) DetectedVersions() (string, string) {
+	return f.OpenShiftVersion, f.KubernetesVersion
+}
+
+func (f *FakeResourceFetcher) EffectiveValues() map[string]string {
+	return f.Values
+}
+
+func (f *FakeResourceFetcher) UndefinedRules() []string {
+	return f.Undefined
+}
+
+func (f *FakeResourceFetcher) FilterErrors() map[string]map[string]int {
+	return f.FilterErrorCounts
+}
+
+func (f *FakeResourceFetcher) FetchResources(ctx context.Context) ([]fetchWarning, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.fetched = make(map[string][]byte, len(f.Resources))
+	for dumpPath, contents := range f.Resources {
+		f.fetched[dumpPath] = contents
+	}
+	return f.Warnings, f.err("FetchResources")
+}
+
+func (f *FakeResourceFetcher) SaveWarningsIfAny(warnings []fetchWarning, outputFile string) error {
+	if err := f.err("SaveWarningsIfAny"); err != nil {
+		return err
+	}
+	return (&scapContentDataStream{}).SaveWarningsIfAny(warnings, outputFile)
+}
+
+func (f *FakeResourceFetcher) SaveMetadataArchive(warnings []fetchWarning, timing fetchTiming, outputFile string) error {
+	if err := f.err("SaveMetadataArchive"); err != nil {
+		return err
+	}
+	manifest := metadataManifest{Resources: []metadataManifestEntry{}}
+	for dumpPath, contents := range f.fetched {
+		manifest.Resources = append(manifest.Resources, metadataManifestEntry{
+			ObjPath:  dumpPath,
+			DumpPath: dumpPath,
+			Size:     len(contents),
+		})
+	}
+	sort.Slice(manifest.Resources, func(i, j int) bool {
+		return manifest.Resources[i].DumpPath < manifest.Resources[j].DumpPath
+	})
+	return saveMetadataArchive(outputFile, warnings, manifest, timing, nil)
+}
+
+func (f *FakeResourceFetcher) SaveResources(to string) error {
+	if err := f.err("SaveResources"); err != nil {
+		return err
+	}
+	return saveResources(to, f.fetched, 0, 0, false)
+}
+
+func (f *FakeResourceFetcher) StreamResources(out io.Writer, compress bool) error {
+	if err := f.err("StreamResources"); err != nil {
+		return err
+	}
+	return streamResources(out, f.fetched, 0, compress)
+}
+
+func (f *FakeResourceFetcher) Summary(warnings []fetchWarning) collectionSummary {
+	summary := collectionSummary{
+		Attempted:      len(f.Resources),
+		Saved:          len(f.fetched),
+		Warnings:       map[string]int{},
+		UndefinedRules: len(f.Undefined),
+	}
+	for _, contents := range f.fetched {
+		summary.BytesWritten += len(contents)
+	}
+	for _, warning := range warnings {
+		summary.Warnings[warning.category]++
+	}
+	return summary
+}
+
+// FetchedResources returns the resources FetchResources returned, by dump
+// path, or nil if it wasn't called
+func (f *FakeResourceFetcher) FetchedResources() map[string][]byte {
+	return f.fetched
+}
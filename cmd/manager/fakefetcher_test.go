@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing the in-memory resource fetcher", func() {
+	var fetcher *FakeResourceFetcher
+
+	BeforeEach(func() {
+		fetcher = NewFakeResourceFetcher(map[string][]byte{
+			"/api/v1/nodes":                      []byte(`{"kind":"NodeList"}`),
+			"/apis/config.openshift.io/v1/oauth": []byte(`{"kind":"OAuth"}`),
+		})
+		fetcher.Warnings = newFetchWarnings(warningCategoryFetch,
+			"could not fetch /apis/config.openshift.io/v1/networks/cluster: not found")
+	})
+
+	It("Serves and saves the resources once fetched", func() {
+		Expect(fetcher.LoadSource("/content/ssg-ocp4-ds.xml")).To(Succeed())
+		Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_cis")).To(Succeed())
+		Expect(fetcher.Profile).To(Equal("xccdf_org.ssgproject.content_profile_cis"))
+		Expect(fetcher.FetchedResources()).To(BeNil())
+
+		warnings, err := fetcher.FetchResources(context.Background())
+		Expect(err).To(BeNil())
+		Expect(warnings).To(Equal(fetcher.Warnings))
+		Expect(fetcher.FetchedResources()).To(HaveLen(2))
+
+		summary := fetcher.Summary(warnings)
+		Expect(summary.Saved).To(Equal(2))
+		Expect(summary.Warnings).To(Equal(map[string]int{"fetch": 1}))
+
+		dir, err := ioutil.TempDir("", "fakefetcher")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		Expect(fetcher.SaveResources(dir)).To(Succeed())
+		saveDir, saveFile, err := getSaveDirectoryAndFileName(dir, "/apis/config.openshift.io/v1/oauth")
+		Expect(err).To(BeNil())
+		saved, err := ioutil.ReadFile(path.Join(saveDir, saveFile))
+		Expect(err).To(BeNil())
+		Expect(string(saved)).To(Equal(`{"kind":"OAuth"}`))
+	})
+
+	It("Returns the programmed errors", func() {
+		fetchErr := errors.New("the API server is unavailable")
+		fetcher.Errors["FetchResources"] = fetchErr
+		Expect(fetcher.LoadSource("/content/ssg-ocp4-ds.xml")).To(Succeed())
+		_, err := fetcher.FetchResources(context.Background())
+		Expect(err).To(Equal(fetchErr))
+	})
+
+	It("Doesn't fetch with a cancelled context", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := fetcher.FetchResources(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(fetcher.FetchedResources()).To(BeNil())
+	})
+})
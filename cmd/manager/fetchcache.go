@@ -0,0 +1,165 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+// The suffix of the cached resources in the cache directory
+const fetchCacheSuffix = ".cached.json"
+
+// fetchCache keeps the filtered resources a fetch returned on disk, so the
+// following runs within the TTL don't fetch them again. The entries are only
+// used by the runs with the same fingerprint, which covers the content and
+// the options that change what the resources are filtered into.
+type fetchCache struct {
+	dir         string
+	ttl         time.Duration
+	fingerprint string
+	now         func() time.Time
+}
+
+// fetchCacheEntry is the file a resource is cached in
+type fetchCacheEntry struct {
+	ObjPath     string    `json:"objPath"`
+	Filter      string    `json:"filter,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	Body        []byte    `json:"body"`
+}
+
+// newFetchCache returns the cache in dir, or nil, caching nothing, if dir
+// isn't set or the TTL isn't positive
+func newFetchCache(dir string, ttl time.Duration, fingerprint string) *fetchCache {
+	if dir == "" || ttl <= 0 {
+		return nil
+	}
+	return &fetchCache{dir: dir, ttl: ttl, fingerprint: fingerprint, now: time.Now}
+}
+
+// fetchCacheFingerprint digests the content digests and the options the
+// cached resources depend on
+func fetchCacheFingerprint(parts ...string) string {
+	digest := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(digest[:])
+}
+
+func (c *fetchCache) path(rpath utils.ResourcePath) string {
+	digest := sha256.Sum256([]byte(rpath.ObjPath + "\x00" + rpath.Filter))
+	return filepath.Join(c.dir, hex.EncodeToString(digest[:])+fetchCacheSuffix)
+}
+
+// get returns the cached body of the resource if it was cached within the
+// TTL by a run with the same fingerprint
+func (c *fetchCache) get(rpath utils.ResourcePath) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	entry, err := c.read(c.path(rpath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			DBG("Ignoring the cached %s: %v", rpath.ObjPath, err)
+		}
+		return nil, false
+	}
+	if entry.ObjPath != rpath.ObjPath || entry.Filter != rpath.Filter || !c.fresh(entry) {
+		return nil, false
+	}
+	return entry.Body, true
+}
+
+// put caches the body of the resource
+func (c *fetchCache) put(rpath utils.ResourcePath, body []byte) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(fetchCacheEntry{
+		ObjPath:     rpath.ObjPath,
+		Filter:      rpath.Filter,
+		Fingerprint: c.fingerprint,
+		FetchedAt:   c.now(),
+		Body:        body,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	// Written aside and renamed, so a run never reads a partial entry
+	tmp, err := ioutil.TempFile(c.dir, "entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(rpath))
+}
+
+// prune removes the entries that expired or were cached for another
+// fingerprint, e.g. before the content was updated
+func (c *fetchCache) prune() error {
+	if c == nil {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*"+fetchCacheSuffix))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if entry, err := c.read(path); err == nil && c.fresh(entry) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fetchCache) fresh(entry *fetchCacheEntry) bool {
+	return entry.Fingerprint == c.fingerprint && c.now().Sub(entry.FetchedAt) < c.ttl
+}
+
+func (c *fetchCache) read(path string) (*fetchCacheEntry, error) {
+	// #nosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &fetchCacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %w", path, err)
+	}
+	return entry, nil
+}
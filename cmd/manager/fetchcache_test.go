@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var _ = Describe("Testing the fetch cache", func() {
+	var (
+		dir     string
+		fetches map[string]int
+		now     time.Time
+	)
+	objects := []utils.ResourcePath{
+		{ObjPath: "/api/v1/nodes/a/proxy/configz", DumpPath: "/kubeletconfig/a", Filter: `.kubeletconfig`},
+		{ObjPath: "/api/v1/namespaces/a/configmaps/missing", DumpPath: "/missing"},
+	}
+	dispatcher := func(uri string) resourceStreamer {
+		return streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+			fetches[uri]++
+			if strings.Contains(uri, "missing") {
+				return nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "missing")
+			}
+			return ioutil.NopCloser(strings.NewReader(`{"kubeletconfig":{"maxPods":250}}`)), nil
+		})
+	}
+	cacheFor := func(fingerprint string) *fetchCache {
+		cache := newFetchCache(dir, time.Hour, fingerprint)
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+	fetchWith := func(cache *fetchCache) map[string][]byte {
+		results, _, err := fetchRecording(context.TODO(), dispatcher, resourceFetcherClients{}, objects,
+			fetchRecorder{cache: cache})
+		Expect(err).To(BeNil())
+		return results
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fetchcache")
+		Expect(err).To(BeNil())
+		fetches = map[string]int{}
+		now = time.Now()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Caches nothing without a directory or a TTL", func() {
+		Expect(newFetchCache("", time.Hour, "")).To(BeNil())
+		Expect(newFetchCache(dir, 0, "")).To(BeNil())
+		var cache *fetchCache
+		_, ok := cache.get(objects[0])
+		Expect(ok).To(BeFalse())
+		Expect(cache.put(objects[0], []byte("{}"))).To(Succeed())
+		Expect(cache.prune()).To(Succeed())
+	})
+
+	It("Reuses the filtered resources within the TTL", func() {
+		cache := cacheFor("content")
+		first := fetchWith(cache)
+		Expect(string(first["/kubeletconfig/a"])).To(Equal(`{"maxPods":250}`))
+
+		now = now.Add(59 * time.Minute)
+		Expect(fetchWith(cache)).To(Equal(first))
+		Expect(fetches["/api/v1/nodes/a/proxy/configz"]).To(Equal(1))
+		// The missing resources are fetched every time
+		Expect(fetches["/api/v1/namespaces/a/configmaps/missing"]).To(Equal(2))
+
+		now = now.Add(2 * time.Minute)
+		Expect(fetchWith(cache)).To(Equal(first))
+		Expect(fetches["/api/v1/nodes/a/proxy/configz"]).To(Equal(2))
+	})
+
+	It("Doesn't reuse the resources cached for another filter", func() {
+		cache := cacheFor("content")
+		fetchWith(cache)
+		refiltered := objects[0]
+		refiltered.Filter = `.kubeletconfig.maxPods`
+		_, ok := cache.get(refiltered)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Drops the resources cached for other content", func() {
+		fetchWith(cacheFor("old content"))
+		cached, err := filepath.Glob(filepath.Join(dir, "*"+fetchCacheSuffix))
+		Expect(err).To(BeNil())
+		Expect(cached).To(HaveLen(1))
+
+		updated := cacheFor("new content")
+		_, ok := updated.get(objects[0])
+		Expect(ok).To(BeFalse())
+		Expect(updated.prune()).To(Succeed())
+		cached, err = filepath.Glob(filepath.Join(dir, "*"+fetchCacheSuffix))
+		Expect(err).To(BeNil())
+		Expect(cached).To(BeEmpty())
+
+		fetchWith(updated)
+		Expect(fetches["/api/v1/nodes/a/proxy/configz"]).To(Equal(2))
+	})
+
+	It("Changes the fingerprint with the content and the options", func() {
+		fetcher := &scapContentDataStream{contentDigest: "a"}
+		fingerprint := fetcher.cacheFingerprint()
+		Expect(fetcher.cacheFingerprint()).To(Equal(fingerprint))
+		for _, changed := range []*scapContentDataStream{
+			{contentDigest: "b"},
+			{contentDigest: "a", tailoringDigest: "t"},
+			{contentDigest: "a", impersonateUser: "auditor"},
+			{contentDigest: "a", resourceFetcherClients: resourceFetcherClients{mcConfigSections: []string{"storage"}}},
+			{contentDigest: "a", filterEnv: filterEnv{"SCAN_NAME=ocp4-cis"}},
+			{contentDigest: "a", apiServer: "https://api.prod-east:6443"},
+			{contentDigest: "a", kubeContext: "prod-east"},
+		} {
+			Expect(changed.cacheFingerprint()).ToNot(Equal(fingerprint))
+		}
+	})
+
+	It("Never shares the cached resources of two contexts", func() {
+		collections, err := clusterCollections(&fetcherConfig{
+			Contexts:      []string{"prod-east", "prod-west"},
+			FetchCacheDir: dir,
+			FetchCacheTTL: time.Hour,
+		})
+		Expect(err).To(BeNil())
+		caches := make([]*fetchCache, 0, len(collections))
+		for _, c := range collections {
+			// Both contexts point at the same API server
+			c.conf.APIServer = "https://api.example.com:6443"
+			fetcher := NewDataStreamResourceFetcher(nil, nil, nil, c.conf).(*scapContentDataStream)
+			fetcher.contentDigest = "content"
+			cache := newFetchCache(fetcher.cacheDir, fetcher.cacheTTL, fetcher.cacheFingerprint())
+			cache.now = func() time.Time { return now }
+			caches = append(caches, cache)
+		}
+		Expect(caches[0].dir).ToNot(Equal(caches[1].dir))
+		Expect(caches[0].fingerprint).ToNot(Equal(caches[1].fingerprint))
+
+		fetchWith(caches[0])
+		_, ok := caches[0].get(objects[0])
+		Expect(ok).To(BeTrue())
+		_, ok = caches[1].get(objects[0])
+		Expect(ok).To(BeFalse())
+		fetchWith(caches[1])
+		Expect(fetches["/api/v1/nodes/a/proxy/configz"]).To(Equal(2))
+	})
+})
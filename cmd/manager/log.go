@@ -17,13 +17,18 @@ package manager
 
 import (
 	"fmt"
+	"io"
 	"os"
 )
 
 var debugLog bool
 
+// logOut is where LOG and DBG write to. Subcommands whose output goes to
+// stdout point it at stderr.
+var logOut io.Writer = os.Stdout
+
 func LOG(format string, a ...interface{}) {
-	fmt.Printf(format+"\n", a...)
+	fmt.Fprintf(logOut, format+"\n", a...)
 }
 
 func DBG(format string, a ...interface{}) {
@@ -0,0 +1,145 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// clusterCollection is the collection from one of the clusters of
+// --contexts, with the outputs of the collector moved to the cluster's
+// subdirectory or prefixed with its name
+type clusterCollection struct {
+	context string
+	conf    *fetcherConfig
+}
+
+// newClusterFetcherFn returns a fetcher of the resources of the cluster of
+// the kubeconfig context
+type newClusterFetcherFn func(kubeContext string, conf *fetcherConfig) (ResourceFetcher, error)
+
+// clusterDirName returns the name a cluster's outputs are saved under. The
+// characters that can't be part of a file name, like the slashes of the
+// contexts generated by oc login, are replaced with underscores.
+func clusterDirName(kubeContext string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, kubeContext)
+}
+
+// clusterCollections returns a collection for each of the contexts. The
+// resources of a cluster are saved and cached under its subdirectories of the
+// result and fetch cache directories, and its warnings, metadata archive and
+// summary files are prefixed with its name.
+func clusterCollections(conf *fetcherConfig) ([]clusterCollection, error) {
+	collections := make([]clusterCollection, 0, len(conf.Contexts))
+	seen := map[string]string{}
+	for _, kubeContext := range conf.Contexts {
+		name := clusterDirName(kubeContext)
+		if name == "" || name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid context '%s'", kubeContext)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("the outputs of the contexts '%s' and '%s' would both be saved as %s",
+				other, kubeContext, name)
+		}
+		seen[name] = kubeContext
+
+		clusterConf := *conf
+		clusterConf.KubeContext = kubeContext
+		clusterConf.ResultDir = filepath.Join(conf.ResultDir, name)
+		if conf.FetchCacheDir != "" {
+			clusterConf.FetchCacheDir = filepath.Join(conf.FetchCacheDir, name)
+		}
+		clusterConf.WarningsOutputFile = prefixedOutputPath(conf.WarningsOutputFile, name)
+		clusterConf.MetadataArchive = prefixedOutputPath(conf.MetadataArchive, name)
+		clusterConf.SummaryFile = prefixedOutputPath(conf.SummaryFile, name)
+		collections = append(collections, clusterCollection{context: kubeContext, conf: &clusterConf})
+	}
+	return collections, nil
+}
+
+// newClusterFetcher builds a fetcher from the kubeconfig context, using the
+// same User-Agent and impersonation as a single cluster's collection
+func newClusterFetcher(kubeContext string, conf *fetcherConfig) (ResourceFetcher, error) {
+	restConfig, err := config.GetConfigWithContext(kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("getting kube cfg: %w", err)
+	}
+	restConfig.UserAgent = fetchUserAgent(conf)
+	return newFetcherForConfig(restConfig, getScheme(), conf)
+}
+
+// runMultiClusterCollection collects the resources of all the clusters of
+// --contexts concurrently, and fails if the collection of any of them failed
+func runMultiClusterCollection(conf *fetcherConfig, runStart time.Time) {
+	collections, err := clusterCollections(conf)
+	if err != nil {
+		FATAL("Invalid --contexts: %v", err)
+	}
+	errs := collectFromClusters(context.Background(), collections, newClusterFetcher, runStart)
+	failed := false
+	for i, err := range errs {
+		if err != nil {
+			LOG("Error collecting the resources of cluster %s: %v", collections[i].context, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// collectFromClusters runs the collections concurrently, and returns the
+// error of each. A failed collection doesn't stop the others.
+func collectFromClusters(ctx context.Context, collections []clusterCollection, newFetcher newClusterFetcherFn,
+	runStart time.Time) []error {
+	errs := make([]error, len(collections))
+	_ = forEachConcurrently(len(collections), len(collections), func(i int) error {
+		c := collections[i]
+		LOG("Collecting the resources of cluster %s", c.context)
+		fetcher, err := newFetcher(c.context, c.conf)
+		if err != nil {
+			errs[i] = err
+			return nil
+		}
+		summary, err := collectFromCluster(ctx, fetcher, c.conf)
+		summary.Cluster = c.context
+		logCollectionSummary(summary, runStart, c.conf.SummaryFile)
+		errs[i] = err
+		return nil
+	})
+	return errs
+}
+
+// collectFromCluster fetches the resources the content needs with the
+// fetcher and saves them along with the warnings and the metadata archive
+func collectFromCluster(ctx context.Context, fetcher ResourceFetcher, conf *fetcherConfig) (collectionSummary, error) {
+	// The collections of --contexts aren't for a scan, nor streamed
+	return collectResources(ctx, fetcher, nil, conf, nil)
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing the collection from several clusters", func() {
+	It("Names the outputs after the contexts", func() {
+		Expect(clusterDirName("prod-east")).To(Equal("prod-east"))
+		Expect(clusterDirName("default/api-cluster-example-com:6443/kube:admin")).To(
+			Equal("default_api-cluster-example-com_6443_kube_admin"))
+	})
+
+	It("Moves the outputs of each cluster apart", func() {
+		collections, err := clusterCollections(&fetcherConfig{
+			Contexts:           []string{"prod-east", "default/api-prod-west:6443/admin"},
+			ResultDir:          "/kubernetes-api-resources",
+			WarningsOutputFile: "/reports/warnings",
+			MetadataArchive:    "/reports/metadata.tar.gz",
+		})
+		Expect(err).To(BeNil())
+		Expect(collections).To(HaveLen(2))
+		Expect(collections[0].context).To(Equal("prod-east"))
+		Expect(collections[0].conf.ResultDir).To(Equal("/kubernetes-api-resources/prod-east"))
+		Expect(collections[0].conf.WarningsOutputFile).To(Equal("/reports/prod-east-warnings"))
+		Expect(collections[0].conf.MetadataArchive).To(Equal("/reports/prod-east-metadata.tar.gz"))
+		Expect(collections[0].conf.SummaryFile).To(BeEmpty())
+		Expect(collections[1].conf.ResultDir).To(Equal("/kubernetes-api-resources/default_api-prod-west_6443_admin"))
+	})
+
+	It("Rejects contexts whose outputs would be mixed", func() {
+		_, err := clusterCollections(&fetcherConfig{Contexts: []string{"prod/east", "prod:east"}})
+		Expect(err).ToNot(BeNil())
+		_, err = clusterCollections(&fetcherConfig{Contexts: []string{".."}})
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("Collects from the other clusters if one fails", func() {
+		dir, err := ioutil.TempDir("", "multicluster")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		collections, err := clusterCollections(&fetcherConfig{
+			Contexts:           []string{"prod-east", "prod-west", "unreachable"},
+			Content:            "/content/ssg-ocp4-ds.xml",
+			Profile:            "xccdf_org.ssgproject.content_profile_cis",
+			ResultDir:          dir,
+			WarningsOutputFile: path.Join(dir, "warnings"),
+		})
+		Expect(err).To(BeNil())
+
+		fetchErr := errors.New("the API server is unavailable")
+		newFetcher := func(kubeContext string, conf *fetcherConfig) (ResourceFetcher, error) {
+			fetcher := NewFakeResourceFetcher(map[string][]byte{
+				"/apis/config.openshift.io/v1/oauths/cluster": []byte(`{"kind":"OAuth"}`),
+			})
+			fetcher.Warnings = newFetchWarnings(warningCategoryFetch,
+				"could not fetch /apis/config.openshift.io/v1/networks/cluster: not found")
+			switch kubeContext {
+			case "prod-west":
+				fetcher.Errors["FetchResources"] = fetchErr
+			case "unreachable":
+				return nil, errors.New("no route to host")
+			}
+			return fetcher, nil
+		}
+		errs := collectFromClusters(context.TODO(), collections, newFetcher, time.Now())
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[0]).To(BeNil())
+		Expect(errors.Is(errs[1], fetchErr)).To(BeTrue())
+		Expect(errs[2]).ToNot(BeNil())
+
+		saved, err := ioutil.ReadFile(path.Join(dir, "prod-east", "apis/config.openshift.io/v1/oauths/cluster"))
+		Expect(err).To(BeNil())
+		Expect(string(saved)).To(Equal(`{"kind":"OAuth"}`))
+		_, err = os.Stat(path.Join(dir, "prod-west"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		for _, cluster := range []string{"prod-east", "prod-west"} {
+			warnings, err := ioutil.ReadFile(path.Join(dir, cluster+"-warnings"))
+			Expect(err).To(BeNil(), cluster)
+			Expect(string(warnings)).To(ContainSubstring("networks/cluster"), cluster)
+		}
+	})
+
+	Context("Collecting the resources of a cluster", func() {
+		var fetcher *FakeResourceFetcher
+
+		BeforeEach(func() {
+			fetcher = NewFakeResourceFetcher(map[string][]byte{
+				"/apis/config.openshift.io/v1/oauths/cluster": []byte(`{"kind":"OAuth"}`),
+			})
+		})
+
+		It("Streams the resources if asked to", func() {
+			var out bytes.Buffer
+			summary, err := collectResources(context.TODO(), fetcher, nil, &fetcherConfig{TarToStdout: true}, &out)
+			Expect(err).To(BeNil())
+			Expect(summary.Saved).To(Equal(1))
+			header, err := tar.NewReader(&out).Next()
+			Expect(err).To(BeNil())
+			Expect(header.Name).To(ContainSubstring("oauths/cluster"))
+		})
+
+		It("Removes the partial output of a cancelled collection", func() {
+			dir, err := ioutil.TempDir("", "collection")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			warningsFile := path.Join(dir, "warnings")
+			Expect(ioutil.WriteFile(warningsFile, []byte("partial"), 0600)).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			summary, err := collectResources(ctx, fetcher, nil, &fetcherConfig{WarningsOutputFile: warningsFile}, nil)
+			Expect(err).To(BeNil())
+			Expect(summary.Cancelled).To(BeTrue())
+			Expect(summary.Saved).To(BeZero())
+			_, err = os.Stat(warningsFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -9,10 +9,12 @@ import (
 	log "github.com/sirupsen/logrus"
 	"go.uber.org/zap/zapcore"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"net"
 	"os"
 	"reflect"
 	goruntime "runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"strconv"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -47,6 +49,7 @@ import (
 	"github.com/ComplianceAsCode/compliance-operator/pkg/controller"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
 	ctrlMetrics "github.com/ComplianceAsCode/compliance-operator/pkg/controller/metrics"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/scansettingbinding"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
 	"github.com/ComplianceAsCode/compliance-operator/version"
 )
@@ -121,6 +124,25 @@ const (
 func defineOperatorFlags(cmd *cobra.Command) {
 	cmd.Flags().Bool("skip-metrics", false,
 		"Skips adding metrics.")
+	cmd.Flags().Bool("enable-webhooks", false,
+		"Serves the validating admission webhooks. Requires a serving certificate "+
+			"in the webhook server's certificate directory.")
+	cmd.Flags().String("controller-metrics-bind-address", ctrlMetrics.MetricsAddrListen,
+		"The address the compliance metrics are served on. The metrics Service keeps exposing them on port "+
+			fmt.Sprintf("%d, which is forwarded to the port given here.", ctrlMetrics.ControllerMetricsPort))
+	cmd.Flags().String("metrics-cert-file", ctrlMetrics.DefaultMetricsCertFile,
+		"The certificate the compliance metrics are served with. They're served over plain HTTP if it, "+
+			"or its key, doesn't exist.")
+	cmd.Flags().String("metrics-key-file", ctrlMetrics.DefaultMetricsKeyFile,
+		"The key of the certificate the compliance metrics are served with.")
+	cmd.Flags().Float64Slice("metrics-histogram-buckets", ctrlMetrics.DefaultHistogramBuckets,
+		"The upper bounds, in seconds, of the buckets of the compliance duration histograms. "+
+			"They must be positive and strictly increasing.")
+	cmd.Flags().Bool("metrics-remediation-transitions", false,
+		"Counts the changes of the application state of the remediations, labeled by the "+
+			"state they changed from and to.")
+	cmd.Flags().Bool("metrics-inconsistent-as-non-compliant", false,
+		"Reports the ComplianceSuites with INCONSISTENT results as NON-COMPLIANT in the compliance_state gauge.")
 	cmd.Flags().String("platform", "OpenShift",
 		"Specifies the Platform the Compliance Operator is running on. "+
 			"This will affect the defaults created.")
@@ -262,11 +284,35 @@ func RunOperator(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	met := ctrlMetrics.New()
+	controllerMetricsAddr, _ := flags.GetString("controller-metrics-bind-address")
+	controllerMetricsPort, err := controllerMetricsPortFromAddress(controllerMetricsAddr)
+	if err != nil {
+		setupLog.Error(err, "Invalid --controller-metrics-bind-address")
+		os.Exit(1)
+	}
+
+	histogramBuckets, _ := flags.GetFloat64Slice("metrics-histogram-buckets")
+	if err := ctrlMetrics.ValidateHistogramBuckets(histogramBuckets); err != nil {
+		setupLog.Error(err, "Invalid --metrics-histogram-buckets")
+		os.Exit(1)
+	}
+
+	met := ctrlMetrics.NewWithBuckets(histogramBuckets)
+	met.SetListenAddress(controllerMetricsAddr)
+	metricsCertFile, _ := flags.GetString("metrics-cert-file")
+	metricsKeyFile, _ := flags.GetString("metrics-key-file")
+	met.SetServingCertificate(metricsCertFile, metricsKeyFile)
+	if countTransitions, _ := flags.GetBool("metrics-remediation-transitions"); countTransitions {
+		met.EnableRemediationTransitions()
+	}
+	if asNonCompliant, _ := flags.GetBool("metrics-inconsistent-as-non-compliant"); asNonCompliant {
+		met.ReportInconsistentAsNonCompliant()
+	}
 	if err := met.Register(); err != nil {
 		setupLog.Error(err, "Error registering metrics")
 		os.Exit(1)
 	}
+	met.SetBuildInfo(version.Version, version.Commit(), utils.GetComponentImage(utils.CONTENT))
 
 	si, getSIErr := getSchedulingInfo(ctx, mgr.GetAPIReader())
 	if getSIErr != nil {
@@ -279,6 +325,15 @@ func RunOperator(cmd *cobra.Command, args []string) {
 		setupLog.Error(err, "")
 		os.Exit(1)
 	}
+
+	enableWebhooks, _ := flags.GetBool("enable-webhooks")
+	if enableWebhooks {
+		if err := scansettingbinding.AddWebhook(mgr); err != nil {
+			setupLog.Error(err, "Error registering the ScanSettingBinding webhook")
+			os.Exit(1)
+		}
+	}
+
 	pflag, _ := flags.GetString("platform")
 	platform := getValidPlatform(pflag)
 
@@ -286,7 +341,7 @@ func RunOperator(cmd *cobra.Command, args []string) {
 	// We only support these metrics in OpenShift (at the moment)
 	if platform == PlatformOpenShift && !skipMetrics {
 		// Add the Metrics Service
-		addMetrics(ctx, cfg, kubeClient, monitoringClient)
+		addMetrics(ctx, cfg, kubeClient, monitoringClient, controllerMetricsPort)
 	}
 
 	if err := ensureDefaultProfileBundles(ctx, mgr.GetClient(), namespaceList, platform); err != nil {
@@ -308,6 +363,20 @@ func RunOperator(cmd *cobra.Command, args []string) {
 	}
 }
 
+// controllerMetricsPortFromAddress returns the port of a host:port address
+// the controller metrics are served on
+func controllerMetricsPortFromAddress(addr string) (int, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q in address %s", port, addr)
+	}
+	return p, nil
+}
+
 func getValidPlatform(p string) PlatformType {
 	switch {
 	case strings.EqualFold(p, string(PlatformOpenShift)):
@@ -322,12 +391,12 @@ func getValidPlatform(p string) PlatformType {
 // addMetrics will create the Services and Service Monitors to allow the operator export the metrics by using
 // the Prometheus operator
 func addMetrics(ctx context.Context, cfg *rest.Config, kClient *kubernetes.Clientset,
-	mClient *monclientv1.MonitoringV1Client) {
+	mClient *monclientv1.MonitoringV1Client, controllerMetricsPort int) {
 	// Get the namespace the operator is currently deployed in.
 	operatorNs := common.GetComplianceOperatorNamespace()
 
 	// Create the metrics service and make sure the service-secret is available
-	metricsService, err := ensureMetricsServiceAndSecret(ctx, kClient, operatorNs)
+	metricsService, err := ensureMetricsServiceAndSecret(ctx, kClient, operatorNs, controllerMetricsPort)
 	if err != nil {
 		setupLog.Error(err, "Error creating metrics service/secret")
 		os.Exit(1)
@@ -344,7 +413,10 @@ func addMetrics(ctx context.Context, cfg *rest.Config, kClient *kubernetes.Clien
 	}
 }
 
-func operatorMetricService(ns string) *v1.Service {
+// operatorMetricService returns the metrics Service. The controller metrics
+// are exposed on ControllerMetricsPort regardless of the port they are served
+// on, so that the ServiceMonitor keeps scraping the same endpoint.
+func operatorMetricService(ns string, controllerMetricsPort int) *v1.Service {
 	return &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
@@ -367,7 +439,7 @@ func operatorMetricService(ns string) *v1.Service {
 				{
 					Name:       ctrlMetrics.ControllerMetricsServiceName,
 					Port:       ctrlMetrics.ControllerMetricsPort,
-					TargetPort: intstr.FromInt(ctrlMetrics.ControllerMetricsPort),
+					TargetPort: intstr.FromInt(controllerMetricsPort),
 					Protocol:   v1.ProtocolTCP,
 				},
 			},
@@ -379,10 +451,11 @@ func operatorMetricService(ns string) *v1.Service {
 	}
 }
 
-func ensureMetricsServiceAndSecret(ctx context.Context, kClient *kubernetes.Clientset, ns string) (*v1.Service, error) {
+func ensureMetricsServiceAndSecret(ctx context.Context, kClient *kubernetes.Clientset, ns string,
+	controllerMetricsPort int) (*v1.Service, error) {
 	var returnService *v1.Service
 	var err error
-	newService := operatorMetricService(ns)
+	newService := operatorMetricService(ns, controllerMetricsPort)
 	createdService, err := kClient.CoreV1().Services(ns).Create(ctx, newService, metav1.CreateOptions{})
 	if err != nil && !kerr.IsAlreadyExists(err) {
 		return nil, err
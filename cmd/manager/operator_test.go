@@ -22,7 +22,7 @@ var _ = Describe("Operator Startup Function tests", func() {
 	Context("Service Monitor Creation", func() {
 		When("Installing to non-controlled namespace", func() {
 			It("ServiceMonitor is generated with the proper TLSConfig ServerName", func() {
-				metricService := operatorMetricService("foobar")
+				metricService := operatorMetricService("foobar", metrics.ControllerMetricsPort)
 				sm := generateOperatorServiceMonitor(metricService, "foobar")
 				controllerMetricServiceFound := false
 				for _, ep := range sm.Spec.Endpoints {
@@ -35,4 +35,33 @@ var _ = Describe("Operator Startup Function tests", func() {
 			})
 		})
 	})
+	Context("Controller metrics address", func() {
+		It("parses the port of the address", func() {
+			port, err := controllerMetricsPortFromAddress(metrics.MetricsAddrListen)
+			Expect(err).To(BeNil())
+			Expect(port).To(Equal(metrics.ControllerMetricsPort))
+
+			port, err = controllerMetricsPortFromAddress("127.0.0.1:9090")
+			Expect(err).To(BeNil())
+			Expect(port).To(Equal(9090))
+		})
+		It("rejects addresses without a valid port", func() {
+			for _, addr := range []string{"8585", ":", ":http", ":0", ":65536"} {
+				_, err := controllerMetricsPortFromAddress(addr)
+				Expect(err).ToNot(BeNil(), addr)
+			}
+		})
+		It("keeps the Service port while forwarding to the configured port", func() {
+			metricService := operatorMetricService("foobar", 9090)
+			found := false
+			for _, port := range metricService.Spec.Ports {
+				if port.Name == metrics.ControllerMetricsServiceName {
+					Expect(port.Port).To(BeEquivalentTo(metrics.ControllerMetricsPort))
+					Expect(port.TargetPort.IntValue()).To(Equal(9090))
+					found = true
+				}
+			}
+			Expect(found).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,206 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/spf13/cobra"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var PreflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Checks that the resources a profile needs can be fetched.",
+	Long: "Resolves the resources a profile would collect and issues a lightweight " +
+		"request against each of them, reporting which endpoints are forbidden or missing.",
+	Run: runPreflight,
+}
+
+func init() {
+	definePreflightFlags(PreflightCmd)
+}
+
+type endpointStatus string
+
+const (
+	endpointOK        endpointStatus = "ok"
+	endpointForbidden endpointStatus = "forbidden"
+	endpointNotFound  endpointStatus = "not-found"
+	endpointError     endpointStatus = "error"
+)
+
+type endpointCheck struct {
+	uri    string
+	status endpointStatus
+	err    error
+}
+
+// endpointProbeFn issues a request against uri and returns the error, if any
+type endpointProbeFn func(ctx context.Context, uri string) error
+
+func definePreflightFlags(cmd *cobra.Command) {
+	cmd.Flags().String("content", "", "The path to the OpenSCAP content file.")
+	cmd.Flags().String("tailoring", "", "The path to the OpenSCAP tailoring file.")
+	cmd.Flags().String("profile", "", "The scan profile.")
+	cmd.Flags().String("node-selector", "", "A label selector limiting which nodes are "+
+		"listed to discover node roles. Defaults to all nodes.")
+	cmd.Flags().Bool("list-checks", false, "Only list the checks the profile selects after resolving the "+
+		"profiles it extends, without contacting the cluster.")
+	cmd.Flags().Bool("debug", false, "Print debug messages.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func runPreflight(cmd *cobra.Command, args []string) {
+	content := getValidStringArg(cmd, "content")
+	profile := getValidStringArg(cmd, "profile")
+	tailoring, _ := cmd.Flags().GetString("tailoring")
+	nodeSelector, _ := cmd.Flags().GetString("node-selector")
+	listChecks, _ := cmd.Flags().GetBool("list-checks")
+	debugLog, _ = cmd.Flags().GetBool("debug")
+
+	if listChecks {
+		listSelectedChecks(content, tailoring, profile)
+		return
+	}
+
+	restConfig := getConfig()
+	scheme := getScheme()
+
+	kubeClientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		FATAL("Error building kubeClientSet: %v", err)
+	}
+
+	client, err := getApiCollectorClient(restConfig, scheme)
+	if err != nil {
+		FATAL("Error building the runtime client: %v", err)
+	}
+
+	fetcher := &scapContentDataStream{
+		resourceFetcherClients: resourceFetcherClients{
+			clientset: kubeClientSet,
+			client:    client,
+			scheme:    scheme,
+		},
+		nodeSelector: nodeSelector,
+	}
+	if err := fetcher.LoadSource(content); err != nil {
+		FATAL("Error loading source data: %v", err)
+	}
+	if tailoring != "" {
+		if err := fetcher.LoadTailoring(tailoring); err != nil {
+			FATAL("Error loading tailoring data: %v", err)
+		}
+	}
+	if err := fetcher.FigureResources(profile); err != nil {
+		FATAL("Error finding resources: %v", err)
+	}
+
+	probe := func(ctx context.Context, uri string) error {
+		// A limit keeps list requests cheap, it's ignored for single objects
+		return kubeClientSet.RESTClient().Get().RequestURI(uri).Param("limit", "1").Do(ctx).Error()
+	}
+	checks := probeEndpoints(context.Background(), probe, fetcher.resources)
+
+	failed := false
+	for _, check := range checks {
+		if check.err != nil {
+			LOG("%s: %s (%v)", check.uri, check.status, check.err)
+		} else {
+			LOG("%s: %s", check.uri, check.status)
+		}
+		if check.status == endpointForbidden || check.status == endpointError {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// probeEndpoints checks every distinct URI in resources with probe and
+// classifies the outcome. Missing resources are reported but are not
+// necessarily a problem, as content often checks for optional objects.
+func probeEndpoints(ctx context.Context, probe endpointProbeFn, resources []utils.ResourcePath) []endpointCheck {
+	var checks []endpointCheck
+	seen := map[string]bool{}
+
+	for _, rpath := range resources {
+		uri := rpath.ObjPath
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
+
+		DBG("Probing URI: '%s'", uri)
+		err := probe(ctx, uri)
+		check := endpointCheck{uri: uri, err: err}
+		switch {
+		case err == nil:
+			check.status = endpointOK
+		case kerrors.IsForbidden(err):
+			check.status = endpointForbidden
+		case kerrors.IsNotFound(err) || meta.IsNoMatchError(err):
+			check.status = endpointNotFound
+		default:
+			check.status = endpointError
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func listSelectedChecks(content, tailoring, profile string) {
+	fetcher := &scapContentDataStream{}
+	if err := fetcher.LoadSource(content); err != nil {
+		FATAL("Error loading source data: %v", err)
+	}
+	if tailoring != "" {
+		if err := fetcher.LoadTailoring(tailoring); err != nil {
+			FATAL("Error loading tailoring data: %v", err)
+		}
+	}
+
+	// The checks are resolved like the collector does, so the listing
+	// matches what a scan of the profile collects
+	chain, err := resolveProfileChain(fetcher.dataStream, fetcher.tailoring, profile)
+	if err != nil {
+		FATAL("Error resolving the checks of profile %s: %v", profile, err)
+	}
+	selections := resolveCheckSelections(chain)
+	nSelected := 0
+	for _, sel := range selections {
+		if sel.selected {
+			nSelected++
+			LOG("%s: selected by %s", sel.id, sel.profile)
+		} else {
+			LOG("%s: unselected by %s", sel.id, sel.profile)
+		}
+	}
+	LOG("%d checks selected, %d unselected", nSelected, len(selections)-nSelected)
+}
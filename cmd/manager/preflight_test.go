@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var _ = Describe("Testing preflight checks", func() {
+	Context("Probing endpoints", func() {
+		It("classifies the response of every distinct endpoint", func() {
+			gr := schema.GroupResource{Group: "some group", Resource: "some resource"}
+			responses := map[string]error{
+				"/version":                     nil,
+				"/api/v1/nodes":                errors.NewForbidden(gr, "", fmt.Errorf("no access")),
+				"/apis/example.io/v1/missing":  errors.NewNotFound(gr, "missing"),
+				"/apis/example.io/v1/timeouts": errors.NewTimeoutError("timed out", 1),
+			}
+			probed := 0
+			probe := func(_ context.Context, uri string) error {
+				probed++
+				return responses[uri]
+			}
+
+			checks := probeEndpoints(context.TODO(), probe, []utils.ResourcePath{
+				{ObjPath: "/version", DumpPath: "/version"},
+				{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+				{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes-filtered", Filter: "."},
+				{ObjPath: "/apis/example.io/v1/missing", DumpPath: "/missing"},
+				{ObjPath: "/apis/example.io/v1/timeouts", DumpPath: "/timeouts"},
+			})
+
+			Expect(probed).To(Equal(4))
+			statuses := map[string]endpointStatus{}
+			for _, check := range checks {
+				statuses[check.uri] = check.status
+			}
+			Expect(statuses).To(Equal(map[string]endpointStatus{
+				"/version":                     endpointOK,
+				"/api/v1/nodes":                endpointForbidden,
+				"/apis/example.io/v1/missing":  endpointNotFound,
+				"/apis/example.io/v1/timeouts": endpointError,
+			}))
+		})
+	})
+
+	Context("Listing the selected checks", func() {
+		parse := func(doc string) *xmlquery.Node {
+			node, err := xmlquery.Parse(strings.NewReader(`<root xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">` +
+				doc + `</root>`))
+			Expect(err).To(BeNil())
+			return node
+		}
+
+		ds := parse(`
+<xccdf-1.2:Profile id="base">
+  <xccdf-1.2:select idref="rule_a" selected="true"/>
+  <xccdf-1.2:select idref="rule_b" selected="true"/>
+  <xccdf-1.2:select idref="rule_c" selected="false"/>
+</xccdf-1.2:Profile>`)
+		tailoring := parse(`
+<xccdf-1.2:Profile id="layer" extends="base">
+  <xccdf-1.2:select idref="rule_b" selected="false"/>
+  <xccdf-1.2:select idref="rule_c" selected="true"/>
+</xccdf-1.2:Profile>
+<xccdf-1.2:Profile id="top" extends="layer">
+  <xccdf-1.2:select idref="rule_a" selected="false"/>
+  <xccdf-1.2:select idref="rule_d" selected="true"/>
+</xccdf-1.2:Profile>
+<xccdf-1.2:Profile id="loop-a" extends="loop-b"/>
+<xccdf-1.2:Profile id="loop-b" extends="loop-a"/>
+<xccdf-1.2:Profile id="dangling" extends="missing"/>`)
+
+		It("merges the selections along the extends chain", func() {
+			chain, err := resolveProfileChain(ds, tailoring, "top")
+			Expect(err).To(BeNil())
+			Expect(resolveCheckSelections(chain)).To(Equal([]checkSelection{
+				{id: "rule_a", selected: false, profile: "top"},
+				{id: "rule_b", selected: false, profile: "layer"},
+				{id: "rule_c", selected: true, profile: "layer"},
+				{id: "rule_d", selected: true, profile: "top"},
+			}))
+		})
+
+		It("resolves the selections of a profile without a tailoring", func() {
+			chain, err := resolveProfileChain(ds, nil, "base")
+			Expect(err).To(BeNil())
+			selections := resolveCheckSelections(chain)
+			Expect(selections).To(HaveLen(3))
+			Expect(selections[0]).To(Equal(checkSelection{id: "rule_a", selected: true, profile: "base"}))
+		})
+
+		It("fails on missing profiles and loops", func() {
+			_, err := resolveProfileChain(ds, tailoring, "dangling")
+			Expect(err).To(MatchError(ContainSubstring("extends profile missing, which was not found")))
+			_, err = resolveProfileChain(ds, tailoring, "loop-a")
+			Expect(err).To(MatchError(ContainSubstring("in a loop")))
+		})
+	})
+})
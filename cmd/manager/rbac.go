@@ -0,0 +1,220 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"flag"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var RBACCmd = &cobra.Command{
+	Use:   "rbac",
+	Short: "Suggests the ClusterRole the collector needs for a profile.",
+	Long: "Resolves the resources a profile would collect and prints a ClusterRole that only " +
+		"allows reading those, including the node proxy used to fetch the KubeletConfigs and the " +
+		"cluster objects that are always collected.",
+	Run: runRBAC,
+}
+
+func init() {
+	defineRBACFlags(RBACCmd)
+}
+
+const defaultRBACRoleName = "api-resource-collector"
+
+// The verbs the collector fetches a collection or a single object with
+var (
+	collectionVerbs = []string{"list"}
+	objectVerbs     = []string{"get"}
+)
+
+func defineRBACFlags(cmd *cobra.Command) {
+	cmd.Flags().String("content", "", "The path to the OpenSCAP content file.")
+	cmd.Flags().String("tailoring", "", "The path to the OpenSCAP tailoring file.")
+	cmd.Flags().String("profile", "", "The scan profile.")
+	cmd.Flags().String("name", defaultRBACRoleName, "The name of the ClusterRole.")
+	cmd.Flags().Bool("skip-kubelet-config", false, "Don't allow fetching the KubeletConfigs of the nodes, "+
+		"for collectors run with --skip-kubelet-config.")
+	cmd.Flags().Bool("debug", false, "Print debug messages.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func runRBAC(cmd *cobra.Command, args []string) {
+	content := getValidStringArg(cmd, "content")
+	profile := getValidStringArg(cmd, "profile")
+	tailoring, _ := cmd.Flags().GetString("tailoring")
+	name, _ := cmd.Flags().GetString("name")
+	skipKubeletConfig, _ := cmd.Flags().GetBool("skip-kubelet-config")
+	debugLog, _ = cmd.Flags().GetBool("debug")
+	// The role is written to stdout, so everything else is logged to stderr
+	out := os.Stdout
+	logOut = os.Stderr
+
+	// The nodes aren't known without contacting the cluster, so the node
+	// proxy is allowed for all of them below instead
+	resources, err := resolveProfileResources(content, tailoring, profile)
+	if err != nil {
+		FATAL("Error %v", err)
+	}
+
+	role := &rbacv1.ClusterRole{}
+	role.SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"))
+	role.Name = name
+	role.Rules = policyRulesForResources(resources, !skipKubeletConfig)
+	data, err := yaml.Marshal(role)
+	if err != nil {
+		FATAL("Error encoding the ClusterRole: %v", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		FATAL("Error writing the ClusterRole: %v", err)
+	}
+}
+
+type apiResource struct {
+	group    string
+	resource string
+}
+
+// resourceAccess is what is read of a resource: the whole collection, or
+// only the objects named
+type resourceAccess struct {
+	collection bool
+	anyObject  bool
+	names      map[string]bool
+}
+
+// policyRulesForResources returns the rules allowing to fetch exactly the
+// resources, sorted by group and resource. Lists are allowed cluster-wide
+// even for namespaced resources, since a ClusterRole can't be limited to
+// some namespaces; single objects are only allowed by name.
+func policyRulesForResources(resources []utils.ResourcePath, nodeProxy bool) []rbacv1.PolicyRule {
+	accesses := map[apiResource]*resourceAccess{}
+	nonResourceURLs := map[string]bool{}
+	access := func(res apiResource) *resourceAccess {
+		if accesses[res] == nil {
+			accesses[res] = &resourceAccess{names: map[string]bool{}}
+		}
+		return accesses[res]
+	}
+	for _, rpath := range resources {
+		res, name, ok := parseResourceURI(rpath.ObjPath)
+		if !ok {
+			nonResourceURLs[strings.SplitN(rpath.ObjPath, "?", 2)[0]] = true
+			continue
+		}
+		if name == "" {
+			access(res).collection = true
+		} else {
+			access(res).names[name] = true
+		}
+	}
+	if nodeProxy {
+		// The KubeletConfigs are fetched from the configz endpoint of every
+		// node whose role is discovered by listing the nodes
+		access(apiResource{resource: "nodes"}).collection = true
+		access(apiResource{resource: "nodes/proxy"}).anyObject = true
+	}
+
+	sorted := make([]apiResource, 0, len(accesses))
+	for res := range accesses {
+		sorted = append(sorted, res)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].group != sorted[j].group {
+			return sorted[i].group < sorted[j].group
+		}
+		return sorted[i].resource < sorted[j].resource
+	})
+
+	rules := []rbacv1.PolicyRule{}
+	for _, res := range sorted {
+		acc := accesses[res]
+		rule := rbacv1.PolicyRule{APIGroups: []string{res.group}, Resources: []string{res.resource}}
+		if acc.collection {
+			listRule := rule
+			listRule.Verbs = collectionVerbs
+			rules = append(rules, listRule)
+		}
+		if acc.anyObject {
+			rule.Verbs = objectVerbs
+			rules = append(rules, rule)
+		} else if len(acc.names) > 0 {
+			rule.Verbs = objectVerbs
+			for name := range acc.names {
+				rule.ResourceNames = append(rule.ResourceNames, name)
+			}
+			sort.Strings(rule.ResourceNames)
+			rules = append(rules, rule)
+		}
+	}
+	if len(nonResourceURLs) > 0 {
+		rule := rbacv1.PolicyRule{Verbs: objectVerbs}
+		for url := range nonResourceURLs {
+			rule.NonResourceURLs = append(rule.NonResourceURLs, url)
+		}
+		sort.Strings(rule.NonResourceURLs)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseResourceURI returns the resource an API URI points to, and the name
+// of the object if it points to a single one. Subresources are returned the
+// way RBAC names them, e.g. nodes/proxy. It returns false for the URIs
+// outside of the resource API, like /version.
+func parseResourceURI(uri string) (apiResource, string, bool) {
+	path := strings.Trim(strings.SplitN(uri, "?", 2)[0], "/")
+	segments := strings.Split(path, "/")
+	var res apiResource
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		res.group = segments[1]
+		segments = segments[3:]
+	default:
+		return res, "", false
+	}
+	// Namespaced resources, but not the namespaces themselves
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		segments = segments[2:]
+	}
+	res.resource = segments[0]
+	switch len(segments) {
+	case 1:
+		return res, "", true
+	case 2:
+		return res, segments[1], true
+	default:
+		// Anything below a subresource, like the configz endpoint of the
+		// node proxy, is allowed by the subresource
+		res.resource += "/" + segments[2]
+		return res, segments[1], true
+	}
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+)
+
+var _ = Describe("Testing the suggested RBAC", func() {
+	Context("Parsing the resource URIs", func() {
+		It("Finds the resource and object of API URIs", func() {
+			for uri, expected := range map[string]struct {
+				res  apiResource
+				name string
+			}{
+				"/api/v1/nodes":                                       {apiResource{resource: "nodes"}, ""},
+				"/api/v1/nodes?labelSelector=a%3Db":                   {apiResource{resource: "nodes"}, ""},
+				"/api/v1/namespaces":                                  {apiResource{resource: "namespaces"}, ""},
+				"/api/v1/namespaces/openshift-etcd":                   {apiResource{resource: "namespaces"}, "openshift-etcd"},
+				"/api/v1/namespaces/openshift-etcd/configmaps":        {apiResource{resource: "configmaps"}, ""},
+				"/api/v1/namespaces/openshift-etcd/configmaps/config": {apiResource{resource: "configmaps"}, "config"},
+				"/api/v1/nodes/worker-0/proxy/configz":                {apiResource{resource: "nodes/proxy"}, "worker-0"},
+				"/apis/config.openshift.io/v1/networks/cluster": {
+					apiResource{group: "config.openshift.io", resource: "networks"}, "cluster"},
+			} {
+				res, name, ok := parseResourceURI(uri)
+				Expect(ok).To(BeTrue(), uri)
+				Expect(res).To(Equal(expected.res), uri)
+				Expect(name).To(Equal(expected.name), uri)
+			}
+		})
+
+		It("Leaves out the URIs outside of the resource API", func() {
+			for _, uri := range []string{"/version", "/healthz", "/api/v1"} {
+				_, _, ok := parseResourceURI(uri)
+				Expect(ok).To(BeFalse(), uri)
+			}
+		})
+	})
+
+	It("Only allows fetching the resources", func() {
+		rules := policyRulesForResources([]utils.ResourcePath{
+			{ObjPath: "/version", DumpPath: "/version"},
+			{ObjPath: "/apis/config.openshift.io/v1/networks/cluster", DumpPath: "/networks"},
+			{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+			{ObjPath: "/api/v1/nodes?labelSelector=a%3Db", DumpPath: "/api/v1/nodes"},
+			{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/b", DumpPath: "/b"},
+			{ObjPath: "/api/v1/namespaces/openshift-kube-apiserver/configmaps/a", DumpPath: "/a"},
+			{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/b", DumpPath: "/b-filtered", Filter: "."},
+		}, true)
+		Expect(rules).To(Equal([]rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"},
+				ResourceNames: []string{"a", "b"}},
+			{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}},
+			{APIGroups: []string{""}, Resources: []string{"nodes/proxy"}, Verbs: []string{"get"}},
+			{APIGroups: []string{"config.openshift.io"}, Resources: []string{"networks"}, Verbs: []string{"get"},
+				ResourceNames: []string{"cluster"}},
+			{NonResourceURLs: []string{"/version"}, Verbs: []string{"get"}},
+		}))
+	})
+
+	It("Doesn't allow the node proxy when the KubeletConfigs are skipped", func() {
+		rules := policyRulesForResources([]utils.ResourcePath{
+			{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+		}, false)
+		Expect(rules).To(Equal([]rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}},
+		}))
+	})
+
+	It("Covers the cluster objects that are always collected", func() {
+		fetcher := &scapContentDataStream{skipKubeletConfig: true}
+		Expect(fetcher.LoadSource("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")).To(Succeed())
+		Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+		rules := policyRulesForResources(fetcher.resources, true)
+		Expect(rules).To(ContainElement(rbacv1.PolicyRule{APIGroups: []string{"config.openshift.io"},
+			Resources: []string{"clusteroperators"}, Verbs: []string{"get"}, ResourceNames: []string{"openshift-apiserver"}}))
+		Expect(rules).To(ContainElement(rbacv1.PolicyRule{NonResourceURLs: []string{"/version"}, Verbs: []string{"get"}}))
+		Expect(len(rules)).To(BeNumerically(">", 5))
+	})
+})
@@ -70,7 +70,10 @@ type scapresultsConfig struct {
 	ExitCodeFile       string
 	CmdOutputFile      string
 	WarningsOutputFile string
+	MetadataArchive    string
 	ScanName           string
+	ScanUID            string
+	ScanIndex          string
 	ConfigMapName      string
 	NodeName           string
 	Namespace          string
@@ -87,7 +90,11 @@ func defineResultcollectorFlags(cmd *cobra.Command) {
 	cmd.Flags().String("exit-code-file", "", "A file containing the oscap command's exit code.")
 	cmd.Flags().String("oscap-output-file", "", "A file containing the oscap command's output.")
 	cmd.Flags().String("warnings-output-file", "", "A file containing the warnings to output.")
+	cmd.Flags().String("metadata-archive-file", "", "An archive with the resource collector's metadata to upload.")
 	cmd.Flags().String("owner", "", "The compliance scan that owns the configMap objects.")
+	cmd.Flags().String("scan-uid", "", "The UID of the compliance scan. Along with --scan-index, it makes up "+
+		"the idempotency keys of the uploads to the resultserver, so a retried upload isn't stored twice.")
+	cmd.Flags().String("scan-index", "", "The current index of the scan.")
 	cmd.Flags().String("config-map-name", "", "The configMap to upload to, typically the podname.")
 	cmd.Flags().String("node-name", "", "The node that was scanned.")
 	cmd.Flags().String("namespace", "openshift-compliance", "Running pod namespace.")
@@ -111,6 +118,8 @@ func parseConfig(cmd *cobra.Command) *scapresultsConfig {
 	conf.ExitCodeFile = getValidStringArg(cmd, "exit-code-file")
 	conf.CmdOutputFile = getValidStringArg(cmd, "oscap-output-file")
 	conf.ScanName = getValidStringArg(cmd, "owner")
+	conf.ScanUID, _ = cmd.Flags().GetString("scan-uid")
+	conf.ScanIndex, _ = cmd.Flags().GetString("scan-index")
 	conf.ConfigMapName = getValidStringArg(cmd, "config-map-name")
 	conf.Namespace = getValidStringArg(cmd, "namespace")
 	conf.Cert = getValidStringArg(cmd, "tls-client-cert")
@@ -123,6 +132,7 @@ func parseConfig(cmd *cobra.Command) *scapresultsConfig {
 		conf.ResultServerURI = "http://" + conf.ScanName + "-rs:8080/"
 	}
 	conf.WarningsOutputFile, _ = cmd.Flags().GetString("warnings-output-file")
+	conf.MetadataArchive, _ = cmd.Flags().GetString("metadata-archive-file")
 
 	// platform scans have no node name
 	conf.NodeName, _ = cmd.Flags().GetString("node-name")
@@ -296,6 +306,16 @@ func readWarningsFile(filename string) string {
 	return strings.Trim(string(contents), "\n")
 }
 
+// uploadIdempotencyKey returns the key of the upload of the report to the
+// result server, which is the same for all the retries of the upload during
+// a run of the scan. It's empty if the scan's UID isn't known.
+func uploadIdempotencyKey(scapresultsconf *scapresultsConfig, reportName string) string {
+	if scapresultsconf.ScanUID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s", scapresultsconf.ScanUID, scapresultsconf.ScanIndex, reportName)
+}
+
 func uploadToResultServer(arfContents *resultFileContents, scapresultsconf *scapresultsConfig) error {
 	return backoff.Retry(func() error {
 		url := scapresultsconf.ResultServerURI
@@ -309,6 +329,9 @@ func uploadToResultServer(arfContents *resultFileContents, scapresultsconf *scap
 		req, _ := http.NewRequest("POST", url, arfContents.contents)
 		req.Header.Add("Content-Type", "application/xml")
 		req.Header.Add("X-Report-Name", scapresultsconf.ConfigMapName)
+		if key := uploadIdempotencyKey(scapresultsconf, scapresultsconf.ConfigMapName); key != "" {
+			req.Header.Add(idempotencyKeyHeader, key)
+		}
 		if arfContents.compressed {
 			req.Header.Add("Content-Encoding", "bzip2")
 		}
@@ -324,6 +347,51 @@ func uploadToResultServer(arfContents *resultFileContents, scapresultsconf *scap
 			return err
 		}
 		cmdLog.Info(string(bytesresp))
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("result server rejected the results: %s", resp.Status)
+		}
+		return nil
+	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries))
+}
+
+// uploadMetadataArchive uploads the resource collector's metadata archive
+// to the result server next to the ARF report. Only platform scans produce
+// the archive, so a missing file is not an error.
+func uploadMetadataArchive(scapresultsconf *scapresultsConfig) error {
+	if scapresultsconf.MetadataArchive == "" {
+		return nil
+	}
+	contents, err := ioutil.ReadFile(filepath.Clean(scapresultsconf.MetadataArchive))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return backoff.Retry(func() error {
+		url := scapresultsconf.ResultServerURI
+		cmdLog.Info("Trying to upload metadata archive to resultserver", "url", url)
+		transport, err := getMutualHttpsTransport(scapresultsconf)
+		if err != nil {
+			cmdLog.Error(err, "Failed to get https transport")
+			return err
+		}
+		client := &http.Client{Transport: transport}
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(contents))
+		req.Header.Add("Content-Type", metadataArchiveContentType)
+		req.Header.Add("X-Report-Name", scapresultsconf.ConfigMapName+"-metadata")
+		if key := uploadIdempotencyKey(scapresultsconf, scapresultsconf.ConfigMapName+"-metadata"); key != "" {
+			req.Header.Add(idempotencyKeyHeader, key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			cmdLog.Error(err, "Failed to upload metadata archive to server")
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("result server rejected the metadata archive: %s", resp.Status)
+		}
 		return nil
 	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), maxRetries))
 }
@@ -487,6 +555,12 @@ func resultCollectorMain(cmd *cobra.Command, args []string) {
 	exitcode := getOscapExitCode(scapresultsconf)
 	cmdLog.Info("Got exit-code from file", "exit-code", exitcode)
 
+	// The collector is done by the time the scanner wrote its exit code
+	if err := uploadMetadataArchive(scapresultsconf); err != nil {
+		cmdLog.Error(err, "Failed to upload metadata archive")
+		os.Exit(1)
+	}
+
 	if exitCodeIsError(exitcode) {
 		handleErrorInOscapRun(exitcode, scapresultsconf, crclient)
 		return
@@ -29,16 +29,23 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	libgocrypto "github.com/openshift/library-go/pkg/crypto"
 
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
 	utils "github.com/ComplianceAsCode/compliance-operator/pkg/utils"
 )
 
@@ -61,6 +68,7 @@ func defineResultServerFlags(cmd *cobra.Command) {
 	cmd.Flags().String("path", "/", "Content path")
 	cmd.Flags().String("owner", "", "Object owner")
 	cmd.Flags().String("scan-index", "", "The current index of the scan")
+	cmd.Flags().String("scan", "", "The name of the scan, on which the deduplicated uploads are recorded")
 	cmd.Flags().String("tls-server-cert", "", "Path to the server cert")
 	cmd.Flags().String("tls-server-key", "", "Path to the server key")
 	cmd.Flags().String("tls-ca", "", "Path to the CA certificate")
@@ -82,12 +90,14 @@ type resultServerConfig struct {
 	Key      string
 	CA       string
 	Rotation uint16
+	ScanName string
 }
 
 func parseResultServerConfig(cmd *cobra.Command) *resultServerConfig {
 	basePath := getValidStringArg(cmd, "path")
 	index := getValidStringArg(cmd, "scan-index")
 	rotation, _ := cmd.Flags().GetUint16("rotation")
+	scanName, _ := cmd.Flags().GetString("scan")
 	conf := &resultServerConfig{
 		Address:  getValidStringArg(cmd, "address"),
 		Port:     getValidStringArg(cmd, "port"),
@@ -97,6 +107,7 @@ func parseResultServerConfig(cmd *cobra.Command) *resultServerConfig {
 		Key:      getValidStringArg(cmd, "tls-server-key"),
 		CA:       getValidStringArg(cmd, "tls-ca"),
 		Rotation: rotation,
+		ScanName: scanName,
 	}
 
 	logf.SetLogger(zap.New())
@@ -170,40 +181,92 @@ func rotateResultDirectories(rootPath string, rotation uint16) error {
 	return lastError
 }
 
-func server(c *resultServerConfig) {
-	exit := make(chan os.Signal, 1)
-	signal.Notify(exit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+// The header holding the key of an upload, which its retries send again so
+// the server only stores it once
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// uploadRecord keeps the keys of the uploads the server stored or is
+// storing, and counts the retries of those it already stored
+type uploadRecord struct {
+	mu sync.Mutex
+	// Whether the upload of each key was stored. Those being stored are
+	// false, those that failed are forgotten so they can be retried.
+	stored map[string]bool
+
+	reportMu     sync.Mutex
+	deduplicated int
+	// Records the number of deduplicated uploads so far, if set
+	report func(count int)
+}
 
-	err := ensureDir(c.Path)
-	if err != nil {
-		cmdLog.Error(err, "Error ensuring result path: %s", c.Path)
-		os.Exit(1)
+func newUploadRecord(report func(count int)) *uploadRecord {
+	return &uploadRecord{
+		stored: map[string]bool{},
+		report: report,
 	}
+}
 
-	rotateResultDirectories(c.BasePath, c.Rotation)
+// deduplicate counts a retry of an upload already stored, and reports the
+// number counted so far
+func (u *uploadRecord) deduplicate() {
+	u.reportMu.Lock()
+	defer u.reportMu.Unlock()
+	u.deduplicated++
+	if u.report != nil {
+		u.report(u.deduplicated)
+	}
+}
 
-	caCert, err := ioutil.ReadFile(c.CA)
-	if err != nil {
-		cmdLog.Error(err, "Error reading CA file")
-		os.Exit(1)
+// begin records that the upload of key is being stored, unless it already
+// was or is being stored. Uploads without a key are always stored.
+func (u *uploadRecord) begin(key string) (stored, inProgress bool) {
+	if key == "" {
+		return false, false
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if stored, ok := u.stored[key]; ok {
+		return stored, !stored
+	}
+	u.stored[key] = false
+	return false, false
+}
 
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+// finish records whether the upload of key was stored
+func (u *uploadRecord) finish(key string, stored bool) {
+	if key == "" {
+		return
 	}
-	// Configures TLS 1.2
-	tlsConfig = libgocrypto.SecureTLSConfig(tlsConfig)
-	tlsConfig.ClientCAs = caCertPool
-	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	tlsConfig.BuildNameToCertificate()
-	server := &http.Server{
-		Addr:      c.Address + ":" + c.Port,
-		TLSConfig: tlsConfig,
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if stored {
+		u.stored[key] = true
+	} else {
+		delete(u.stored, key)
 	}
+}
+
+// newResultUploadHandler stores the uploaded reports under dir. A retry of
+// an upload already stored gets the same response again without the report
+// being stored twice.
+func newResultUploadHandler(dir string, uploads *uploadRecord) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		stored, inProgress := uploads.begin(key)
+		if stored {
+			cmdLog.Info("Upload already stored", "idempotency-key", key)
+			uploads.deduplicate()
+			return
+		} else if inProgress {
+			cmdLog.Info("Rejecting. The upload is already being stored.", "idempotency-key", key)
+			http.Error(w, "upload in progress", http.StatusConflict)
+			return
+		}
+		succeeded := false
+		defer func() {
+			uploads.finish(key, succeeded)
+		}()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		filename := r.Header.Get("X-Report-Name")
 		if filename == "" {
 			cmdLog.Info("Rejecting. No \"X-Report-Name\" header given.")
@@ -220,7 +283,10 @@ func server(c *resultServerConfig) {
 			extraExtension = "." + extraExtension
 		}
 		// TODO(jaosorior): Check that content-type is application/xml
-		filePath := path.Join(c.Path, filename+".xml"+extraExtension)
+		filePath := path.Join(dir, filename+".xml"+extraExtension)
+		if r.Header.Get("Content-Type") == metadataArchiveContentType {
+			filePath = path.Join(dir, filename+".tar.gz")
+		}
 		cleanPath := filepath.Clean(filePath)
 		f, err := os.Create(cleanPath)
 		if err != nil {
@@ -237,8 +303,87 @@ func server(c *resultServerConfig) {
 			http.Error(w, "Error writing file", 500)
 			return
 		}
+		succeeded = true
 		cmdLog.Info("Received file", "file-path", cleanPath)
+	}
+}
+
+// deduplicatedUploadsReporter returns a function recording the number of
+// deduplicated uploads on the scan, for the operator to expose as a metric
+// once the scan is done. The number of the previous run is reset. Nothing
+// is recorded without a scan.
+func deduplicatedUploadsReporter(scanName string) func(count int) {
+	if scanName == "" {
+		return nil
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		cmdLog.Error(err, "Error getting kube cfg")
+		os.Exit(1)
+	}
+	client, err := getApiCollectorClient(cfg, getScheme())
+	if err != nil {
+		cmdLog.Error(err, "Error building the runtime client")
+		os.Exit(1)
+	}
+	key := types.NamespacedName{Name: scanName, Namespace: common.GetComplianceOperatorNamespace()}
+	report := func(count int) {
+		// Not being able to record them shouldn't fail the uploads
+		if err := annotateDeduplicatedUploads(context.TODO(), client, key, count); err != nil {
+			cmdLog.Error(err, "Couldn't record the deduplicated uploads", "scan", key)
+		}
+	}
+	report(0)
+	return report
+}
+
+// annotateDeduplicatedUploads records the number of deduplicated uploads in
+// an annotation of the given ComplianceScan
+func annotateDeduplicatedUploads(ctx context.Context, client runtimeclient.Client, key types.NamespacedName, count int) error {
+	scan := &compv1alpha1.ComplianceScan{}
+	if err := client.Get(ctx, key, scan); err != nil {
+		return err
+	}
+	return patchScanAnnotations(ctx, client, scan, map[string]string{
+		compv1alpha1.ComplianceScanDeduplicatedUploadsAnnotation: strconv.Itoa(count),
 	})
+}
+
+func server(c *resultServerConfig) {
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	err := ensureDir(c.Path)
+	if err != nil {
+		cmdLog.Error(err, "Error ensuring result path: %s", c.Path)
+		os.Exit(1)
+	}
+
+	rotateResultDirectories(c.BasePath, c.Rotation)
+
+	caCert, err := ioutil.ReadFile(c.CA)
+	if err != nil {
+		cmdLog.Error(err, "Error reading CA file")
+		os.Exit(1)
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	// Configures TLS 1.2
+	tlsConfig = libgocrypto.SecureTLSConfig(tlsConfig)
+	tlsConfig.ClientCAs = caCertPool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.BuildNameToCertificate()
+	server := &http.Server{
+		Addr:      c.Address + ":" + c.Port,
+		TLSConfig: tlsConfig,
+	}
+
+	uploads := newUploadRecord(deduplicatedUploadsReporter(c.ScanName))
+	http.HandleFunc("/", newResultUploadHandler(c.Path, uploads))
 
 	cmdLog.Info("Listening...")
 
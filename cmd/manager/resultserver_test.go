@@ -16,13 +16,22 @@ limitations under the License.
 package manager
 
 import (
+	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 )
 
 func _readDirNames(path string) []string {
@@ -168,4 +177,102 @@ var _ = Describe("Resultserver testing", func() {
 			Expect(lostFoundDir).To(BeADirectory())
 		})
 	})
+
+	Context("Retried uploads", func() {
+		var (
+			dir      string
+			uploads  *uploadRecord
+			handler  http.HandlerFunc
+			reported []int
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "uploads")
+			Expect(err).To(BeNil())
+			reported = nil
+			uploads = newUploadRecord(func(count int) {
+				reported = append(reported, count)
+			})
+			handler = newResultUploadHandler(dir, uploads)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		upload := func(key, body string) int {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set("X-Report-Name", "scan-pod")
+			if key != "" {
+				req.Header.Set(idempotencyKeyHeader, key)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			return rec.Code
+		}
+
+		It("Only stores an upload once per key", func() {
+			Expect(upload("uid/1/scan-pod", "first")).To(Equal(http.StatusOK))
+			Expect(upload("uid/1/scan-pod", "retry")).To(Equal(http.StatusOK))
+			stored, err := ioutil.ReadFile(path.Join(dir, "scan-pod.xml"))
+			Expect(err).To(BeNil())
+			Expect(string(stored)).To(Equal("first"))
+
+			By("storing the upload of the next run of the scan")
+			Expect(upload("uid/2/scan-pod", "second")).To(Equal(http.StatusOK))
+			stored, err = ioutil.ReadFile(path.Join(dir, "scan-pod.xml"))
+			Expect(err).To(BeNil())
+			Expect(string(stored)).To(Equal("second"))
+
+			By("reporting the deduplicated uploads")
+			Expect(reported).To(Equal([]int{1}))
+		})
+
+		It("Records the deduplicated uploads on the scan", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-scan", Namespace: "openshift-compliance"},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+			Expect(annotateDeduplicatedUploads(context.TODO(), client, key, 2)).To(Succeed())
+
+			Expect(client.Get(context.TODO(), key, scan)).To(Succeed())
+			count, ok := scan.GetDeduplicatedUploads()
+			Expect(ok).To(BeTrue())
+			Expect(count).To(Equal(2))
+		})
+
+		It("Always stores the uploads without a key", func() {
+			Expect(upload("", "first")).To(Equal(http.StatusOK))
+			Expect(upload("", "retry")).To(Equal(http.StatusOK))
+			stored, err := ioutil.ReadFile(path.Join(dir, "scan-pod.xml"))
+			Expect(err).To(BeNil())
+			Expect(string(stored)).To(Equal("retry"))
+		})
+
+		It("Lets a failed upload be retried", func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("first"))
+			req.Header.Set(idempotencyKeyHeader, "uid/1/scan-pod")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(upload("uid/1/scan-pod", "retry")).To(Equal(http.StatusOK))
+		})
+
+		It("Rejects a retry while the upload is being stored", func() {
+			stored, inProgress := uploads.begin("uid/1/scan-pod")
+			Expect(stored).To(BeFalse())
+			Expect(inProgress).To(BeFalse())
+			Expect(upload("uid/1/scan-pod", "retry")).To(Equal(http.StatusConflict))
+			uploads.finish("uid/1/scan-pod", true)
+			Expect(upload("uid/1/scan-pod", "retry")).To(Equal(http.StatusOK))
+		})
+
+		It("Keys the uploads by the scan's run", func() {
+			conf := &scapresultsConfig{ScanUID: "uid", ScanIndex: "3"}
+			Expect(uploadIdempotencyKey(conf, "scan-pod")).To(Equal("uid/3/scan-pod"))
+			Expect(uploadIdempotencyKey(&scapresultsConfig{}, "scan-pod")).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,302 @@
+/*
+Copyright © 2020 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
+)
+
+var SarifCmd = &cobra.Command{
+	Use:   "sarif",
+	Short: "Exports ComplianceCheckResults as a SARIF report.",
+	Long: "Converts the ComplianceCheckResult objects of a scan or a suite into a " +
+		"SARIF 2.1.0 report, so they can be consumed by code scanning dashboards.",
+	Run: runSarif,
+}
+
+func init() {
+	defineSarifFlags(SarifCmd)
+}
+
+const (
+	sarifVersion   = "2.1.0"
+	sarifSchema    = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName  = "compliance-operator"
+	sarifToolURI   = "https://github.com/ComplianceAsCode/compliance-operator"
+	sarifLevelNone = "none"
+)
+
+// The SARIF types only cover the subset of the specification the report uses
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name,omitempty"`
+	ShortDescription     *sarifMessage          `json:"shortDescription,omitempty"`
+	FullDescription      *sarifMessage          `json:"fullDescription,omitempty"`
+	Help                 *sarifMessage          `json:"help,omitempty"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string                 `json:"ruleId"`
+	RuleIndex        int                    `json:"ruleIndex"`
+	Kind             string                 `json:"kind"`
+	Level            string                 `json:"level"`
+	Message          sarifMessage           `json:"message"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+func defineSarifFlags(cmd *cobra.Command) {
+	cmd.Flags().String("namespace", common.GetComplianceOperatorNamespace(), "The namespace of the results.")
+	cmd.Flags().String("scan", "", "Only export the results of this ComplianceScan.")
+	cmd.Flags().String("suite", "", "Only export the results of this ComplianceSuite.")
+	cmd.Flags().String("output", "", "The file to write the report to. Defaults to stdout.")
+
+	flags := cmd.Flags()
+
+	// Add flags registered by imported packages (e.g. glog and
+	// controller-runtime)
+	flags.AddGoFlagSet(flag.CommandLine)
+}
+
+func runSarif(cmd *cobra.Command, args []string) {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	scan, _ := cmd.Flags().GetString("scan")
+	suite, _ := cmd.Flags().GetString("suite")
+	output, _ := cmd.Flags().GetString("output")
+
+	crclient, err := createCrClient(getConfig())
+	if err != nil {
+		FATAL("Error building client: %v", err)
+	}
+
+	labels := runtimeclient.MatchingLabels{}
+	if scan != "" {
+		labels[compv1alpha1.ComplianceScanLabel] = scan
+	}
+	if suite != "" {
+		labels[compv1alpha1.SuiteLabel] = suite
+	}
+	results := &compv1alpha1.ComplianceCheckResultList{}
+	if err := crclient.getClient().List(context.TODO(), results, runtimeclient.InNamespace(namespace), labels); err != nil {
+		FATAL("Error listing ComplianceCheckResults: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			FATAL("Error creating the output file: %v", err)
+		}
+		// #nosec
+		defer f.Close()
+		out = f
+	}
+	if err := writeSarif(out, checkResultsToSarif(results.Items)); err != nil {
+		FATAL("Error writing the SARIF report: %v", err)
+	}
+}
+
+func writeSarif(out io.Writer, log *sarifLog) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// checkResultsToSarif converts the results into a SARIF log with a single
+// run. Results of the same rule, e.g. from scans of different node roles,
+// share one SARIF rule. The results are sorted by check ID, and those of the
+// same check by name, which tells their scans apart.
+func checkResultsToSarif(checks []compv1alpha1.ComplianceCheckResult) *sarifLog {
+	sorted := make([]compv1alpha1.ComplianceCheckResult, len(checks))
+	copy(sorted, checks)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           sarifToolName,
+				InformationURI: sarifToolURI,
+				Rules:          []sarifRule{},
+			},
+		},
+		Results: []sarifResult{},
+	}
+	ruleIndexes := map[string]int{}
+
+	for i := range sorted {
+		check := &sorted[i]
+		idx, ok := ruleIndexes[check.ID]
+		if !ok {
+			idx = len(run.Tool.Driver.Rules)
+			ruleIndexes[check.ID] = idx
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, checkResultToSarifRule(check))
+		}
+
+		kind, level := sarifKindAndLevel(check)
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    check.ID,
+			RuleIndex: idx,
+			Kind:      kind,
+			Level:     level,
+			Message: sarifMessage{
+				Text: fmt.Sprintf("%s: %s", check.Status, sarifShortDescription(check)),
+			},
+			LogicalLocations: []sarifLogicalLocation{
+				{
+					Name:               check.Name,
+					FullyQualifiedName: check.Namespace + "/" + check.Name,
+					Kind:               "resource",
+				},
+			},
+			Properties: map[string]interface{}{
+				"status":   string(check.Status),
+				"severity": string(check.Severity),
+				"scan":     check.Labels[compv1alpha1.ComplianceScanLabel],
+			},
+		})
+	}
+
+	return &sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	}
+}
+
+func checkResultToSarifRule(check *compv1alpha1.ComplianceCheckResult) sarifRule {
+	rule := sarifRule{
+		ID:   check.ID,
+		Name: check.Annotations[compv1alpha1.ComplianceCheckResultRuleAnnotation],
+		DefaultConfiguration: sarifConfiguration{
+			Level: sarifSeverityLevel(check.Severity),
+		},
+		Properties: map[string]interface{}{
+			"severity": string(check.Severity),
+		},
+	}
+	if desc := sarifShortDescription(check); desc != "" {
+		rule.ShortDescription = &sarifMessage{Text: desc}
+	}
+	if check.Description != "" {
+		rule.FullDescription = &sarifMessage{Text: check.Description}
+	}
+	if check.Instructions != "" {
+		rule.Help = &sarifMessage{Text: check.Instructions}
+	}
+	// Code scanning dashboards rank findings by this score
+	if score, ok := sarifSecuritySeverity[check.Severity]; ok {
+		rule.Properties["security-severity"] = score
+	}
+	return rule
+}
+
+// The description starts with the rule title on its own line
+func sarifShortDescription(check *compv1alpha1.ComplianceCheckResult) string {
+	return strings.TrimSpace(strings.SplitN(check.Description, "\n", 2)[0])
+}
+
+var sarifSecuritySeverity = map[compv1alpha1.ComplianceCheckResultSeverity]string{
+	compv1alpha1.CheckResultSeverityCritical: "9.5",
+	compv1alpha1.CheckResultSeverityHigh:     "8.0",
+	compv1alpha1.CheckResultSeverityMedium:   "5.5",
+	compv1alpha1.CheckResultSeverityLow:      "2.0",
+}
+
+func sarifSeverityLevel(severity compv1alpha1.ComplianceCheckResultSeverity) string {
+	switch {
+	case severity.IsMoreSevereThan(compv1alpha1.CheckResultSeverityMedium):
+		return "error"
+	case severity.IsMoreSevereThan(compv1alpha1.CheckResultSeverityLow):
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifKindAndLevel maps the check status to a SARIF result kind. SARIF
+// only allows a level other than "none" for failures.
+func sarifKindAndLevel(check *compv1alpha1.ComplianceCheckResult) (string, string) {
+	switch check.Status {
+	case compv1alpha1.CheckResultFail:
+		return "fail", sarifSeverityLevel(check.Severity)
+	case compv1alpha1.CheckResultPass:
+		return "pass", sarifLevelNone
+	case compv1alpha1.CheckResultInfo:
+		return "informational", sarifLevelNone
+	case compv1alpha1.CheckResultNotApplicable:
+		return "notApplicable", sarifLevelNone
+	case compv1alpha1.CheckResultManual, compv1alpha1.CheckResultInconsistent:
+		return "review", sarifLevelNone
+	default:
+		// Errors and unknown statuses couldn't be determined
+		return "open", sarifLevelNone
+	}
+}
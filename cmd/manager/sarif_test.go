@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+)
+
+func newSarifTestCheck(name, scan string, status compv1alpha1.ComplianceCheckStatus) compv1alpha1.ComplianceCheckResult {
+	return compv1alpha1.ComplianceCheckResult{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openshift-compliance",
+			Labels: map[string]string{
+				compv1alpha1.ComplianceScanLabel: scan,
+			},
+			Annotations: map[string]string{
+				compv1alpha1.ComplianceCheckResultRuleAnnotation: "kubelet-anonymous-auth",
+			},
+		},
+		ID:           "xccdf_org.ssgproject.content_rule_kubelet_anonymous_auth",
+		Status:       status,
+		Severity:     compv1alpha1.CheckResultSeverityHigh,
+		Description:  "Disable anonymous authentication\nAnonymous requests shouldn't be served.",
+		Instructions: "Check the kubelet configuration.",
+	}
+}
+
+var _ = Describe("Testing the SARIF export", func() {
+	It("shares one rule between the results of the same check", func() {
+		log := checkResultsToSarif([]compv1alpha1.ComplianceCheckResult{
+			newSarifTestCheck("cis-node-worker-kubelet-anonymous-auth", "cis-node-worker", compv1alpha1.CheckResultPass),
+			newSarifTestCheck("cis-node-master-kubelet-anonymous-auth", "cis-node-master", compv1alpha1.CheckResultFail),
+		})
+
+		Expect(log.Version).To(Equal("2.1.0"))
+		Expect(log.Runs).To(HaveLen(1))
+		run := log.Runs[0]
+
+		Expect(run.Tool.Driver.Rules).To(HaveLen(1))
+		rule := run.Tool.Driver.Rules[0]
+		Expect(rule.ID).To(Equal("xccdf_org.ssgproject.content_rule_kubelet_anonymous_auth"))
+		Expect(rule.Name).To(Equal("kubelet-anonymous-auth"))
+		Expect(rule.ShortDescription.Text).To(Equal("Disable anonymous authentication"))
+		Expect(rule.Help.Text).To(Equal("Check the kubelet configuration."))
+		Expect(rule.DefaultConfiguration.Level).To(Equal("error"))
+		Expect(rule.Properties).To(HaveKeyWithValue("security-severity", "8.0"))
+
+		// The results of the same check are sorted by name
+		Expect(run.Results).To(HaveLen(2))
+		Expect(run.Results[0].Kind).To(Equal("fail"))
+		Expect(run.Results[0].Level).To(Equal("error"))
+		Expect(run.Results[0].Properties).To(HaveKeyWithValue("scan", "cis-node-master"))
+		Expect(run.Results[1].Kind).To(Equal("pass"))
+		Expect(run.Results[1].Level).To(Equal("none"))
+		for _, result := range run.Results {
+			Expect(result.RuleIndex).To(Equal(0))
+		}
+	})
+
+	It("sorts the results by check ID before their names", func() {
+		audit := newSarifTestCheck("upstream-audit-log-forwarding-enabled", "upstream", compv1alpha1.CheckResultFail)
+		audit.ID = "xccdf_org.ssgproject.content_rule_audit_log_forwarding_enabled"
+		log := checkResultsToSarif([]compv1alpha1.ComplianceCheckResult{
+			newSarifTestCheck("cis-node-worker-kubelet-anonymous-auth", "cis-node-worker", compv1alpha1.CheckResultPass),
+			newSarifTestCheck("cis-node-master-kubelet-anonymous-auth", "cis-node-master", compv1alpha1.CheckResultFail),
+			audit,
+		})
+
+		names := []string{}
+		for _, result := range log.Runs[0].Results {
+			names = append(names, result.LogicalLocations[0].Name)
+		}
+		Expect(names).To(Equal([]string{
+			"upstream-audit-log-forwarding-enabled",
+			"cis-node-master-kubelet-anonymous-auth",
+			"cis-node-worker-kubelet-anonymous-auth",
+		}))
+		Expect(log.Runs[0].Tool.Driver.Rules[0].ID).To(Equal(audit.ID))
+	})
+
+	It("maps the statuses that aren't failures to levelless kinds", func() {
+		expected := map[compv1alpha1.ComplianceCheckStatus]string{
+			compv1alpha1.CheckResultInfo:          "informational",
+			compv1alpha1.CheckResultManual:        "review",
+			compv1alpha1.CheckResultInconsistent:  "review",
+			compv1alpha1.CheckResultNotApplicable: "notApplicable",
+			compv1alpha1.CheckResultError:         "open",
+		}
+		for status, kind := range expected {
+			check := newSarifTestCheck("check", "scan", status)
+			gotKind, gotLevel := sarifKindAndLevel(&check)
+			Expect(gotKind).To(Equal(kind), string(status))
+			Expect(gotLevel).To(Equal("none"), string(status))
+		}
+	})
+
+	It("maps the severities of failures to levels", func() {
+		expected := map[compv1alpha1.ComplianceCheckResultSeverity]string{
+			compv1alpha1.CheckResultSeverityCritical: "error",
+			compv1alpha1.CheckResultSeverityHigh:     "error",
+			compv1alpha1.CheckResultSeverityMedium:   "warning",
+			compv1alpha1.CheckResultSeverityLow:      "note",
+			compv1alpha1.CheckResultSeverityInfo:     "note",
+			compv1alpha1.CheckResultSeverityUnknown:  "note",
+		}
+		for severity, level := range expected {
+			Expect(sarifSeverityLevel(severity)).To(Equal(level), string(severity))
+		}
+	})
+
+	It("writes valid JSON", func() {
+		var buf bytes.Buffer
+		Expect(writeSarif(&buf, checkResultsToSarif(nil))).To(Succeed())
+		parsed := map[string]interface{}{}
+		Expect(json.Unmarshal(buf.Bytes(), &parsed)).To(Succeed())
+		Expect(parsed).To(HaveKeyWithValue("$schema", sarifSchema))
+	})
+})
@@ -16,27 +16,40 @@ limitations under the License.
 package manager
 
 import (
+	"archive/tar"
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	semver "github.com/blang/semver/v4"
+	ign3types "github.com/coreos/ignition/v2/config/v3_2/types"
 	mcfgv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
 	mcfgcommon "github.com/openshift/machine-config-operator/pkg/controller/common"
 	"github.com/wI2L/jsondiff"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	runtimejson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/validation"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
@@ -44,18 +57,70 @@ import (
 	"github.com/itchyny/gojq"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 )
 
 const (
-	contentFileTimeout          = 3600
 	valuePrefix                 = "xccdf_org.ssgproject.content_value_"
 	kubeletConfigPathPrefix     = "/kubeletconfig/"
 	kubeletConfigRolePathPrefix = "/kubeletconfig/role/"
+	// The JSON patches from the KubeletConfig of a role to the nodes'
+	// that differ, saved as /kubeletconfig/diffs/<role>/<node>
+	kubeletConfigDiffPathPrefix = "/kubeletconfig/diffs/"
+	machineConfigsURI           = "/apis/machineconfiguration.openshift.io/v1/machineconfigs"
+	// The layouts of the saved resources, for scanners expecting an older
+	// one. v1 only has the KubeletConfigs of the nodes, v2 adds the ones
+	// their roles share.
+	dumpPathSchemeV1      = "v1"
+	dumpPathSchemeV2      = "v2"
+	defaultDumpPathScheme = dumpPathSchemeV2
+	// What to do when the cluster isn't one of the versions the content
+	// targets
+	versionCheckWarn = "warn"
+	versionCheckFail = "fail"
+	// What to do when the OpenShift version can't be detected, or to only
+	// detect the Kubernetes version
+	versionDetectionWarn        = "warn"
+	versionDetectionFail        = "fail"
+	versionDetectionVersionOnly = "version-only"
+	defaultVersionDetection     = versionDetectionWarn
+	// The metadata of the benchmark declaring the versions the content
+	// targets, named like the annotations of the remediations
+	contentOCPVersionMetadata = "ocp-version"
+	contentK8SVersionMetadata = "k8s-version"
+	// The resources every scan fetches, which the versions are read from
+	versionDumpPath           = "/version"
+	apiserverOperatorDumpPath = configAPIPrefix + "clusteroperators/openshift-apiserver"
+	// The OpenShift configuration resources, mostly cluster singletons
+	configAPIPrefix = "/apis/config.openshift.io/v1/"
+	// The configz endpoint doesn't say which KubeletConfiguration version it
+	// returns, so this one is set unless configured otherwise
+	defaultKubeletConfigAPIVersion = "kubelet.config.k8s.io/v1beta1"
+	// Keeps the apiVersion of the configz response, if it has one
+	kubeletConfigAPIVersionAuto = "auto"
+	// The reason saved instead of the KubeletConfig of a role too few of
+	// whose nodes returned one
+	kubeletCoverageErrorReason = "InsufficientNodeCoverage"
+	// Built-in resources are served as protobuf, custom resources as JSON
+	protobufAcceptHeader = "application/vnd.kubernetes.protobuf,application/json"
+	// How many nodes to request per page during role discovery
+	nodeListPageSize = 500
+	// Default permissions of the saved resources and their directories
+	defaultResourceFileMode os.FileMode = 0600
+	defaultResourceDirMode  os.FileMode = 0700
+	// Saved in place of the resources that couldn't be fetched, followed by
+	// the reason, so the content can tell they're missing
+	kubeAPIErrorPrefix = "# kube-api-error="
+	// The suffix of the resources saved gzipped
+	savedResourceGzipSuffix = ".gz"
 )
 
 var (
 	MoreThanOneObjErr = errors.New("more than one object returned from the filter")
+	// The prefix of the protobuf-encoded API responses
+	protobufMagic = []byte{0x6b, 0x38, 0x73, 0x00}
 )
 
 // resourceFetcherClients just gathers several needed structs together so we can
@@ -66,54 +131,201 @@ type resourceFetcherClients struct {
 	// ClientSet for Gets
 	clientset *kubernetes.Clientset
 	scheme    *runtime.Scheme
+	// How many objects are fetched at a time, one if not set
+	fetchConcurrency int
+	// How many times, and after how long at first, a fetch that failed
+	// because of an overloaded or failing API server is retried
+	fetchRetries    int
+	fetchRetryDelay time.Duration
+	// If set, only the MachineConfigs of these pools are fetched
+	machineConfigPools []string
+	// Whether the MachineConfigs are written to a temporary file as they're
+	// fetched, instead of being held in memory
+	mcsToDisk bool
+	// If set, only these Ignition sections of the MachineConfigs are kept
+	mcConfigSections []string
 }
 
 // For OpenSCAP content as an XML data stream. Implements ResourceFetcher.
 type scapContentDataStream struct {
 	resourceFetcherClients
+	// How long to wait for the content files another container writes
+	contentWait contentWait
 	// Staging objects
 	dataStream *xmlquery.Node
 	tailoring  *xmlquery.Node
-	resources  []utils.ResourcePath
-	found      map[string][]byte
+	// Digests of the loaded datastream and tailoring files
+	contentDigest   string
+	tailoringDigest string
+	// The digests the datastream and tailoring files must have to be
+	// loaded, not verified if empty
+	expectedContentDigest   string
+	expectedTailoringDigest string
+	resources               []utils.ResourcePath
+	found                   map[string][]byte
+	// XCCDF values explicitly set by the profile and tailoring in use
+	effectiveValues map[string]string
+	// Label selector used to scope the node list for role discovery
+	nodeSelector string
+	// The subset of nodes the node list and KubeletConfigs are restricted to
+	nodes         []string
+	nodesMatching string
+	// The roles the KubeletConfigs are aggregated under, instead of those of
+	// the node-role.kubernetes.io labels
+	nodeRoles []nodeRole
+	// Don't discover nodes nor collect their KubeletConfigs
+	skipKubeletConfig bool
+	// The dump paths of the resources every scan fetches that aren't
+	// fetched, unless a check reads them
+	skipStaged []string
+	// Also collect the KubeletConfigs of the nodes that aren't ready or
+	// are unschedulable
+	keepUnreadyNodes bool
+	// The percentage of the nodes of a role that must return a
+	// KubeletConfig for the role's to be saved, not checked if 0
+	minNodeCoverage int
+	// The apiVersion the KubeletConfigs are labeled with
+	kubeletAPIVersion string
+	// The layout of the saved resources
+	dumpPathScheme string
+	// Whether to warn or fail if the cluster isn't one of the versions the
+	// content targets, not checked if empty
+	versionCheck string
+	// What to do if the OpenShift version can't be detected, not checked if
+	// empty
+	versionDetection string
+	// The versions detected by the last fetch, by the name of the version
+	detectedVersions map[string]string
+	// Add the per-node and per-role KubeletConfigs to the metadata archive
+	keepNodeKubelets bool
+	// Fetch all lists at the resourceVersion of the first one
+	consistentSnapshot bool
+	// Request the resources as protobuf and convert them to JSON
+	preferProtobuf bool
+	// Fetch the OpenShift configuration objects in fewer, concurrent requests
+	batchConfigFetch bool
+	// Don't save the values of the ConfigMaps' binary data
+	redactBinaryData bool
+	// The user the resources are fetched as, if not the collector itself
+	impersonateUser string
+	// The rules the profile selects that the content doesn't define
+	undefinedRules []string
+	// The values substituted in the resource paths instead of those of the
+	// content and tailoring, and those of them the content defines
+	valueOverrides   map[string]string
+	overriddenValues map[string]string
+	// The filter errors of the last fetch by kind and dump path
+	filterErrors filterErrorCounts
+	// The runtime values the filters can read from $ENV
+	filterEnv filterEnv
+	// The XCCDF values of the profile the filters can read as variables
+	filterValues filterValues
+	// The file the warnings are appended to during the fetch, before being
+	// saved for good
+	warningsFile string
+	// Where the filtered resources are cached across runs, and for how long.
+	// Nothing is cached if either isn't set.
+	cacheDir string
+	cacheTTL time.Duration
+	// The API server and kubeconfig context of the cluster the resources are
+	// fetched from, so the cached resources of other clusters aren't used
+	apiServer   string
+	kubeContext string
+	// Permissions of the saved resources and their directories
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	// Whether the saved resources are gzipped
+	compressResources bool
 }
 
-func NewDataStreamResourceFetcher(scheme *runtime.Scheme, client runtimeclient.Client, clientSet *kubernetes.Clientset) ResourceFetcher {
+func NewDataStreamResourceFetcher(scheme *runtime.Scheme, client runtimeclient.Client, clientSet *kubernetes.Clientset, conf *fetcherConfig) ResourceFetcher {
 	return &scapContentDataStream{
 		resourceFetcherClients: resourceFetcherClients{
-			clientset: clientSet,
-			client:    client,
-			scheme:    scheme,
+			clientset:          clientSet,
+			client:             client,
+			scheme:             scheme,
+			fetchConcurrency:   conf.FetchConcurrency,
+			fetchRetries:       conf.FetchRetries,
+			fetchRetryDelay:    conf.FetchRetryDelay,
+			machineConfigPools: conf.MachineConfigPools,
+			mcsToDisk:          conf.MCsToDisk,
+			mcConfigSections:   conf.MCConfigSections,
 		},
+		contentWait:             contentWait{timeout: conf.ContentTimeout, pollInterval: conf.ContentPollPeriod},
+		expectedContentDigest:   conf.ContentDigest,
+		expectedTailoringDigest: conf.TailoringDigest,
+		nodeSelector:            conf.NodeSelector,
+		nodes:                   conf.Nodes,
+		nodesMatching:           conf.NodesMatching,
+		nodeRoles:               conf.NodeRoles,
+		skipKubeletConfig:       conf.SkipKubeletConfig,
+		skipStaged:              conf.SkipStaged,
+		keepUnreadyNodes:        conf.KeepUnreadyNodes,
+		minNodeCoverage:         conf.MinNodeCoverage,
+		kubeletAPIVersion:       conf.KubeletAPIVersion,
+		dumpPathScheme:          conf.DumpPathScheme,
+		versionCheck:            conf.VersionCheck,
+		versionDetection:        conf.VersionDetection,
+		valueOverrides:          conf.ValueOverrides,
+		keepNodeKubelets:        conf.KeepNodeKubelets,
+		consistentSnapshot:      conf.ConsistentSnapshot,
+		preferProtobuf:          conf.PreferProtobuf,
+		batchConfigFetch:        conf.BatchConfigFetch,
+		redactBinaryData:        conf.RedactBinaryData,
+		impersonateUser:         conf.ImpersonateUser,
+		filterEnv:               newFilterEnv(os.LookupEnv, conf.ScanName),
+		warningsFile:            conf.WarningsOutputFile,
+		cacheDir:                conf.FetchCacheDir,
+		cacheTTL:                conf.FetchCacheTTL,
+		apiServer:               conf.APIServer,
+		kubeContext:             conf.KubeContext,
+		fileMode:                conf.FileMode,
+		dirMode:                 conf.DirMode,
+		compressResources:       conf.CompressResources,
 	}
 }
 
 func (c *scapContentDataStream) LoadSource(path string) error {
-	xml, err := c.loadContent(path)
+	source, err := c.contentSource(path)
+	if err != nil {
+		return err
+	}
+	xml, digest, err := loadVerifiedContent(context.TODO(), source, c.expectedContentDigest)
 	if err != nil {
 		return err
 	}
 	c.dataStream = xml
+	c.contentDigest = digest
 	return nil
 }
 
 func (c *scapContentDataStream) LoadTailoring(path string) error {
-	xml, err := c.loadContent(path)
+	source, err := c.contentSource(path)
+	if err != nil {
+		return err
+	}
+	xml, digest, err := loadVerifiedContent(context.TODO(), source, c.expectedTailoringDigest)
 	if err != nil {
 		return err
 	}
 	c.tailoring = xml
+	c.tailoringDigest = digest
 	return nil
 }
 
-func (c *scapContentDataStream) loadContent(path string) (*xmlquery.Node, error) {
-	f, err := openNonEmptyFile(path)
-	if err != nil {
-		return nil, err
+// contentSource returns the source of the content at location, reading
+// ConfigMaps with the fetcher's clientset if it has one
+func (c *scapContentDataStream) contentSource(location string) (ContentSource, error) {
+	// A nil clientset must stay a nil interface for the source to tell it has none
+	var clientset kubernetes.Interface
+	if c.clientset != nil {
+		clientset = c.clientset
 	}
-	// #nosec
-	defer f.Close()
-	return parseContent(f)
+	return newContentSource(location, clientset, c.contentWait)
+}
+
+func (c *scapContentDataStream) ContentDigests() (string, string) {
+	return c.contentDigest, c.tailoringDigest
 }
 
 func parseContent(f *os.File) (*xmlquery.Node, error) {
@@ -122,55 +334,48 @@ func parseContent(f *os.File) (*xmlquery.Node, error) {
 
 // Returns the file, but only after it has been created by the other init container.
 // This avoids a race.
-func openNonEmptyFile(filename string) (*os.File, error) {
-	readFileTimeoutChan := make(chan *os.File, 1)
+func openNonEmptyFile(ctx context.Context, filename string, wait contentWait) (*os.File, error) {
+	wait = wait.withDefaults()
 
 	// gosec complains that the file is passed through an evironment variable. But
 	// this is not a security issue because none of the files are user-provided
 	cleanFileName := filepath.Clean(filename)
 
-	go func() {
-		for {
-			// Note that we're cleaning the filename path above.
-			// #nosec
-			file, err := os.Open(cleanFileName)
-			if err == nil {
-				fileinfo, err := file.Stat()
-				// Only try to use the file if it already has contents.
-				if err == nil && fileinfo.Size() > 0 {
-					readFileTimeoutChan <- file
-				}
-			} else if !os.IsNotExist(err) {
-				fmt.Println(err)
-				os.Exit(1)
+	timeout := time.After(wait.timeout)
+	for {
+		// Note that we're cleaning the filename path above.
+		// #nosec
+		file, err := os.Open(cleanFileName)
+		if err == nil {
+			fileinfo, err := file.Stat()
+			// Only try to use the file if it already has contents.
+			if err == nil && fileinfo.Size() > 0 {
+				LOG("File '%s' found, using.", filename)
+				return file, nil
 			}
-			time.Sleep(1 * time.Second)
+			file.Close()
+		} else if !os.IsNotExist(err) {
+			return nil, err
 		}
-	}()
 
-	select {
-	case file := <-readFileTimeoutChan:
-		fmt.Printf("File '%s' found, using.\n", filename)
-		return file, nil
-	case <-time.After(time.Duration(contentFileTimeout) * time.Second):
-		fmt.Println("Timeout. Aborting.")
-		os.Exit(1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, fmt.Errorf("timed out after %s waiting for %s to be written", wait.timeout, filename)
+		case <-time.After(wait.pollInterval):
+		}
 	}
-
-	// We shouldn't get here.
-	return nil, nil
 }
 
-func (c *scapContentDataStream) FigureResources(profile string) error {
-	// Always stage the clusteroperators/openshift-apiserver object for version detection.
-	found := []utils.ResourcePath{
+// stagedResources returns the resources every scan fetches, whether the
+// profile needs them or not. The clusteroperators/openshift-apiserver object
+// is staged for version detection, unless only /version is used.
+func stagedResources(versionDetection string) []utils.ResourcePath {
+	staged := []utils.ResourcePath{
 		{
-			ObjPath:  "/version",
-			DumpPath: "/version",
-		},
-		{
-			ObjPath:  "/apis/config.openshift.io/v1/clusteroperators/openshift-apiserver",
-			DumpPath: "/apis/config.openshift.io/v1/clusteroperators/openshift-apiserver",
+			ObjPath:  versionDumpPath,
+			DumpPath: versionDumpPath,
 		},
 		{
 			ObjPath:  "/apis/config.openshift.io/v1/infrastructures/cluster",
@@ -180,507 +385,2983 @@ func (c *scapContentDataStream) FigureResources(profile string) error {
 			ObjPath:  "/apis/config.openshift.io/v1/networks/cluster",
 			DumpPath: "/apis/config.openshift.io/v1/networks/cluster",
 		},
-		{
-			ObjPath:  "/api/v1/nodes",
-			DumpPath: "/api/v1/nodes",
-		},
 	}
 
-	roleNodesList, err := fetchNodesWithRole(context.Background(), c.resourceFetcherClients.client)
-	if err != nil {
-		LOG("Failed to fetch role list with nodes, error: %v", err)
+	if versionDetection != versionDetectionVersionOnly {
+		staged = append(staged, utils.ResourcePath{
+			ObjPath:  apiserverOperatorDumpPath,
+			DumpPath: apiserverOperatorDumpPath,
+		})
+	}
+	return staged
+}
+
+// validateSkipStaged checks that the skipped dump paths are of resources
+// every scan fetches
+func validateSkipStaged(skipped []string) error {
+	staged := stagedResources("")
+	for _, dumpPath := range skipped {
+		if len(withoutSkipped(staged, []string{dumpPath})) == len(staged) {
+			return fmt.Errorf("%s isn't one of the resources every scan fetches", dumpPath)
+		}
+	}
+	return nil
+}
+
+// isSkipped returns whether dumpPath is one of the skipped dump paths
+func isSkipped(dumpPath string, skipped []string) bool {
+	for _, skippedPath := range skipped {
+		if skippedPath == dumpPath {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutSkipped returns the resources whose dump path isn't skipped
+func withoutSkipped(resources []utils.ResourcePath, skipped []string) []utils.ResourcePath {
+	kept := make([]utils.ResourcePath, 0, len(resources))
+	for _, rpath := range resources {
+		if !isSkipped(rpath.DumpPath, skipped) {
+			kept = append(kept, rpath)
+		}
+	}
+	return kept
+}
+
+// versionSkippedWarning warns when /version was skipped but the collection
+// depends on the cluster's version, either because some resources are
+// only fetched on some versions or because the content's versions are
+// checked
+func versionSkippedWarning(resources []utils.ResourcePath, skipped []string, versionCheck string) string {
+	if !isSkipped(versionDumpPath, skipped) {
+		return ""
+	}
+	_, versionGated := splitVersionGated(resources)
+	for _, rpath := range resources {
+		if rpath.DumpPath == versionDumpPath {
+			// A check reads it, so it's fetched anyway
+			return ""
+		}
+	}
+	if len(versionGated) == 0 && versionCheck == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s isn't fetched, so the Kubernetes version can't be detected, but the resources "+
+		"fetched or the content's version check depend on it", versionDumpPath)
+}
+
+func (c *scapContentDataStream) FigureResources(profile string) error {
+	found := withoutSkipped(stagedResources(c.versionDetection), c.skipStaged)
+
+	if err := validateContent(c.dataStream, c.tailoring, profile); err != nil {
 		return err
 	}
 
-	if len(roleNodesList) > 0 {
-		found = append(found, getKubeletConfigResourcePath(roleNodesList)...)
+	if _, err := labels.Parse(c.nodesMatching); err != nil {
+		return fmt.Errorf("invalid node subset selector '%s': %w", c.nodesMatching, err)
 	}
 
-	effectiveProfile := profile
-	var valuesList map[string]string
+	if c.skipKubeletConfig {
+		DBG("Skipping node role discovery and KubeletConfig collection")
+	} else {
+		roleNodesList, err := fetchNodesWithRole(context.Background(), c.resourceFetcherClients.client,
+			joinSelectors(c.nodeSelector, c.nodesMatching), c.keepUnreadyNodes, c.nodeRoles)
+		if err != nil {
+			LOG("Failed to fetch role list with nodes, error: %v", err)
+			return err
+		}
+		roleNodesList = filterRoleNodes(roleNodesList, c.nodes)
 
-	if c.tailoring != nil {
-		var selected []utils.ResourcePath
-		selected, valuesList = getResourcePaths(c.tailoring, c.dataStream, profile, nil)
-		if len(selected) == 0 {
-			fmt.Printf("no valid checks found in tailoring\n")
+		if len(roleNodesList) > 0 {
+			found = append(found, getKubeletConfigResourcePath(roleNodesList, c.kubeletAPIVersion)...)
 		}
+	}
+
+	chain, err := resolveProfileChain(c.dataStream, c.tailoring, profile)
+	if err != nil {
+		return err
+	}
+
+	// The checks the chain ends up selecting are collected, each along with
+	// the profile that selected it, so a profile can unselect the checks of
+	// the one it extends. The values each profile resolves override those of
+	// the profile it extends.
+	merged := mergeCheckSelections(chain)
+	var resolvedValues map[string]string
+	c.undefinedRules = nil
+	nSelected := 0
+	for _, link := range chain {
+		selected, values, undefined := getChecksResourcePaths(link.defs, c.dataStream,
+			selectedChecksOf(link, merged), withValueOverrides(resolvedValues, c.valueOverrides))
+		c.undefinedRules = appendMissing(c.undefinedRules, undefined...)
+		nSelected += len(selected)
 		found = append(found, selected...)
-		// Overwrite profile so the next search uses the extended profile
-		effectiveProfile = c.getExtendedProfileFromTailoring(c.tailoring, profile)
-		// No profile is being extended
-		if effectiveProfile == "" {
-			c.resources = found
-			return nil
+		resolvedValues = values
+	}
+	if nSelected == 0 {
+		if chain[0].defs == c.tailoring {
+			LOG("no valid checks found in tailoring")
+		} else {
+			LOG("no valid checks found in profile")
 		}
 	}
-
-	selected, _ := getResourcePaths(c.dataStream, c.dataStream, effectiveProfile, valuesList)
-	if len(selected) == 0 {
-		fmt.Printf("no valid checks found in profile\n")
+	if len(c.undefinedRules) > 0 {
+		LOG("The profile %s selects %d rules that aren't defined in the content", profile, len(c.undefinedRules))
 	}
-	found = append(found, selected...)
-	c.resources = found
+	c.resources = c.withNodeList(found)
 	DBG("c.resources: %v\n", c.resources)
+	c.effectiveValues = getEffectiveValues(chain)
+	c.recordValueOverrides(resolvedValues)
+	c.filterValues = filterValues(resolvedValues)
 	return nil
 }
 
-// getPathsFromRuleWarning finds the API endpoint from in. The expected structure is:
-//
-//	<warning category="general" lang="en-US"><code class="ocp-api-endpoint">/apis/config.openshift.io/v1/oauths/cluster
-//	</code></warning>
-func getPathFromWarningXML(in *xmlquery.Node, valueList map[string]string) []utils.ResourcePath {
-	DBG("Parsing warning %s", in.OutputXML(false))
-	path, err := utils.GetPathFromWarningXML(in, valueList)
-	if err != nil {
-		LOG("Error occurred at parsing warning %s", in.OutputXML((false)))
-		LOG("Error message: %s", err)
+// withValueOverrides returns a copy of the values with the overrides set
+func withValueOverrides(values, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return values
 	}
-	return path
-}
-
-// Fetch all nodes from the cluster and find all roles for each node.
-func fetchNodesWithRole(ctx context.Context, c runtimeclient.Client) (map[string][]string, error) {
-	nodeList := v1.NodeList{}
-	if err := c.List(ctx, &nodeList); err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	merged := make(map[string]string, len(values)+len(overrides))
+	for name, value := range values {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
 	}
+	return merged
+}
 
-	roleNodesList := make(map[string][]string)
-	for _, node := range nodeList.Items {
-		nodeName := node.Name
-		nodeRoles := utils.GetNodeRoles(node.ObjectMeta.Labels)
-		for _, role := range nodeRoles {
-			roleNodesList[role] = append(roleNodesList[role], nodeName)
+// recordValueOverrides keeps the overrides of the values the content
+// defines, which were substituted in the resource paths, and adds them to
+// the effective values. The others are ignored, like those of a tailoring.
+func (c *scapContentDataStream) recordValueOverrides(resolved map[string]string) {
+	c.overriddenValues = nil
+	for name, value := range c.valueOverrides {
+		if _, ok := resolved[name]; !ok {
+			LOG("The value %s isn't defined in the content, not overriding it", name)
+			continue
+		}
+		if c.overriddenValues == nil {
+			c.overriddenValues = map[string]string{}
 		}
+		c.overriddenValues[name] = value
+		if c.effectiveValues == nil {
+			c.effectiveValues = map[string]string{}
+		}
+		c.effectiveValues[name] = value
 	}
+}
 
-	return roleNodesList, nil
-
+// valueOverridesWarning lists the overridden values, sorted by name
+func valueOverridesWarning(overridden map[string]string) string {
+	pairs := make([]string, 0, len(overridden))
+	for name, value := range overridden {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("The values were overridden at collection time, the results don't reflect the content: %s",
+		strings.Join(pairs, ", "))
 }
 
-// Get resourcePath for KubeletConfig
-func getKubeletConfigResourcePath(roleNodesList map[string][]string) []utils.ResourcePath {
-	resourcePath := []utils.ResourcePath{}
-	for role, nodeList := range roleNodesList {
-		for _, node := range nodeList {
-			resourcePath = append(resourcePath, utils.ResourcePath{
-				ObjPath:  "/api/v1/nodes/" + node + "/proxy/configz",
-				DumpPath: kubeletConfigPathPrefix + role + "/" + node,
-				Filter:   `.kubeletconfig|.kind="KubeletConfiguration"|.apiVersion="kubelet.config.k8s.io/v1beta1"`,
-			})
+// parseValueOverrides parses the name=value pairs overriding the values of
+// the content. The names may have the XCCDF value prefix.
+func parseValueOverrides(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	overrides := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimPrefix(strings.TrimSpace(name), valuePrefix)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid value override %q, expected name=value", pair)
 		}
+		overrides[name] = value
 	}
-	return resourcePath
+	return overrides, nil
 }
 
-// Get role name and node name from DumpPath
-func getRoleNodeNameFromDumpPath(dumpPath string) (roleName string, nodeName string) {
-	if strings.HasPrefix(dumpPath, kubeletConfigPathPrefix) {
-		dumpPathSplit := strings.Split(dumpPath, "/")
-		if len(dumpPathSplit) != 4 {
-			return "", ""
+// withNodeList stages the node list when something reads it: the
+// KubeletConfig collection, whose node roles the content evaluates, or a
+// selected check fetching the nodes. Platform-only profiles collected without
+// the KubeletConfigs don't pay for listing all the nodes of a large cluster.
+func (c *scapContentDataStream) withNodeList(found []utils.ResourcePath) []utils.ResourcePath {
+	if c.skipKubeletConfig && !readsNodes(found) {
+		DBG("No check reads the nodes, not staging the node list")
+		return found
+	}
+	return append(found, getNodeListResourcePath(c.nodes, c.nodesMatching))
+}
+
+// readsNodes tells whether any of the resources is a node or the node list
+func readsNodes(resources []utils.ResourcePath) bool {
+	for _, rpath := range resources {
+		if rpath.ObjPath == "/api/v1/nodes" || strings.HasPrefix(rpath.ObjPath, "/api/v1/nodes/") ||
+			strings.HasPrefix(rpath.ObjPath, "/api/v1/nodes?") {
+			return true
 		}
-		// example of DumpPath: /kubeletconfig/master/node-1
-		roleName = dumpPathSplit[2]
-		nodeName = dumpPathSplit[3]
-		return roleName, nodeName
 	}
-	return "", ""
+	return false
 }
 
-// Collect the resource paths for objects that this scan needs to obtain.
-// The profile will have a series of "selected" checks that we grab all of the path info from.
-func getResourcePaths(profileDefs *xmlquery.Node, ruleDefs *xmlquery.Node, profile string, overrideValueList map[string]string) ([]utils.ResourcePath, map[string]string) {
-	out := []utils.ResourcePath{}
-	selectedChecks := []string{}
+func (c *scapContentDataStream) DetectedVersions() (string, string) {
+	return c.detectedVersions[contentOCPVersionMetadata], c.detectedVersions[contentK8SVersionMetadata]
+}
 
-	// Before staring process, collect all of the variables in definitions.
-	valuesList := make(map[string]string)
-	defs := [...]*xmlquery.Node{ruleDefs, profileDefs}
-	for _, def := range defs {
-		allValues := xmlquery.Find(def, "//xccdf-1.2:Value")
+func (c *scapContentDataStream) EffectiveValues() map[string]string {
+	return c.effectiveValues
+}
 
-		for _, variable := range allValues {
-			for _, val := range variable.SelectElements("//xccdf-1.2:value") {
-				if val.SelectAttr("hidden") == "true" {
-					// this is typically used for functions
-					continue
-				}
-				if val.SelectAttr("selector") == "" {
-					// It is not an enum choice, but a default value instead
-					if strings.HasPrefix(variable.SelectAttr("id"), valuePrefix) {
-						valuesList[strings.TrimPrefix(variable.SelectAttr("id"), valuePrefix)] = html.UnescapeString(val.OutputXML(false))
-					}
-				}
+func (c *scapContentDataStream) UndefinedRules() []string {
+	return c.undefinedRules
+}
+
+func (c *scapContentDataStream) FilterErrors() map[string]map[string]int {
+	return c.filterErrors
+}
+
+// appendMissing appends the items that the list doesn't contain yet
+func appendMissing(list []string, items ...string) []string {
+	for _, item := range items {
+		missing := true
+		for _, listed := range list {
+			if listed == item {
+				missing = false
+				break
 			}
 		}
-		allSetValues := xmlquery.Find(def, "//xccdf-1.2:set-value")
-		for _, variable := range allSetValues {
-			if strings.HasPrefix(variable.SelectAttr("idref"), valuePrefix) {
-				valuesList[strings.TrimPrefix(variable.SelectAttr("idref"), valuePrefix)] = html.UnescapeString(variable.OutputXML(false))
-			}
+		if missing {
+			list = append(list, item)
 		}
 	}
+	return list
+}
 
-	// override variables which is defined in tailored profile
-	if overrideValueList != nil {
-		for k, v := range overrideValueList {
-			if _, exists := valuesList[k]; exists {
-				valuesList[k] = v
-			}
+// maxListedUndefinedRules is how many of the undefined rules the warning
+// names, so it stays readable when a content update dropped a lot of them
+const maxListedUndefinedRules = 5
+
+// undefinedRulesWarning sums up the selected rules the content doesn't define
+func undefinedRulesWarning(rules []string) string {
+	listed := rules
+	if len(listed) > maxListedUndefinedRules {
+		listed = listed[:maxListedUndefinedRules]
+	}
+	warning := fmt.Sprintf("The profile selects %d rules that aren't defined in the content: %s",
+		len(rules), strings.Join(listed, ", "))
+	if len(rules) > len(listed) {
+		warning += fmt.Sprintf(" and %d more", len(rules)-len(listed))
+	}
+	return warning
+}
+
+// getEffectiveValues returns the XCCDF values explicitly set by the scanned
+// profile and the profiles it extends. The values a profile sets override the
+// ones set by the profiles it extends.
+func getEffectiveValues(chain []profileLink) map[string]string {
+	values := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range getProfileSetValues(chain[i].defs, chain[i].id) {
+			values[k] = v
 		}
 	}
+	return values
+}
 
-	// First we find the Profile node, to locate the enabled checks.
-	DBG("Using profile %s", profile)
-	nodes := profileDefs.SelectElements("//xccdf-1.2:Profile")
-	if len(nodes) == 0 {
-		DBG("no profiles found in datastream")
+// xccdfValueText returns the text of a value or set-value element as the XML
+// parser decoded it, so entities are only decoded once. CDATA sections are
+// taken as is and comments are left out. Surrounding whitespace is trimmed
+// unless the element preserves it.
+func xccdfValueText(node *xmlquery.Node) string {
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == xmlquery.TextNode || child.Type == xmlquery.CharDataNode {
+			text.WriteString(child.Data)
+		}
 	}
-	for _, node := range nodes {
-		profileID := node.SelectAttr("id")
-		if profileID != profile {
+	if node.SelectAttr("xml:space") == "preserve" {
+		return text.String()
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// getProfileSetValues returns the values set through set-value elements of
+// the given profile, keyed by the value ID without the value prefix.
+func getProfileSetValues(ds *xmlquery.Node, profileID string) map[string]string {
+	values := make(map[string]string)
+	for _, node := range ds.SelectElements("//xccdf-1.2:Profile") {
+		if node.SelectAttr("id") != profileID {
 			continue
 		}
-
-		checks := node.SelectElements("//xccdf-1.2:select")
-		for _, check := range checks {
-			if check.SelectAttr("selected") != "true" {
-				continue
-			}
-
-			if idRef := check.SelectAttr("idref"); idRef != "" {
-				DBG("selected: %v", idRef)
-				selectedChecks = append(selectedChecks, idRef)
+		for _, setValue := range node.SelectElements("xccdf-1.2:set-value") {
+			idref := setValue.SelectAttr("idref")
+			if strings.HasPrefix(idref, valuePrefix) {
+				values[strings.TrimPrefix(idref, valuePrefix)] = xccdfValueText(setValue)
 			}
 		}
 	}
+	return values
+}
 
-	checkDefinitions := ruleDefs.SelectElements("//xccdf-1.2:Rule")
-	if len(checkDefinitions) == 0 {
-		DBG("WARNING: No rules to query (invalid datastream)")
-		return out, valuesList
+// getPathsFromRuleWarning finds the API endpoint from in. The expected structure is:
+//
+//	<warning category="general" lang="en-US"><code class="ocp-api-endpoint">/apis/config.openshift.io/v1/oauths/cluster
+//	</code></warning>
+func getPathFromWarningXML(in *xmlquery.Node, valueList map[string]string) []utils.ResourcePath {
+	DBG("Parsing warning %s", in.OutputXML(false))
+	path, err := utils.GetPathFromWarningXML(in, valueList)
+	if err != nil {
+		LOG("Error occurred at parsing warning %s", in.OutputXML((false)))
+		LOG("Error message: %s", err)
 	}
+	return path
+}
 
-	// For each of our selected checks, collect the required path info.
-	for _, checkID := range selectedChecks {
-		var found *xmlquery.Node
-		for _, rule := range checkDefinitions {
-			if rule.SelectAttr("id") == checkID {
-				found = rule
-				break
-			}
-		}
-		if found == nil {
-			DBG("WARNING: Couldn't find a check for id %s", checkID)
-			continue
-		}
+// Fetch the nodes matching the label selector from the cluster and find all
+// roles for each node. An empty selector matches all nodes. Nodes are listed
+// in pages so large clusters don't have to be held in memory at once, and
+// only their name, labels and, unless the unready nodes are kept, readiness
+// are retained. If roles are given, the nodes have the roles whose selectors
+// they match instead of those of their node-role labels.
+func fetchNodesWithRole(ctx context.Context, c runtimeclient.Client, selector string, keepUnready bool,
+	roles []nodeRole) (map[string][]string, error) {
+	labelSelector, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node selector '%s': %w", selector, err)
+	}
 
-		// This node is called "warning" and contains the path info. It's not an actual "warning" for us here.
-		var warningFound bool
-		warningObjs := found.SelectElements("//xccdf-1.2:warning")
+	roleNodesList := make(map[string][]string)
+	listOpts := &runtimeclient.ListOptions{
+		LabelSelector: labelSelector,
+		Limit:         nodeListPageSize,
+	}
+	for {
+		nodes, cont, err := listRoleNodesPage(ctx, c, listOpts, keepUnready)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list nodes: %w", err)
+		}
 
-		for _, warn := range warningObjs {
-			if warn == nil {
+		for _, node := range nodes {
+			if node.notServing != "" {
+				// Its configz endpoint would only raise warnings
+				LOG("Skipping node %s, which is %s", node.name, node.notServing)
 				continue
 			}
-			apiPaths := getPathFromWarningXML(warn, valuesList)
-			if len(apiPaths) == 0 {
-				continue
+			nodeRoles := nodeRoleNames(node.labels, roles)
+			for _, role := range nodeRoles {
+				roleNodesList[role] = append(roleNodesList[role], node.name)
 			}
-			// We only care for the first occurrence that works
-			out = append(out, apiPaths...)
-			warningFound = true
-			break
 		}
 
-		if !warningFound {
-			DBG("Couldn't find 'warning' child of check %s", checkID)
-			continue
+		if cont == "" {
+			break
 		}
-
+		listOpts.Continue = cont
 	}
-	return out, valuesList
+
+	return roleNodesList, nil
 }
 
-func (c *scapContentDataStream) getExtendedProfileFromTailoring(ds *xmlquery.Node, tailoredProfile string) string {
-	nodes := ds.SelectElements("//xccdf-1.2:Profile")
-	for _, node := range nodes {
-		tailoredProfileID := node.SelectAttr("id")
-		if tailoredProfileID != tailoredProfile {
-			continue
-		}
+// nodeRole is a role the KubeletConfigs of the nodes matching its selector
+// are aggregated under
+type nodeRole struct {
+	name     string
+	selector labels.Selector
+}
 
-		profileID := node.SelectAttr("extends")
-		if profileID != "" {
-			return profileID
+// parseNodeRoles parses the role=selector pairs mapping the nodes to roles
+func parseNodeRoles(pairs []string) ([]nodeRole, error) {
+	roles := make([]nodeRole, 0, len(pairs))
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		name, selector, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || strings.TrimSpace(selector) == "" {
+			return nil, fmt.Errorf("invalid node role %q, expected role=selector", pair)
+		}
+		// The role is part of the path the KubeletConfigs are saved to
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid node role name '%s': %s", name, strings.Join(errs, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("node role '%s' is mapped more than once", name)
 		}
+		seen[name] = true
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of node role '%s': %w", name, err)
+		}
+		roles = append(roles, nodeRole{name: name, selector: parsed})
 	}
-	return ""
+	return roles, nil
 }
 
-func (c *scapContentDataStream) FetchResources() ([]string, error) {
-	found, warnings, err := fetch(context.Background(), getStreamerFn, c.resourceFetcherClients, c.resources)
-	if err != nil {
-		return warnings, err
+// nodeRoleNames returns the roles of the node: those whose selectors its
+// labels match if roles are given, otherwise those of its node-role labels
+func nodeRoleNames(nodeLabels map[string]string, roles []nodeRole) []string {
+	if len(roles) == 0 {
+		return utils.GetNodeRoles(nodeLabels)
 	}
-	c.found = found
-	return warnings, nil
+	names := []string{}
+	for _, role := range roles {
+		if role.selector.Matches(labels.Set(nodeLabels)) {
+			names = append(names, role.name)
+		}
+	}
+	return names
 }
 
-// resourceStreamer is an interface capable of streaming a particular URI
-type resourceStreamer interface {
-	Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error)
+// roleNode is what the role discovery retains of a node
+type roleNode struct {
+	name   string
+	labels map[string]string
+	// Why the node can't serve its KubeletConfig, if it can't
+	notServing string
 }
 
-type streamerDispatcherFn func(string) resourceStreamer
-
-// getStreamerFn returns a structure implementing resourceStreamer interface based on the
-// uri passed to it
-func getStreamerFn(uri string) resourceStreamer {
-	if uri == "/apis/machineconfiguration.openshift.io/v1/machineconfigs" {
-		return &mcStreamer{}
+// listRoleNodesPage lists a page of the nodes and returns the continue token
+// of the next one. If the unready nodes are kept, their readiness doesn't
+// matter and only their metadata is listed, leaving out their status.
+func listRoleNodesPage(ctx context.Context, c runtimeclient.Client, listOpts *runtimeclient.ListOptions,
+	keepUnready bool) ([]roleNode, string, error) {
+	if keepUnready {
+		metaList := &metav1.PartialObjectMetadataList{}
+		metaList.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("NodeList"))
+		if err := c.List(ctx, metaList, listOpts); err != nil {
+			return nil, "", err
+		}
+		nodes := make([]roleNode, 0, len(metaList.Items))
+		for i := range metaList.Items {
+			nodes = append(nodes, roleNode{name: metaList.Items[i].Name, labels: metaList.Items[i].Labels})
+		}
+		return nodes, metaList.Continue, nil
 	}
 
-	return &uriStreamer{
-		uri: uri,
+	nodeList := &v1.NodeList{}
+	if err := c.List(ctx, nodeList, listOpts); err != nil {
+		return nil, "", err
 	}
+	nodes := make([]roleNode, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		nodes = append(nodes, roleNode{name: node.Name, labels: node.Labels, notServing: nodeNotServingReason(node)})
+	}
+	return nodes, nodeList.Continue, nil
 }
 
-// uriStreamer implements resourceStreamer for fetching a generic URI
+// nodeNotServingReason tells why the node can't be expected to serve its
+// KubeletConfig, or returns an empty string if it can. Nodes that don't
+// report whether they're ready are assumed to be.
+func nodeNotServingReason(node *v1.Node) string {
+	if node.Spec.Unschedulable {
+		return "unschedulable"
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status != v1.ConditionTrue {
+			return "not ready"
+		}
+	}
+	return ""
+}
+
+// getNodeListResourcePath returns the resource path of the node list. If the
+// collection is restricted to a subset of the nodes, only those are listed,
+// but the list is still saved under the same path for the content to find it.
+func getNodeListResourcePath(names []string, selector string) utils.ResourcePath {
+	rpath := utils.ResourcePath{
+		ObjPath:  "/api/v1/nodes",
+		DumpPath: "/api/v1/nodes",
+	}
+	if selector != "" {
+		rpath.ObjPath += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	if len(names) > 0 {
+		quoted := make([]string, 0, len(names))
+		for _, name := range names {
+			quoted = append(quoted, strconv.Quote(name))
+		}
+		rpath.Filter = fmt.Sprintf(".items |= map(select(.metadata.name | IN(%s)))", strings.Join(quoted, ", "))
+	}
+	return rpath
+}
+
+// joinSelectors combines label selectors so nodes have to match all of them
+func joinSelectors(selectors ...string) string {
+	nonEmpty := []string{}
+	for _, selector := range selectors {
+		if selector != "" {
+			nonEmpty = append(nonEmpty, selector)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+// filterRoleNodes only keeps the given nodes in the role list. Roles left
+// without nodes are dropped. An empty list of names keeps all the nodes.
+func filterRoleNodes(roleNodesList map[string][]string, names []string) map[string][]string {
+	if len(names) == 0 {
+		return roleNodesList
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	filtered := make(map[string][]string)
+	for role, nodes := range roleNodesList {
+		for _, node := range nodes {
+			if wanted[node] {
+				filtered[role] = append(filtered[role], node)
+			}
+		}
+	}
+	return filtered
+}
+
+// Get resourcePath for KubeletConfig
+func getKubeletConfigResourcePath(roleNodesList map[string][]string, apiVersion string) []utils.ResourcePath {
+	resourcePath := []utils.ResourcePath{}
+	filter := kubeletConfigFilter(apiVersion)
+	for role, nodeList := range roleNodesList {
+		for _, node := range nodeList {
+			resourcePath = append(resourcePath, utils.ResourcePath{
+				ObjPath:  "/api/v1/nodes/" + node + "/proxy/configz",
+				DumpPath: kubeletConfigPathPrefix + role + "/" + node,
+				Filter:   filter,
+			})
+		}
+	}
+	return resourcePath
+}
+
+// kubeletConfigFilter returns the filter turning a configz response into a
+// KubeletConfiguration of the given apiVersion. With "auto", the apiVersion
+// of the response is kept and the default is only used if it has none.
+func kubeletConfigFilter(apiVersion string) string {
+	if apiVersion == "" {
+		apiVersion = defaultKubeletConfigAPIVersion
+	}
+	if apiVersion == kubeletConfigAPIVersionAuto {
+		return fmt.Sprintf(`.kubeletconfig|.kind="KubeletConfiguration"|.apiVersion=(.apiVersion // "%s")`, defaultKubeletConfigAPIVersion)
+	}
+	return fmt.Sprintf(`.kubeletconfig|.kind="KubeletConfiguration"|.apiVersion="%s"`, apiVersion)
+}
+
+// validateKubeletConfig checks that a filtered configz response is a
+// KubeletConfiguration. The filter sets the kind and apiVersion whatever the
+// kubelet returned, so a response without a kubeletconfig, like an error,
+// ends up with no other field.
+func validateKubeletConfig(content []byte) error {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("not a JSON object: %w", err)
+	}
+	if kind, _ := config["kind"].(string); kind != "KubeletConfiguration" {
+		return fmt.Errorf("unexpected kind %v", config["kind"])
+	}
+	if apiVersion, _ := config["apiVersion"].(string); apiVersion == "" {
+		return fmt.Errorf("unexpected apiVersion %v", config["apiVersion"])
+	}
+	if len(config) == 2 {
+		return errors.New("no configuration field")
+	}
+	return nil
+}
+
+// dropInvalidKubeletConfigs removes the KubeletConfigs of the nodes that
+// aren't valid from found, with a warning for each, so they don't count
+// when the KubeletConfigs of their role are compared. The placeholders of
+// the nodes whose KubeletConfig couldn't be fetched are kept, since the fetch
+// already warned about them, and aren't compared either.
+func dropInvalidKubeletConfigs(found map[string][]byte, warnings []string) []string {
+	var dropped []string
+	for dumpPath, content := range found {
+		role, node := getRoleNodeNameFromDumpPath(dumpPath)
+		if role == "" || isResourcePlaceholder(content) {
+			continue
+		}
+		if err := validateKubeletConfig(content); err != nil {
+			dropped = append(dropped, fmt.Sprintf("Skipping the KubeletConfig of node %s of role %s, "+
+				"which isn't a valid KubeletConfiguration: %v", node, role, err))
+			delete(found, dumpPath)
+		}
+	}
+	// The map is iterated in random order
+	sort.Strings(dropped)
+	for _, warning := range dropped {
+		LOG(warning)
+	}
+	return append(warnings, dropped...)
+}
+
+// validateDumpPathScheme checks that scheme is one of the known layouts of
+// the saved resources
+func validateDumpPathScheme(scheme string) error {
+	switch scheme {
+	case dumpPathSchemeV1, dumpPathSchemeV2:
+		return nil
+	}
+	return fmt.Errorf("unknown scheme %s, expected %s or %s", scheme, dumpPathSchemeV1, dumpPathSchemeV2)
+}
+
+// validateKubeletNodeCoverage checks that coverage is a percentage
+func validateKubeletNodeCoverage(coverage int) error {
+	if coverage < 0 || coverage > 100 {
+		return fmt.Errorf("%d isn't between 0 and 100", coverage)
+	}
+	return nil
+}
+
+// validateVersionCheck checks that check is either empty, "warn" or "fail"
+func validateVersionCheck(check string) error {
+	switch check {
+	case "", versionCheckWarn, versionCheckFail:
+		return nil
+	}
+	return fmt.Errorf("unknown check %s, expected %s or %s", check, versionCheckWarn, versionCheckFail)
+}
+
+// validateVersionDetection checks that detection is one of the ways of
+// handling an undetected OpenShift version
+func validateVersionDetection(detection string) error {
+	switch detection {
+	case versionDetectionWarn, versionDetectionFail, versionDetectionVersionOnly:
+		return nil
+	}
+	return fmt.Errorf("unknown handling %s, expected %s, %s or %s", detection,
+		versionDetectionWarn, versionDetectionFail, versionDetectionVersionOnly)
+}
+
+// versionDetectionError tells why the version the content is evaluated
+// against wasn't detected: the OpenShift version, or with "version-only" the
+// Kubernetes one. It returns nil if it was, or if detection is empty.
+func versionDetectionError(detection string, versions map[string]string) error {
+	switch detection {
+	case "":
+		return nil
+	case versionDetectionVersionOnly:
+		if versions[contentK8SVersionMetadata] == "" {
+			return fmt.Errorf("couldn't detect the Kubernetes version from %s", versionDumpPath)
+		}
+		return nil
+	}
+	if versions[contentOCPVersionMetadata] == "" {
+		return fmt.Errorf("couldn't detect the OpenShift version from %s, the checks depending on it "+
+			"might not apply to this cluster", apiserverOperatorDumpPath)
+	}
+	return nil
+}
+
+// contentVersionRanges returns the version ranges the benchmark declares in
+// its metadata by the name of the version, e.g.
+// <co:ocp-version>&gt;=4.12.0 &lt;4.15.0</co:ocp-version>. The namespace of
+// the metadata isn't checked.
+func contentVersionRanges(dataStream *xmlquery.Node) map[string]string {
+	ranges := map[string]string{}
+	if dataStream == nil {
+		return ranges
+	}
+	for _, node := range xmlquery.Find(dataStream, "//xccdf-1.2:Benchmark/xccdf-1.2:metadata/*") {
+		if node.Data == contentOCPVersionMetadata || node.Data == contentK8SVersionMetadata {
+			ranges[node.Data] = strings.TrimSpace(node.InnerText())
+		}
+	}
+	return ranges
+}
+
+// clusterVersions returns the OpenShift and Kubernetes versions of the
+// cluster by the name of their metadata, read from the fetched resources.
+// The versions that weren't fetched are left out.
+func clusterVersions(found map[string][]byte) map[string]string {
+	versions := map[string]string{}
+	k8sVersion := struct {
+		GitVersion string `json:"gitVersion"`
+	}{}
+	if err := json.Unmarshal(found[versionDumpPath], &k8sVersion); err == nil && k8sVersion.GitVersion != "" {
+		versions[contentK8SVersionMetadata] = k8sVersion.GitVersion
+	}
+	apiserverOperator := struct {
+		Status struct {
+			Versions []struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"status"`
+	}{}
+	if err := json.Unmarshal(found[apiserverOperatorDumpPath], &apiserverOperator); err == nil {
+		for _, version := range apiserverOperator.Status.Versions {
+			if version.Name == "openshift-apiserver" {
+				versions[contentOCPVersionMetadata] = version.Version
+			}
+		}
+	}
+	return versions
+}
+
+// splitVersionGated separates the resources only needed on some versions
+func splitVersionGated(resources []utils.ResourcePath) (ungated, gated []utils.ResourcePath) {
+	for _, rpath := range resources {
+		if rpath.OCPVersion != "" || rpath.K8SVersion != "" {
+			gated = append(gated, rpath)
+		} else {
+			ungated = append(ungated, rpath)
+		}
+	}
+	return ungated, gated
+}
+
+// filterVersionGated returns the resources needed on the cluster's versions,
+// and a note for each of the others, which aren't fetched since the checks
+// reading them don't apply. A resource is still fetched if its version
+// wasn't detected or its range can't be parsed.
+func filterVersionGated(resources []utils.ResourcePath, versions map[string]string) ([]utils.ResourcePath, []string) {
+	needed := []utils.ResourcePath{}
+	skipped := []string{}
+	for _, rpath := range resources {
+		mismatch := ""
+		for _, gate := range []struct{ name, product, vrange string }{
+			{contentOCPVersionMetadata, "OpenShift", rpath.OCPVersion},
+			{contentK8SVersionMetadata, "Kubernetes", rpath.K8SVersion},
+		} {
+			if gate.vrange == "" || versions[gate.name] == "" {
+				continue
+			}
+			expected, rangeErr := semver.ParseRange(gate.vrange)
+			version, versionErr := semver.ParseTolerant(versions[gate.name])
+			if rangeErr != nil || versionErr != nil {
+				LOG("Couldn't check whether %s is needed on %s %s, fetching it", rpath.ObjPath, gate.product,
+					versions[gate.name])
+				continue
+			}
+			if !expected(version) {
+				mismatch = fmt.Sprintf("%s %s (the cluster runs %s)", gate.product, gate.vrange, versions[gate.name])
+				break
+			}
+		}
+		if mismatch == "" {
+			needed = append(needed, rpath)
+			continue
+		}
+		skipped = append(skipped, fmt.Sprintf("Not fetching %s, which is only needed on %s, so the checks "+
+			"reading it don't apply to this cluster", rpath.ObjPath, mismatch))
+	}
+	return needed, skipped
+}
+
+// contentVersionMismatches returns a message for every version range the
+// cluster isn't in, sorted by the name of the version. A version that
+// couldn't be detected doesn't match its range.
+func contentVersionMismatches(ranges, versions map[string]string) []string {
+	products := map[string]string{contentOCPVersionMetadata: "OpenShift", contentK8SVersionMetadata: "Kubernetes"}
+	mismatches := []string{}
+	for name, vrange := range ranges {
+		product := products[name]
+		expected, err := semver.ParseRange(vrange)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("The content declares an invalid %s version range %s: %v",
+				product, vrange, err))
+			continue
+		}
+		version, ok := versions[name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("The content targets %s %s, but the cluster's %s "+
+				"version couldn't be detected", product, vrange, product))
+			continue
+		}
+		parsed, err := semver.ParseTolerant(version)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("Couldn't parse the cluster's %s version %s: %v",
+				product, version, err))
+			continue
+		}
+		if !expected(parsed) {
+			mismatches = append(mismatches, fmt.Sprintf("The content targets %s %s, but the cluster runs %s",
+				product, vrange, version))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// validateKubeletConfigAPIVersion checks that apiVersion is either "auto" or
+// of the group/version form
+func validateKubeletConfigAPIVersion(apiVersion string) error {
+	if apiVersion == kubeletConfigAPIVersionAuto {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return err
+	}
+	if gv.Group == "" || gv.Version == "" {
+		return fmt.Errorf("%s is not of the group/version form", apiVersion)
+	}
+	if errs := validation.IsDNS1123Subdomain(gv.Group); len(errs) > 0 {
+		return fmt.Errorf("invalid group in %s: %s", apiVersion, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1123Label(gv.Version); len(errs) > 0 {
+		return fmt.Errorf("invalid version in %s: %s", apiVersion, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Get role name and node name from DumpPath
+func getRoleNodeNameFromDumpPath(dumpPath string) (roleName string, nodeName string) {
+	if strings.HasPrefix(dumpPath, kubeletConfigPathPrefix) {
+		dumpPathSplit := strings.Split(dumpPath, "/")
+		if len(dumpPathSplit) != 4 {
+			return "", ""
+		}
+		// example of DumpPath: /kubeletconfig/master/node-1
+		roleName = dumpPathSplit[2]
+		nodeName = dumpPathSplit[3]
+		return roleName, nodeName
+	}
+	return "", ""
+}
+
+// Collect the resource paths for objects that this scan needs to obtain.
+// The profile will have a series of "selected" checks that we grab all of the path info from.
+// The selected checks that aren't defined as a Rule are returned as well.
+func getResourcePaths(profileDefs *xmlquery.Node, ruleDefs *xmlquery.Node, profile string, overrideValueList map[string]string) ([]utils.ResourcePath, map[string]string, []string) {
+	selectedChecks := []string{}
+	// First we find the Profile node, to locate the enabled checks.
+	DBG("Using profile %s", profile)
+	nodes := profileDefs.SelectElements("//xccdf-1.2:Profile")
+	if len(nodes) == 0 {
+		DBG("no profiles found in datastream")
+	}
+	for _, node := range nodes {
+		profileID := node.SelectAttr("id")
+		if profileID != profile {
+			continue
+		}
+
+		checks := node.SelectElements("//xccdf-1.2:select")
+		for _, check := range checks {
+			if check.SelectAttr("selected") != "true" {
+				continue
+			}
+
+			if idRef := check.SelectAttr("idref"); idRef != "" {
+				DBG("selected: %v", idRef)
+				selectedChecks = append(selectedChecks, idRef)
+			}
+		}
+	}
+	return getChecksResourcePaths(profileDefs, ruleDefs, selectedChecks, overrideValueList)
+}
+
+// getChecksResourcePaths collects the resource paths of the given checks,
+// along with the values of the definitions and the checks that aren't
+// defined as a Rule
+func getChecksResourcePaths(profileDefs *xmlquery.Node, ruleDefs *xmlquery.Node, selectedChecks []string,
+	overrideValueList map[string]string) ([]utils.ResourcePath, map[string]string, []string) {
+	out := []utils.ResourcePath{}
+	var undefined []string
+
+	// Before staring process, collect all of the variables in definitions.
+	valuesList := make(map[string]string)
+	defs := [...]*xmlquery.Node{ruleDefs, profileDefs}
+	for _, def := range defs {
+		allValues := xmlquery.Find(def, "//xccdf-1.2:Value")
+
+		for _, variable := range allValues {
+			for _, val := range variable.SelectElements("//xccdf-1.2:value") {
+				if val.SelectAttr("hidden") == "true" {
+					// this is typically used for functions
+					continue
+				}
+				if val.SelectAttr("selector") == "" {
+					// It is not an enum choice, but a default value instead
+					if strings.HasPrefix(variable.SelectAttr("id"), valuePrefix) {
+						valuesList[strings.TrimPrefix(variable.SelectAttr("id"), valuePrefix)] = xccdfValueText(val)
+					}
+				}
+			}
+		}
+		allSetValues := xmlquery.Find(def, "//xccdf-1.2:set-value")
+		for _, variable := range allSetValues {
+			if strings.HasPrefix(variable.SelectAttr("idref"), valuePrefix) {
+				valuesList[strings.TrimPrefix(variable.SelectAttr("idref"), valuePrefix)] = xccdfValueText(variable)
+			}
+		}
+	}
+
+	// override variables which is defined in tailored profile
+	if overrideValueList != nil {
+		for k, v := range overrideValueList {
+			if _, exists := valuesList[k]; exists {
+				valuesList[k] = v
+			}
+		}
+	}
+
+	checkDefinitions := ruleDefs.SelectElements("//xccdf-1.2:Rule")
+	if len(checkDefinitions) == 0 {
+		DBG("WARNING: No rules to query (invalid datastream)")
+		return out, valuesList, selectedChecks
+	}
+
+	// For each of our selected checks, collect the required path info.
+	for _, checkID := range selectedChecks {
+		var found *xmlquery.Node
+		for _, rule := range checkDefinitions {
+			if rule.SelectAttr("id") == checkID {
+				found = rule
+				break
+			}
+		}
+		if found == nil {
+			DBG("WARNING: Couldn't find a check for id %s", checkID)
+			undefined = append(undefined, checkID)
+			continue
+		}
+
+		// This node is called "warning" and contains the path info. It's not an actual "warning" for us here.
+		var warningFound bool
+		warningObjs := found.SelectElements("//xccdf-1.2:warning")
+
+		for _, warn := range warningObjs {
+			if warn == nil {
+				continue
+			}
+			apiPaths := getPathFromWarningXML(warn, valuesList)
+			if len(apiPaths) == 0 {
+				continue
+			}
+			// We only care for the first occurrence that works
+			out = append(out, apiPaths...)
+			warningFound = true
+			break
+		}
+
+		if !warningFound {
+			DBG("Couldn't find 'warning' child of check %s", checkID)
+			continue
+		}
+
+	}
+	return out, valuesList, undefined
+}
+
+// profileLink is a profile of an extends chain along with the document
+// defining it, the tailoring or the data stream
+type profileLink struct {
+	id   string
+	defs *xmlquery.Node
+}
+
+// resolveProfileChain follows the extends attributes from the profile, which
+// is looked up in the tailoring if there's one. The profiles it extends are
+// looked up in the tailoring and then in the data stream. The chain starts
+// with the profile and ends with the profile that extends none.
+func resolveProfileChain(ds, tailoring *xmlquery.Node, profileID string) ([]profileLink, error) {
+	first := profileLink{id: profileID, defs: ds}
+	if tailoring != nil {
+		first.defs = tailoring
+	}
+	chain := []profileLink{first}
+	seen := map[string]bool{profileID: true}
+	for {
+		link := chain[len(chain)-1]
+		node := findProfile(link.id, link.defs)
+		if node == nil {
+			return nil, fmt.Errorf("profile %s was not found", link.id)
+		}
+		extended := node.SelectAttr("extends")
+		if extended == "" {
+			return chain, nil
+		}
+		if seen[extended] {
+			ids := make([]string, 0, len(chain)+1)
+			for _, l := range chain {
+				ids = append(ids, l.id)
+			}
+			return nil, fmt.Errorf("profile %s is extended in a loop: %s", extended,
+				strings.Join(append(ids, extended), " -> "))
+		}
+		seen[extended] = true
+		next := profileLink{id: extended, defs: ds}
+		if tailoring != nil && findProfile(extended, tailoring) != nil {
+			next.defs = tailoring
+		}
+		// The base profile might have been removed from a newer content
+		// bundle, in which case we would silently collect nothing for it.
+		if findProfile(extended, next.defs) == nil {
+			kind := "profile"
+			if link.defs == tailoring {
+				kind = "tailored profile"
+			}
+			return nil, fmt.Errorf("%s %s extends profile %s, which was not found in the data stream",
+				kind, link.id, extended)
+		}
+		chain = append(chain, next)
+	}
+}
+
+// findProfile returns the first Profile with the given ID found in defs
+func findProfile(profileID string, defs ...*xmlquery.Node) *xmlquery.Node {
+	for _, def := range defs {
+		for _, node := range def.SelectElements("//xccdf-1.2:Profile") {
+			if node.SelectAttr("id") == profileID {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// checkSelection records whether a check ends up selected by a profile, and
+// which profile in the extends chain decided it
+type checkSelection struct {
+	id       string
+	selected bool
+	profile  string
+}
+
+// mergeCheckSelections merges the check selections of the profiles of a
+// chain. The extended profiles are applied first, so each profile can select
+// or unselect the checks of the one it extends.
+func mergeCheckSelections(chain []profileLink) map[string]checkSelection {
+	merged := map[string]checkSelection{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		node := findProfile(chain[i].id, chain[i].defs)
+		if node == nil {
+			continue
+		}
+		for _, sel := range node.SelectElements("xccdf-1.2:select") {
+			idRef := sel.SelectAttr("idref")
+			if idRef == "" {
+				continue
+			}
+			merged[idRef] = checkSelection{
+				id:       idRef,
+				selected: sel.SelectAttr("selected") == "true",
+				profile:  chain[i].id,
+			}
+		}
+	}
+	return merged
+}
+
+// resolveCheckSelections returns the check selections of the chain, merged
+// like mergeCheckSelections does, sorted by check ID
+func resolveCheckSelections(chain []profileLink) []checkSelection {
+	merged := mergeCheckSelections(chain)
+	selections := make([]checkSelection, 0, len(merged))
+	for _, sel := range merged {
+		selections = append(selections, sel)
+	}
+	sort.Slice(selections, func(i, j int) bool {
+		return selections[i].id < selections[j].id
+	})
+	return selections
+}
+
+// selectedChecksOf returns the checks the profile of the link selects, in
+// document order, that are still selected once the chain is merged and
+// whose selection the link decided, so each check is collected once
+func selectedChecksOf(link profileLink, merged map[string]checkSelection) []string {
+	node := findProfile(link.id, link.defs)
+	if node == nil {
+		return nil
+	}
+	var checks []string
+	for _, sel := range node.SelectElements("xccdf-1.2:select") {
+		idRef := sel.SelectAttr("idref")
+		if decided, ok := merged[idRef]; ok && decided.selected && decided.profile == link.id {
+			checks = appendMissing(checks, idRef)
+		}
+	}
+	return checks
+}
+
+// profileExists returns whether a Profile with the given ID is defined in ds.
+func profileExists(ds *xmlquery.Node, profileID string) bool {
+	return findProfile(profileID, ds) != nil
+}
+
+// validateContent checks the data stream has profiles and rules, and that the
+// profile is defined by the tailoring if there's one, or else by the data
+// stream, so malformed content or a wrong profile fails the scan instead of
+// collecting nothing
+func validateContent(ds, tailoring *xmlquery.Node, profileID string) error {
+	if ds == nil {
+		return errors.New("no data stream was loaded")
+	}
+	if ds.SelectElement("//xccdf-1.2:Profile") == nil {
+		return errors.New("the data stream defines no XCCDF 1.2 profile")
+	}
+	if ds.SelectElement("//xccdf-1.2:Rule") == nil {
+		return errors.New("the data stream defines no XCCDF 1.2 rule")
+	}
+	if tailoring != nil {
+		if !profileExists(tailoring, profileID) {
+			return fmt.Errorf("profile %s was not found in the tailoring", profileID)
+		}
+		return nil
+	}
+	if !profileExists(ds, profileID) {
+		return fmt.Errorf("profile %s was not found in the data stream", profileID)
+	}
+	return nil
+}
+
+func (c *scapContentDataStream) FetchResources(ctx context.Context) ([]fetchWarning, error) {
+	streamerFn := getStreamerFn
+	snapshot := &resourceSnapshot{}
+	clients := c.resourceFetcherClients
+	if c.consistentSnapshot {
+		streamerFn = snapshot.getStreamerFn
+		// The lists are pinned to the resourceVersion of the first one
+		clients.fetchConcurrency = 1
+	} else if c.preferProtobuf {
+		streamerFn = getProtobufStreamerFn
+	}
+	// The resources only needed on some versions are fetched once the
+	// versions are detected
+	resources, versionGated := splitVersionGated(c.resources)
+	if c.redactBinaryData {
+		resources = redactConfigMapBinaryData(resources)
+		versionGated = redactConfigMapBinaryData(versionGated)
+	}
+	if c.batchConfigFetch {
+		prefetch := &configPrefetch{next: streamerFn}
+		prefetch.fetch(ctx, clients, resources)
+		streamerFn = prefetch.getStreamerFn
+	}
+	c.filterErrors = filterErrorCounts{}
+	warningsLog := newWarningsLog(c.warningsFile)
+	defer warningsLog.close()
+	recorder := fetchRecorder{filterErrors: c.filterErrors, warnings: warningsLog, filterEnv: c.filterEnv,
+		filterValues: c.filterValues}
+	// A snapshot is a single point in time, which cached resources aren't
+	if !c.consistentSnapshot {
+		recorder.cache = newFetchCache(c.cacheDir, c.cacheTTL, c.cacheFingerprint())
+		if err := recorder.cache.prune(); err != nil {
+			LOG("Couldn't remove the stale cached resources: %v", err)
+		}
+	}
+	found, warnings, err := fetchRecording(ctx, streamerFn, clients, resources, recorder)
+	if err == nil && len(versionGated) > 0 {
+		needed, skipped := filterVersionGated(versionGated, clusterVersions(found))
+		for _, skip := range skipped {
+			warnings = append(warnings, fetchWarning{category: warningCategoryVersionGated, message: skip})
+			warningsLog.append(skip)
+		}
+		var gatedFound map[string][]byte
+		var gatedWarnings []fetchWarning
+		gatedFound, gatedWarnings, err = fetchRecording(ctx, streamerFn, clients, needed, recorder)
+		for dumpPath, contents := range gatedFound {
+			found[dumpPath] = contents
+		}
+		warnings = append(warnings, gatedWarnings...)
+	}
+	warnings = append(warnings, newFetchWarnings(warningCategorySnapshot, snapshot.warnings...)...)
+	if c.impersonateUser != "" {
+		// Make it clear in the scan that the results reflect what this
+		// user can see, and not the whole cluster
+		warnings = append(newFetchWarnings(warningCategoryImpersonation,
+			fmt.Sprintf("The resources were fetched impersonating %s", c.impersonateUser)), warnings...)
+	}
+	if len(c.undefinedRules) > 0 {
+		// Usually a sign of a botched content update
+		warnings = append(newFetchWarnings(warningCategoryUndefinedRules, undefinedRulesWarning(c.undefinedRules)), warnings...)
+	}
+	if skipWarning := versionSkippedWarning(c.resources, c.skipStaged, c.versionCheck); skipWarning != "" {
+		warnings = append(newFetchWarnings(warningCategoryVersion, skipWarning), warnings...)
+	}
+	if len(c.overriddenValues) > 0 {
+		// Meant for testing, so it shouldn't go unnoticed in production
+		warnings = append(newFetchWarnings(warningCategoryValueOverrides, valueOverridesWarning(c.overriddenValues)), warnings...)
+	}
+	if err != nil {
+		return warnings, err
+	}
+	if !c.skipKubeletConfig {
+		warnings = append(warnings, newFetchWarnings(warningCategoryKubeletConfig,
+			dropInvalidKubeletConfigs(found, nil)...)...)
+	}
+	if !c.skipKubeletConfig && c.dumpPathScheme != dumpPathSchemeV1 {
+		var kubeletWarnings []string
+		found, kubeletWarnings, err = saveConsistentKubeletResult(found, nil)
+		warnings = append(warnings, newFetchWarnings(warningCategoryKubeletConfig, kubeletWarnings...)...)
+		if err != nil {
+			return warnings, err
+		}
+		warnings = append(warnings, newFetchWarnings(warningCategoryKubeletConfig,
+			markThinKubeletRoles(c.resources, found, nil, c.minNodeCoverage)...)...)
+	}
+	c.detectedVersions = clusterVersions(found)
+	if detectionErr := versionDetectionError(c.versionDetection, c.detectedVersions); detectionErr != nil {
+		if c.versionDetection == versionDetectionFail {
+			return warnings, detectionErr
+		}
+		warnings = append(warnings, newFetchWarnings(warningCategoryVersion, detectionErr.Error())...)
+	}
+	if c.versionCheck != "" {
+		mismatches := contentVersionMismatches(contentVersionRanges(c.dataStream), c.detectedVersions)
+		warnings = append(warnings, newFetchWarnings(warningCategoryVersion, mismatches...)...)
+		if len(mismatches) > 0 && c.versionCheck == versionCheckFail {
+			return warnings, fmt.Errorf("the content doesn't target this cluster: %s", strings.Join(mismatches, "; "))
+		}
+	}
+	c.found = found
+	return warnings, nil
+}
+
+// cacheFingerprint identifies what the cached resources were fetched for: the
+// cluster, the content and tailoring, and the options changing what the
+// filters return
+func (c *scapContentDataStream) cacheFingerprint() string {
+	return fetchCacheFingerprint(c.apiServer, c.kubeContext, c.contentDigest, c.tailoringDigest, c.impersonateUser,
+		strings.Join(c.machineConfigPools, ","), strings.Join(c.mcConfigSections, ","),
+		strings.Join(c.filterEnv, ","), c.filterValues.String())
+}
+
+// redactConfigMapBinaryData returns a copy of the paths where the ConfigMaps
+// referenced by name keep the keys, but not the values, of their binary data
+func redactConfigMapBinaryData(paths []utils.ResourcePath) []utils.ResourcePath {
+	redacted := make([]utils.ResourcePath, len(paths))
+	for i, rpath := range paths {
+		if rpath.Filter == utils.ConfigMapDataFilter {
+			rpath.Filter = utils.ConfigMapRedactedDataFilter
+		}
+		redacted[i] = rpath
+	}
+	return redacted
+}
+
+// resourceStreamer is an interface capable of streaming a particular URI
+type resourceStreamer interface {
+	Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error)
+}
+
+type streamerDispatcherFn func(string) resourceStreamer
+
+const (
+	defaultFetchRetries    = 3
+	defaultFetchRetryDelay = time.Second
+	// The longest a retry waits for without a Retry-After
+	maxFetchRetryDelay = time.Minute
+)
+
+// isTransientFetchError tells whether the fetch failed because the API
+// server was overloaded or failing, and may succeed if retried
+func isTransientFetchError(err error) bool {
+	return kerrors.IsTooManyRequests(err) || kerrors.IsServerTimeout(err) ||
+		kerrors.IsServiceUnavailable(err) || kerrors.IsInternalError(err)
+}
+
+// fetchRetryDelay returns how long to wait before the retry following the
+// given attempt: the delay the API server asked for, or else the base delay
+// doubled on each attempt, of which a random half is waited, so the
+// concurrent fetches don't all retry at once. Neither is longer than
+// maxFetchRetryDelay.
+func fetchRetryDelay(err error, base time.Duration, attempt int) time.Duration {
+	if seconds, ok := kerrors.SuggestsClientDelay(err); ok {
+		if suggested := time.Duration(seconds) * time.Second; suggested < maxFetchRetryDelay {
+			return suggested
+		}
+		return maxFetchRetryDelay
+	}
+	delay := base
+	for i := 0; i < attempt && delay < maxFetchRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxFetchRetryDelay {
+		delay = maxFetchRetryDelay
+	}
+	// #nosec
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// streamWithRetries streams the resource, retrying up to
+// rfClients.fetchRetries times while the errors are transient. The error of
+// the last attempt is returned once they're used up.
+func streamWithRetries(ctx context.Context, streamer resourceStreamer, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	for attempt := 0; ; attempt++ {
+		stream, err := streamer.Stream(ctx, rfClients)
+		if !isTransientFetchError(err) || attempt >= rfClients.fetchRetries {
+			return stream, err
+		}
+		delay := fetchRetryDelay(err, rfClients.fetchRetryDelay, attempt)
+		DBG("Retrying the fetch in %s after a transient error: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// getStreamerFn returns a structure implementing resourceStreamer interface based on the
+// uri passed to it
+func getStreamerFn(uri string) resourceStreamer {
+	if uri == machineConfigsURI {
+		return &mcStreamer{}
+	}
+	if isSecretURI(uri) {
+		return &secretStreamer{streamer: &uriStreamer{uri: uri}}
+	}
+
+	return &uriStreamer{
+		uri: uri,
+	}
+}
+
+// uriStreamer implements resourceStreamer for fetching a generic URI
 type uriStreamer struct {
 	uri string
 }
 
-func (us *uriStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
-	return rfClients.clientset.RESTClient().Get().RequestURI(us.uri).Stream(ctx)
+func (us *uriStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	return rfClients.clientset.RESTClient().Get().RequestURI(us.uri).Stream(ctx)
+}
+
+// getProtobufStreamerFn is a streamerDispatcherFn requesting the resources
+// as protobuf
+func getProtobufStreamerFn(uri string) resourceStreamer {
+	if uri == machineConfigsURI {
+		return &mcStreamer{}
+	}
+	if isSecretURI(uri) {
+		return &secretStreamer{streamer: &protobufStreamer{uri: uri}}
+	}
+	return &protobufStreamer{uri: uri}
+}
+
+// protobufStreamer implements resourceStreamer for fetching a URI as protobuf
+// if the API server supports it for the resource, and as JSON otherwise. The
+// protobuf responses are converted to JSON for the filters.
+type protobufStreamer struct {
+	uri string
+}
+
+func (ps *protobufStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	body, err := rfClients.clientset.RESTClient().Get().RequestURI(ps.uri).
+		SetHeader("Accept", protobufAcceptHeader).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(body, protobufMagic) {
+		// e.g. custom resources, or the kubelet's configz
+		return &bufCloser{bytes.NewBuffer(body)}, nil
+	}
+	converted, err := protobufToJSON(body)
+	if err != nil {
+		DBG("Couldn't convert %s from protobuf, fetching it as JSON: %v", ps.uri, err)
+		return (&uriStreamer{uri: ps.uri}).Stream(ctx, rfClients)
+	}
+	return &bufCloser{bytes.NewBuffer(converted)}, nil
+}
+
+// protobufToJSON converts a protobuf-encoded built-in object or list to JSON
+func protobufToJSON(body []byte) ([]byte, error) {
+	obj, gvk, err := clientgoscheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Protobuf messages don't carry the kind, unlike the JSON the API
+	// server returns
+	obj.GetObjectKind().SetGroupVersionKind(*gvk)
+	return json.Marshal(obj)
+}
+
+// The placeholder the values of the data of the Secrets are replaced with
+const secretRedactedValue = "<redacted>"
+
+// isSecretURI tells whether the URI points to a Secret or a list of them
+func isSecretURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 3 || segments[0] != "api" {
+		return false
+	}
+	segments = segments[2:]
+	if len(segments) >= 2 && segments[0] == "namespaces" {
+		segments = segments[2:]
+	}
+	// Not the subresources of a Secret, which don't exist anyway
+	return (len(segments) == 1 || len(segments) == 2) && segments[0] == "secrets"
+}
+
+// secretStreamer implements resourceStreamer for fetching Secrets without
+// their data. The values of .data are replaced with a placeholder, so the
+// checks can still tell which keys a Secret has, and .stringData is removed.
+// It's done before any filter runs, so no filter can save the data.
+type secretStreamer struct {
+	streamer resourceStreamer
+}
+
+func (ss *secretStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	stream, err := ss.streamer.Stream(ctx, rfClients)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	obj := map[string]interface{}{}
+	decoder := json.NewDecoder(stream)
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("failed to decode the Secrets: %w", err)
+	}
+	if items, ok := obj["items"].([]interface{}); ok {
+		for _, item := range items {
+			if secret, ok := item.(map[string]interface{}); ok {
+				redactSecret(secret)
+			}
+		}
+	} else {
+		redactSecret(obj)
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the redacted Secrets: %w", err)
+	}
+	return &bufCloser{bytes.NewBuffer(body)}, nil
+}
+
+// redactSecret replaces the values of the data of the Secret with a
+// placeholder and drops its stringData, as well as the copy of the whole
+// Secret kubectl apply keeps in an annotation
+func redactSecret(secret map[string]interface{}) {
+	delete(secret, "stringData")
+	if metadata, ok := secret["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, v1.LastAppliedConfigAnnotation)
+		}
+	}
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok {
+		delete(secret, "data")
+		return
+	}
+	for key := range data {
+		data[key] = secretRedactedValue
+	}
+}
+
+// mcStreamer implements resourceStreamer for fetching a list of MachineConfigs
+type mcStreamer struct {
+	// If set, the first page is fetched at the snapshot's resourceVersion
+	snapshot *resourceSnapshot
+}
+
+// bufCloser is a kludge so that mcStreamer's Stream() method can return an io.ReadCloser
+type bufCloser struct {
+	*bytes.Buffer
+}
+
+// Close is a dummy method because a buffer doesn't have to be closed, just enables us to return io.ReadCloser
+// from mcStreamer's Stream() method
+func (bc *bufCloser) Close() error {
+	return nil
+}
+
+// Stream fetches MachineConfigs in batches of pageSize, removes the file contents from each MC in the batch,
+// adds each batch to a resulting list which is finally returned as JSON
+func (ms *mcStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	selectors, err := machineConfigPoolSelectors(ctx, rfClients)
+	if err != nil {
+		return nil, err
+	}
+	if rfClients.mcsToDisk {
+		return ms.streamToDisk(ctx, rfClients, selectors)
+	}
+
+	// Like the API server, an empty list has empty items and not null
+	mcfgListNoFiles := mcfgv1.MachineConfigList{Items: []mcfgv1.MachineConfig{}}
+	err = ms.eachPage(ctx, rfClients, selectors, func(mcs []mcfgv1.MachineConfig) error {
+		mcfgListNoFiles.Items = append(mcfgListNoFiles.Items, mcs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jsonSerializer := runtimejson.NewSerializerWithOptions(runtimejson.DefaultMetaFactory,
+		rfClients.scheme,
+		rfClients.scheme,
+		runtimejson.SerializerOptions{Pretty: true})
+	buf := &bufCloser{&bytes.Buffer{}}
+	if err := jsonSerializer.Encode(&mcfgListNoFiles, buf); err != nil {
+		return nil, fmt.Errorf("failed to serialize MC list: %w", err)
+	}
+	return buf, nil
+}
+
+// streamToDisk writes the MachineConfigs to a temporary file as each batch
+// is fetched, so only one batch is held in memory, and returns the file. The
+// list is the same as the one Stream returns otherwise, without the
+// indentation. The file is removed once closed.
+func (ms *mcStreamer) streamToDisk(ctx context.Context, rfClients resourceFetcherClients,
+	selectors []labels.Selector) (io.ReadCloser, error) {
+	file, err := ioutil.TempFile("", "machineconfigs-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the MC list file: %w", err)
+	}
+	tmp := &tempFileCloser{file}
+	w := bufio.NewWriter(file)
+	fail := func(err error) (io.ReadCloser, error) {
+		tmp.Close()
+		return nil, err
+	}
+
+	// The list itself has no metadata, like the one Stream encodes
+	if _, err := w.WriteString(`{"metadata":{},"items":[`); err != nil {
+		return fail(fmt.Errorf("failed to write the MC list: %w", err))
+	}
+	written := 0
+	err = ms.eachPage(ctx, rfClients, selectors, func(mcs []mcfgv1.MachineConfig) error {
+		for i := range mcs {
+			body, err := json.Marshal(&mcs[i])
+			if err != nil {
+				return fmt.Errorf("failed to serialize MC %s: %w", mcs[i].Name, err)
+			}
+			if written > 0 {
+				body = append([]byte{','}, body...)
+			}
+			if _, err := w.Write(body); err != nil {
+				return fmt.Errorf("failed to write the MC list: %w", err)
+			}
+			written++
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := w.WriteString("]}\n"); err != nil {
+		return fail(fmt.Errorf("failed to write the MC list: %w", err))
+	}
+	if err := w.Flush(); err != nil {
+		return fail(fmt.Errorf("failed to write the MC list: %w", err))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to read the MC list: %w", err))
+	}
+	return tmp, nil
+}
+
+// eachPage fetches the MachineConfigs selected by the pools in batches of
+// pageSize, and calls do with each batch once the file contents are removed
+func (ms *mcStreamer) eachPage(ctx context.Context, rfClients resourceFetcherClients, selectors []labels.Selector,
+	do func(mcs []mcfgv1.MachineConfig) error) error {
+	const pageSize = 5
+
+	continueToken := ""
+	pinnedVersion := ""
+	if ms.snapshot != nil {
+		pinnedVersion = ms.snapshot.resourceVersion
+	}
+	for {
+		mcfgList := mcfgv1.MachineConfigList{}
+		listOpts := runtimeclient.ListOptions{
+			Limit: int64(pageSize),
+		}
+		if len(selectors) == 1 && !selectors[0].Empty() {
+			// The API server only returns the MachineConfigs of the pool
+			listOpts.LabelSelector = selectors[0]
+		}
+		if continueToken != "" {
+			// The continue token already pins the following pages to the
+			// resourceVersion of the first one
+			listOpts.Continue = continueToken
+		} else if pinnedVersion != "" {
+			listOpts.Raw = &metav1.ListOptions{
+				ResourceVersion:      pinnedVersion,
+				ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+			}
+		}
+		err := rfClients.client.List(ctx, &mcfgList, &listOpts)
+		if continueToken == "" && pinnedVersion != "" && ms.snapshot.fallsBack(machineConfigsURI, err) {
+			pinnedVersion = ""
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list MachineConfigs: %w", err)
+		}
+		if continueToken == "" && ms.snapshot != nil {
+			ms.snapshot.pin(mcfgList.ResourceVersion)
+		}
+
+		mcfgList.Items = machineConfigsOfPools(mcfgList.Items, selectors)
+		mcfgListNoFilesBatch, err := filterMcList(&mcfgList, rfClients.mcConfigSections)
+		if err != nil {
+			return fmt.Errorf("failed to filter machine configs: %w", err)
+		}
+		if err := do(mcfgListNoFilesBatch.Items); err != nil {
+			return err
+		}
+
+		continueToken = mcfgList.ListMeta.Continue
+		if continueToken == "" {
+			return nil
+		}
+	}
+}
+
+// tempFileCloser removes the temporary file once it's closed
+type tempFileCloser struct {
+	*os.File
+}
+
+func (tc *tempFileCloser) Close() error {
+	err := tc.File.Close()
+	if removeErr := os.Remove(tc.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// machineConfigPoolSelectors returns the machineConfigSelectors of
+// rfClients.machineConfigPools, or nil if all the MachineConfigs are fetched
+func machineConfigPoolSelectors(ctx context.Context, rfClients resourceFetcherClients) ([]labels.Selector, error) {
+	var selectors []labels.Selector
+	for _, name := range rfClients.machineConfigPools {
+		pool := mcfgv1.MachineConfigPool{}
+		if err := rfClients.client.Get(ctx, runtimeclient.ObjectKey{Name: name}, &pool); err != nil {
+			return nil, fmt.Errorf("failed to get MachineConfigPool %s: %w", name, err)
+		}
+		// Like for the MCO, a pool without a selector has no MachineConfigs
+		selector, err := metav1.LabelSelectorAsSelector(pool.Spec.MachineConfigSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid machineConfigSelector of MachineConfigPool %s: %w", name, err)
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// machineConfigsOfPools returns the MachineConfigs matched by any of the
+// selectors, or all of them without selectors
+func machineConfigsOfPools(mcs []mcfgv1.MachineConfig, selectors []labels.Selector) []mcfgv1.MachineConfig {
+	if len(selectors) == 0 {
+		return mcs
+	}
+	matched := make([]mcfgv1.MachineConfig, 0, len(mcs))
+	for i := range mcs {
+		for _, selector := range selectors {
+			if selector.Matches(labels.Set(mcs[i].Labels)) {
+				matched = append(matched, mcs[i])
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// The Ignition sections of the MachineConfigs that can be kept. The ignition
+// section, with the version of the config, is always kept.
+var mcConfigSections = map[string]func(ign *ign3types.Config){
+	"passwd":  func(ign *ign3types.Config) { ign.Passwd = ign3types.Passwd{} },
+	"storage": func(ign *ign3types.Config) { ign.Storage = ign3types.Storage{} },
+	"systemd": func(ign *ign3types.Config) { ign.Systemd = ign3types.Systemd{} },
+}
+
+// validateMCConfigSections checks that the sections are Ignition sections
+// that can be kept
+func validateMCConfigSections(sections []string) error {
+	for _, section := range sections {
+		if _, ok := mcConfigSections[section]; !ok {
+			return fmt.Errorf("unknown Ignition section %s, expected passwd, storage or systemd", section)
+		}
+	}
+	return nil
+}
+
+// filterMcList removes the files from the Ignition configs of the
+// MachineConfigs. If sections are given, the other sections are removed as
+// well.
+func filterMcList(mcListIn *mcfgv1.MachineConfigList, sections []string) (*mcfgv1.MachineConfigList, error) {
+	mcfgListNoFiles := mcfgv1.MachineConfigList{}
+	mcfgListNoFiles.TypeMeta = mcListIn.TypeMeta
+	mcfgListNoFiles.ListMeta = mcListIn.ListMeta
+	kept := map[string]bool{}
+	for _, section := range sections {
+		kept[section] = true
+	}
+
+	for i := 0; i < len(mcListIn.Items); i++ {
+		mc := mcListIn.Items[i]
+		if len(mc.Spec.Config.Raw) > 0 {
+			// if Ignition exists, filter out all the potentially large files
+			ign, err := mcfgcommon.ParseAndConvertConfig(mc.Spec.Config.Raw)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse MC %s: %w", mc.Name, err)
+			}
+			ign.Storage.Files = nil // just get rid of the files the easy way
+			if len(sections) > 0 {
+				for name, drop := range mcConfigSections {
+					if !kept[name] {
+						drop(&ign)
+					}
+				}
+			}
+			rawOutIgn, err := json.Marshal(ign)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal Ignition object back to a a raw object: %w", err)
+			}
+			mc.Spec.Config.Raw = rawOutIgn
+		}
+		mcfgListNoFiles.Items = append(mcfgListNoFiles.Items, mc)
+	}
+
+	return &mcfgListNoFiles, nil
+}
+
+// resourceSnapshot makes the list fetches see a single point in time of the
+// cluster. The resourceVersion of the first list that is fetched is pinned,
+// and the following lists are requested at exactly that version. Lists that
+// the API server can't serve at that version, e.g. because it was compacted
+// in the meantime, are fetched at their latest version with a warning.
+type resourceSnapshot struct {
+	resourceVersion string
+	warnings        []string
+}
+
+// getStreamerFn is a streamerDispatcherFn fetching the lists within the
+// snapshot
+func (s *resourceSnapshot) getStreamerFn(uri string) resourceStreamer {
+	if uri == machineConfigsURI {
+		return &mcStreamer{snapshot: s}
+	}
+	var streamer resourceStreamer = &snapshotStreamer{uri: uri, snapshot: s}
+	if !isListURI(uri) {
+		streamer = &uriStreamer{uri: uri}
+	}
+	if isSecretURI(uri) {
+		return &secretStreamer{streamer: streamer}
+	}
+	return streamer
+}
+
+// pin records the resourceVersion of the first list fetched
+func (s *resourceSnapshot) pin(resourceVersion string) {
+	if s.resourceVersion != "" || resourceVersion == "" {
+		return
+	}
+	LOG("Fetching the lists at resourceVersion %s", resourceVersion)
+	s.resourceVersion = resourceVersion
+}
+
+// fallsBack tells whether err means that the list couldn't be served at the
+// pinned resourceVersion, and records a warning if so.
+func (s *resourceSnapshot) fallsBack(uri string, err error) bool {
+	if !kerrors.IsResourceExpired(err) && !kerrors.IsGone(err) && !kerrors.IsBadRequest(err) {
+		return false
+	}
+	s.warnings = append(s.warnings, fmt.Sprintf("could not fetch %s at resourceVersion %s, "+
+		"its latest version was fetched instead: %v", uri, s.resourceVersion, err))
+	return true
+}
+
+// isListURI tells whether the URI points to a collection of resources, either
+// cluster-wide or in a namespace, rather than a single object or subresource.
+func isListURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	// Skip the /api/<version> or /apis/<group>/<version> prefix
+	switch {
+	case len(segments) > 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) > 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		return false
+	}
+	return len(segments) == 1 || (len(segments) == 3 && segments[0] == "namespaces")
+}
+
+// snapshotStreamer implements resourceStreamer for fetching a list within a
+// resourceSnapshot
+type snapshotStreamer struct {
+	uri      string
+	snapshot *resourceSnapshot
+}
+
+func (ss *snapshotStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	if ss.snapshot.resourceVersion == "" {
+		// The first list has to be read to learn its resourceVersion
+		body, err := rfClients.clientset.RESTClient().Get().RequestURI(ss.uri).DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ss.snapshot.pin(listResourceVersion(body))
+		return &bufCloser{bytes.NewBuffer(body)}, nil
+	}
+
+	stream, err := rfClients.clientset.RESTClient().Get().RequestURI(ss.uri).
+		Param("resourceVersion", ss.snapshot.resourceVersion).
+		Param("resourceVersionMatch", string(metav1.ResourceVersionMatchExact)).
+		Stream(ctx)
+	if ss.snapshot.fallsBack(ss.uri, err) {
+		return (&uriStreamer{uri: ss.uri}).Stream(ctx, rfClients)
+	}
+	return stream, err
+}
+
+// configPrefetch fetches the OpenShift configuration objects the resources
+// point to ahead of the fetch, in fewer requests. The objects of a kind
+// that are needed along with others of the same kind or with their whole
+// list are taken from a single list request, and the other objects are
+// fetched concurrently, up to rfClients.fetchConcurrency kinds at a time.
+// Anything that couldn't be prefetched, e.g. because
+// it's forbidden or missing, is left to the fetch, which then reports it
+// like it would have without prefetching.
+type configPrefetch struct {
+	// The prefetched objects and lists by URI
+	bodies map[string][]byte
+	// The dispatcher fetching what wasn't prefetched
+	next streamerDispatcherFn
+}
+
+// getStreamerFn is a streamerDispatcherFn serving the prefetched URIs
+func (p *configPrefetch) getStreamerFn(uri string) resourceStreamer {
+	if body, ok := p.bodies[uri]; ok {
+		return &prefetchedStreamer{body: body}
+	}
+	return p.next(uri)
+}
+
+func (p *configPrefetch) fetch(ctx context.Context, rfClients resourceFetcherClients, resources []utils.ResourcePath) {
+	p.bodies = map[string][]byte{}
+	names := map[string][]string{}
+	listed := map[string]bool{}
+	for _, rpath := range resources {
+		if !strings.HasPrefix(rpath.ObjPath, configAPIPrefix) || strings.Contains(rpath.ObjPath, "?") {
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(rpath.ObjPath, configAPIPrefix), "/")
+		switch len(segments) {
+		case 1:
+			listed[segments[0]] = true
+		case 2:
+			names[segments[0]] = appendMissing(names[segments[0]], segments[1])
+		}
+	}
+
+	kinds := make([]string, 0, len(names))
+	for resource := range names {
+		kinds = append(kinds, resource)
+	}
+	sort.Strings(kinds)
+	var mutex sync.Mutex
+	_ = forEachConcurrently(len(kinds), rfClients.fetchConcurrency, func(i int) error {
+		bodies := p.fetchKind(ctx, rfClients, kinds[i], names[kinds[i]], listed[kinds[i]])
+		mutex.Lock()
+		defer mutex.Unlock()
+		for uri, body := range bodies {
+			p.bodies[uri] = body
+		}
+		return nil
+	})
+	DBG("Prefetched %d OpenShift configuration URIs", len(p.bodies))
+}
+
+// fetchKind fetches the named objects of the resource, from its list if
+// more than one is needed or the list itself is, and returns them by URI
+func (p *configPrefetch) fetchKind(ctx context.Context, rfClients resourceFetcherClients, resource string,
+	names []string, listed bool) map[string][]byte {
+	bodies := map[string][]byte{}
+	if len(names) == 1 && !listed {
+		uri := configAPIPrefix + resource + "/" + names[0]
+		if body, err := readStream(ctx, p.next(uri), rfClients); err == nil {
+			bodies[uri] = body
+		}
+		return bodies
+	}
+
+	listURI := configAPIPrefix + resource
+	list, err := readStream(ctx, p.next(listURI), rfClients)
+	if err != nil {
+		DBG("Couldn't prefetch %s, fetching its objects one by one: %v", listURI, err)
+		return bodies
+	}
+	items, err := listItemsByName(list)
+	if err != nil {
+		DBG("Couldn't split %s, fetching its objects one by one: %v", listURI, err)
+		return bodies
+	}
+	if listed {
+		bodies[listURI] = list
+	}
+	for _, name := range names {
+		// The objects missing from the list are fetched, and reported, as usual
+		if item, ok := items[name]; ok {
+			bodies[listURI+"/"+name] = item
+		}
+	}
+	return bodies
+}
+
+// listItemsByName splits a list response into its items by name. The items
+// are given the kind and apiVersion of the list's objects if they lack them,
+// so they look like the objects fetched one by one.
+func listItemsByName(list []byte) (map[string][]byte, error) {
+	parsed := struct {
+		Kind       string            `json:"kind"`
+		APIVersion string            `json:"apiVersion"`
+		Items      []json.RawMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal(list, &parsed); err != nil {
+		return nil, err
+	}
+	items := make(map[string][]byte, len(parsed.Items))
+	for _, raw := range parsed.Items {
+		item := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, err
+		}
+		obj := unstructured.Unstructured{Object: item}
+		if obj.GetName() == "" {
+			continue
+		}
+		if obj.GetKind() != "" && obj.GetAPIVersion() != "" {
+			items[obj.GetName()] = raw
+			continue
+		}
+		obj.SetKind(strings.TrimSuffix(parsed.Kind, "List"))
+		obj.SetAPIVersion(parsed.APIVersion)
+		body, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		items[obj.GetName()] = body
+	}
+	return items, nil
+}
+
+func readStream(ctx context.Context, streamer resourceStreamer, rfClients resourceFetcherClients) ([]byte, error) {
+	stream, err := streamer.Stream(ctx, rfClients)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return ioutil.ReadAll(stream)
+}
+
+// prefetchedStreamer implements resourceStreamer for a body fetched ahead
+type prefetchedStreamer struct {
+	body []byte
+}
+
+func (ps *prefetchedStreamer) Stream(_ context.Context, _ resourceFetcherClients) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(ps.body)), nil
+}
+
+// listResourceVersion returns the resourceVersion of a list response, or an
+// empty string if it has none
+func listResourceVersion(body []byte) string {
+	list := struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return ""
+	}
+	return list.Metadata.ResourceVersion
+}
+
+func fetch(ctx context.Context, streamDispatcher streamerDispatcherFn, rfClients resourceFetcherClients, objects []utils.ResourcePath) (map[string][]byte, []string, error) {
+	found, warnings, err := fetchRecording(ctx, streamDispatcher, rfClients, objects, fetchRecorder{})
+	return found, warningMessages(warnings), err
+}
+
+// fetchRecorder keeps track of what a fetch runs into as it goes. Either
+// field may be nil.
+type fetchRecorder struct {
+	// The filter errors by kind and dump path
+	filterErrors filterErrorCounts
+	// Where the warnings are appended as they're raised
+	warnings *warningsLog
+	// The runtime values the filters can read from $ENV
+	filterEnv filterEnv
+	// The XCCDF values the filters can read as variables
+	filterValues filterValues
+	// Where the fetched resources are cached
+	cache *fetchCache
+}
+
+// fetchRecording is fetch, also recording the filter errors and warnings in
+// rec. Up to rfClients.fetchConcurrency objects are fetched at a time, and a
+// fatal error cancels the fetches in flight. The results and warnings are
+// merged in the order of the objects, as if they were fetched one by one.
+func fetchRecording(ctx context.Context, streamDispatcher streamerDispatcherFn, rfClients resourceFetcherClients,
+	objects []utils.ResourcePath, rec fetchRecorder) (map[string][]byte, []fetchWarning, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fetched := make([]fetchedObject, len(objects))
+	// Guards rec and fatalErr
+	var mutex sync.Mutex
+	var fatalErr error
+
+	_ = forEachConcurrently(len(objects), rfClients.fetchConcurrency, func(i int) error {
+		// Bail out between requests if the scan was cancelled
+		err := ctx.Err()
+		if err == nil {
+			err = fetchObject(ctx, streamDispatcher, rfClients, objects[i], &fetched[i], rec, &mutex)
+		}
+		// Only what was fetched without a hitch is cached
+		if obj := &fetched[i]; err == nil && obj.found && !obj.cached && len(obj.warnings) == 0 {
+			if cacheErr := rec.cache.put(objects[i], obj.body); cacheErr != nil {
+				LOG("Couldn't cache %s: %v", objects[i].ObjPath, cacheErr)
+			}
+		}
+		if err != nil {
+			// The error is kept before the other fetches are cancelled, so
+			// it isn't mistaken for theirs
+			mutex.Lock()
+			if fatalErr == nil {
+				fatalErr = err
+			}
+			mutex.Unlock()
+			cancel()
+		}
+		return err
+	})
+
+	var warnings []fetchWarning
+	results := map[string][]byte{}
+	for i, rpath := range objects {
+		warnings = append(warnings, fetched[i].warnings...)
+		if fetched[i].found {
+			results[rpath.DumpPath] = fetched[i].body
+		}
+	}
+	if fatalErr != nil {
+		return nil, warnings, fatalErr
+	}
+	return results, warnings, nil
+}
+
+// fetchedObject is what the fetch of an object returned
+type fetchedObject struct {
+	body     []byte
+	found    bool
+	cached   bool
+	warnings []fetchWarning
+}
+
+// fetchObject fetches and filters rpath into obj. The mutex guards rec,
+// which the concurrent fetches share.
+func fetchObject(ctx context.Context, streamDispatcher streamerDispatcherFn, rfClients resourceFetcherClients,
+	rpath utils.ResourcePath, obj *fetchedObject, rec fetchRecorder, mutex *sync.Mutex) error {
+	warn := func(category, warning string) {
+		obj.warnings = append(obj.warnings, fetchWarning{category: category, message: warning})
+		mutex.Lock()
+		defer mutex.Unlock()
+		rec.warnings.append(warning)
+	}
+	addFilterError := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		rec.filterErrors.add(rpath.DumpPath, err)
+	}
+	save := func(body []byte) {
+		obj.body = body
+		obj.found = true
+	}
+
+	uri := rpath.ObjPath
+	if body, ok := rec.cache.get(rpath); ok {
+		LOG("Using the cached URI: '%s'", uri)
+		save(body)
+		obj.cached = true
+		return nil
+	}
+	LOG("Fetching URI: '%s'", uri)
+	streamer := streamDispatcher(uri)
+	stream, err := streamWithRetries(ctx, streamer, rfClients)
+	if isTransientFetchError(err) {
+		warn(warningCategoryFetch, fmt.Sprintf("could not fetch %s after %d retries: %v", uri, rfClients.fetchRetries, err))
+		return nil
+	} else if meta.IsNoMatchError(err) || kerrors.IsForbidden(err) || kerrors.IsNotFound(err) {
+		DBG("Encountered non-fatal error to be persisted in the scan: %s", err)
+		objerr := fmt.Errorf("could not fetch %s: %w", uri, err)
+		warn(warningCategoryFetch, objerr.Error())
+		// for 404s we'll add a warning comment in the object so openSCAP can read and process it
+		if kerrors.IsNotFound(err) {
+			save([]byte(kubeAPIErrorPrefix + kerrors.ReasonForError(err)))
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("streaming URIs failed: %w", err)
+	}
+	defer stream.Close()
+	if rpath.Filter != "" {
+		// Filters over list items are applied while the list is
+		// being read, so huge lists don't have to be held in memory
+		if itemFilter, ok := getListItemFilter(rpath.Filter); ok {
+			DBG("Applying filter '%s' to the items of path '%s'", rpath.Filter, rpath.ObjPath)
+			filteredBody, filterErr := filterListItems(ctx, stream, rpath.Filter, itemFilter, rec.filterEnv,
+				rec.filterValues, rpath.AllowMultiple)
+			addFilterError(filterErr)
+			if errors.Is(filterErr, errEmptyBody) {
+				DBG("no data in request body")
+				return nil
+			} else if errors.Is(filterErr, MoreThanOneObjErr) {
+				warn(warningCategoryFilter, filterErr.Error())
+			} else if errors.Is(filterErr, errUndefinedFilterVariable) {
+				warn(warningCategoryFilter, fmt.Sprintf("could not filter %s: %v", uri, filterErr))
+				return nil
+			} else if filterErr != nil {
+				return fmt.Errorf("couldn't filter the items of '%s': %w", uri, filterErr)
+			}
+			save(filteredBody)
+			return nil
+		}
+	}
+	body, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		DBG("no data in request body")
+		return nil
+	}
+	if rpath.Filter != "" {
+		DBG("Applying filter '%s' to path '%s'", rpath.Filter, rpath.ObjPath)
+		filteredBody, filterErr := filter(ctx, body, rpath.Filter, rec.filterEnv, rec.filterValues, rpath.AllowMultiple)
+		addFilterError(filterErr)
+		if errors.Is(filterErr, MoreThanOneObjErr) {
+			warn(warningCategoryFilter, filterErr.Error())
+		} else if errors.Is(filterErr, errUndefinedFilterVariable) {
+			warn(warningCategoryFilter, fmt.Sprintf("could not filter %s: %v", uri, filterErr))
+			return nil
+		} else if filterErr != nil {
+			return fmt.Errorf("couldn't filter '%s': %w", body, filterErr)
+		}
+		save(filteredBody)
+	} else {
+		save(body)
+	}
+	return nil
+}
+
+// markThinKubeletRoles replaces the KubeletConfig of the roles fewer than
+// minCoverage percent of whose nodes returned one with an error, so the
+// nodes that are e.g. rebooting don't make a role look consistent from a thin
+// sample. The nodes' own KubeletConfigs are kept.
+func markThinKubeletRoles(resources []utils.ResourcePath, found map[string][]byte, warnings []string,
+	minCoverage int) []string {
+	if minCoverage <= 0 {
+		return warnings
+	}
+	expected := map[string]int{}
+	returned := map[string]int{}
+	for _, rpath := range resources {
+		role, _ := getRoleNodeNameFromDumpPath(rpath.DumpPath)
+		if role == "" {
+			continue
+		}
+		expected[role]++
+		if content, ok := found[rpath.DumpPath]; ok && !isResourcePlaceholder(content) {
+			returned[role]++
+		}
+	}
+	roles := make([]string, 0, len(expected))
+	for role := range expected {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if returned[role]*100 >= minCoverage*expected[role] {
+			continue
+		}
+		why := fmt.Sprintf("Only %d of the %d nodes of role %s returned a KubeletConfig, fewer than the %d%% needed, "+
+			"so the KubeletConfig of the role is inconclusive", returned[role], expected[role], role, minCoverage)
+		LOG(why)
+		warnings = append(warnings, why)
+		found[kubeletConfigRolePathPrefix+role] = []byte(kubeAPIErrorPrefix + kubeletCoverageErrorReason)
+	}
+	return warnings
+}
+
+// Only save consistent KubeletConfigs per node role. The diff of each node
+// whose KubeletConfig differs from what the role's nodes before it share is
+// saved under kubeletConfigDiffPathPrefix.
+func saveConsistentKubeletResult(result map[string][]byte, warning []string) (map[string][]byte, []string, error) {
+	if len(result) == 0 {
+		return result, warning, nil
+	}
+	// Sorted, so the diffs are taken against the same nodes on every run
+	dumpPaths := make([]string, 0, len(result))
+	for dumpPath := range result {
+		dumpPaths = append(dumpPaths, dumpPath)
+	}
+	sort.Strings(dumpPaths)
+	kubeletConfigsRole := make(map[string][]byte)
+	kubeletConfigDiffs := make(map[string][]byte)
+	for _, dumpPath := range dumpPaths {
+		content := result[dumpPath]
+		role, node := getRoleNodeNameFromDumpPath(dumpPath)
+		// The nodes whose KubeletConfig couldn't be fetched have nothing to compare
+		if role == "" || isResourcePlaceholder(content) {
+			continue
+		}
+		if existingKC, ok := kubeletConfigsRole[role]; ok {
+			diff, err := jsondiff.CompareJSON(existingKC, content)
+			if err != nil {
+				return nil, nil, fmt.Errorf("couldn't compare kubelet configs: %w for %s", err, node)
+			}
+			if diff != nil {
+				why := fmt.Sprintf("Kubelet configs for %s are not consistent with role %s, Diff: %s of KubeletConfigs for %s role will not be saved.", node, role, diff, role)
+				LOG(why)
+				warning = append(warning, why)
+				diffJSON, err := json.Marshal(diff)
+				if err != nil {
+					return nil, nil, fmt.Errorf("couldn't marshal the kubelet config diff: %w for %s", err, node)
+				}
+				kubeletConfigDiffs[kubeletConfigDiffPathPrefix+role+"/"+node] = diffJSON
+				intersectionKC, err := utils.JSONIntersection(existingKC, content)
+				if err != nil {
+					return nil, nil, fmt.Errorf("couldn't get intersection of kubelet configs: %w for %s", err, node)
+				}
+				kubeletConfigsRole[role] = intersectionKC
+			}
+		} else {
+			kubeletConfigsRole[role] = content
+		}
+	}
+	for role, content := range kubeletConfigsRole {
+		if role == "" {
+			continue
+		}
+		result[kubeletConfigRolePathPrefix+role] = content
+	}
+	for dumpPath, diff := range kubeletConfigDiffs {
+		result[dumpPath] = diff
+	}
+	return result, warning, nil
+}
+
+// The variables of the collector's environment the filters can read from
+// $ENV, for the values only known once the collector runs. The rest of the
+// environment, which can hold credentials, is never exposed to the content.
+var filterEnvAllowlist = []string{
+	"CLUSTER_BASE_DOMAIN",
+	"CLUSTER_NAME",
+	"CLUSTER_PLATFORM",
+}
+
+// The $ENV variable holding the name of the scan the resources are
+// collected for
+const filterEnvScanName = "SCAN_NAME"
+
+// filterEnv is the environment of the filters as KEY=value pairs
+type filterEnv []string
+
+// newFilterEnv returns the allowlisted variables that lookup finds, and the
+// scan name if there's one
+func newFilterEnv(lookup func(string) (string, bool), scanName string) filterEnv {
+	var env filterEnv
+	for _, key := range filterEnvAllowlist {
+		if value, ok := lookup(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	if scanName != "" {
+		env = append(env, filterEnvScanName+"="+scanName)
+	}
+	return env
+}
+
+// filterValues are the XCCDF values the filters can read as variables, e.g.
+// $openshift_kube_apiserver_config_name, keyed by the value IDs without
+// their prefix
+type filterValues map[string]string
+
+// The names of the values that can be filter variables. $ENV is kept for the
+// environment.
+var filterVariableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// errUndefinedFilterVariable is returned for the filters that read a
+// variable none of the values define
+var errUndefinedFilterVariable = errors.New("undefined variable")
+
+// String lists the values as sorted name=value pairs
+func (v filterValues) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// variables returns the names of the values that can be filter variables,
+// sorted and prefixed with $, along with their values in the same order
+func (v filterValues) variables() ([]string, []interface{}) {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		if name != "ENV" && filterVariableName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	variables := make([]string, len(names))
+	bound := make([]interface{}, len(names))
+	for i, name := range names {
+		variables[i] = "$" + name
+		bound[i] = v[name]
+	}
+	return variables, bound
+}
+
+// compiledFilter is a compiled filter along with the values its variables
+// are bound to when it runs
+type compiledFilter struct {
+	code   *gojq.Code
+	values []interface{}
+}
+
+func (f *compiledFilter) run(ctx context.Context, obj interface{}) gojq.Iter {
+	return f.code.RunWithContext(ctx, obj, f.values...)
+}
+
+// compileFilter compiles the parsed filter so that $ENV and env only hold env
+// and the values are bound to their variables
+func compileFilter(fltr *gojq.Query, env filterEnv, values filterValues) (*compiledFilter, error) {
+	variables, bound := values.variables()
+	code, err := gojq.Compile(fltr, gojq.WithEnvironLoader(func() []string {
+		return env
+	}), gojq.WithVariables(variables))
+	if err != nil {
+		// gojq doesn't export the error of the undefined variables
+		if name := strings.TrimPrefix(err.Error(), "variable not defined: "); name != err.Error() {
+			return nil, &filterError{filterErrorUndefinedVariable,
+				fmt.Errorf("%w %s, the profile sets no value named %s", errUndefinedFilterVariable,
+					name, strings.TrimPrefix(name, "$"))}
+		}
+		return nil, &filterError{filterErrorEval, err}
+	}
+	return &compiledFilter{code: code, values: bound}, nil
+}
+
+func filter(ctx context.Context, rawobj []byte, filter string, env filterEnv, values filterValues,
+	allowMultiple bool) ([]byte, error) {
+	fltr, fltrErr := gojq.Parse(filter)
+	if fltrErr != nil {
+		return nil, &filterError{filterErrorParse, fmt.Errorf("could not create filter '%s': %w", filter, fltrErr)}
+	}
+	obj := map[string]interface{}{}
+	unmarshallErr := json.Unmarshal(rawobj, &obj)
+	if unmarshallErr != nil {
+		return nil, fmt.Errorf("Error unmarshalling json: %w", unmarshallErr)
+	}
+	return runFilter(ctx, fltr, filter, obj, env, values, allowMultiple)
+}
+
+// runFilter runs the parsed filter on obj, which must yield exactly one
+// result, unless allowMultiple is set, in which case all the results are
+// returned as an array
+func runFilter(ctx context.Context, fltr *gojq.Query, filter string, obj interface{}, env filterEnv,
+	values filterValues, allowMultiple bool) ([]byte, error) {
+	code, err := compileFilter(fltr, env, values)
+	if err != nil {
+		return nil, err
+	}
+	iter := code.run(ctx, obj)
+	if allowMultiple {
+		return runFilterAll(iter)
+	}
+	v, ok := iter.Next()
+	if !ok {
+		DBG("No result from filter. This is an issue and an error will be returned.")
+		return nil, &filterError{filterErrorNoResult, fmt.Errorf("couldn't get filtered object")}
+	}
+	if err, ok := v.(error); ok {
+		DBG("Error while filtering: %s", err)
+		return nil, &filterError{filterErrorEval, err}
+	}
+
+	out, marshallErr := json.Marshal(&v)
+	if marshallErr != nil {
+		return nil, fmt.Errorf("Error marshalling json: %w", marshallErr)
+	}
+	_, isNotEOF := iter.Next()
+	if isNotEOF {
+		DBG("No more results should have come from the filter. This is an issue with the content.")
+		return out, &filterError{filterErrorMulti, fmt.Errorf("Skipping extra results from filter '%s': %w", filter, MoreThanOneObjErr)}
+	}
+	return out, nil
+}
+
+// runFilterAll returns all the results of the filter as an array, which is
+// empty if there's none
+func runFilterAll(iter gojq.Iter) ([]byte, error) {
+	results := []interface{}{}
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			DBG("Error while filtering: %s", err)
+			return nil, &filterError{filterErrorEval, err}
+		}
+		results = append(results, v)
+	}
+	out, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling json: %w", err)
+	}
+	return out, nil
+}
+
+// The kinds of filterError
+const (
+	filterErrorParse    = "parse"
+	filterErrorNoResult = "no-result"
+	filterErrorMulti    = "multi"
+	filterErrorEval     = "eval"
+	// The filter reads a variable none of the values define
+	filterErrorUndefinedVariable = "undefined-variable"
+)
+
+// filterError is a failure of the filter of a resource path, which points at
+// a problem with the content rather than with the fetch
+type filterError struct {
+	kind string
+	err  error
+}
+
+func (e *filterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *filterError) Unwrap() error {
+	return e.err
+}
+
+// filterErrorCounts counts the filter errors by kind and dump path. The
+// KubeletConfigs of the nodes of a role are counted under the path of the
+// role, so the counts don't grow with the nodes.
+type filterErrorCounts map[string]map[string]int
+
+// add counts err if it's a filter error of the resource at dumpPath
+func (f filterErrorCounts) add(dumpPath string, err error) {
+	var fltrErr *filterError
+	if f == nil || !errors.As(err, &fltrErr) {
+		return
+	}
+	if f[fltrErr.kind] == nil {
+		f[fltrErr.kind] = map[string]int{}
+	}
+	if role, node := getRoleNodeNameFromDumpPath(dumpPath); node != "" {
+		dumpPath = kubeletConfigPathPrefix + role
+	}
+	f[fltrErr.kind][dumpPath]++
+}
+
+// listItemFilter is a filter of the `[.items[] | item] | rest` form that
+// filters over list responses usually have. Both item and rest are optional.
+// Such a filter gives the same output when item is applied to each list item
+// separately and rest to the array of the results.
+type listItemFilter struct {
+	item *gojq.Query
+	rest *gojq.Query
+}
+
+// getListItemFilter returns whether filter can be applied to one list item at
+// a time, and how.
+func getListItemFilter(filter string) (*listItemFilter, bool) {
+	q, err := gojq.Parse(filter)
+	if err != nil || q.Meta != nil || len(q.Imports) > 0 || len(q.FuncDefs) > 0 {
+		return nil, false
+	}
+
+	lf := &listItemFilter{}
+	if q.Op == gojq.OpPipe {
+		lf.rest = q.Right
+		q = q.Left
+	}
+	if !isPlainQuery(q) || q.Term.Type != gojq.TermTypeArray || len(q.Term.SuffixList) > 0 || q.Term.Array.Query == nil {
+		return nil, false
+	}
+
+	inner := q.Term.Array.Query
+	if len(inner.FuncDefs) > 0 {
+		return nil, false
+	}
+	if inner.Op == gojq.OpPipe {
+		if !isItemsIterator(inner.Left) {
+			return nil, false
+		}
+		lf.item = inner.Right
+		return lf, true
+	}
+	return lf, isItemsIterator(inner)
+}
+
+// isPlainQuery returns whether q consists of a single term only
+func isPlainQuery(q *gojq.Query) bool {
+	return q != nil && q.Term != nil && q.Left == nil && q.Right == nil &&
+		q.Meta == nil && len(q.Imports) == 0 && len(q.FuncDefs) == 0
+}
+
+// isItemsIterator returns whether q is exactly `.items[]`
+func isItemsIterator(q *gojq.Query) bool {
+	if !isPlainQuery(q) || q.Term.Type != gojq.TermTypeIndex || len(q.Term.SuffixList) != 1 {
+		return false
+	}
+	index := q.Term.Index
+	if index == nil || index.Name != "items" || index.Str != nil || index.Start != nil || index.End != nil || index.IsSlice {
+		return false
+	}
+	suffix := q.Term.SuffixList[0]
+	return suffix.Iter && !suffix.Optional && suffix.Index == nil && suffix.Bind == nil
+}
+
+var errEmptyBody = errors.New("no data in body")
+
+// filterListItems decodes the items of the list read from r one at a time and
+// applies lf to them. This gives the same output as filter() without reading
+// the whole list into memory and decoding it in one go.
+func filterListItems(ctx context.Context, r io.Reader, filter string, lf *listItemFilter, env filterEnv,
+	values filterValues, allowMultiple bool) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, errEmptyBody
+	} else if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object, got %v", tok)
+	}
+
+	var itemCode *compiledFilter
+	if lf.item != nil {
+		if itemCode, err = compileFilter(lf.item, env, values); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	foundItems := false
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+		}
+		if key, _ := keyTok.(string); key != "items" {
+			// Skip other fields such as the list metadata
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+			}
+			continue
+		}
+
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("cannot iterate over items: %v", tok)
+		}
+		foundItems = true
+		out.Reset()
+		out.WriteByte('[')
+		first := true
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var item interface{}
+			if err := dec.Decode(&item); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+			}
+			results, err := runItemFilter(ctx, itemCode, item)
+			if err != nil {
+				return nil, err
+			}
+			for _, result := range results {
+				if !first {
+					out.WriteByte(',')
+				}
+				out.Write(result)
+				first = false
+			}
+		}
+		// Consume the closing bracket of the items
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+		}
+		out.WriteByte(']')
+	}
+	if !foundItems {
+		return nil, fmt.Errorf("cannot iterate over items: no items in the object")
+	}
+	if lf.rest == nil {
+		return out.Bytes(), nil
+	}
+
+	// The filtered items are usually a small fraction of the list, so the
+	// rest of the filter is run on them as a whole
+	var filtered []interface{}
+	if err := json.Unmarshal(out.Bytes(), &filtered); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling json: %w", err)
+	}
+	return runFilter(ctx, lf.rest, filter, filtered, env, values, allowMultiple)
 }
 
-// mcStreamer implements resourceStreamer for fetching a list of MachineConfigs
-type mcStreamer struct{}
+// runItemFilter returns the marshalled outputs of itemFilter for a single
+// list item. A nil filter returns the item itself.
+func runItemFilter(ctx context.Context, itemFilter *compiledFilter, item interface{}) ([][]byte, error) {
+	if itemFilter == nil {
+		out, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling json: %w", err)
+		}
+		return [][]byte{out}, nil
+	}
 
-// bufCloser is a kludge so that mcStreamer's Stream() method can return an io.ReadCloser
-type bufCloser struct {
-	*bytes.Buffer
+	var results [][]byte
+	iter := itemFilter.run(ctx, item)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			DBG("Error while filtering: %s", err)
+			return nil, &filterError{filterErrorEval, err}
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling json: %w", err)
+		}
+		results = append(results, out)
+	}
+	return results, nil
 }
 
-// Close is a dummy method because a buffer doesn't have to be closed, just enables us to return io.ReadCloser
-// from mcStreamer's Stream() method
-func (bc *bufCloser) Close() error {
-	return nil
+func (c *scapContentDataStream) SaveWarningsIfAny(warnings []fetchWarning, outputFile string) error {
+	// No warnings to persist
+	if warnings == nil || len(warnings) == 0 {
+		return nil
+	}
+	DBG("Persisting warnings to output file")
+	warningsStr := strings.Join(dedupeWarnings(warningMessages(warnings)), "\n")
+	err := ioutil.WriteFile(outputFile, []byte(warningsStr), 0600)
+	return err
 }
 
-// Stream fetches MachineConfigs in batches of pageSize, removes the file contents from each MC in the batch,
-// adds each batch to a resulting list which is finally returned as JSON
-func (ms *mcStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
-	mcfgListNoFiles := mcfgv1.MachineConfigList{}
-	const pageSize = 5
+// warningsLog appends the warnings to a file as they're raised, so that a
+// collector killed before saving them still leaves those it had raised.
+// SaveWarningsIfAny overwrites the file with the deduplicated warnings once
+// the fetch is done.
+type warningsLog struct {
+	path string
+	file *os.File
+}
 
-	continueToken := ""
-	for {
-		mcfgList := mcfgv1.MachineConfigList{}
-		listOpts := runtimeclient.ListOptions{
-			Limit: int64(pageSize),
-		}
-		if continueToken != "" {
-			listOpts.Continue = continueToken
-		}
-		if err := rfClients.client.List(ctx, &mcfgList, &listOpts); err != nil {
-			return nil, fmt.Errorf("failed to list MachineConfigs: %w", err)
-		}
+// newWarningsLog returns a log appending to the file at path, removing the
+// warnings an earlier run may have left there, or nil if path is empty
+func newWarningsLog(path string) *warningsLog {
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		LOG("Couldn't remove the earlier warnings in %s: %v", path, err)
+	}
+	return &warningsLog{path: path}
+}
 
-		mcfgListNoFilesBatch, err := filterMcList(&mcfgList)
+// append writes the warning as a line of the file, which is only created
+// once there's a warning to write. Failing to write it doesn't fail the
+// fetch, since the warning is saved along with the others afterwards.
+func (l *warningsLog) append(warning string) {
+	if l == nil {
+		return
+	}
+	if l.file == nil {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 		if err != nil {
-			return nil, fmt.Errorf("failed to filter machine configs: %w", err)
+			DBG("Couldn't open the warnings file %s: %v", l.path, err)
+			return
 		}
+		l.file = f
+	}
+	if _, err := fmt.Fprintln(l.file, warning); err != nil {
+		DBG("Couldn't append to the warnings file %s: %v", l.path, err)
+	}
+}
 
-		mcfgListNoFiles.Items = append(mcfgListNoFiles.Items, mcfgListNoFilesBatch.Items...)
+func (l *warningsLog) close() {
+	if l == nil || l.file == nil {
+		return
+	}
+	if err := l.file.Close(); err != nil {
+		DBG("Couldn't close the warnings file %s: %v", l.path, err)
+	}
+	l.file = nil
+}
 
-		continueToken = mcfgList.ListMeta.Continue
-		if continueToken == "" {
-			break
+// dedupeWarnings keeps the first occurrence of each warning, in order, and
+// notes how often the ones that were raised several times were seen, e.g.
+// when several rules hit the same forbidden endpoint.
+func dedupeWarnings(warnings []string) []string {
+	counts := make(map[string]int, len(warnings))
+	var unique []string
+	for _, warning := range warnings {
+		if counts[warning] == 0 {
+			unique = append(unique, warning)
 		}
+		counts[warning]++
 	}
-
-	jsonSerializer := runtimejson.NewSerializerWithOptions(runtimejson.DefaultMetaFactory,
-		rfClients.scheme,
-		rfClients.scheme,
-		runtimejson.SerializerOptions{Pretty: true})
-	buf := &bufCloser{&bytes.Buffer{}}
-	if err := jsonSerializer.Encode(&mcfgListNoFiles, buf); err != nil {
-		return nil, fmt.Errorf("failed to serialize MC list: %w", err)
+	for i, warning := range unique {
+		if counts[warning] > 1 {
+			unique[i] = fmt.Sprintf("%s (seen %d times)", warning, counts[warning])
+		}
 	}
-	return buf, nil
+	return unique
 }
 
-func filterMcList(mcListIn *mcfgv1.MachineConfigList) (*mcfgv1.MachineConfigList, error) {
-	mcfgListNoFiles := mcfgv1.MachineConfigList{}
-	mcfgListNoFiles.TypeMeta = mcListIn.TypeMeta
-	mcfgListNoFiles.ListMeta = mcListIn.ListMeta
+// The metadata archive is a gzip-compressed tarball holding the collector's
+// auxiliary output, so it can be handed over as a single artifact. It
+// contains the following files:
+//
+//	warnings.txt  - the warnings raised while fetching, one per line
+//	manifest.json - the resources that were collected, see metadataManifest
+//	timing.json   - how long fetching took, see fetchTiming
+//
+// If the per-node KubeletConfigs are kept, they're added along with the role
+// summaries and the diffs of the nodes, named after their dump path, e.g.
+// kubeletconfig/worker/node-1, kubeletconfig/role/worker and
+// kubeletconfig/diffs/worker/node-1.
+const (
+	metadataArchiveWarnings = "warnings.txt"
+	metadataArchiveManifest = "manifest.json"
+	metadataArchiveTiming   = "timing.json"
 
-	for i := 0; i < len(mcListIn.Items); i++ {
-		mc := mcListIn.Items[i]
-		if len(mc.Spec.Config.Raw) > 0 {
-			// if Ignition exists, filter out all the potentially large files
-			ign, err := mcfgcommon.ParseAndConvertConfig(mc.Spec.Config.Raw)
-			if err != nil {
-				return nil, fmt.Errorf("cannot parse MC %s: %w", mc.Name, err)
-			}
-			ign.Storage.Files = nil // just get rid of the files the easy way
-			rawOutIgn, err := json.Marshal(ign)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal Ignition object back to a a raw object: %w", err)
-			}
-			mc.Spec.Config.Raw = rawOutIgn
-		}
-		mcfgListNoFiles.Items = append(mcfgListNoFiles.Items, mc)
-	}
+	metadataArchiveContentType = "application/gzip"
+)
 
-	return &mcfgListNoFiles, nil
+type metadataManifestEntry struct {
+	ObjPath  string `json:"objPath"`
+	DumpPath string `json:"dumpPath"`
+	Size     int    `json:"size"`
 }
 
-func fetch(ctx context.Context, streamDispatcher streamerDispatcherFn, rfClients resourceFetcherClients, objects []utils.ResourcePath) (map[string][]byte, []string, error) {
-	var warnings []string
-	results := map[string][]byte{}
+type metadataManifest struct {
+	// Set if the resources were fetched as another user
+	ImpersonatedUser string                  `json:"impersonatedUser,omitempty"`
+	Resources        []metadataManifestEntry `json:"resources"`
+}
 
-	for _, rpath := range objects {
-		err := func() error {
-			uri := rpath.ObjPath
-			LOG("Fetching URI: '%s'", uri)
-			streamer := streamDispatcher(uri)
-			stream, err := streamer.Stream(ctx, rfClients)
-			if meta.IsNoMatchError(err) || kerrors.IsForbidden(err) || kerrors.IsNotFound(err) {
-				DBG("Encountered non-fatal error to be persisted in the scan: %s", err)
-				objerr := fmt.Errorf("could not fetch %s: %w", uri, err)
-				warnings = append(warnings, objerr.Error())
-				// for 404s we'll add a warning comment in the object so openSCAP can read and process it
-				if kerrors.IsNotFound(err) {
-					results[rpath.DumpPath] = []byte("# kube-api-error=" + kerrors.ReasonForError(err))
-				}
-				return nil
-			} else if err != nil {
-				return fmt.Errorf("streaming URIs failed: %w", err)
-			}
-			defer stream.Close()
-			body, err := ioutil.ReadAll(stream)
-			if err != nil {
-				return err
-			}
-			if len(body) == 0 {
-				DBG("no data in request body")
-				return nil
-			}
-			if rpath.Filter != "" {
-				DBG("Applying filter '%s' to path '%s'", rpath.Filter, rpath.ObjPath)
-				filteredBody, filterErr := filter(ctx, body, rpath.Filter)
-				if errors.Is(filterErr, MoreThanOneObjErr) {
-					warnings = append(warnings, filterErr.Error())
-				} else if filterErr != nil {
-					return fmt.Errorf("couldn't filter '%s': %w", body, filterErr)
-				}
-				results[rpath.DumpPath] = filteredBody
-			} else {
-				results[rpath.DumpPath] = body
-			}
-			return nil
-		}()
-		if err != nil {
-			return nil, warnings, err
-		}
+type fetchTiming struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+func newFetchTiming(start, end time.Time) fetchTiming {
+	return fetchTiming{Start: start, End: end, DurationSeconds: end.Sub(start).Seconds()}
+}
+
+// collectionSummary sums up a collector run, so it can be logged as a single
+// line and monitored without piecing together the per-resource messages
+type collectionSummary struct {
+	// The resources the content needs and those that were fetched
+	Attempted int `json:"attempted"`
+	Saved     int `json:"saved"`
+	// The size of the saved resources
+	BytesWritten int `json:"bytesWritten"`
+	// The number of warnings per category, see fetchWarning
+	Warnings             map[string]int `json:"warnings"`
+	UndefinedRules       int            `json:"undefinedRules,omitempty"`
+	FetchDurationSeconds float64        `json:"fetchDurationSeconds"`
+	DurationSeconds      float64        `json:"durationSeconds"`
+	Cancelled            bool           `json:"cancelled,omitempty"`
+	// The kubeconfig context of the cluster, when collecting from several
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// The parts of the collection a fetchWarning may come from
+const (
+	warningCategoryImpersonation  = "impersonation"
+	warningCategoryUndefinedRules = "undefinedRules"
+	warningCategoryValueOverrides = "valueOverrides"
+	warningCategoryVersionGated   = "versionGated"
+	warningCategoryVersion        = "version"
+	warningCategorySnapshot       = "snapshot"
+	warningCategoryFetch          = "fetch"
+	warningCategoryFilter         = "filter"
+	warningCategoryKubeletConfig  = "kubeletConfig"
+)
+
+// fetchWarning is a warning raised while collecting the resources, along
+// with the part of the collection that raised it
+type fetchWarning struct {
+	category string
+	message  string
+}
+
+// newFetchWarnings returns a warning of the category for each message
+func newFetchWarnings(category string, messages ...string) []fetchWarning {
+	warnings := make([]fetchWarning, 0, len(messages))
+	for _, message := range messages {
+		warnings = append(warnings, fetchWarning{category: category, message: message})
 	}
-	results, warnings, err := saveConsistentKubeletResult(results, warnings)
-	return results, warnings, err
+	return warnings
 }
 
-// Only save consistent KubeletConfigs per node role.
-func saveConsistentKubeletResult(result map[string][]byte, warning []string) (map[string][]byte, []string, error) {
-	if len(result) == 0 {
-		return result, warning, nil
+// warningMessages returns the messages of the warnings, in order
+func warningMessages(warnings []fetchWarning) []string {
+	var messages []string
+	for _, warning := range warnings {
+		messages = append(messages, warning.message)
 	}
-	kubeletConfigsRole := make(map[string][]byte)
-	for dumpPath, content := range result {
-		role, node := getRoleNodeNameFromDumpPath(dumpPath)
-		if role == "" {
+	return messages
+}
+
+func (c *scapContentDataStream) Summary(warnings []fetchWarning) collectionSummary {
+	summary := collectionSummary{
+		Attempted: len(c.resources),
+		Saved:     len(c.found),
+		Warnings:  map[string]int{},
+	}
+	summary.UndefinedRules = len(c.undefinedRules)
+	for _, contents := range c.found {
+		summary.BytesWritten += len(contents)
+	}
+	for _, warning := range warnings {
+		summary.Warnings[warning.category]++
+	}
+	return summary
+}
+
+func (c *scapContentDataStream) SaveMetadataArchive(warnings []fetchWarning, timing fetchTiming, outputFile string) error {
+	manifest := metadataManifest{
+		ImpersonatedUser: c.impersonateUser,
+		Resources:        []metadataManifestEntry{},
+	}
+	for _, rpath := range c.resources {
+		contents, ok := c.found[rpath.DumpPath]
+		if !ok {
 			continue
 		}
-		if existingKC, ok := kubeletConfigsRole[role]; ok {
-			diff, err := jsondiff.CompareJSON(existingKC, content)
-			if err != nil {
-				return nil, nil, fmt.Errorf("couldn't compare kubelet configs: %w for %s", err, node)
-			}
-			if diff != nil {
-				why := fmt.Sprintf("Kubelet configs for %s are not consistent with role %s, Diff: %s of KubeletConfigs for %s role will not be saved.", node, role, diff, role)
-				LOG(why)
-				warning = append(warning, why)
-				intersectionKC, err := utils.JSONIntersection(existingKC, content)
-				if err != nil {
-					return nil, nil, fmt.Errorf("couldn't get intersection of kubelet configs: %w for %s", err, node)
-				}
-				kubeletConfigsRole[role] = intersectionKC
-			}
-		} else {
-			kubeletConfigsRole[role] = content
+		manifest.Resources = append(manifest.Resources, metadataManifestEntry{
+			ObjPath:  rpath.ObjPath,
+			DumpPath: rpath.DumpPath,
+			Size:     len(contents),
+		})
+	}
+	// Role summaries and diffs are created after fetching and have no
+	// source path
+	for dumpPath, contents := range c.found {
+		if strings.HasPrefix(dumpPath, kubeletConfigRolePathPrefix) ||
+			strings.HasPrefix(dumpPath, kubeletConfigDiffPathPrefix) {
+			manifest.Resources = append(manifest.Resources, metadataManifestEntry{
+				DumpPath: dumpPath,
+				Size:     len(contents),
+			})
 		}
 	}
-	for role, content := range kubeletConfigsRole {
-		if role == "" {
-			continue
+	sort.Slice(manifest.Resources, func(i, j int) bool {
+		return manifest.Resources[i].DumpPath < manifest.Resources[j].DumpPath
+	})
+
+	var kubeletConfigs map[string][]byte
+	if c.keepNodeKubelets {
+		kubeletConfigs = map[string][]byte{}
+		for dumpPath, contents := range c.found {
+			if strings.HasPrefix(dumpPath, kubeletConfigPathPrefix) {
+				kubeletConfigs[strings.TrimPrefix(dumpPath, "/")] = contents
+			}
 		}
-		result[kubeletConfigRolePathPrefix+role] = content
 	}
-	return result, warning, nil
+
+	DBG("Persisting metadata archive to output file")
+	return saveMetadataArchive(outputFile, warnings, manifest, timing, kubeletConfigs)
 }
 
-func filter(ctx context.Context, rawobj []byte, filter string) ([]byte, error) {
-	fltr, fltrErr := gojq.Parse(filter)
-	if fltrErr != nil {
-		return nil, fmt.Errorf("could not create filter '%s': %w", filter, fltrErr)
+func saveMetadataArchive(outputFile string, warnings []fetchWarning, manifest metadataManifest, timing fetchTiming, extraFiles map[string][]byte) error {
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
 	}
-	obj := map[string]interface{}{}
-	unmarshallErr := json.Unmarshal(rawobj, &obj)
-	if unmarshallErr != nil {
-		return nil, fmt.Errorf("Error unmarshalling json: %w", unmarshallErr)
+	timingBytes, err := json.Marshal(timing)
+	if err != nil {
+		return err
 	}
-	iter := fltr.RunWithContext(ctx, obj)
-	v, ok := iter.Next()
-	if !ok {
-		DBG("No result from filter. This is an issue and an error will be returned.")
-		return nil, fmt.Errorf("couldn't get filtered object")
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	files := []struct {
+		name     string
+		contents []byte
+	}{
+		{metadataArchiveWarnings, []byte(strings.Join(warningMessages(warnings), "\n"))},
+		{metadataArchiveManifest, manifestBytes},
+		{metadataArchiveTiming, timingBytes},
 	}
-	if err, ok := v.(error); ok {
-		DBG("Error while filtering: %s", err)
-		return nil, err
+	extraNames := make([]string, 0, len(extraFiles))
+	for name := range extraFiles {
+		extraNames = append(extraNames, name)
 	}
-
-	out, marshallErr := json.Marshal(&v)
-	if marshallErr != nil {
-		return nil, fmt.Errorf("Error marshalling json: %w", marshallErr)
+	sort.Strings(extraNames)
+	for _, name := range extraNames {
+		files = append(files, struct {
+			name     string
+			contents []byte
+		}{name, extraFiles[name]})
 	}
-	_, isNotEOF := iter.Next()
-	if isNotEOF {
-		DBG("No more results should have come from the filter. This is an issue with the content.")
-		return out, fmt.Errorf("Skipping extra results from filter '%s': %w", filter, MoreThanOneObjErr)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.contents)),
+			ModTime: timing.End,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.contents); err != nil {
+			return err
+		}
 	}
-	return out, nil
-}
-
-func (c *scapContentDataStream) SaveWarningsIfAny(warnings []string, outputFile string) error {
-	// No warnings to persist
-	if warnings == nil || len(warnings) == 0 {
-		return nil
+	if err := tw.Close(); err != nil {
+		return err
 	}
-	DBG("Persisting warnings to output file")
-	warningsStr := strings.Join(warnings, "\n")
-	err := ioutil.WriteFile(outputFile, []byte(warningsStr), 0600)
-	return err
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputFile, buf.Bytes(), 0600)
 }
 
 func (c *scapContentDataStream) SaveResources(to string) error {
-	return saveResources(to, c.found)
+	return saveResources(to, c.found, c.fileMode, c.dirMode, c.compressResources)
 }
 
-func saveResources(rootDir string, data map[string][]byte) error {
+// saveResources writes data under rootDir. The permissions are set
+// explicitly, so they aren't affected by the umask and also apply to
+// directories and files that already exist. If compress is set, the
+// resources are gzipped and saved with the .gz suffix, except for the empty
+// ones and the placeholders of the missing ones, which are kept as they are
+// since gzipping them wouldn't save any space.
+func saveResources(rootDir string, data map[string][]byte, fileMode, dirMode os.FileMode, compress bool) error {
+	if fileMode == 0 {
+		fileMode = defaultResourceFileMode
+	}
+	if dirMode == 0 {
+		dirMode = defaultResourceDirMode
+	}
 	for apiPath, fileContents := range data {
 		saveDir, saveFile, err := getSaveDirectoryAndFileName(rootDir, apiPath)
 		savePath := path.Join(saveDir, saveFile)
@@ -688,14 +3369,130 @@ func saveResources(rootDir string, data map[string][]byte) error {
 		if err != nil {
 			return err
 		}
-		err = os.MkdirAll(saveDir, 0700)
+		// The other form of the file may be left over from a previous run,
+		// and would be read instead
+		stalePath := savePath + savedResourceGzipSuffix
+		if compress && !isResourcePlaceholder(fileContents) {
+			fileContents, err = gzipResource(fileContents)
+			if err != nil {
+				return err
+			}
+			savePath, stalePath = stalePath, savePath
+		}
+		err = mkdirAllWithMode(rootDir, saveDir, dirMode)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(savePath, fileContents, fileMode)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(stalePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err = os.Chmod(savePath, fileMode)
 		if err != nil {
 			return err
 		}
-		err = ioutil.WriteFile(savePath, fileContents, 0600)
+	}
+	return nil
+}
+
+// isResourcePlaceholder tells whether the contents are empty or the comment
+// saved in place of a resource that couldn't be fetched
+func isResourcePlaceholder(contents []byte) bool {
+	return len(contents) == 0 || bytes.HasPrefix(contents, []byte(kubeAPIErrorPrefix))
+}
+
+func gzipResource(contents []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipResource(data []byte) ([]byte, error) {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+	return ioutil.ReadAll(gzr)
+}
+
+func (c *scapContentDataStream) StreamResources(out io.Writer, compress bool) error {
+	return streamResources(out, c.found, c.fileMode, compress)
+}
+
+// streamResources writes data to out as a tar stream, optionally gzipped. The
+// entries are named after the paths saveResources would write the resources
+// to, relative to the result directory, and are sorted so the stream is
+// stable.
+func streamResources(out io.Writer, data map[string][]byte, fileMode os.FileMode, compress bool) error {
+	if fileMode == 0 {
+		fileMode = defaultResourceFileMode
+	}
+	apiPaths := make([]string, 0, len(data))
+	for apiPath := range data {
+		apiPaths = append(apiPaths, apiPath)
+	}
+	sort.Strings(apiPaths)
+
+	var gzw *gzip.Writer
+	tarOut := out
+	if compress {
+		gzw = gzip.NewWriter(out)
+		tarOut = gzw
+	}
+	tw := tar.NewWriter(tarOut)
+	modTime := time.Now()
+	for _, apiPath := range apiPaths {
+		saveDir, saveFile, err := getSaveDirectoryAndFileName("", apiPath)
 		if err != nil {
 			return err
 		}
+		name := strings.TrimPrefix(path.Join(saveDir, saveFile), "/")
+		LOG("Streaming fetched resource as: '%s'", name)
+		contents := data[apiPath]
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    int64(fileMode),
+			Size:    int64(len(contents)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gzw != nil {
+		return gzw.Close()
+	}
+	return nil
+}
+
+// mkdirAllWithMode creates dir and its parents up to rootDir, and sets
+// their permissions to mode. rootDir itself is left untouched, as it is
+// usually a volume mount.
+func mkdirAllWithMode(rootDir, dir string, mode os.FileMode) error {
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	root := path.Clean(rootDir)
+	for d := dir; d != root && d != "." && d != "/"; d = path.Dir(d) {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
 	}
 	return nil
 }
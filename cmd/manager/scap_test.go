@@ -1,14 +1,29 @@
 package manager
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
-
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/common"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+	"github.com/ComplianceAsCode/compliance-operator/version"
 	"github.com/antchfx/xmlquery"
 	igntypes "github.com/coreos/ignition/v2/config/v3_2/types"
 	. "github.com/onsi/ginkgo"
@@ -17,10 +32,16 @@ import (
 	"github.com/wI2L/jsondiff"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -58,7 +79,7 @@ var _ = Describe("Testing SCAP parsing and storage", func() {
 					DumpPath: "/api/v1/namespaces/openshift-kube-apiserver/configmaps/config",
 				},
 			}
-			got, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
+			got, _, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
 			Expect(got).To(Equal(expected))
 		})
 	})
@@ -88,7 +109,7 @@ var _ = Describe("Testing SCAP parsing and storage", func() {
 					Filter:   ".apiServerArguments",
 				},
 			}
-			got, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
+			got, _, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
 			Expect(got).To(Equal(expected))
 
 			dataStreamFile.Close()
@@ -110,7 +131,7 @@ var _ = Describe("Testing SCAP parsing and storage", func() {
 					DumpPath: "/apis/config.openshift.io/v1/oauths/cluster",
 				},
 			}
-			got, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
+			got, _, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
 			Expect(got).To(Equal(expected))
 			dataStreamFile.Close()
 		})
@@ -131,7 +152,7 @@ var _ = Describe("Testing SCAP parsing and storage", func() {
 					DumpPath: "/apis/config.openshift.io/v1/oauths/cluster",
 				},
 			}
-			got, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
+			got, _, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
 			Expect(got).To(Equal(expected))
 			dataStreamFile.Close()
 		})
@@ -163,14 +184,694 @@ var _ = Describe("Testing SCAP parsing and storage", func() {
 					Filter:   ".data[\"config.yaml\"] | fromjson | .apiServerArguments",
 				},
 			}
-			_, valuesList := getResourcePaths(tpContentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
-			got, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", valuesList)
+			_, valuesList, _ := getResourcePaths(tpContentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", nil)
+			got, _, _ := getResourcePaths(contentDS, contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate", valuesList)
 			Expect(got).To(Equal(expected))
 
 			dataStreamFile.Close()
 		})
 	})
 
+	Context("Parsing a tailoring that extends a missing profile", func() {
+		It("Returns an error instead of an empty effective profile", func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			tpDataStreamFile, err := os.Open("../../tests/data/tailored-profile.xml")
+			Expect(err).To(BeNil())
+			defer tpDataStreamFile.Close()
+
+			contentDS, err := parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+			tpContentDS, err := parseContent(tpDataStreamFile)
+			Expect(err).To(BeNil())
+
+			By("checking the extended profile isn't in the datastream")
+			Expect(profileExists(contentDS, "xccdf_org.ssgproject.content_profile_cis")).To(BeFalse())
+			Expect(profileExists(contentDS, "xccdf_org.ssgproject.content_profile_platform-moderate")).To(BeTrue())
+
+			By("figuring out the resources")
+			fetcher := &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{
+					client: fake.NewFakeClientWithScheme(scheme.Scheme),
+				},
+				dataStream: contentDS,
+				tailoring:  tpContentDS,
+			}
+			err = fetcher.FigureResources("xccdf_compliance.openshift.io_profile_hypershift-profile")
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("xccdf_org.ssgproject.content_profile_cis"))
+		})
+	})
+
+	Context("Validating the content", func() {
+		const moderate = "xccdf_org.ssgproject.content_profile_platform-moderate"
+		var contentDS *xmlquery.Node
+
+		BeforeEach(func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			contentDS, err = parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+		})
+
+		It("Accepts the profiles of the data stream", func() {
+			Expect(validateContent(contentDS, nil, moderate)).To(Succeed())
+		})
+
+		It("Fails on a profile the content doesn't define", func() {
+			fetcher := &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{
+					client: fake.NewFakeClientWithScheme(scheme.Scheme),
+				},
+				dataStream: contentDS,
+			}
+			err := fetcher.FigureResources("xccdf_org.ssgproject.content_profile_missing")
+			Expect(err).To(MatchError("profile xccdf_org.ssgproject.content_profile_missing was not found in the data stream"))
+			Expect(fetcher.resources).To(BeEmpty())
+
+			tailoringFile, err := os.Open("../../tests/data/tailored-profile.xml")
+			Expect(err).To(BeNil())
+			defer tailoringFile.Close()
+			tailoring, err := parseContent(tailoringFile)
+			Expect(err).To(BeNil())
+			Expect(validateContent(contentDS, tailoring, moderate)).To(
+				MatchError(ContainSubstring("was not found in the tailoring")))
+		})
+
+		It("Fails on content without profiles or rules", func() {
+			noRules, err := utils.ParseContent(strings.NewReader(
+				`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">` +
+					`<xccdf-1.2:Profile id="` + moderate + `"/></xccdf-1.2:Benchmark>`))
+			Expect(err).To(BeNil())
+			Expect(validateContent(noRules, nil, moderate)).To(MatchError(ContainSubstring("no XCCDF 1.2 rule")))
+
+			noProfiles, err := utils.ParseContent(strings.NewReader(
+				`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">` +
+					`<xccdf-1.2:Rule id="rule"/></xccdf-1.2:Benchmark>`))
+			Expect(err).To(BeNil())
+			Expect(validateContent(noProfiles, nil, moderate)).To(MatchError(ContainSubstring("no XCCDF 1.2 profile")))
+
+			Expect(validateContent(nil, nil, moderate)).ToNot(Succeed())
+		})
+	})
+
+	Context("Following the profiles a profile extends", func() {
+		parse := func(profiles string) *xmlquery.Node {
+			doc, err := utils.ParseContent(strings.NewReader(
+				`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">` +
+					profiles + `<xccdf-1.2:Rule id="rule"/></xccdf-1.2:Benchmark>`))
+			Expect(err).To(BeNil())
+			return doc
+		}
+		profile := func(id, extends, value string) string {
+			return `<xccdf-1.2:Profile id="` + id + `" extends="` + extends + `">` +
+				`<xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_var">` + value +
+				`</xccdf-1.2:set-value></xccdf-1.2:Profile>`
+		}
+		chainIDs := func(chain []profileLink) []string {
+			ids := []string{}
+			for _, link := range chain {
+				ids = append(ids, link.id)
+			}
+			return ids
+		}
+
+		It("Follows the whole chain, the children's values overriding the parents'", func() {
+			ds := parse(profile("moderate", "base", "moderate") + profile("base", "", "base"))
+			tailoring := parse(profile("tailored", "stricter", "tailored") +
+				`<xccdf-1.2:Profile id="stricter" extends="moderate"/>`)
+
+			chain, err := resolveProfileChain(ds, tailoring, "tailored")
+			Expect(err).To(BeNil())
+			Expect(chainIDs(chain)).To(Equal([]string{"tailored", "stricter", "moderate", "base"}))
+			Expect(chain[1].defs).To(Equal(tailoring))
+			Expect(chain[2].defs).To(Equal(ds))
+			Expect(getEffectiveValues(chain)).To(Equal(map[string]string{"var": "tailored"}))
+			Expect(getEffectiveValues(chain[2:])).To(Equal(map[string]string{"var": "moderate"}))
+
+			chain, err = resolveProfileChain(ds, nil, "base")
+			Expect(err).To(BeNil())
+			Expect(chainIDs(chain)).To(Equal([]string{"base"}))
+		})
+
+		It("Reports the profiles that extend each other", func() {
+			ds := parse(profile("a", "b", "a") + profile("b", "c", "b") + profile("c", "a", "c"))
+			_, err := resolveProfileChain(ds, nil, "a")
+			Expect(err).To(MatchError("profile a is extended in a loop: a -> b -> c -> a"))
+
+			fetcher := &scapContentDataStream{dataStream: ds, skipKubeletConfig: true}
+			Expect(fetcher.FigureResources("b")).To(MatchError(ContainSubstring("extended in a loop")))
+		})
+
+		It("Reports a missing profile in the chain", func() {
+			ds := parse(profile("moderate", "removed", "moderate"))
+			_, err := resolveProfileChain(ds, nil, "moderate")
+			Expect(err).To(MatchError("profile moderate extends profile removed, which was not found in the data stream"))
+		})
+
+		It("Collects the checks the preflight listing selects", func() {
+			rule := func(id, path string) string {
+				return `<xccdf-1.2:Rule id="` + id + `"><xccdf-1.2:warning category="general">` +
+					`<html:code class="ocp-api-endpoint">` + path + `</html:code></xccdf-1.2:warning></xccdf-1.2:Rule>`
+			}
+			parseDoc := func(doc string) *xmlquery.Node {
+				node, err := utils.ParseContent(strings.NewReader(
+					`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2" ` +
+						`xmlns:html="http://www.w3.org/1999/xhtml">` + doc + `</xccdf-1.2:Benchmark>`))
+				Expect(err).To(BeNil())
+				return node
+			}
+			ds := parseDoc(`<xccdf-1.2:Profile id="moderate">` +
+				`<xccdf-1.2:select idref="rule_kept" selected="true"/>` +
+				`<xccdf-1.2:select idref="rule_unselected" selected="true"/>` +
+				`</xccdf-1.2:Profile>` +
+				rule("rule_kept", "/apis/example.io/v1/kept") +
+				rule("rule_unselected", "/apis/example.io/v1/unselected"))
+			tailoring := parseDoc(`<xccdf-1.2:Profile id="tailored" extends="moderate">` +
+				`<xccdf-1.2:select idref="rule_unselected" selected="false"/>` +
+				`</xccdf-1.2:Profile>`)
+
+			chain, err := resolveProfileChain(ds, tailoring, "tailored")
+			Expect(err).To(BeNil())
+			Expect(resolveCheckSelections(chain)).To(Equal([]checkSelection{
+				{id: "rule_kept", selected: true, profile: "moderate"},
+				{id: "rule_unselected", selected: false, profile: "tailored"},
+			}))
+
+			fetcher := &scapContentDataStream{dataStream: ds, tailoring: tailoring, skipKubeletConfig: true}
+			Expect(fetcher.FigureResources("tailored")).To(Succeed())
+			paths := []string{}
+			for _, rpath := range fetcher.resources {
+				paths = append(paths, rpath.ObjPath)
+			}
+			Expect(paths).To(ContainElement("/apis/example.io/v1/kept"))
+			Expect(paths).ToNot(ContainElement("/apis/example.io/v1/unselected"))
+		})
+	})
+
+	Context("Skipping the KubeletConfig collection", func() {
+		It("Doesn't stage any KubeletConfig paths", func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			contentDS, err := parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-node-worker-0",
+					Labels: map[string]string{
+						"node-role.kubernetes.io/worker": "",
+					},
+				},
+			}
+			fetcher := &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{
+					client: fake.NewFakeClientWithScheme(scheme.Scheme, node),
+				},
+				dataStream:        contentDS,
+				skipKubeletConfig: true,
+			}
+			err = fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")
+			Expect(err).To(BeNil())
+			Expect(fetcher.resources).ToNot(BeEmpty())
+			for _, resource := range fetcher.resources {
+				Expect(resource.DumpPath).ToNot(HavePrefix("/kubeletconfig"))
+			}
+		})
+
+		It("Only stages the node list if something reads it", func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			contentDS, err := parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+			nodeList := utils.ResourcePath{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"}
+
+			By("skipping the KubeletConfigs of a platform-only profile")
+			fetcher := &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{
+					client: fake.NewFakeClientWithScheme(scheme.Scheme),
+				},
+				dataStream:        contentDS,
+				skipKubeletConfig: true,
+			}
+			Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+			Expect(fetcher.resources).ToNot(BeEmpty())
+			Expect(fetcher.resources).ToNot(ContainElement(nodeList))
+
+			By("collecting the KubeletConfigs")
+			fetcher.skipKubeletConfig = false
+			Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+			Expect(fetcher.resources).To(ContainElement(nodeList))
+
+			By("selecting a check that reads the nodes")
+			fetcher.skipKubeletConfig = true
+			Expect(fetcher.withNodeList([]utils.ResourcePath{
+				{ObjPath: "/api/v1/nodes/worker-0", DumpPath: "/api/v1/nodes/worker-0"},
+			})).To(ContainElement(nodeList))
+			Expect(readsNodes([]utils.ResourcePath{{ObjPath: "/api/v1/nodesomething"}})).To(BeFalse())
+		})
+	})
+
+	Context("Skipping the staged resources", func() {
+		networks := "/apis/config.openshift.io/v1/networks/cluster"
+
+		It("Doesn't stage the skipped resources", func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			contentDS, err := parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+
+			fetcher := &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{
+					client: fake.NewFakeClientWithScheme(scheme.Scheme),
+				},
+				dataStream:        contentDS,
+				skipKubeletConfig: true,
+				skipStaged:        []string{networks, versionDumpPath},
+			}
+			Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+			Expect(fetcher.resources).ToNot(BeEmpty())
+			Expect(fetcher.resources).To(ContainElement(utils.ResourcePath{
+				ObjPath: apiserverOperatorDumpPath, DumpPath: apiserverOperatorDumpPath}))
+			for _, resource := range fetcher.resources {
+				Expect(resource.DumpPath).ToNot(BeElementOf(networks, versionDumpPath))
+			}
+		})
+
+		It("Only skips the resources every scan fetches", func() {
+			Expect(validateSkipStaged([]string{versionDumpPath, networks, apiserverOperatorDumpPath})).To(Succeed())
+			Expect(validateSkipStaged([]string{"/api/v1/nodes"})).ToNot(Succeed())
+		})
+
+		It("Warns when /version is skipped but the collection depends on the version", func() {
+			gated := []utils.ResourcePath{{ObjPath: "/a", DumpPath: "/a", K8SVersion: ">=1.27.0"}}
+			ungated := []utils.ResourcePath{{ObjPath: "/a", DumpPath: "/a"}}
+			skipped := []string{versionDumpPath}
+			Expect(versionSkippedWarning(gated, skipped, "")).To(HavePrefix("/version isn't fetched"))
+			Expect(versionSkippedWarning(ungated, skipped, versionCheckWarn)).To(HavePrefix("/version isn't fetched"))
+			Expect(versionSkippedWarning(ungated, skipped, "")).To(BeEmpty())
+			Expect(versionSkippedWarning(gated, []string{networks}, "")).To(BeEmpty())
+			Expect(versionSkippedWarning(append(gated, utils.ResourcePath{ObjPath: versionDumpPath,
+				DumpPath: versionDumpPath}), skipped, "")).To(BeEmpty())
+		})
+	})
+
+	Context("Restricting the collection to a node subset", func() {
+		It("Lists all the nodes without a subset", func() {
+			rpath := getNodeListResourcePath(nil, "")
+			Expect(rpath.ObjPath).To(Equal("/api/v1/nodes"))
+			Expect(rpath.DumpPath).To(Equal("/api/v1/nodes"))
+			Expect(rpath.Filter).To(BeEmpty())
+		})
+
+		It("Only keeps the selected nodes in the node list", func() {
+			rpath := getNodeListResourcePath([]string{"worker-0", "worker-2"}, "node-role.kubernetes.io/worker")
+			Expect(rpath.ObjPath).To(Equal("/api/v1/nodes?labelSelector=node-role.kubernetes.io%2Fworker"))
+			Expect(rpath.DumpPath).To(Equal("/api/v1/nodes"))
+
+			nodeList := []byte(`{"kind":"NodeList","apiVersion":"v1","items":[` +
+				`{"metadata":{"name":"worker-0"}},{"metadata":{"name":"worker-1"}},{"metadata":{"name":"worker-2"}}]}`)
+			filtered, err := filter(context.Background(), nodeList, rpath.Filter, nil, nil, false)
+			Expect(err).To(BeNil())
+
+			var result corev1.NodeList
+			Expect(json.Unmarshal(filtered, &result)).To(Succeed())
+			Expect(result.Kind).To(Equal("NodeList"))
+			Expect(result.Items).To(HaveLen(2))
+			Expect(result.Items[0].Name).To(Equal("worker-0"))
+			Expect(result.Items[1].Name).To(Equal("worker-2"))
+		})
+
+		It("Rejects an invalid subset selector", func() {
+			dataStreamFile, err := os.Open("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")
+			Expect(err).To(BeNil())
+			defer dataStreamFile.Close()
+			contentDS, err := parseContent(dataStreamFile)
+			Expect(err).To(BeNil())
+
+			fetcher := &scapContentDataStream{
+				dataStream:        contentDS,
+				nodesMatching:     "!!invalid",
+				skipKubeletConfig: true,
+			}
+			err = fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Context("Streaming resources as a tar", func() {
+		data := map[string][]byte{
+			"/api/v1/nodes":                      []byte(`{"kind":"NodeList"}`),
+			"/kubeletconfig/worker/worker-0":     []byte(`{"kind":"KubeletConfiguration"}`),
+			"/apis/config.openshift.io/v1/oauth": []byte(`{"kind":"OAuth"}`),
+		}
+
+		readEntries := func(r io.Reader) map[string]string {
+			entries := map[string]string{}
+			names := []string{}
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+				Expect(hdr.Mode).To(Equal(int64(0640)))
+				contents, err := ioutil.ReadAll(tr)
+				Expect(err).To(BeNil())
+				entries[hdr.Name] = string(contents)
+				names = append(names, hdr.Name)
+			}
+			Expect(sort.StringsAreSorted(names)).To(BeTrue())
+			return entries
+		}
+
+		expected := map[string]string{
+			"api/v1/nodes":                      `{"kind":"NodeList"}`,
+			"kubeletconfig/worker/worker-0":     `{"kind":"KubeletConfiguration"}`,
+			"apis/config.openshift.io/v1/oauth": `{"kind":"OAuth"}`,
+		}
+
+		It("Keeps the dump path layout", func() {
+			var buf bytes.Buffer
+			Expect(streamResources(&buf, data, 0640, false)).To(Succeed())
+			Expect(readEntries(&buf)).To(Equal(expected))
+		})
+
+		It("Compresses the stream if requested", func() {
+			var buf bytes.Buffer
+			Expect(streamResources(&buf, data, 0640, true)).To(Succeed())
+			gzr, err := gzip.NewReader(&buf)
+			Expect(err).To(BeNil())
+			Expect(readEntries(gzr)).To(Equal(expected))
+		})
+
+		It("Rejects bad object paths", func() {
+			var buf bytes.Buffer
+			Expect(streamResources(&buf, map[string][]byte{"/": []byte("{}")}, 0640, false)).ToNot(Succeed())
+		})
+	})
+
+	Context("Saving resources with custom permissions", func() {
+		It("Validates the configured modes", func() {
+			mode, err := parseResourceMode("0640", 0600)
+			Expect(err).To(BeNil())
+			Expect(mode).To(Equal(os.FileMode(0640)))
+
+			for _, invalid := range []string{"0666", "0400", "4600", "rw-", ""} {
+				_, err := parseResourceMode(invalid, 0600)
+				Expect(err).ToNot(BeNil(), invalid)
+			}
+		})
+
+		It("Applies the modes regardless of the umask", func() {
+			dir, err := ioutil.TempDir("", "saved-resources")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			err = saveResources(dir, map[string][]byte{
+				"/api/v1/nodes": []byte("{}"),
+			}, 0640, 0750, false)
+			Expect(err).To(BeNil())
+
+			for p, mode := range map[string]os.FileMode{
+				dir + "/api":          0750,
+				dir + "/api/v1":       0750,
+				dir + "/api/v1/nodes": 0640,
+			} {
+				info, err := os.Stat(p)
+				Expect(err).To(BeNil())
+				Expect(info.Mode().Perm()).To(Equal(mode), p)
+			}
+		})
+
+		It("Gzips the resources but not the placeholders", func() {
+			dir, err := ioutil.TempDir("", "saved-resources")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			// Left over from an uncompressed run
+			Expect(saveResources(dir, map[string][]byte{"/api/v1/nodes": []byte("{}")}, 0, 0, false)).To(Succeed())
+
+			err = saveResources(dir, map[string][]byte{
+				"/api/v1/nodes":                          []byte(`{"items":[]}`),
+				"/api/v1/namespaces/a/configmaps/absent": []byte("# kube-api-error=NotFound"),
+				"/api/v1/namespaces/a/configmaps/empty":  {},
+			}, 0640, 0750, true)
+			Expect(err).To(BeNil())
+
+			_, err = os.Stat(dir + "/api/v1/nodes")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			compressed, err := ioutil.ReadFile(dir + "/api/v1/nodes.gz")
+			Expect(err).To(BeNil())
+			Expect(gunzipResource(compressed)).To(Equal([]byte(`{"items":[]}`)))
+			info, err := os.Stat(dir + "/api/v1/nodes.gz")
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+			placeholder, err := ioutil.ReadFile(dir + "/api/v1/namespaces/a/configmaps/absent")
+			Expect(err).To(BeNil())
+			Expect(string(placeholder)).To(Equal("# kube-api-error=NotFound"))
+			empty, err := ioutil.ReadFile(dir + "/api/v1/namespaces/a/configmaps/empty")
+			Expect(err).To(BeNil())
+			Expect(empty).To(BeEmpty())
+		})
+
+		It("Rejects bad object paths when compressing", func() {
+			dir, err := ioutil.TempDir("", "saved-resources")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			err = saveResources(dir, map[string][]byte{"nodes": []byte("{}")}, 0640, 0750, true)
+			Expect(err).To(MatchError("bad object path: nodes"))
+			entries, err := ioutil.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+
+	Context("Reporting the selected rules that aren't defined", func() {
+		It("Returns the rules missing from the content", func() {
+			content, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+  <xccdf-1.2:Profile id="xccdf_org.ssgproject.content_profile_test">
+    <xccdf-1.2:select idref="xccdf_org.ssgproject.content_rule_defined" selected="true"/>
+    <xccdf-1.2:select idref="xccdf_org.ssgproject.content_rule_removed" selected="true"/>
+    <xccdf-1.2:select idref="xccdf_org.ssgproject.content_rule_unselected" selected="false"/>
+  </xccdf-1.2:Profile>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_defined"/>
+</xccdf-1.2:Benchmark>`))
+			Expect(err).To(BeNil())
+			_, _, undefined := getResourcePaths(content, content, "xccdf_org.ssgproject.content_profile_test", nil)
+			Expect(undefined).To(Equal([]string{"xccdf_org.ssgproject.content_rule_removed"}))
+		})
+
+		It("Sums them up in a warning", func() {
+			rules := []string{"rule_1", "rule_2", "rule_3", "rule_4", "rule_5", "rule_6", "rule_7"}
+			Expect(undefinedRulesWarning(rules[:2])).To(Equal(
+				"The profile selects 2 rules that aren't defined in the content: rule_1, rule_2"))
+			warning := undefinedRulesWarning(rules)
+			Expect(warning).To(Equal("The profile selects 7 rules that aren't defined in the content: " +
+				"rule_1, rule_2, rule_3, rule_4, rule_5 and 2 more"))
+
+			fetcher := &scapContentDataStream{undefinedRules: rules}
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).To(BeNil())
+			Expect(warnings).To(Equal(newFetchWarnings(warningCategoryUndefinedRules, warning)))
+			Expect(fetcher.Summary(warnings).UndefinedRules).To(Equal(7))
+		})
+
+		It("Annotates the scan with their number", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-scan",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+			fetcher := &scapContentDataStream{undefinedRules: []string{"rule-a", "rule-b", "rule-c"}}
+			Expect(recordCollection(context.TODO(), client, key, fetcher, time.Second)).To(Succeed())
+
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), key, updated)).To(Succeed())
+			count, ok := updated.GetUndefinedRules()
+			Expect(ok).To(BeTrue())
+			Expect(count).To(Equal(3))
+		})
+
+		It("Annotates the scan with the fetch duration", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-scan",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+			fetcher := &scapContentDataStream{}
+			Expect(recordCollection(context.TODO(), client, key, fetcher, 42*time.Second+500*time.Microsecond)).To(Succeed())
+
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), key, updated)).To(Succeed())
+			Expect(updated.GetAnnotations()[compv1alpha1.ComplianceScanFetchDurationAnnotation]).To(Equal("42.001s"))
+			d, ok := updated.GetFetchDuration()
+			Expect(ok).To(BeTrue())
+			Expect(d).To(Equal(42*time.Second + time.Millisecond))
+		})
+	})
+
+	Context("Decoding the values", func() {
+		It("Decodes the entities exactly once", func() {
+			content, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+  <xccdf-1.2:Profile id="xccdf_org.ssgproject.content_profile_test">
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_lt">a &lt; b</xccdf-1.2:set-value>
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_amp">^a&amp;b$</xccdf-1.2:set-value>
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_numeric">a&#38;b&#x3c;c</xccdf-1.2:set-value>
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_escaped">&amp;lt;</xccdf-1.2:set-value>
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_cdata"><![CDATA[a<b&c]]></xccdf-1.2:set-value>
+    <xccdf-1.2:set-value idref="xccdf_org.ssgproject.content_value_comment"> 42 <!-- the default --></xccdf-1.2:set-value>
+  </xccdf-1.2:Profile>
+</xccdf-1.2:Benchmark>`))
+			Expect(err).To(BeNil())
+			Expect(getProfileSetValues(content, "xccdf_org.ssgproject.content_profile_test")).To(Equal(map[string]string{
+				"lt":      "a < b",
+				"amp":     "^a&b$",
+				"numeric": "a&b<c",
+				"escaped": "&lt;",
+				"cdata":   "a<b&c",
+				"comment": "42",
+			}))
+		})
+	})
+
+	Context("Saving the warnings", func() {
+		It("Writes each warning once, counting the repeated ones", func() {
+			dir, err := ioutil.TempDir("", "warnings")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			outputFile := dir + "/warning_output"
+
+			fetcher := scapContentDataStream{}
+			Expect(fetcher.SaveWarningsIfAny(newFetchWarnings(warningCategoryFetch,
+				"could not fetch /apis/config.openshift.io/v1/oauths: forbidden",
+				"could not fetch /api/v1/nodes: timeout",
+				"could not fetch /apis/config.openshift.io/v1/oauths: forbidden",
+				"could not fetch /apis/config.openshift.io/v1/oauths: forbidden",
+			), outputFile)).To(Succeed())
+
+			out, err := ioutil.ReadFile(outputFile)
+			Expect(err).To(BeNil())
+			Expect(string(out)).To(Equal("could not fetch /apis/config.openshift.io/v1/oauths: forbidden (seen 3 times)\n" +
+				"could not fetch /api/v1/nodes: timeout"))
+		})
+	})
+
+	Context("Saving the metadata archive", func() {
+		It("Bundles the warnings, manifest and timing data", func() {
+			dir, err := ioutil.TempDir("", "metadata-archive")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			archivePath := dir + "/metadata.tar.gz"
+
+			fetcher := scapContentDataStream{
+				resources: []utils.ResourcePath{
+					{ObjPath: "/version", DumpPath: "/version"},
+					{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+				},
+				found: map[string][]byte{
+					"/version": []byte(`{"major":"1"}`),
+				},
+			}
+			start := time.Now()
+			timing := newFetchTiming(start, start.Add(2*time.Second))
+			err = fetcher.SaveMetadataArchive(newFetchWarnings(warningCategoryFetch, "warning one", "warning two"),
+				timing, archivePath)
+			Expect(err).To(BeNil())
+
+			f, err := os.Open(archivePath)
+			Expect(err).To(BeNil())
+			defer f.Close()
+			gzr, err := gzip.NewReader(f)
+			Expect(err).To(BeNil())
+			tr := tar.NewReader(gzr)
+			contents := map[string][]byte{}
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+				contents[hdr.Name], err = ioutil.ReadAll(tr)
+				Expect(err).To(BeNil())
+			}
+
+			Expect(contents).To(HaveLen(3))
+			Expect(string(contents[metadataArchiveWarnings])).To(Equal("warning one\nwarning two"))
+
+			manifest := metadataManifest{}
+			Expect(json.Unmarshal(contents[metadataArchiveManifest], &manifest)).To(Succeed())
+			Expect(manifest.Resources).To(Equal([]metadataManifestEntry{
+				{ObjPath: "/version", DumpPath: "/version", Size: 13},
+			}))
+
+			parsedTiming := fetchTiming{}
+			Expect(json.Unmarshal(contents[metadataArchiveTiming], &parsedTiming)).To(Succeed())
+			Expect(parsedTiming.DurationSeconds).To(BeNumerically("==", 2))
+		})
+
+		It("Keeps the per-node KubeletConfigs if asked to", func() {
+			dir, err := ioutil.TempDir("", "metadata-archive")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			archivePath := dir + "/metadata.tar.gz"
+
+			fetcher := scapContentDataStream{
+				keepNodeKubelets: true,
+				found: map[string][]byte{
+					"/version":                       []byte(`{"major":"1"}`),
+					"/kubeletconfig/worker/worker-0": []byte(`{"maxPods":250}`),
+					"/kubeletconfig/worker/worker-1": []byte(`{"maxPods":500}`),
+					"/kubeletconfig/role/worker":     []byte(`{}`),
+				},
+			}
+			timing := newFetchTiming(time.Now(), time.Now())
+			Expect(fetcher.SaveMetadataArchive(nil, timing, archivePath)).To(Succeed())
+
+			f, err := os.Open(archivePath)
+			Expect(err).To(BeNil())
+			defer f.Close()
+			gzr, err := gzip.NewReader(f)
+			Expect(err).To(BeNil())
+			tr := tar.NewReader(gzr)
+			names := []string{}
+			contents := map[string][]byte{}
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+				names = append(names, hdr.Name)
+				contents[hdr.Name], err = ioutil.ReadAll(tr)
+				Expect(err).To(BeNil())
+			}
+
+			Expect(names).To(Equal([]string{
+				metadataArchiveWarnings,
+				metadataArchiveManifest,
+				metadataArchiveTiming,
+				"kubeletconfig/role/worker",
+				"kubeletconfig/worker/worker-0",
+				"kubeletconfig/worker/worker-1",
+			}))
+			Expect(string(contents["kubeletconfig/worker/worker-1"])).To(Equal(`{"maxPods":500}`))
+		})
+	})
+
 	Context("Parses the save path appropriately", func() {
 		It("Parses correctly with the root being '/tmp'", func() {
 			root := "/tmp"
@@ -222,7 +923,7 @@ var _ = Describe("Testing filtering", func() {
 		})
 		It("filters namespaces appropriately", func() {
 			filteredOut, filterErr := filter(context.TODO(), rawns,
-				`[.items[] | select((.metadata.name | startswith("openshift") | not) and (.metadata.name | startswith("kube-") | not) and .metadata.name != "default")]`)
+				`[.items[] | select((.metadata.name | startswith("openshift") | not) and (.metadata.name | startswith("kube-") | not) and .metadata.name != "default")]`, nil, nil, false)
 			Expect(filterErr).To(BeNil())
 			nsArr := []interface{}{}
 			unmErr := json.Unmarshal(filteredOut, &nsArr)
@@ -231,10 +932,62 @@ var _ = Describe("Testing filtering", func() {
 		})
 	})
 
+	Context("Streaming list filters", func() {
+		var rawns []byte
+		BeforeEach(func() {
+			var readErr error
+			rawns, readErr = ioutil.ReadFile("../../tests/data/namespaces.json")
+			Expect(readErr).To(BeNil())
+		})
+
+		It("gives the same output as filtering the whole list", func() {
+			for _, f := range []string{
+				`[.items[]]`,
+				`[.items[] | select(.metadata.name | startswith("openshift") | not)]`,
+				`[.items[] | .metadata.name, .kind]`,
+				`[.items[] | .metadata.name] | map(select(startswith("kube"))) | length`,
+			} {
+				itemFilter, ok := getListItemFilter(f)
+				Expect(ok).To(BeTrue(), f)
+
+				expected, err := filter(context.TODO(), rawns, f, nil, nil, false)
+				Expect(err).To(BeNil())
+				streamed, err := filterListItems(context.TODO(), bytes.NewReader(rawns), f, itemFilter, nil, nil, false)
+				Expect(err).To(BeNil())
+				Expect(streamed).To(Equal(expected), f)
+			}
+		})
+
+		It("only streams filters over the list items", func() {
+			for _, f := range []string{
+				`.items[0]`,
+				`.items | length`,
+				`[.items[0] | .metadata]`,
+				`[.items[] as $ns | $ns.metadata]`,
+				`[.items[]?]`,
+			} {
+				_, ok := getListItemFilter(f)
+				Expect(ok).To(BeFalse(), f)
+			}
+		})
+
+		It("handles empty and malformed bodies", func() {
+			itemFilter, ok := getListItemFilter(`[.items[]]`)
+			Expect(ok).To(BeTrue())
+
+			_, err := filterListItems(context.TODO(), bytes.NewReader([]byte{}), `[.items[]]`, itemFilter, nil, nil, false)
+			Expect(err).To(MatchError(errEmptyBody))
+			_, err = filterListItems(context.TODO(), bytes.NewReader([]byte(`{"items": null}`)), `[.items[]]`, itemFilter, nil, nil, false)
+			Expect(err).ToNot(BeNil())
+			_, err = filterListItems(context.TODO(), bytes.NewReader([]byte(`[]`)), `[.items[]]`, itemFilter, nil, nil, false)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
 	Context("Testing errors", func() {
 		It("outputs error if it can't create filter", func() {
 			_, filterErr := filter(context.TODO(), []byte{},
-				`.items[`)
+				`.items[`, nil, nil, false)
 			Expect(filterErr).ToNot(BeNil())
 		})
 		Context("Filtering namespaces", func() {
@@ -248,26 +1001,246 @@ var _ = Describe("Testing filtering", func() {
 			})
 
 			It("skips extra results", func() {
-				_, filterErr := filter(context.TODO(), rawns, `.items[]`)
+				_, filterErr := filter(context.TODO(), rawns, `.items[]`, nil, nil, false)
 				Expect(filterErr).Should(MatchError(MoreThanOneObjErr))
 			})
+
+			It("keeps all the results if the resource allows them", func() {
+				out, err := filter(context.TODO(), rawns, `.items[] | .metadata.name | select(startswith("openshift-"))`,
+					nil, nil, true)
+				Expect(err).To(BeNil())
+				names := []string{}
+				Expect(json.Unmarshal(out, &names)).To(Succeed())
+				Expect(len(names)).To(BeNumerically(">", 1))
+
+				out, err = filter(context.TODO(), rawns, `.items[] | select(.metadata.name == "missing")`, nil, nil, true)
+				Expect(err).To(BeNil())
+				Expect(string(out)).To(Equal("[]"))
+
+				f := `[.items[] | .metadata.name] | .[]`
+				itemFilter, ok := getListItemFilter(f)
+				Expect(ok).To(BeTrue())
+				streamed, err := filterListItems(context.TODO(), bytes.NewReader(rawns), f, itemFilter, nil, nil, true)
+				Expect(err).To(BeNil())
+				expected, err := filter(context.TODO(), rawns, `[.items[] | .metadata.name]`, nil, nil, false)
+				Expect(err).To(BeNil())
+				Expect(streamed).To(MatchJSON(expected))
+			})
 		})
 	})
-})
 
-type notFoundFetcher struct{}
+	Context("Reading the runtime values", func() {
+		environ := map[string]string{
+			"CLUSTER_BASE_DOMAIN":   "example.com",
+			"AWS_SECRET_ACCESS_KEY": "hunter2",
+			"KUBECONFIG":            "/root/.kube/config",
+		}
+		lookup := func(key string) (string, bool) {
+			value, ok := environ[key]
+			return value, ok
+		}
 
-func (ff *notFoundFetcher) Stream(_ context.Context, _ resourceFetcherClients) (io.ReadCloser, error) {
-	return nil, errors.NewNotFound(schema.GroupResource{
-		Group:    "some group",
-		Resource: "some resource",
-	}, "some name")
-}
+		It("only exposes the allowlisted variables and the scan name", func() {
+			env := newFilterEnv(lookup, "ocp4-cis")
+			Expect(env).To(ConsistOf("CLUSTER_BASE_DOMAIN=example.com", "SCAN_NAME=ocp4-cis"))
 
-var _ = Describe("Testing fetching", func() {
-	var (
-		fakeClients resourceFetcherClients
-	)
+			out, err := filter(context.TODO(), []byte(`{}`), `$ENV`, env, nil, false)
+			Expect(err).To(BeNil())
+			Expect(string(out)).To(Equal(`{"CLUSTER_BASE_DOMAIN":"example.com","SCAN_NAME":"ocp4-cis"}`))
+		})
+
+		It("doesn't expose the process environment", func() {
+			os.Setenv("COMPLIANCE_TEST_SECRET", "hunter2")
+			defer os.Unsetenv("COMPLIANCE_TEST_SECRET")
+			env := newFilterEnv(os.LookupEnv, "")
+			for _, f := range []string{`$ENV.COMPLIANCE_TEST_SECRET`, `env.COMPLIANCE_TEST_SECRET`, `$ENV.PATH`} {
+				out, err := filter(context.TODO(), []byte(`{}`), f, env, nil, false)
+				Expect(err).To(BeNil(), f)
+				Expect(string(out)).To(Equal("null"), f)
+			}
+		})
+
+		It("exposes the values to the filters over list items", func() {
+			rawns, err := ioutil.ReadFile("../../tests/data/namespaces.json")
+			Expect(err).To(BeNil())
+			f := `[.items[] | {name: .metadata.name, domain: $ENV.CLUSTER_BASE_DOMAIN, secret: $ENV.AWS_SECRET_ACCESS_KEY}] | first`
+			itemFilter, ok := getListItemFilter(f)
+			Expect(ok).To(BeTrue())
+			out, err := filterListItems(context.TODO(), bytes.NewReader(rawns), f, itemFilter, newFilterEnv(lookup, ""), nil, false)
+			Expect(err).To(BeNil())
+			Expect(string(out)).To(MatchRegexp(`^{"domain":"example.com","name":"[^"]+","secret":null}$`))
+		})
+	})
+
+	Context("Reading the XCCDF values from the filters", func() {
+		values := filterValues{
+			"expected_name": "openshift-apiserver",
+			"var-with-dash": "ignored",
+		}
+		var rawns []byte
+
+		BeforeEach(func() {
+			var err error
+			rawns, err = ioutil.ReadFile("../../tests/data/namespaces.json")
+			Expect(err).To(BeNil())
+		})
+
+		It("binds the values to variables", func() {
+			f := `[.items[] | select(.metadata.name == $expected_name) | .metadata.name]`
+			out, err := filter(context.TODO(), rawns, f, nil, values, false)
+			Expect(err).To(BeNil())
+			Expect(string(out)).To(Equal(`["openshift-apiserver"]`))
+
+			itemFilter, ok := getListItemFilter(f)
+			Expect(ok).To(BeTrue())
+			streamed, err := filterListItems(context.TODO(), bytes.NewReader(rawns), f, itemFilter, nil, values, false)
+			Expect(err).To(BeNil())
+			Expect(streamed).To(Equal(out))
+		})
+
+		It("warns about the variables no value defines", func() {
+			_, err := filter(context.TODO(), rawns, `.items[] | select(.metadata.name == $unknown_name)`, nil, values, false)
+			Expect(err).To(MatchError(errUndefinedFilterVariable))
+			Expect(err.Error()).To(ContainSubstring("$unknown_name"))
+
+			objects := []utils.ResourcePath{{
+				ObjPath:  "/api/v1/namespaces",
+				DumpPath: "/api/v1/namespaces",
+				Filter:   `[.items[] | select(.metadata.name == $unknown_name)]`,
+			}}
+			dispatcher := func(uri string) resourceStreamer {
+				return streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+					return ioutil.NopCloser(bytes.NewReader(rawns)), nil
+				})
+			}
+			errs := filterErrorCounts{}
+			found, warnings, err := fetchRecording(context.TODO(), dispatcher, resourceFetcherClients{}, objects,
+				fetchRecorder{filterErrors: errs, filterValues: values})
+			Expect(err).To(BeNil())
+			Expect(found).To(BeEmpty())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0].category).To(Equal(warningCategoryFilter))
+			Expect(warnings[0].message).To(ContainSubstring("undefined variable $unknown_name"))
+			Expect(errs[filterErrorUndefinedVariable]).To(HaveKeyWithValue("/api/v1/namespaces", 1))
+		})
+	})
+})
+
+// patchCountingClient counts the patches sent to the objects, leaving out
+// those sent to their status
+type patchCountingClient struct {
+	runtimeclient.Client
+	patches int
+}
+
+func (c *patchCountingClient) Patch(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+	c.patches++
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// nodePagingClient lists the nodes, or their metadata, pageSize at a time
+type nodePagingClient struct {
+	runtimeclient.Client
+	pageSize int
+	pages    int
+}
+
+func (c *nodePagingClient) List(ctx context.Context, list runtimeclient.ObjectList, opts ...runtimeclient.ListOption) error {
+	listOpts := &runtimeclient.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	offset := 0
+	if listOpts.Continue != "" {
+		offset, _ = strconv.Atoi(listOpts.Continue)
+	}
+	listOpts.Continue = ""
+	if err := c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+	c.pages++
+	page := func(n int) (int, string) {
+		end := offset + c.pageSize
+		if end >= n {
+			return n, ""
+		}
+		return end, strconv.Itoa(end)
+	}
+	switch l := list.(type) {
+	case *corev1.NodeList:
+		end, cont := page(len(l.Items))
+		l.Items, l.Continue = l.Items[offset:end], cont
+	case *metav1.PartialObjectMetadataList:
+		end, cont := page(len(l.Items))
+		l.Items, l.Continue = l.Items[offset:end], cont
+	}
+	return nil
+}
+
+type notFoundFetcher struct{}
+
+func (ff *notFoundFetcher) Stream(_ context.Context, _ resourceFetcherClients) (io.ReadCloser, error) {
+	return nil, errors.NewNotFound(schema.GroupResource{
+		Group:    "some group",
+		Resource: "some resource",
+	}, "some name")
+}
+
+// cannedStreamer streams a canned body, or fails with a canned error
+// countingStreamer tells how many of the streamers sharing its counts
+// stream at most at once
+type countingStreamer struct {
+	next        resourceStreamer
+	mutex       *sync.Mutex
+	inFlight    *int
+	maxInFlight *int
+}
+
+func (s *countingStreamer) Stream(ctx context.Context, rfClients resourceFetcherClients) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	*s.inFlight++
+	if *s.inFlight > *s.maxInFlight {
+		*s.maxInFlight = *s.inFlight
+	}
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		*s.inFlight--
+		s.mutex.Unlock()
+	}()
+	// Give the other kinds the time to start
+	time.Sleep(10 * time.Millisecond)
+	return s.next.Stream(ctx, rfClients)
+}
+
+type cannedStreamer struct {
+	body string
+	err  error
+}
+
+func (cs *cannedStreamer) Stream(_ context.Context, _ resourceFetcherClients) (io.ReadCloser, error) {
+	if cs.err != nil {
+		return nil, cs.err
+	}
+	return ioutil.NopCloser(strings.NewReader(cs.body)), nil
+}
+
+// streamerFunc is a resourceStreamer calling itself
+type streamerFunc func(ctx context.Context) (io.ReadCloser, error)
+
+func (f streamerFunc) Stream(ctx context.Context, _ resourceFetcherClients) (io.ReadCloser, error) {
+	return f(ctx)
+}
+
+// cannedDispatcher dispatches each URI to its canned streamer
+func cannedDispatcher(streamers map[string]*cannedStreamer) streamerDispatcherFn {
+	return func(uri string) resourceStreamer {
+		return streamers[uri]
+	}
+}
+
+var _ = Describe("Testing fetching", func() {
+	var (
+		fakeClients resourceFetcherClients
+	)
 
 	const (
 		mcFipsFilter   = `[.items[] | select(.metadata.name | test("^[0-9]{2}-worker-fips$|^[0-9]{2}-master-fips$"))]|map(.spec.fips == true)`
@@ -292,6 +1265,698 @@ var _ = Describe("Testing fetching", func() {
 			Expect(warnings[0]).To(Equal("could not fetch : some resource.some group \"some name\" not found"))
 		})
 	})
+	Context("Classifying the fetch results", func() {
+		gr := schema.GroupResource{Group: "config.openshift.io", Resource: "oauths"}
+		for _, tc := range []struct {
+			description string
+			streamer    *cannedStreamer
+			filter      string
+			results     map[string][]byte
+			warnings    []string
+			fails       bool
+		}{
+			{
+				description: "saves the body",
+				streamer:    &cannedStreamer{body: `{"kind":"OAuth"}`},
+				results:     map[string][]byte{"/oauth": []byte(`{"kind":"OAuth"}`)},
+			},
+			{
+				description: "saves the filtered body",
+				streamer:    &cannedStreamer{body: `{"kind":"OAuth","spec":{}}`},
+				filter:      `.kind`,
+				results:     map[string][]byte{"/oauth": []byte(`"OAuth"`)},
+			},
+			{
+				description: "saves the first result of a filter with several, with a warning",
+				streamer:    &cannedStreamer{body: `{"items":[1,2]}`},
+				filter:      `.items[]`,
+				results:     map[string][]byte{"/oauth": []byte(`1`)},
+				warnings:    []string{"Skipping extra results from filter '.items[]': more than one object returned from the filter"},
+			},
+			{
+				description: "saves nothing for an empty body",
+				streamer:    &cannedStreamer{},
+				results:     map[string][]byte{},
+			},
+			{
+				description: "marks a missing resource for OpenSCAP, with a warning",
+				streamer:    &cannedStreamer{err: errors.NewNotFound(gr, "cluster")},
+				results:     map[string][]byte{"/oauth": []byte("# kube-api-error=NotFound")},
+				warnings:    []string{`could not fetch /apis/config.openshift.io/v1/oauths/cluster: oauths.config.openshift.io "cluster" not found`},
+			},
+			{
+				description: "only warns about a forbidden resource",
+				streamer:    &cannedStreamer{err: errors.NewForbidden(gr, "cluster", fmt.Errorf("no access"))},
+				results:     map[string][]byte{},
+				warnings: []string{`could not fetch /apis/config.openshift.io/v1/oauths/cluster: ` +
+					`oauths.config.openshift.io "cluster" is forbidden: no access`},
+			},
+			{
+				description: "only warns about a resource the cluster doesn't serve",
+				streamer: &cannedStreamer{err: &meta.NoKindMatchError{
+					GroupKind:        schema.GroupKind{Group: "config.openshift.io", Kind: "OAuth"},
+					SearchedVersions: []string{"v1"},
+				}},
+				results:  map[string][]byte{},
+				warnings: []string{`could not fetch /apis/config.openshift.io/v1/oauths/cluster: no matches for kind "OAuth" in version "config.openshift.io/v1"`},
+			},
+			{
+				description: "only warns about a resource the API server keeps failing",
+				streamer:    &cannedStreamer{err: errors.NewInternalError(fmt.Errorf("boom"))},
+				results:     map[string][]byte{},
+				warnings:    []string{"could not fetch /apis/config.openshift.io/v1/oauths/cluster after 0 retries: Internal error occurred: boom"},
+			},
+			{
+				description: "fails on other errors",
+				streamer:    &cannedStreamer{err: errors.NewBadRequest("boom")},
+				fails:       true,
+			},
+			{
+				description: "fails on a filter without a result",
+				streamer:    &cannedStreamer{body: `{"kind":"OAuth"}`},
+				filter:      `empty`,
+				fails:       true,
+			},
+		} {
+			tc := tc
+			It(tc.description, func() {
+				dispatcher := cannedDispatcher(map[string]*cannedStreamer{
+					"/apis/config.openshift.io/v1/oauths/cluster": tc.streamer,
+				})
+				results, warnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{},
+					[]utils.ResourcePath{{
+						ObjPath:  "/apis/config.openshift.io/v1/oauths/cluster",
+						DumpPath: "/oauth",
+						Filter:   tc.filter,
+					}})
+				if tc.fails {
+					Expect(err).ToNot(BeNil())
+					return
+				}
+				Expect(err).To(BeNil())
+				Expect(results).To(Equal(tc.results))
+				Expect(warnings).To(Equal(tc.warnings))
+			})
+		}
+
+		It("Keeps the KubeletConfigs of the nodes of a role when they're consistent", func() {
+			config := `{"kubeletconfig":{"maxPods":250}}`
+			dispatcher := cannedDispatcher(map[string]*cannedStreamer{
+				"/api/v1/nodes/worker-0/proxy/configz": {body: config},
+				"/api/v1/nodes/worker-1/proxy/configz": {body: config},
+			})
+			results, warnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{}, []utils.ResourcePath{
+				{ObjPath: "/api/v1/nodes/worker-0/proxy/configz", DumpPath: "/kubeletconfig/worker/worker-0"},
+				{ObjPath: "/api/v1/nodes/worker-1/proxy/configz", DumpPath: "/kubeletconfig/worker/worker-1"},
+			})
+			Expect(err).To(BeNil())
+			results, warnings, err = saveConsistentKubeletResult(results, warnings)
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+			Expect(string(results[kubeletConfigRolePathPrefix+"worker"])).To(Equal(config))
+		})
+
+		It("Keeps what the KubeletConfigs of a role share when they differ", func() {
+			dispatcher := cannedDispatcher(map[string]*cannedStreamer{
+				"/api/v1/nodes/worker-0/proxy/configz": {body: `{"kubeletconfig":{"maxPods":250,"podPidsLimit":4096}}`},
+				"/api/v1/nodes/worker-1/proxy/configz": {body: `{"kubeletconfig":{"maxPods":250,"podPidsLimit":1024}}`},
+			})
+			results, warnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{}, []utils.ResourcePath{
+				{ObjPath: "/api/v1/nodes/worker-0/proxy/configz", DumpPath: "/kubeletconfig/worker/worker-0"},
+				{ObjPath: "/api/v1/nodes/worker-1/proxy/configz", DumpPath: "/kubeletconfig/worker/worker-1"},
+			})
+			Expect(err).To(BeNil())
+			results, warnings, err = saveConsistentKubeletResult(results, warnings)
+			Expect(err).To(BeNil())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(HavePrefix("Kubelet configs for "))
+			Expect(warnings[0]).To(ContainSubstring("are not consistent with role worker"))
+			Expect(string(results[kubeletConfigRolePathPrefix+"worker"])).To(MatchJSON(`{"kubeletconfig":{"maxPods":250}}`))
+			Expect(string(results[kubeletConfigDiffPathPrefix+"worker/worker-1"])).To(MatchJSON(
+				`[{"op":"replace","path":"/kubeletconfig/podPidsLimit","value":1024}]`))
+			Expect(results).ToNot(HaveKey(kubeletConfigDiffPathPrefix + "worker/worker-0"))
+		})
+	})
+
+	Context("Counting the filter errors", func() {
+		fakeDispatcher := func(uri string) resourceStreamer {
+			return &cannedStreamer{body: `{"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"b"}}]}`}
+		}
+
+		It("Counts the extra results by dump path", func() {
+			counts := filterErrorCounts{}
+			_, warnings, err := fetchRecording(context.TODO(), fakeDispatcher, resourceFetcherClients{},
+				[]utils.ResourcePath{
+					{ObjPath: "/api/v1/nodes", DumpPath: "/nodes", Filter: `.items[].metadata.name`},
+					{ObjPath: "/api/v1/pods", DumpPath: "/pods", Filter: `[.items[] | .metadata.name]`},
+				}, fetchRecorder{filterErrors: counts})
+			Expect(err).To(BeNil())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0].category).To(Equal(warningCategoryFilter))
+			Expect(counts).To(Equal(filterErrorCounts{filterErrorMulti: {"/nodes": 1}}))
+		})
+
+		It("Counts the failures that fail the fetch", func() {
+			for filter, kind := range map[string]string{
+				`.items[`:            filterErrorParse,
+				`empty`:              filterErrorNoResult,
+				`.items[] | error`:   filterErrorEval,
+				`[.items[] | 1 / 0]`: filterErrorEval,
+			} {
+				counts := filterErrorCounts{}
+				_, _, err := fetchRecording(context.TODO(), fakeDispatcher, resourceFetcherClients{},
+					[]utils.ResourcePath{{ObjPath: "/api/v1/nodes", DumpPath: "/nodes", Filter: filter}},
+					fetchRecorder{filterErrors: counts})
+				Expect(err).ToNot(BeNil(), filter)
+				Expect(counts).To(Equal(filterErrorCounts{kind: {"/nodes": 1}}), filter)
+			}
+		})
+
+		It("Counts the KubeletConfigs of a role together", func() {
+			counts := filterErrorCounts{}
+			fltrErr := &filterError{filterErrorMulti, MoreThanOneObjErr}
+			counts.add(kubeletConfigPathPrefix+"worker/worker-0", fltrErr)
+			counts.add(kubeletConfigPathPrefix+"worker/worker-1", fltrErr)
+			counts.add(kubeletConfigPathPrefix+"master/master-0", fltrErr)
+			Expect(counts).To(Equal(filterErrorCounts{filterErrorMulti: {
+				kubeletConfigPathPrefix + "worker": 2,
+				kubeletConfigPathPrefix + "master": 1,
+			}}))
+		})
+	})
+
+	Context("Fetching concurrently", func() {
+		notFound := errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "missing")
+		objects := []utils.ResourcePath{
+			{ObjPath: "/api/v1/nodes", DumpPath: "/nodes", Filter: `.items[].metadata.name`},
+			{ObjPath: "/api/v1/namespaces/a/configmaps/missing", DumpPath: "/missing"},
+			{ObjPath: "/api/v1/pods", DumpPath: "/pods", Filter: `[.items[] | .metadata.name]`},
+			{ObjPath: "/version", DumpPath: "/version"},
+			{ObjPath: "/api/v1/namespaces/b/configmaps/missing", DumpPath: "/missing-too"},
+		}
+		dispatcher := cannedDispatcher(map[string]*cannedStreamer{
+			"/api/v1/nodes": {body: `{"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"b"}}]}`},
+			"/api/v1/namespaces/a/configmaps/missing": {err: notFound},
+			"/api/v1/pods": {body: `{"items":[{"metadata":{"name":"c"}}]}`},
+			"/version":     {body: `{"gitVersion":"v1.27.6"}`},
+			"/api/v1/namespaces/b/configmaps/missing": {err: notFound},
+		})
+
+		It("Returns what fetching the objects one by one does", func() {
+			expected, expectedWarnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{}, objects)
+			Expect(err).To(BeNil())
+			Expect(expectedWarnings).To(HaveLen(3))
+			Expect(string(expected["/missing"])).To(Equal("# kube-api-error=NotFound"))
+			for i := 0; i < 10; i++ {
+				counts := filterErrorCounts{}
+				results, warnings, err := fetchRecording(context.TODO(), dispatcher,
+					resourceFetcherClients{fetchConcurrency: 4}, objects, fetchRecorder{filterErrors: counts})
+				Expect(err).To(BeNil())
+				Expect(results).To(Equal(expected))
+				Expect(warningMessages(warnings)).To(Equal(expectedWarnings))
+				Expect(counts).To(Equal(filterErrorCounts{filterErrorMulti: {"/nodes": 1}}))
+			}
+		})
+
+		It("Fetches up to the concurrency at a time", func() {
+			var mutex sync.Mutex
+			active, maxActive := 0, 0
+			blocking := func(uri string) resourceStreamer {
+				return streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+					mutex.Lock()
+					active++
+					if active > maxActive {
+						maxActive = active
+					}
+					mutex.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					mutex.Lock()
+					active--
+					mutex.Unlock()
+					return ioutil.NopCloser(strings.NewReader(`{}`)), nil
+				})
+			}
+			var many []utils.ResourcePath
+			for i := 0; i < 12; i++ {
+				many = append(many, utils.ResourcePath{ObjPath: fmt.Sprintf("/%d", i), DumpPath: fmt.Sprintf("/%d", i)})
+			}
+			results, _, err := fetchRecording(context.TODO(), blocking, resourceFetcherClients{fetchConcurrency: 3},
+				many, fetchRecorder{})
+			Expect(err).To(BeNil())
+			Expect(results).To(HaveLen(12))
+			Expect(maxActive).To(BeNumerically(">", 1))
+			Expect(maxActive).To(BeNumerically("<=", 3))
+		})
+
+		It("Cancels the other fetches on a fatal error", func() {
+			fatal := fmt.Errorf("connection refused")
+			failing := func(uri string) resourceStreamer {
+				return streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+					if uri == "/fails" {
+						return nil, fatal
+					}
+					<-ctx.Done()
+					return nil, ctx.Err()
+				})
+			}
+			_, _, err := fetchRecording(context.TODO(), failing, resourceFetcherClients{fetchConcurrency: 4},
+				[]utils.ResourcePath{
+					{ObjPath: "/blocks", DumpPath: "/blocks"},
+					{ObjPath: "/blocks-too", DumpPath: "/blocks-too"},
+					{ObjPath: "/fails", DumpPath: "/fails"},
+					{ObjPath: "/blocks-as-well", DumpPath: "/blocks-as-well"},
+				}, fetchRecorder{})
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		})
+	})
+
+	Context("Fetching the Secrets", func() {
+		const secret = `{"kind":"Secret","metadata":{"name":"tls","annotations":{
+			"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"tls.key\":\"c2VjcmV0\"}}",
+			"owner":"ingress"}},"type":"kubernetes.io/tls","data":{"tls.crt":"Y2VydA==","tls.key":"c2VjcmV0"},
+			"stringData":{"extra":"secret"}}`
+		secrets := func(body string) streamerDispatcherFn {
+			return func(uri string) resourceStreamer {
+				return &secretStreamer{streamer: streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+					return ioutil.NopCloser(strings.NewReader(body)), nil
+				})}
+			}
+		}
+
+		It("Recognizes the URIs of the Secrets", func() {
+			for _, uri := range []string{
+				"/api/v1/secrets",
+				"/api/v1/namespaces/openshift-ingress/secrets",
+				"/api/v1/namespaces/openshift-ingress/secrets/tls",
+				"/api/v1/namespaces/openshift-ingress/secrets?labelSelector=app%3Dingress",
+			} {
+				Expect(isSecretURI(uri)).To(BeTrue(), uri)
+				Expect(getStreamerFn(uri)).To(BeAssignableToTypeOf(&secretStreamer{}), uri)
+				Expect(getProtobufStreamerFn(uri)).To(BeAssignableToTypeOf(&secretStreamer{}), uri)
+				Expect((&resourceSnapshot{}).getStreamerFn(uri)).To(BeAssignableToTypeOf(&secretStreamer{}), uri)
+			}
+			for _, uri := range []string{
+				"/api/v1/namespaces/secrets/configmaps/tls",
+				"/api/v1/namespaces/secrets",
+				"/apis/example.com/v1/secrets",
+				"/api/v1/configmaps",
+			} {
+				Expect(isSecretURI(uri)).To(BeFalse(), uri)
+			}
+		})
+
+		It("Keeps the keys, but not the values, of the data", func() {
+			results, warnings, err := fetch(context.TODO(), secrets(secret), resourceFetcherClients{},
+				[]utils.ResourcePath{{ObjPath: "/api/v1/namespaces/openshift-ingress/secrets/tls", DumpPath: "/tls"}})
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+			Expect(string(results["/tls"])).To(MatchJSON(`{"kind":"Secret","metadata":{"name":"tls",
+				"annotations":{"owner":"ingress"}},"type":"kubernetes.io/tls",
+				"data":{"tls.crt":"<redacted>","tls.key":"<redacted>"}}`))
+		})
+
+		It("Redacts the Secrets of the lists before filtering them", func() {
+			list := `{"kind":"SecretList","items":[` + secret + `,{"kind":"Secret","metadata":{"name":"empty"}}]}`
+			results, _, err := fetch(context.TODO(), secrets(list), resourceFetcherClients{},
+				[]utils.ResourcePath{{
+					ObjPath:  "/api/v1/namespaces/openshift-ingress/secrets",
+					DumpPath: "/secrets",
+					Filter:   `[.items[] | {name: .metadata.name, data, stringData, metadata}]`,
+				}})
+			Expect(err).To(BeNil())
+			Expect(string(results["/secrets"])).ToNot(ContainSubstring("c2VjcmV0"))
+			Expect(string(results["/secrets"])).ToNot(ContainSubstring("Y2VydA=="))
+			Expect(string(results["/secrets"])).To(MatchJSON(`[
+				{"name":"tls","data":{"tls.crt":"<redacted>","tls.key":"<redacted>"},"stringData":null,
+				 "metadata":{"name":"tls","annotations":{"owner":"ingress"}}},
+				{"name":"empty","data":null,"stringData":null,"metadata":{"name":"empty"}}]`))
+		})
+	})
+
+	Context("Retrying the transient errors", func() {
+		objects := []utils.ResourcePath{{ObjPath: "/api/v1/nodes", DumpPath: "/nodes"}}
+		failingTimes := func(attempts *int, failures int, fetchErr error) streamerDispatcherFn {
+			return func(uri string) resourceStreamer {
+				return streamerFunc(func(ctx context.Context) (io.ReadCloser, error) {
+					*attempts++
+					if *attempts <= failures {
+						return nil, fetchErr
+					}
+					return ioutil.NopCloser(strings.NewReader(`{"items":[]}`)), nil
+				})
+			}
+		}
+		clients := resourceFetcherClients{fetchRetries: 3, fetchRetryDelay: time.Millisecond}
+
+		It("Fetches the resource once the API server recovers", func() {
+			for _, fetchErr := range []error{
+				errors.NewTooManyRequests("too many requests", 0),
+				errors.NewServerTimeout(schema.GroupResource{Resource: "nodes"}, "list", 0),
+				errors.NewServiceUnavailable("unavailable"),
+				errors.NewInternalError(fmt.Errorf("etcd leader changed")),
+			} {
+				attempts := 0
+				results, warnings, err := fetch(context.TODO(), failingTimes(&attempts, 2, fetchErr), clients, objects)
+				Expect(err).To(BeNil())
+				Expect(warnings).To(BeEmpty())
+				Expect(attempts).To(Equal(3))
+				Expect(string(results["/nodes"])).To(Equal(`{"items":[]}`))
+			}
+		})
+
+		It("Skips the resource with a warning once the retries are used up", func() {
+			attempts := 0
+			results, warnings, err := fetch(context.TODO(),
+				failingTimes(&attempts, 10, errors.NewTooManyRequests("too many requests", 0)), clients, objects)
+			Expect(err).To(BeNil())
+			Expect(attempts).To(Equal(4))
+			Expect(results).ToNot(HaveKey("/nodes"))
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(HavePrefix("could not fetch /api/v1/nodes after 3 retries: "))
+		})
+
+		It("Doesn't retry the other errors", func() {
+			attempts := 0
+			forbidden := errors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", fmt.Errorf("denied"))
+			_, warnings, err := fetch(context.TODO(), failingTimes(&attempts, 10, forbidden), clients, objects)
+			Expect(err).To(BeNil())
+			Expect(attempts).To(Equal(1))
+			Expect(warnings).To(HaveLen(1))
+
+			attempts = 0
+			_, _, err = fetch(context.TODO(), failingTimes(&attempts, 10, fmt.Errorf("connection refused")),
+				clients, objects)
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("Waits for the Retry-After of the API server, or for a growing random delay", func() {
+			Expect(fetchRetryDelay(errors.NewTooManyRequests("too many requests", 7), time.Second, 0)).To(
+				Equal(7 * time.Second))
+			Expect(fetchRetryDelay(errors.NewTooManyRequests("too many requests", 3600), time.Second, 0)).To(
+				Equal(maxFetchRetryDelay))
+			internal := errors.NewInternalError(fmt.Errorf("etcd leader changed"))
+			for i := 0; i < 20; i++ {
+				delay := fetchRetryDelay(internal, 100*time.Millisecond, 2)
+				Expect(delay).To(BeNumerically(">=", 200*time.Millisecond))
+				Expect(delay).To(BeNumerically("<=", 400*time.Millisecond))
+			}
+			Expect(fetchRetryDelay(internal, time.Second, 100)).To(BeNumerically("<=", maxFetchRetryDelay))
+		})
+
+		It("Stops waiting when the fetch is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			attempts := 0
+			_, err := streamWithRetries(ctx,
+				failingTimes(&attempts, 10, errors.NewInternalError(fmt.Errorf("etcd leader changed")))("/api/v1/nodes"),
+				resourceFetcherClients{fetchRetries: 3, fetchRetryDelay: time.Hour})
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(attempts).To(Equal(1))
+		})
+	})
+
+	Context("Appending the warnings as they're raised", func() {
+		var warningsFile string
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "warnings")
+			Expect(err).To(BeNil())
+			warningsFile = f.Name()
+			// Left over by an earlier run
+			_, err = f.WriteString("stale warning\n")
+			Expect(err).To(BeNil())
+			Expect(f.Close()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove(warningsFile)
+		})
+
+		It("Leaves the warnings raised before the collector stopped", func() {
+			notFound := errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "missing")
+			var writtenBefore string
+			dispatcher := func(uri string) resourceStreamer {
+				if uri == "/api/v1/nodes" {
+					// Stands in for the collector being killed now
+					written, err := ioutil.ReadFile(warningsFile)
+					Expect(err).To(BeNil())
+					writtenBefore = string(written)
+				}
+				return &cannedStreamer{err: notFound}
+			}
+			log := newWarningsLog(warningsFile)
+			_, warnings, err := fetchRecording(context.TODO(), dispatcher, resourceFetcherClients{}, []utils.ResourcePath{
+				{ObjPath: "/api/v1/namespaces/a/configmaps/missing", DumpPath: "/a"},
+				{ObjPath: "/api/v1/namespaces/b/configmaps/missing", DumpPath: "/b"},
+				{ObjPath: "/api/v1/nodes", DumpPath: "/nodes"},
+			}, fetchRecorder{warnings: log})
+			log.close()
+			Expect(err).To(BeNil())
+			Expect(warnings).To(HaveLen(3))
+			Expect(warnings[2].category).To(Equal(warningCategoryFetch))
+			Expect(writtenBefore).To(Equal(warnings[0].message + "\n" + warnings[1].message + "\n"))
+		})
+
+		It("Doesn't leave a file without warnings", func() {
+			log := newWarningsLog(warningsFile)
+			_, warnings, err := fetchRecording(context.TODO(), cannedDispatcher(map[string]*cannedStreamer{
+				"/api/v1/nodes": {body: `{"items":[]}`},
+			}), resourceFetcherClients{}, []utils.ResourcePath{{ObjPath: "/api/v1/nodes", DumpPath: "/nodes"}},
+				fetchRecorder{warnings: log})
+			log.close()
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+			_, err = os.Stat(warningsFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Replaces the appended warnings with the deduplicated ones", func() {
+			log := newWarningsLog(warningsFile)
+			log.append("forbidden")
+			log.append("forbidden")
+			log.close()
+			appended, err := ioutil.ReadFile(warningsFile)
+			Expect(err).To(BeNil())
+			Expect(string(appended)).To(Equal("forbidden\nforbidden\n"))
+
+			fetcher := &scapContentDataStream{}
+			Expect(fetcher.SaveWarningsIfAny(newFetchWarnings(warningCategoryFetch, "forbidden", "forbidden"),
+				warningsFile)).To(Succeed())
+			saved, err := ioutil.ReadFile(warningsFile)
+			Expect(err).To(BeNil())
+			Expect(string(saved)).To(Equal("forbidden (seen 2 times)"))
+		})
+	})
+
+	Context("handle cancellation", func() {
+		It("stops fetching once the context is cancelled", func() {
+			fakeDispatcher := func(uri string) resourceStreamer {
+				return &notFoundFetcher{}
+			}
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+
+			files, _, err := fetch(ctx,
+				fakeDispatcher,
+				resourceFetcherClients{},
+				[]utils.ResourcePath{{DumpPath: "key"}})
+
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(files).To(BeEmpty())
+		})
+
+		It("cancels the context when the scan gets the cancel annotation", func() {
+			origInterval := cancellationPollInterval
+			cancellationPollInterval = 10 * time.Millisecond
+			defer func() { cancellationPollInterval = origInterval }()
+
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-scan",
+					Namespace: common.GetComplianceOperatorNamespace(),
+					Annotations: map[string]string{
+						compv1alpha1.ComplianceScanCancelAnnotation: "",
+					},
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			go watchForCancellation(ctx, cancel, client, types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace})
+
+			Eventually(ctx.Done(), time.Second).Should(BeClosed())
+		})
+	})
+
+	Context("Fetching with impersonation", func() {
+		It("Only impersonates when a user is configured", func() {
+			cfg := &rest.Config{Host: "https://example.com"}
+			Expect(getFetchConfig(cfg, &fetcherConfig{})).To(BeIdenticalTo(cfg))
+
+			fetchConfig := getFetchConfig(cfg, &fetcherConfig{
+				ImpersonateUser:   "system:serviceaccount:test:auditor",
+				ImpersonateGroups: []string{"auditors"},
+			})
+			Expect(fetchConfig.Impersonate.UserName).To(Equal("system:serviceaccount:test:auditor"))
+			Expect(fetchConfig.Impersonate.Groups).To(Equal([]string{"auditors"}))
+			Expect(cfg.Impersonate.UserName).To(BeEmpty())
+		})
+
+		It("Labels the results as fetched under impersonation", func() {
+			fetcher := &scapContentDataStream{impersonateUser: "system:serviceaccount:test:auditor"}
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).To(BeNil())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0].category).To(Equal(warningCategoryImpersonation))
+			Expect(warnings[0].message).To(ContainSubstring("impersonating system:serviceaccount:test:auditor"))
+		})
+	})
+
+	Context("Setting the User-Agent", func() {
+		It("Identifies the scan if configured", func() {
+			Expect(fetchUserAgent(&fetcherConfig{})).To(Equal("compliance-operator/" + version.Version))
+			Expect(fetchUserAgent(&fetcherConfig{UserAgentScan: "scan/ocp4-cis"})).To(
+				Equal("compliance-operator/" + version.Version + " scan/ocp4-cis"))
+		})
+	})
+
+	Context("Overriding the values of the content", func() {
+		It("Substitutes the overrides in the resource paths", func() {
+			overrides, err := parseValueOverrides([]string{
+				"xccdf_org.ssgproject.content_value_openshift_kube_apiserver_config_name=other-config",
+				"undefined_value=1",
+			})
+			Expect(err).To(BeNil())
+			Expect(overrides).To(HaveKeyWithValue("openshift_kube_apiserver_config_name", "other-config"))
+
+			fetcher := &scapContentDataStream{skipKubeletConfig: true, valueOverrides: overrides}
+			Expect(fetcher.LoadSource("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")).To(Succeed())
+			Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+			Expect(fetcher.resources).To(ContainElement(utils.ResourcePath{
+				ObjPath:  "/api/v1/namespaces/master-mycluster1/configmaps/other-config",
+				DumpPath: "/api/v1/namespaces/master-mycluster1/configmaps/other-config",
+				Filter:   ".apiServerArguments",
+			}))
+			Expect(fetcher.EffectiveValues()).To(HaveKeyWithValue("openshift_kube_apiserver_config_name", "other-config"))
+
+			By("only listing the values the content defines in the warning")
+			warning := valueOverridesWarning(fetcher.overriddenValues)
+			Expect(warning).To(HaveSuffix(": openshift_kube_apiserver_config_name=other-config"))
+		})
+
+		It("Rejects the overrides without a value", func() {
+			_, err := parseValueOverrides([]string{"openshift_kube_apiserver_config_name"})
+			Expect(err).ToNot(BeNil())
+			_, err = parseValueOverrides([]string{"=value"})
+			Expect(err).ToNot(BeNil())
+			overrides, err := parseValueOverrides(nil)
+			Expect(err).To(BeNil())
+			Expect(overrides).To(BeNil())
+		})
+	})
+
+	Context("Prefixing the output files", func() {
+		It("Only renames the files that are set", func() {
+			Expect(prefixedOutputPath("/tmp/shared/warnings", "ocp4-cis")).To(Equal("/tmp/shared/ocp4-cis-warnings"))
+			Expect(prefixedOutputPath("summary.json", "ocp4-cis")).To(Equal("ocp4-cis-summary.json"))
+			Expect(prefixedOutputPath("/tmp/shared/warnings", "")).To(Equal("/tmp/shared/warnings"))
+			Expect(prefixedOutputPath("", "ocp4-cis")).To(BeEmpty())
+		})
+	})
+
+	Context("Recording the effective values", func() {
+		It("Prefers the values set by the tailoring", func() {
+			tpDataStreamFile, err := os.Open("../../tests/data/tailored-profile.xml")
+			Expect(err).To(BeNil())
+			defer tpDataStreamFile.Close()
+			tpContentDS, err := parseContent(tpDataStreamFile)
+			Expect(err).To(BeNil())
+
+			values := getEffectiveValues([]profileLink{
+				{id: "xccdf_compliance.openshift.io_profile_hypershift-profile", defs: tpContentDS},
+			})
+			Expect(values).To(Equal(map[string]string{
+				"openshift_kube_apiserver_config_namespace": "customized",
+				"jqfilter": `.data["config.yaml"] | fromjson | .apiServerArguments`,
+			}))
+		})
+
+		It("Records the content digests in the scan status", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-scan",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+
+			fetcher := &scapContentDataStream{}
+			Expect(fetcher.LoadSource("../../tests/data/ssg-ocp4-ds-new.xml")).To(Succeed())
+			contentDigest, tailoringDigest := fetcher.ContentDigests()
+			Expect(contentDigest).To(HavePrefix("sha256:"))
+			Expect(tailoringDigest).To(BeEmpty())
+
+			err := recordCollection(context.TODO(), client, key, fetcher, time.Second)
+			Expect(err).To(BeNil())
+
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), key, updated)).To(Succeed())
+			Expect(updated.Status.ContentDigest).To(Equal(contentDigest))
+		})
+
+		It("Annotates the scan with the values", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-scan",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+			}
+			client := fake.NewFakeClientWithScheme(getScheme(), scan)
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+
+			fetcher := &scapContentDataStream{effectiveValues: map[string]string{
+				"var_file_permissions": "0600",
+			}}
+			err := recordCollection(context.TODO(), client, key, fetcher, time.Second)
+			Expect(err).To(BeNil())
+
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), key, updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue(
+				compv1alpha1.ComplianceScanEffectiveValuesAnnotation, `{"var_file_permissions":"0600"}`))
+		})
+
+		It("Records the collection with a single patch of the scan annotations", func() {
+			scan := &compv1alpha1.ComplianceScan{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-scan",
+					Namespace:   common.GetComplianceOperatorNamespace(),
+					Annotations: map[string]string{"keep": "me"},
+				},
+			}
+			client := &patchCountingClient{Client: fake.NewFakeClientWithScheme(getScheme(), scan)}
+			key := types.NamespacedName{Name: scan.Name, Namespace: scan.Namespace}
+
+			fetcher := &scapContentDataStream{
+				undefinedRules: []string{"rule-a"},
+				filterErrors:   map[string]map[string]int{"parse": {"/api/v1/nodes": 1}},
+			}
+			Expect(recordCollection(context.TODO(), client, key, fetcher, time.Second)).To(Succeed())
+			Expect(client.patches).To(Equal(1))
+
+			updated := &compv1alpha1.ComplianceScan{}
+			Expect(client.Get(context.TODO(), key, updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue("keep", "me"))
+			Expect(updated.Annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceScanUndefinedRulesAnnotation, "1"))
+			Expect(updated.Annotations).To(HaveKeyWithValue(
+				compv1alpha1.ComplianceScanFilterErrorsAnnotation, `{"parse":{"/api/v1/nodes":1}}`))
+			Expect(updated.Annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceScanFetchDurationAnnotation, "1s"))
+		})
+	})
+
 	Context("handle Machine Config fetching", func() {
 		var filter string
 		var files map[string][]byte
@@ -376,31 +2041,180 @@ var _ = Describe("Testing fetching", func() {
 				},
 			}
 
-			files, warnings, err = fetch(context.TODO(), getStreamerFn, fakeClients, fetchMcResources)
+			files, warnings, err = fetch(context.TODO(), getStreamerFn, fakeClients, fetchMcResources)
+		})
+		When("MC filters FIPS", func() {
+			BeforeEach(func() {
+				filter = mcFipsFilter
+			})
+
+			It("Keeps the FIPS attributes intact", func() {
+				Expect(err).To(BeNil())
+				Expect(files).To(HaveLen(1))
+				Expect(string(files["mcDumpPath"])).To(Equal("[false,true]"))
+				Expect(warnings).To(HaveLen(0))
+			})
+		})
+		When("MC filters Clevis", func() {
+			BeforeEach(func() {
+				filter = mcClevisFilter
+			})
+
+			It("Keeps the Clevis attributes intact", func() {
+				Expect(err).To(BeNil())
+				Expect(files).To(HaveLen(1))
+				Expect(string(files["mcDumpPath"])).To(Equal("[true,true]"))
+				Expect(warnings).To(HaveLen(0))
+			})
+		})
+	})
+
+	Context("Keeping some Ignition sections of the MachineConfigs", func() {
+		const ign = `{"ignition":{"version":"3.2.0"},
+			"passwd":{"users":[{"name":"core","sshAuthorizedKeys":["ssh-ed25519 AAAA"]}]},
+			"storage":{"files":[{"path":"/etc/foo","contents":{"source":"data:,foo"}}],
+			           "luks":[{"name":"root","device":"/dev/sda"}]},
+			"systemd":{"units":[{"name":"kubelet.service","enabled":true}]}}`
+		mcs := &mcfgv1.MachineConfigList{Items: []mcfgv1.MachineConfig{{
+			ObjectMeta: metav1.ObjectMeta{Name: "99-worker"},
+			Spec: mcfgv1.MachineConfigSpec{
+				Config:          runtime.RawExtension{Raw: []byte(ign)},
+				KernelArguments: []string{"audit=1"},
+			},
+		}}}
+		config := func(sections ...string) igntypes.Config {
+			filtered, err := filterMcList(mcs, sections)
+			Expect(err).To(BeNil())
+			Expect(filtered.Items).To(HaveLen(1))
+			Expect(filtered.Items[0].Spec.KernelArguments).To(Equal([]string{"audit=1"}))
+			parsed := igntypes.Config{}
+			Expect(json.Unmarshal(filtered.Items[0].Spec.Config.Raw, &parsed)).To(Succeed())
+			Expect(parsed.Ignition.Version).To(Equal("3.2.0"))
+			return parsed
+		}
+
+		It("Only removes the files by default", func() {
+			parsed := config()
+			Expect(parsed.Storage.Files).To(BeEmpty())
+			Expect(parsed.Storage.Luks).To(HaveLen(1))
+			Expect(parsed.Passwd.Users).To(HaveLen(1))
+			Expect(parsed.Systemd.Units).To(HaveLen(1))
+		})
+
+		It("Removes the sections that aren't kept", func() {
+			parsed := config("systemd")
+			Expect(parsed.Systemd.Units).To(HaveLen(1))
+			Expect(parsed.Passwd.Users).To(BeEmpty())
+			Expect(parsed.Storage.Luks).To(BeEmpty())
+
+			parsed = config("storage", "passwd")
+			Expect(parsed.Systemd.Units).To(BeEmpty())
+			Expect(parsed.Passwd.Users).To(HaveLen(1))
+			Expect(parsed.Storage.Luks).To(HaveLen(1))
+			Expect(parsed.Storage.Files).To(BeEmpty())
+		})
+
+		It("Rejects the sections that can't be kept", func() {
+			Expect(validateMCConfigSections([]string{"systemd", "passwd", "storage"})).To(Succeed())
+			Expect(validateMCConfigSections([]string{"ignition"})).ToNot(Succeed())
+			Expect(validateMCConfigSections([]string{"kernelArguments"})).ToNot(Succeed())
+		})
+	})
+
+	Context("Fetching the MachineConfigs of some pools", func() {
+		const roleLabel = "machineconfiguration.openshift.io/role"
+		mcsResource := []utils.ResourcePath{{
+			ObjPath:  "/apis/machineconfiguration.openshift.io/v1/machineconfigs",
+			Filter:   `[.items[].metadata.name]`,
+			DumpPath: "/mcs",
+		}}
+		var fakeClients resourceFetcherClients
+
+		BeforeEach(func() {
+			mc := func(name, role string) runtime.Object {
+				return &mcfgv1.MachineConfig{ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{roleLabel: role},
+				}}
+			}
+			pool := func(name string, selector *metav1.LabelSelector) runtime.Object {
+				return &mcfgv1.MachineConfigPool{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec:       mcfgv1.MachineConfigPoolSpec{MachineConfigSelector: selector},
+				}
+			}
+			workerSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key: roleLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{"worker", "infra"},
+			}}}
+			fakeClients = resourceFetcherClients{client: fake.NewFakeClientWithScheme(getScheme(),
+				mc("00-master", "master"), mc("00-worker", "worker"), mc("50-infra", "infra"), mc("99-gpu", "gpu"),
+				pool("master", &metav1.LabelSelector{MatchLabels: map[string]string{roleLabel: "master"}}),
+				pool("infra", workerSelector),
+				pool("gpu", &metav1.LabelSelector{MatchLabels: map[string]string{roleLabel: "gpu"}}),
+				pool("empty", nil),
+			)}
+		})
+
+		fetchOfPools := func(pools ...string) (string, []string, error) {
+			fakeClients.machineConfigPools = pools
+			files, warnings, err := fetch(context.TODO(), getStreamerFn, fakeClients, mcsResource)
+			return string(files["/mcs"]), warnings, err
+		}
+
+		It("Fetches all the MachineConfigs by default", func() {
+			mcs, warnings, err := fetchOfPools()
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+			Expect(mcs).To(Equal(`["00-master","00-worker","50-infra","99-gpu"]`))
+		})
+
+		It("Only fetches those selected by the pools", func() {
+			mcs, _, err := fetchOfPools("infra")
+			Expect(err).To(BeNil())
+			Expect(mcs).To(Equal(`["00-worker","50-infra"]`))
+
+			mcs, _, err = fetchOfPools("master", "gpu", "infra")
+			Expect(err).To(BeNil())
+			Expect(mcs).To(Equal(`["00-master","00-worker","50-infra","99-gpu"]`))
+
+			mcs, _, err = fetchOfPools("master", "gpu")
+			Expect(err).To(BeNil())
+			Expect(mcs).To(Equal(`["00-master","99-gpu"]`))
 		})
-		When("MC filters FIPS", func() {
-			BeforeEach(func() {
-				filter = mcFipsFilter
-			})
 
-			It("Keeps the FIPS attributes intact", func() {
-				Expect(err).To(BeNil())
-				Expect(files).To(HaveLen(1))
-				Expect(string(files["mcDumpPath"])).To(Equal("[false,true]"))
-				Expect(warnings).To(HaveLen(0))
-			})
+		It("Fetches none for a pool without a selector", func() {
+			mcs, _, err := fetchOfPools("empty")
+			Expect(err).To(BeNil())
+			Expect(mcs).To(Equal(`[]`))
 		})
-		When("MC filters Clevis", func() {
-			BeforeEach(func() {
-				filter = mcClevisFilter
-			})
 
-			It("Keeps the Clevis attributes intact", func() {
+		It("Saves the same MachineConfigs when writing them to disk", func() {
+			spooled := func() int {
+				files, err := filepath.Glob(filepath.Join(os.TempDir(), "machineconfigs-*.json"))
 				Expect(err).To(BeNil())
-				Expect(files).To(HaveLen(1))
-				Expect(string(files["mcDumpPath"])).To(Equal("[true,true]"))
-				Expect(warnings).To(HaveLen(0))
-			})
+				return len(files)
+			}
+			before := spooled()
+			raw := []utils.ResourcePath{{ObjPath: mcsResource[0].ObjPath, DumpPath: "/mcs"}}
+			for _, pools := range [][]string{nil, {"infra"}, {"empty"}} {
+				fakeClients.machineConfigPools = pools
+				fakeClients.mcsToDisk = false
+				inMemory, _, err := fetch(context.TODO(), getStreamerFn, fakeClients, raw)
+				Expect(err).To(BeNil())
+				fakeClients.mcsToDisk = true
+				onDisk, warnings, err := fetch(context.TODO(), getStreamerFn, fakeClients, raw)
+				Expect(err).To(BeNil())
+				Expect(warnings).To(BeEmpty())
+				Expect(string(onDisk["/mcs"])).To(MatchJSON(inMemory["/mcs"]), strings.Join(pools, ","))
+			}
+			Expect(spooled()).To(Equal(before))
+		})
+
+		It("Warns about a pool that doesn't exist", func() {
+			_, warnings, err := fetchOfPools("missing")
+			Expect(err).To(BeNil())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(ContainSubstring("failed to get MachineConfigPool missing"))
 		})
 	})
 
@@ -656,6 +2470,10 @@ var _ = Describe("Testing fetching", func() {
 
 			expectedInconsistentResult["/kubeletconfig/role/master"] = kubeletConfigIntersection
 			expectedInconsistentResult["/kubeletconfig/role/worker"] = kubeletConfig
+			inconsistentDiff, err := jsondiff.CompareJSON(kubeletConfig, kubeletConfigInconsistent)
+			Expect(err).To(BeNil())
+			expectedInconsistentResult["/kubeletconfig/diffs/master/test-node-master-1"], err = json.Marshal(inconsistentDiff)
+			Expect(err).To(BeNil())
 
 			expectedNodeList = map[string][]string{
 				"master": {"test-node-master-0", "test-node-master-1"},
@@ -665,16 +2483,111 @@ var _ = Describe("Testing fetching", func() {
 		})
 		When("Fetching NodeList", func() {
 			It("Get Expected Node List", func() {
-				roleNodesList, err = fetchNodesWithRole(context.Background(), fakeClients.client)
+				roleNodesList, err = fetchNodesWithRole(context.Background(), fakeClients.client, "", false, nil)
 				Expect(err).To(BeNil())
 				Expect(roleNodesList["master"]).To(ConsistOf(expectedNodeList["master"]))
 				Expect(roleNodesList["worker"]).To(ConsistOf(expectedNodeList["worker"]))
 			})
 
 			It("Get expcted KubeletConfig resource path", func() {
-				figuredResources = getKubeletConfigResourcePath(roleNodesList)
+				figuredResources = getKubeletConfigResourcePath(roleNodesList, defaultKubeletConfigAPIVersion)
 				Expect(compareResourcePaths(figuredResources, expectedFiguredResources)).To(Equal(true))
 			})
+
+			It("Only lists the nodes matching the node selector", func() {
+				masterNodes, err := fetchNodesWithRole(context.Background(), fakeClients.client, "node-role.kubernetes.io/master", false, nil)
+				Expect(err).To(BeNil())
+				Expect(masterNodes["master"]).To(ConsistOf(expectedNodeList["master"]))
+				Expect(masterNodes).ToNot(HaveKey("worker"))
+			})
+
+			It("Skips the nodes that aren't ready or are unschedulable", func() {
+				worker := func(name string, unschedulable bool, ready corev1.ConditionStatus) corev1.Node {
+					node := corev1.Node{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:   name,
+							Labels: map[string]string{"node-role.kubernetes.io/worker": ""},
+						},
+						Spec: corev1.NodeSpec{Unschedulable: unschedulable},
+					}
+					if ready != "" {
+						node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}
+					}
+					return node
+				}
+				nodes := &corev1.NodeList{Items: []corev1.Node{
+					worker("ready", false, corev1.ConditionTrue),
+					worker("not-ready", false, corev1.ConditionFalse),
+					worker("unknown", false, corev1.ConditionUnknown),
+					worker("cordoned", true, corev1.ConditionTrue),
+					worker("unreported", false, ""),
+				}}
+				client := fake.NewFakeClientWithScheme(scheme.Scheme, nodes)
+
+				serving, err := fetchNodesWithRole(context.Background(), client, "", false, nil)
+				Expect(err).To(BeNil())
+				Expect(serving["worker"]).To(ConsistOf("ready", "unreported"))
+
+				all, err := fetchNodesWithRole(context.Background(), client, "", true, nil)
+				Expect(err).To(BeNil())
+				Expect(all["worker"]).To(ConsistOf("ready", "not-ready", "unknown", "cordoned", "unreported"))
+			})
+
+			It("Finds the same roles when the nodes are listed in pages", func() {
+				for _, keepUnready := range []bool{false, true} {
+					whole, err := fetchNodesWithRole(context.Background(), fakeClients.client, "", keepUnready, nil)
+					Expect(err).To(BeNil())
+					pager := &nodePagingClient{Client: fakeClients.client, pageSize: 2}
+					paged, err := fetchNodesWithRole(context.Background(), pager, "", keepUnready, nil)
+					Expect(err).To(BeNil())
+					Expect(pager.pages).To(BeNumerically(">", 1))
+					Expect(paged).To(Equal(whole))
+				}
+			})
+
+			It("Aggregates the nodes under the mapped roles", func() {
+				roles, err := parseNodeRoles([]string{
+					"control-plane=node-role.kubernetes.io/master",
+					"all=kubernetes.io/os!=windows",
+				})
+				Expect(err).To(BeNil())
+				mapped, err := fetchNodesWithRole(context.Background(), fakeClients.client, "", false, roles)
+				Expect(err).To(BeNil())
+				Expect(mapped).To(HaveLen(2))
+				Expect(mapped["control-plane"]).To(ConsistOf(expectedNodeList["master"]))
+				Expect(mapped["all"]).To(ConsistOf(append(expectedNodeList["master"], expectedNodeList["worker"]...)))
+
+				paths := getKubeletConfigResourcePath(map[string][]string{"control-plane": {"test-node-master-0"}}, "")
+				Expect(paths).To(HaveLen(1))
+				Expect(paths[0].DumpPath).To(Equal("/kubeletconfig/control-plane/test-node-master-0"))
+			})
+
+			It("Rejects invalid node roles", func() {
+				for _, invalid := range [][]string{
+					{"infra"},
+					{"infra="},
+					{"../role=node-role.kubernetes.io/infra"},
+					{"infra=!!invalid"},
+					{"infra=a", "infra=b"},
+				} {
+					_, err := parseNodeRoles(invalid)
+					Expect(err).ToNot(BeNil(), strings.Join(invalid, " "))
+				}
+			})
+
+			It("Rejects an invalid node selector", func() {
+				_, err := fetchNodesWithRole(context.Background(), fakeClients.client, "!!invalid", false, nil)
+				Expect(err).ToNot(BeNil())
+			})
+
+			It("Restricts the KubeletConfigs to the node subset", func() {
+				subset, err := fetchNodesWithRole(context.Background(), fakeClients.client,
+					joinSelectors("", "node-role.kubernetes.io/worker"), false, nil)
+				Expect(err).To(BeNil())
+				subset = filterRoleNodes(subset, []string{"test-node-worker-0", "test-node-worker-2", "test-node-master-0"})
+				Expect(subset).To(HaveLen(1))
+				Expect(subset["worker"]).To(ConsistOf("test-node-worker-0", "test-node-worker-2"))
+			})
 		})
 		When("Test for consistency after fetching api resource", func() {
 			It("Resource is consistent", func() {
@@ -729,3 +2642,833 @@ func compareFetchedResults(a, b map[string][]byte) bool {
 	}
 	return true
 }
+
+var _ = Describe("Testing consistent snapshots", func() {
+	It("Recognizes the URIs of lists", func() {
+		Expect(isListURI("/api/v1/nodes")).To(BeTrue())
+		Expect(isListURI("/api/v1/nodes?labelSelector=node-role.kubernetes.io%2Fworker")).To(BeTrue())
+		Expect(isListURI("/api/v1/namespaces")).To(BeTrue())
+		Expect(isListURI("/api/v1/namespaces/openshift-etcd/pods")).To(BeTrue())
+		Expect(isListURI("/apis/config.openshift.io/v1/clusteroperators")).To(BeTrue())
+		Expect(isListURI("/apis/apps/v1/namespaces/openshift-etcd/deployments")).To(BeTrue())
+
+		Expect(isListURI("/api/v1/namespaces/openshift-etcd")).To(BeFalse())
+		Expect(isListURI("/api/v1/nodes/worker-0/proxy/configz")).To(BeFalse())
+		Expect(isListURI("/apis/config.openshift.io/v1/clusteroperators/etcd/status")).To(BeFalse())
+		Expect(isListURI("/apis/apps/v1/namespaces/openshift-etcd/deployments/etcd")).To(BeFalse())
+		Expect(isListURI("/version")).To(BeFalse())
+	})
+
+	Context("Fetching the resources", func() {
+		var (
+			server    *httptest.Server
+			requested map[string]url.Values
+			clients   resourceFetcherClients
+		)
+
+		BeforeEach(func() {
+			requested = map[string]url.Values{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested[r.URL.Path] = r.URL.Query()
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/api/v1/nodes":
+					fmt.Fprint(w, `{"kind":"NodeList","apiVersion":"v1","metadata":{"resourceVersion":"42"},"items":[]}`)
+				case "/api/v1/namespaces/openshift-etcd/configmaps/etcd":
+					fmt.Fprint(w, `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"etcd"}}`)
+				case "/api/v1/namespaces/openshift-etcd/pods":
+					fmt.Fprint(w, `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"43"},"items":[]}`)
+				case "/api/v1/namespaces/openshift-etcd/secrets":
+					if r.URL.Query().Get("resourceVersion") != "" {
+						w.WriteHeader(http.StatusGone)
+						fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Expired","code":410,"message":"too old resource version"}`)
+						return
+					}
+					fmt.Fprint(w, `{"kind":"SecretList","apiVersion":"v1","metadata":{"resourceVersion":"44"},"items":[]}`)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			Expect(err).To(BeNil())
+			clients = resourceFetcherClients{clientset: clientset}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Fetches the lists at the resourceVersion of the first one", func() {
+			snapshot := &resourceSnapshot{}
+			files, warnings, err := fetch(context.TODO(), snapshot.getStreamerFn, clients, []utils.ResourcePath{
+				{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/etcd", DumpPath: "/configmap"},
+				{ObjPath: "/api/v1/nodes", DumpPath: "/nodes"},
+				{ObjPath: "/api/v1/namespaces/openshift-etcd/pods", DumpPath: "/pods"},
+			})
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+			Expect(files).To(HaveLen(3))
+			Expect(snapshot.resourceVersion).To(Equal("42"))
+
+			Expect(requested["/api/v1/namespaces/openshift-etcd/configmaps/etcd"]).To(BeEmpty())
+			Expect(requested["/api/v1/nodes"]).To(BeEmpty())
+			Expect(requested["/api/v1/namespaces/openshift-etcd/pods"].Get("resourceVersion")).To(Equal("42"))
+			Expect(requested["/api/v1/namespaces/openshift-etcd/pods"].Get("resourceVersionMatch")).To(Equal("Exact"))
+		})
+
+		It("Falls back to the latest version with a warning", func() {
+			snapshot := &resourceSnapshot{}
+			files, _, err := fetch(context.TODO(), snapshot.getStreamerFn, clients, []utils.ResourcePath{
+				{ObjPath: "/api/v1/nodes", DumpPath: "/nodes"},
+				{ObjPath: "/api/v1/namespaces/openshift-etcd/secrets", DumpPath: "/secrets"},
+			})
+			Expect(err).To(BeNil())
+			Expect(string(files["/secrets"])).To(ContainSubstring(`"resourceVersion":"44"`))
+			Expect(snapshot.warnings).To(HaveLen(1))
+			Expect(snapshot.warnings[0]).To(ContainSubstring("could not fetch /api/v1/namespaces/openshift-etcd/secrets at resourceVersion 42"))
+		})
+	})
+})
+
+var _ = Describe("Testing ConfigMaps referenced by name", func() {
+	const configMap = `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"ca","namespace":"openshift-config"},` +
+		`"data":{"ca.crt":"-----BEGIN CERTIFICATE-----"},"binaryData":{"ca.der":"MIIB"}}`
+
+	It("Keeps the data and the binary data", func() {
+		out, err := filter(context.TODO(), []byte(configMap), utils.ConfigMapDataFilter, nil, nil, false)
+		Expect(err).To(BeNil())
+		Expect(string(out)).To(MatchJSON(`{"data":{"ca.crt":"-----BEGIN CERTIFICATE-----"},"binaryData":{"ca.der":"MIIB"}}`))
+	})
+
+	It("Copes with ConfigMaps without data", func() {
+		out, err := filter(context.TODO(), []byte(`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"empty"}}`), utils.ConfigMapDataFilter, nil, nil, false)
+		Expect(err).To(BeNil())
+		Expect(string(out)).To(MatchJSON(`{"data":{},"binaryData":{}}`))
+	})
+
+	It("Redacts the binary data if asked to", func() {
+		paths := redactConfigMapBinaryData([]utils.ResourcePath{
+			{ObjPath: "/api/v1/namespaces/openshift-config/configmaps/ca", Filter: utils.ConfigMapDataFilter},
+			{ObjPath: "/api/v1/nodes", Filter: ".items"},
+		})
+		Expect(paths[0].Filter).To(Equal(utils.ConfigMapRedactedDataFilter))
+		Expect(paths[1].Filter).To(Equal(".items"))
+
+		out, err := filter(context.TODO(), []byte(configMap), paths[0].Filter, nil, nil, false)
+		Expect(err).To(BeNil())
+		Expect(string(out)).To(MatchJSON(`{"data":{"ca.crt":"-----BEGIN CERTIFICATE-----"},"binaryData":{"ca.der":"<redacted>"}}`))
+	})
+})
+
+var _ = Describe("Testing the collection summary", func() {
+	It("Counts the resources, bytes and warnings by category", func() {
+		c := &scapContentDataStream{
+			resources: []utils.ResourcePath{
+				{ObjPath: "/version", DumpPath: "/version"},
+				{ObjPath: "/api/v1/nodes", DumpPath: "/api/v1/nodes"},
+				{ObjPath: "/apis/config.openshift.io/v1/oauths/cluster", DumpPath: "/apis/config.openshift.io/v1/oauths/cluster"},
+			},
+			found: map[string][]byte{
+				"/version":      []byte("0123456789"),
+				"/api/v1/nodes": []byte("01234"),
+			},
+		}
+		var warnings []fetchWarning
+		warnings = append(warnings, newFetchWarnings(warningCategoryImpersonation,
+			"The resources were fetched impersonating system:serviceaccount:ns:sa")...)
+		warnings = append(warnings, newFetchWarnings(warningCategoryFetch,
+			"could not fetch /apis/config.openshift.io/v1/oauths/cluster: forbidden",
+			"could not fetch /apis/config.openshift.io/v1/oauths: not found")...)
+		warnings = append(warnings, newFetchWarnings(warningCategorySnapshot,
+			"could not fetch /api/v1/pods at resourceVersion 42, its latest version was fetched instead: gone")...)
+		warnings = append(warnings, newFetchWarnings(warningCategoryFilter,
+			"more than one object returned from the filter")...)
+		warnings = append(warnings, newFetchWarnings(warningCategoryKubeletConfig,
+			"Kubelet configs for worker-1 are not consistent with role worker")...)
+		warnings = append(warnings, newFetchWarnings(warningCategoryVersion,
+			"The content targets OpenShift >=4.14.0, but the cluster runs 4.12.3")...)
+		summary := c.Summary(warnings)
+
+		Expect(summary.Attempted).To(Equal(3))
+		Expect(summary.Saved).To(Equal(2))
+		Expect(summary.BytesWritten).To(Equal(15))
+		Expect(summary.Warnings).To(Equal(map[string]int{
+			"impersonation": 1,
+			"fetch":         2,
+			"snapshot":      1,
+			"filter":        1,
+			"kubeletConfig": 1,
+			"version":       1,
+		}))
+	})
+
+	It("Writes the summary to a file", func() {
+		dir, err := ioutil.TempDir("", "summary")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		summaryFile := dir + "/summary.json"
+
+		logCollectionSummary(collectionSummary{Attempted: 1, Warnings: map[string]int{}}, time.Now(), summaryFile)
+
+		contents, err := ioutil.ReadFile(summaryFile)
+		Expect(err).To(BeNil())
+		parsed := collectionSummary{}
+		Expect(json.Unmarshal(contents, &parsed)).To(Succeed())
+		Expect(parsed.Attempted).To(Equal(1))
+		Expect(parsed.DurationSeconds).To(BeNumerically(">=", 0))
+	})
+})
+
+var _ = Describe("Testing the inputs read from the scan", func() {
+	var client runtimeclient.Client
+
+	BeforeEach(func() {
+		scan := &compv1alpha1.ComplianceScan{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-scan",
+				Namespace: common.GetComplianceOperatorNamespace(),
+			},
+			Spec: compv1alpha1.ComplianceScanSpec{
+				Profile:            "xccdf_org.ssgproject.content_profile_moderate",
+				Content:            "ssg-ocp4-ds.xml",
+				TailoringConfigMap: &compv1alpha1.TailoringConfigMapRef{Name: "tailoring"},
+			},
+		}
+		client = fake.NewFakeClientWithScheme(getScheme(), scan)
+	})
+
+	It("Fills what isn't set from the spec", func() {
+		conf := &fetcherConfig{ScanName: "test-scan"}
+		Expect(setInputsFromScan(context.TODO(), client, conf)).To(Succeed())
+		Expect(conf.Content).To(Equal("/content/ssg-ocp4-ds.xml"))
+		Expect(conf.Profile).To(Equal("xccdf_org.ssgproject.content_profile_moderate"))
+		Expect(conf.Tailoring).To(Equal("/tailoring/tailoring.xml"))
+	})
+
+	It("Keeps what is set", func() {
+		conf := &fetcherConfig{ScanName: "test-scan", Content: "/tmp/ds.xml", Profile: "other"}
+		Expect(setInputsFromScan(context.TODO(), client, conf)).To(Succeed())
+		Expect(conf.Content).To(Equal("/tmp/ds.xml"))
+		Expect(conf.Profile).To(Equal("other"))
+	})
+
+	It("Fails if the scan doesn't exist", func() {
+		conf := &fetcherConfig{ScanName: "missing-scan"}
+		Expect(setInputsFromScan(context.TODO(), client, conf)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Testing empty collections", func() {
+	It("Passes if some resources were fetched", func() {
+		Expect(emptyCollectionError(collectionSummary{Attempted: 2, Saved: 1})).To(BeNil())
+	})
+
+	It("Tells that no checks need resources", func() {
+		err := emptyCollectionError(collectionSummary{UndefinedRules: 3})
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("no resources were fetched: the profile selects no checks that need API resources, " +
+			"and 3 of the rules it selects aren't defined in the content"))
+	})
+
+	It("Sums up the warnings of the failed fetches", func() {
+		err := emptyCollectionError(collectionSummary{
+			Attempted: 4,
+			Warnings:  map[string]int{"fetch": 3, "impersonation": 1},
+		})
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("no resources were fetched: none of the 4 resources the content needs " +
+			"could be fetched (warnings: fetch: 3, impersonation: 1)"))
+	})
+})
+
+var _ = Describe("Testing the KubeletConfig apiVersion", func() {
+	const configz = `{"kubeletconfig":{"authentication":{"anonymous":{"enabled":false}}}}`
+	const configzWithVersion = `{"kubeletconfig":{"apiVersion":"kubelet.config.k8s.io/v1","authentication":{"anonymous":{"enabled":false}}}}`
+
+	filterAPIVersion := func(response, apiVersion string) string {
+		out, err := filter(context.TODO(), []byte(response), kubeletConfigFilter(apiVersion), nil, nil, false)
+		Expect(err).To(BeNil())
+		parsed := map[string]interface{}{}
+		Expect(json.Unmarshal(out, &parsed)).To(Succeed())
+		Expect(parsed).To(HaveKeyWithValue("kind", "KubeletConfiguration"))
+		return parsed["apiVersion"].(string)
+	}
+
+	It("Sets the configured apiVersion", func() {
+		Expect(filterAPIVersion(configz, "")).To(Equal(defaultKubeletConfigAPIVersion))
+		Expect(filterAPIVersion(configzWithVersion, defaultKubeletConfigAPIVersion)).To(Equal(defaultKubeletConfigAPIVersion))
+		Expect(filterAPIVersion(configz, "kubelet.config.k8s.io/v1")).To(Equal("kubelet.config.k8s.io/v1"))
+	})
+
+	It("Keeps the apiVersion of the response in auto mode", func() {
+		Expect(filterAPIVersion(configzWithVersion, kubeletConfigAPIVersionAuto)).To(Equal("kubelet.config.k8s.io/v1"))
+		Expect(filterAPIVersion(configz, kubeletConfigAPIVersionAuto)).To(Equal(defaultKubeletConfigAPIVersion))
+	})
+
+	It("Only accepts group/version apiVersions", func() {
+		Expect(validateKubeletConfigAPIVersion("auto")).To(Succeed())
+		Expect(validateKubeletConfigAPIVersion("kubelet.config.k8s.io/v1")).To(Succeed())
+		Expect(validateKubeletConfigAPIVersion("v1")).ToNot(Succeed())
+		Expect(validateKubeletConfigAPIVersion("a/b/c")).ToNot(Succeed())
+		Expect(validateKubeletConfigAPIVersion(`v1"|.x="`)).ToNot(Succeed())
+		Expect(validateKubeletConfigAPIVersion(`kubelet"|.x="1/v1`)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Testing protobuf fetches", func() {
+	var (
+		server   *httptest.Server
+		accepted map[string]string
+		clients  resourceFetcherClients
+	)
+
+	BeforeEach(func() {
+		accepted = map[string]string{}
+		nodeList := &corev1.NodeList{
+			TypeMeta: metav1.TypeMeta{Kind: "NodeList", APIVersion: "v1"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+			Items: []corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{"node-role.kubernetes.io/worker": ""}}},
+			},
+		}
+		pb := &bytes.Buffer{}
+		Expect(protobuf.NewSerializer(scheme.Scheme, scheme.Scheme).Encode(nodeList, pb)).To(Succeed())
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accepted[r.URL.Path] = r.Header.Get("Accept")
+			protobufAccepted := strings.Contains(r.Header.Get("Accept"), "application/vnd.kubernetes.protobuf")
+			switch r.URL.Path {
+			case "/api/v1/nodes":
+				if protobufAccepted {
+					w.Header().Set("Content-Type", "application/vnd.kubernetes.protobuf")
+					w.Write(pb.Bytes())
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				Expect(json.NewEncoder(w).Encode(nodeList)).To(Succeed())
+			case "/apis/config.openshift.io/v1/clusteroperators":
+				// Custom resources are only served as JSON
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"kind":"ClusterOperatorList","apiVersion":"config.openshift.io/v1","items":[{"metadata":{"name":"etcd"}}]}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		Expect(err).To(BeNil())
+		clients = resourceFetcherClients{clientset: clientset}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Gets the same JSON as when fetching JSON", func() {
+		resources := []utils.ResourcePath{
+			{ObjPath: "/api/v1/nodes", DumpPath: "/nodes", Filter: `[.items[] | .metadata.name]`},
+			{ObjPath: "/api/v1/nodes", DumpPath: "/nodelist"},
+			{ObjPath: "/apis/config.openshift.io/v1/clusteroperators", DumpPath: "/clusteroperators"},
+		}
+		expected, warnings, err := fetch(context.TODO(), getStreamerFn, clients, resources)
+		Expect(err).To(BeNil())
+		Expect(warnings).To(BeEmpty())
+
+		files, warnings, err := fetch(context.TODO(), getProtobufStreamerFn, clients, resources)
+		Expect(err).To(BeNil())
+		Expect(warnings).To(BeEmpty())
+		Expect(accepted["/api/v1/nodes"]).To(Equal(protobufAcceptHeader))
+		Expect(string(files["/nodes"])).To(Equal(`["worker-0"]`))
+		Expect(files["/nodelist"]).To(MatchJSON(expected["/nodelist"]))
+		Expect(files["/clusteroperators"]).To(MatchJSON(expected["/clusteroperators"]))
+
+		list := corev1.NodeList{}
+		Expect(json.Unmarshal(files["/nodelist"], &list)).To(Succeed())
+		Expect(list.Kind).To(Equal("NodeList"))
+		Expect(list.APIVersion).To(Equal("v1"))
+		Expect(list.ResourceVersion).To(Equal("42"))
+	})
+
+	It("Reports missing resources the same way", func() {
+		resources := []utils.ResourcePath{
+			{ObjPath: "/api/v1/namespaces/openshift-etcd/configmaps/missing", DumpPath: "/configmap"},
+		}
+		_, expected, err := fetch(context.TODO(), getStreamerFn, clients, resources)
+		Expect(err).To(BeNil())
+		Expect(expected).To(HaveLen(1))
+
+		_, warnings, err := fetch(context.TODO(), getProtobufStreamerFn, clients, resources)
+		Expect(err).To(BeNil())
+		Expect(warnings).To(Equal(expected))
+	})
+})
+
+var _ = Describe("Testing the dump-path schemes", func() {
+	var (
+		server  *httptest.Server
+		fetcher *scapContentDataStream
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/nodes/worker-0/proxy/configz" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"kubeletconfig":{"maxPods":250}}`)
+		}))
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		Expect(err).To(BeNil())
+		fetcher = &scapContentDataStream{
+			resourceFetcherClients: resourceFetcherClients{clientset: clientset},
+			resources: []utils.ResourcePath{{
+				ObjPath:  "/api/v1/nodes/worker-0/proxy/configz",
+				DumpPath: kubeletConfigPathPrefix + "worker/worker-0",
+				Filter:   kubeletConfigFilter(defaultKubeletConfigAPIVersion),
+			}},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Saves the KubeletConfigs of the roles by default", func() {
+		_, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(fetcher.found).To(HaveKey(kubeletConfigPathPrefix + "worker/worker-0"))
+		Expect(fetcher.found).To(HaveKey(kubeletConfigRolePathPrefix + "worker"))
+	})
+
+	It("Only saves the KubeletConfigs of the nodes with v1", func() {
+		fetcher.dumpPathScheme = dumpPathSchemeV1
+		_, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(fetcher.found).To(HaveKey(kubeletConfigPathPrefix + "worker/worker-0"))
+		Expect(fetcher.found).ToNot(HaveKey(kubeletConfigRolePathPrefix + "worker"))
+	})
+
+	It("Skips the nodes whose KubeletConfig isn't valid", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/v1/nodes/worker-0/proxy/configz":
+				fmt.Fprint(w, `{"kubeletconfig":{"maxPods":250}}`)
+			case "/api/v1/nodes/worker-1/proxy/configz":
+				fmt.Fprint(w, `{"kind":"Status","status":"Failure","message":"the kubelet is restarting"}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		fetcher.resources = append(fetcher.resources, utils.ResourcePath{
+			ObjPath:  "/api/v1/nodes/worker-1/proxy/configz",
+			DumpPath: kubeletConfigPathPrefix + "worker/worker-1",
+			Filter:   kubeletConfigFilter(defaultKubeletConfigAPIVersion),
+		})
+		warnings, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(warningMessages(warnings)).To(ConsistOf(HavePrefix("Skipping the KubeletConfig of node worker-1 of role worker")))
+		Expect(warnings[0].category).To(Equal(warningCategoryKubeletConfig))
+		Expect(fetcher.found).ToNot(HaveKey(kubeletConfigPathPrefix + "worker/worker-1"))
+		Expect(string(fetcher.found[kubeletConfigRolePathPrefix+"worker"])).To(
+			Equal(string(fetcher.found[kubeletConfigPathPrefix+"worker/worker-0"])))
+	})
+
+	It("Saves the KubeletConfig of a role too few of whose nodes returned one as an error", func() {
+		fetcher.resources = append(fetcher.resources, utils.ResourcePath{
+			ObjPath:  "/api/v1/nodes/worker-1/proxy/configz",
+			DumpPath: kubeletConfigPathPrefix + "worker/worker-1",
+			Filter:   kubeletConfigFilter(defaultKubeletConfigAPIVersion),
+		})
+		fetcher.minNodeCoverage = 50
+		_, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(string(fetcher.found[kubeletConfigRolePathPrefix+"worker"])).To(HavePrefix("{"))
+
+		fetcher.minNodeCoverage = 75
+		warnings, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(warningMessages(warnings)).To(ContainElement(HavePrefix("Only 1 of the 2 nodes of role worker returned a KubeletConfig")))
+		Expect(fetcher.found).To(HaveKey(kubeletConfigPathPrefix + "worker/worker-0"))
+		Expect(string(fetcher.found[kubeletConfigRolePathPrefix+"worker"])).To(
+			Equal("# kube-api-error=" + kubeletCoverageErrorReason))
+	})
+
+	It("Keeps the placeholders of the KubeletConfigs that couldn't be fetched", func() {
+		found := map[string][]byte{
+			kubeletConfigPathPrefix + "worker/worker-0": []byte(`{"kind":"KubeletConfiguration","apiVersion":"v1","maxPods":250}`),
+			kubeletConfigPathPrefix + "worker/worker-1": []byte(kubeAPIErrorPrefix + "NotFound"),
+			kubeletConfigPathPrefix + "worker/worker-2": []byte(`{"kind":"Status"}`),
+		}
+		warnings := dropInvalidKubeletConfigs(found, nil)
+		Expect(warnings).To(ConsistOf(HavePrefix("Skipping the KubeletConfig of node worker-2 of role worker")))
+		Expect(found).To(HaveKey(kubeletConfigPathPrefix + "worker/worker-0"))
+		Expect(found).To(HaveKey(kubeletConfigPathPrefix + "worker/worker-1"))
+		Expect(found).ToNot(HaveKey(kubeletConfigPathPrefix + "worker/worker-2"))
+	})
+
+	It("Only accepts percentages as the node coverage", func() {
+		Expect(validateKubeletNodeCoverage(0)).To(Succeed())
+		Expect(validateKubeletNodeCoverage(100)).To(Succeed())
+		Expect(validateKubeletNodeCoverage(-1)).ToNot(Succeed())
+		Expect(validateKubeletNodeCoverage(101)).ToNot(Succeed())
+	})
+
+	It("Validates the KubeletConfigs", func() {
+		Expect(validateKubeletConfig([]byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","maxPods":250}`))).To(Succeed())
+		for _, config := range []string{
+			`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1"}`,
+			`{"kind":"Status","apiVersion":"v1","message":"error"}`,
+			`{"kind":"KubeletConfiguration","maxPods":250}`,
+			`["KubeletConfiguration"]`,
+		} {
+			Expect(validateKubeletConfig([]byte(config))).ToNot(Succeed(), config)
+		}
+	})
+
+	It("Only accepts the known schemes", func() {
+		Expect(validateDumpPathScheme(dumpPathSchemeV1)).To(Succeed())
+		Expect(validateDumpPathScheme(dumpPathSchemeV2)).To(Succeed())
+		Expect(validateDumpPathScheme("v3")).ToNot(Succeed())
+		Expect(validateDumpPathScheme("")).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Checking the versions the content targets", func() {
+	parseBenchmark := func(metadata string) *xmlquery.Node {
+		node, err := xmlquery.Parse(strings.NewReader(`<ds:data-stream-collection
+    xmlns:ds="http://scap.nist.gov/schema/scap/source/1.2"
+    xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2"
+    xmlns:co="http://compliance.openshift.io/content">
+  <xccdf-1.2:Benchmark id="xccdf_org.ssgproject.content_benchmark_OCP-4">
+    <xccdf-1.2:metadata>` + metadata + `</xccdf-1.2:metadata>
+  </xccdf-1.2:Benchmark>
+</ds:data-stream-collection>`))
+		Expect(err).To(BeNil())
+		return node
+	}
+	found := map[string][]byte{
+		versionDumpPath: []byte(`{"major":"1","minor":"25","gitVersion":"v1.25.4+77bec7a"}`),
+		apiserverOperatorDumpPath: []byte(`{"kind":"ClusterOperator","status":{"versions":[` +
+			`{"name":"operator","version":"4.12.3"},{"name":"openshift-apiserver","version":"4.12.3"}]}}`),
+	}
+
+	It("Reads the version ranges of the benchmark", func() {
+		ranges := contentVersionRanges(parseBenchmark(`<dc:publisher xmlns:dc="http://purl.org/dc/elements/1.1/">SSG</dc:publisher>
+      <co:ocp-version>&gt;=4.12.0 &lt;4.15.0</co:ocp-version>
+      <co:k8s-version> &gt;=1.25.0 </co:k8s-version>`))
+		Expect(ranges).To(Equal(map[string]string{
+			contentOCPVersionMetadata: ">=4.12.0 <4.15.0",
+			contentK8SVersionMetadata: ">=1.25.0",
+		}))
+		Expect(contentVersionRanges(parseBenchmark(""))).To(BeEmpty())
+	})
+
+	It("Reads the versions of the cluster", func() {
+		Expect(clusterVersions(found)).To(Equal(map[string]string{
+			contentOCPVersionMetadata: "4.12.3",
+			contentK8SVersionMetadata: "v1.25.4+77bec7a",
+		}))
+		Expect(clusterVersions(map[string][]byte{})).To(BeEmpty())
+	})
+
+	It("Reports the versions out of their range", func() {
+		versions := clusterVersions(found)
+		Expect(contentVersionMismatches(map[string]string{
+			contentOCPVersionMetadata: ">=4.12.0 <4.15.0",
+			contentK8SVersionMetadata: ">=1.25.0",
+		}, versions)).To(BeEmpty())
+
+		mismatches := contentVersionMismatches(map[string]string{
+			contentOCPVersionMetadata: ">=4.14.0",
+			contentK8SVersionMetadata: "not a range",
+		}, versions)
+		Expect(mismatches).To(HaveLen(2))
+		Expect(mismatches[0]).To(ContainSubstring("invalid Kubernetes version range"))
+		Expect(mismatches[1]).To(Equal("The content targets OpenShift >=4.14.0, but the cluster runs 4.12.3"))
+
+		mismatches = contentVersionMismatches(map[string]string{contentOCPVersionMetadata: ">=4.12.0"},
+			map[string]string{contentK8SVersionMetadata: "v1.25.4"})
+		Expect(mismatches).To(HaveLen(1))
+		Expect(mismatches[0]).To(ContainSubstring("couldn't be detected"))
+	})
+
+	Context("Checking the versions while fetching the resources", func() {
+		var (
+			server  *httptest.Server
+			fetcher *scapContentDataStream
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := found[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(body)
+			}))
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			Expect(err).To(BeNil())
+			fetcher = &scapContentDataStream{
+				resourceFetcherClients: resourceFetcherClients{clientset: clientset},
+				dataStream:             parseBenchmark(`<co:ocp-version>&gt;=4.14.0</co:ocp-version>`),
+				skipKubeletConfig:      true,
+				resources: []utils.ResourcePath{
+					{ObjPath: versionDumpPath, DumpPath: versionDumpPath},
+					{ObjPath: apiserverOperatorDumpPath, DumpPath: apiserverOperatorDumpPath},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Doesn't check the versions by default", func() {
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).To(BeNil())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("Warns about the mismatches", func() {
+			fetcher.versionCheck = versionCheckWarn
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).To(BeNil())
+			Expect(warnings).To(Equal(newFetchWarnings(warningCategoryVersion,
+				"The content targets OpenShift >=4.14.0, but the cluster runs 4.12.3")))
+			Expect(fetcher.found).To(HaveKey(versionDumpPath))
+		})
+
+		It("Fails on mismatches", func() {
+			fetcher.versionCheck = versionCheckFail
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("doesn't target this cluster"))
+			Expect(warnings).To(HaveLen(1))
+		})
+
+		It("Only fetches the resources needed on the cluster's versions", func() {
+			found["/apis/config.openshift.io/v1/olds/cluster"] = []byte(`{"kind":"Old"}`)
+			found["/apis/config.openshift.io/v1/news/cluster"] = []byte(`{"kind":"New"}`)
+			defer delete(found, "/apis/config.openshift.io/v1/olds/cluster")
+			defer delete(found, "/apis/config.openshift.io/v1/news/cluster")
+			fetcher.resources = append(fetcher.resources,
+				utils.ResourcePath{ObjPath: "/apis/config.openshift.io/v1/olds/cluster", DumpPath: "/old",
+					OCPVersion: "<4.12.0"},
+				utils.ResourcePath{ObjPath: "/apis/config.openshift.io/v1/news/cluster", DumpPath: "/new",
+					OCPVersion: ">=4.12.0", K8SVersion: ">=1.25.0"},
+			)
+
+			warnings, err := fetcher.FetchResources(context.TODO())
+			Expect(err).To(BeNil())
+			Expect(fetcher.found).To(HaveKey("/new"))
+			Expect(fetcher.found).ToNot(HaveKey("/old"))
+			Expect(warnings).To(Equal(newFetchWarnings(warningCategoryVersionGated,
+				"Not fetching /apis/config.openshift.io/v1/olds/cluster, which is "+
+					"only needed on OpenShift <4.12.0 (the cluster runs 4.12.3), so the checks reading it don't apply "+
+					"to this cluster")))
+		})
+
+		It("Fetches the resources if the version wasn't detected", func() {
+			needed, skipped := filterVersionGated([]utils.ResourcePath{
+				{ObjPath: "/a", DumpPath: "/a", OCPVersion: "<4.12.0"},
+				{ObjPath: "/b", DumpPath: "/b", K8SVersion: "not a range"},
+			}, map[string]string{contentK8SVersionMetadata: "v1.25.4"})
+			Expect(needed).To(HaveLen(2))
+			Expect(skipped).To(BeEmpty())
+		})
+	})
+
+	It("Only accepts the known checks", func() {
+		Expect(validateVersionCheck("")).To(Succeed())
+		Expect(validateVersionCheck(versionCheckWarn)).To(Succeed())
+		Expect(validateVersionCheck(versionCheckFail)).To(Succeed())
+		Expect(validateVersionCheck("error")).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Handling an undetected version", func() {
+	var (
+		server  *httptest.Server
+		fetcher *scapContentDataStream
+	)
+
+	BeforeEach(func() {
+		// Not an OpenShift cluster, so there's no openshift-apiserver
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != versionDumpPath {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"major":"1","minor":"25","gitVersion":"v1.25.4"}`))
+		}))
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		Expect(err).To(BeNil())
+		fetcher = &scapContentDataStream{
+			resourceFetcherClients: resourceFetcherClients{clientset: clientset},
+			skipKubeletConfig:      true,
+			resources: []utils.ResourcePath{
+				{ObjPath: versionDumpPath, DumpPath: versionDumpPath},
+				{ObjPath: apiserverOperatorDumpPath, DumpPath: apiserverOperatorDumpPath},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Warns and continues", func() {
+		fetcher.versionDetection = versionDetectionWarn
+		warnings, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(warningMessages(warnings)).To(ContainElement(ContainSubstring("couldn't detect the OpenShift version")))
+		ocpVersion, k8sVersion := fetcher.DetectedVersions()
+		Expect(ocpVersion).To(BeEmpty())
+		Expect(k8sVersion).To(Equal("v1.25.4"))
+	})
+
+	It("Fails", func() {
+		fetcher.versionDetection = versionDetectionFail
+		_, err := fetcher.FetchResources(context.TODO())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("couldn't detect the OpenShift version"))
+	})
+
+	It("Only detects the Kubernetes version", func() {
+		fetcher.versionDetection = versionDetectionVersionOnly
+		fetcher.resources = fetcher.resources[:1]
+		warnings, err := fetcher.FetchResources(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(warnings).To(BeEmpty())
+		_, k8sVersion := fetcher.DetectedVersions()
+		Expect(k8sVersion).To(Equal("v1.25.4"))
+	})
+
+	It("Doesn't stage the clusteroperator with only /version", func() {
+		Expect(fetcher.LoadSource("../../tests/data/ssg-ocp4-ds-new-warning-variable.xml")).To(Succeed())
+		fetcher.versionDetection = versionDetectionVersionOnly
+		Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+		Expect(fetcher.resources).To(ContainElement(utils.ResourcePath{ObjPath: versionDumpPath, DumpPath: versionDumpPath}))
+		for _, rpath := range fetcher.resources {
+			Expect(rpath.ObjPath).ToNot(Equal(apiserverOperatorDumpPath))
+		}
+
+		fetcher.versionDetection = versionDetectionWarn
+		Expect(fetcher.FigureResources("xccdf_org.ssgproject.content_profile_platform-moderate")).To(Succeed())
+		Expect(fetcher.resources).To(ContainElement(utils.ResourcePath{
+			ObjPath: apiserverOperatorDumpPath, DumpPath: apiserverOperatorDumpPath}))
+	})
+
+	It("Only accepts the known handlings", func() {
+		Expect(validateVersionDetection(versionDetectionWarn)).To(Succeed())
+		Expect(validateVersionDetection(versionDetectionFail)).To(Succeed())
+		Expect(validateVersionDetection(versionDetectionVersionOnly)).To(Succeed())
+		Expect(validateVersionDetection("")).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Testing the batched config fetches", func() {
+	var (
+		requests  map[string]int
+		mutex     sync.Mutex
+		streamers map[string]*cannedStreamer
+	)
+	dispatcher := func(uri string) resourceStreamer {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests[uri]++
+		if streamer, ok := streamers[uri]; ok {
+			return streamer
+		}
+		return &cannedStreamer{err: errors.NewNotFound(schema.GroupResource{}, uri)}
+	}
+	resources := []utils.ResourcePath{
+		{ObjPath: versionDumpPath, DumpPath: versionDumpPath},
+		{ObjPath: apiserverOperatorDumpPath, DumpPath: apiserverOperatorDumpPath},
+		{ObjPath: configAPIPrefix + "clusteroperators/etcd", DumpPath: "/etcd", Filter: `.metadata.name`},
+		{ObjPath: configAPIPrefix + "infrastructures/cluster", DumpPath: "/infrastructure"},
+		{ObjPath: configAPIPrefix + "networks/cluster", DumpPath: "/network"},
+	}
+
+	BeforeEach(func() {
+		requests = map[string]int{}
+		streamers = map[string]*cannedStreamer{
+			versionDumpPath: {body: `{"gitVersion":"v1.25.4"}`},
+			configAPIPrefix + "clusteroperators": {body: `{"kind":"ClusterOperatorList","apiVersion":"config.openshift.io/v1",` +
+				`"items":[{"metadata":{"name":"etcd"}},{"metadata":{"name":"openshift-apiserver"}}]}`},
+			configAPIPrefix + "clusteroperators/etcd":   {body: `{"kind":"ClusterOperator","metadata":{"name":"etcd"}}`},
+			apiserverOperatorDumpPath:                   {body: `{"kind":"ClusterOperator","metadata":{"name":"openshift-apiserver"}}`},
+			configAPIPrefix + "infrastructures/cluster": {body: `{"kind":"Infrastructure","metadata":{"name":"cluster"}}`},
+			configAPIPrefix + "networks/cluster":        {body: `{"kind":"Network","metadata":{"name":"cluster"}}`},
+		}
+	})
+
+	It("Saves the same resources in fewer requests", func() {
+		expected, expectedWarnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{}, resources)
+		Expect(err).To(BeNil())
+
+		requests = map[string]int{}
+		prefetch := &configPrefetch{next: dispatcher}
+		prefetch.fetch(context.TODO(), resourceFetcherClients{}, resources)
+		Expect(requests).To(Equal(map[string]int{
+			configAPIPrefix + "clusteroperators":        1,
+			configAPIPrefix + "infrastructures/cluster": 1,
+			configAPIPrefix + "networks/cluster":        1,
+		}))
+
+		files, warnings, err := fetch(context.TODO(), prefetch.getStreamerFn, resourceFetcherClients{}, resources)
+		Expect(err).To(BeNil())
+		Expect(warnings).To(Equal(expectedWarnings))
+		Expect(requests[configAPIPrefix+"clusteroperators/etcd"]).To(BeZero())
+		Expect(requests[apiserverOperatorDumpPath]).To(BeZero())
+		Expect(requests[versionDumpPath]).To(Equal(1))
+		Expect(files).To(HaveLen(len(expected)))
+		Expect(string(files["/etcd"])).To(Equal(string(expected["/etcd"])))
+		Expect(files[apiserverOperatorDumpPath]).To(MatchJSON(`{"kind":"ClusterOperator","apiVersion":"config.openshift.io/v1",` +
+			`"metadata":{"name":"openshift-apiserver"}}`))
+		Expect(files["/infrastructure"]).To(Equal(expected["/infrastructure"]))
+	})
+
+	It("Leaves what couldn't be prefetched to the fetch", func() {
+		streamers[configAPIPrefix+"clusteroperators"] = &cannedStreamer{
+			err: errors.NewForbidden(schema.GroupResource{Resource: "clusteroperators"}, "", fmt.Errorf("no access"))}
+		delete(streamers, configAPIPrefix+"networks/cluster")
+		expected, expectedWarnings, err := fetch(context.TODO(), dispatcher, resourceFetcherClients{}, resources)
+		Expect(err).To(BeNil())
+
+		prefetch := &configPrefetch{next: dispatcher}
+		prefetch.fetch(context.TODO(), resourceFetcherClients{}, resources)
+		files, warnings, err := fetch(context.TODO(), prefetch.getStreamerFn, resourceFetcherClients{}, resources)
+		Expect(err).To(BeNil())
+		Expect(warnings).To(Equal(expectedWarnings))
+		Expect(files).To(Equal(expected))
+		Expect(string(files["/network"])).To(HavePrefix("# kube-api-error="))
+	})
+
+	It("Prefetches up to the fetch concurrency of kinds at a time", func() {
+		var inFlight, maxInFlight int
+		counting := func(uri string) resourceStreamer {
+			return &countingStreamer{next: dispatcher(uri), mutex: &mutex, inFlight: &inFlight, maxInFlight: &maxInFlight}
+		}
+		for _, concurrency := range []int{1, 2} {
+			inFlight, maxInFlight = 0, 0
+			prefetch := &configPrefetch{next: counting}
+			prefetch.fetch(context.TODO(), resourceFetcherClients{fetchConcurrency: concurrency}, resources)
+			Expect(prefetch.bodies).To(HaveLen(4))
+			Expect(maxInFlight).To(BeNumerically("<=", concurrency))
+		}
+	})
+
+	It("Keeps the kind and apiVersion of the list items", func() {
+		items, err := listItemsByName([]byte(`{"kind":"ClusterOperatorList","apiVersion":"config.openshift.io/v1","items":[` +
+			`{"kind":"ClusterOperator","apiVersion":"config.openshift.io/v1","metadata":{"name":"etcd"}},` +
+			`{"metadata":{}}]}`))
+		Expect(err).To(BeNil())
+		Expect(items).To(HaveLen(1))
+		Expect(string(items["etcd"])).To(Equal(`{"kind":"ClusterOperator","apiVersion":"config.openshift.io/v1","metadata":{"name":"etcd"}}`))
+	})
+})
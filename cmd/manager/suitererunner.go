@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	backoff "github.com/cenkalti/backoff/v4"
@@ -30,14 +32,18 @@ func init() {
 }
 
 type rerunnerconfig struct {
-	Name      string
-	Namespace string
-	client    *complianceCrClient
+	Name         string
+	Namespace    string
+	Nodes        []string
+	NodeSelector string
+	client       *complianceCrClient
 }
 
 func defineRerunnerFlags(cmd *cobra.Command) {
 	cmd.Flags().String("name", "", "The name of the ComplianceSuite to be re-run")
 	cmd.Flags().String("namespace", "", "The namespace of the ComplianceSuite to be re-run")
+	cmd.Flags().StringSlice("nodes", nil, "Only re-run the scans on these nodes. Can be repeated.")
+	cmd.Flags().String("node-selector", "", "Only re-run the scans on the nodes matching this label selector.")
 
 	flags := cmd.Flags()
 
@@ -50,6 +56,12 @@ func getRerunnerConfig(cmd *cobra.Command) *rerunnerconfig {
 	var conf rerunnerconfig
 	conf.Name = getValidStringArg(cmd, "name")
 	conf.Namespace = getValidStringArg(cmd, "namespace")
+	conf.Nodes, _ = cmd.Flags().GetStringSlice("nodes")
+	conf.NodeSelector, _ = cmd.Flags().GetString("node-selector")
+	if _, err := labels.Parse(conf.NodeSelector); err != nil {
+		fmt.Printf("Invalid node selector '%s': %s\n", conf.NodeSelector, err)
+		os.Exit(1)
+	}
 
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -68,6 +80,9 @@ func getRerunnerConfig(cmd *cobra.Command) *rerunnerconfig {
 
 func RerunSuite(cmd *cobra.Command, args []string) {
 	conf := getRerunnerConfig(cmd)
+	// Recorded on every scan so the operator can tell when the rerunner
+	// last ran
+	tick := time.Now().UTC().Format(time.RFC3339)
 
 	scans := &compv1alpha1.ComplianceScanList{}
 	scanSuiteSelector := make(map[string]string)
@@ -103,6 +118,8 @@ func RerunSuite(cmd *cobra.Command, args []string) {
 				scanCopy.Annotations = make(map[string]string)
 			}
 			scanCopy.Annotations[compv1alpha1.ComplianceScanRescanAnnotation] = ""
+			scanCopy.Annotations[compv1alpha1.ComplianceScanRerunnerTickAnnotation] = tick
+			setRescanNodeSubset(scanCopy, conf.Nodes, conf.NodeSelector)
 
 			fmt.Printf("Re-running ComplianceScan '%s'\n", scanCopy.Name)
 			err := conf.client.client.Update(context.TODO(), scanCopy)
@@ -123,3 +140,18 @@ func RerunSuite(cmd *cobra.Command, args []string) {
 		}
 	}
 }
+
+// setRescanNodeSubset restricts the rescan to the given nodes. Without a
+// subset, a previous restriction is removed so the whole scan is re-run.
+func setRescanNodeSubset(scan *compv1alpha1.ComplianceScan, nodes []string, selector string) {
+	if len(nodes) > 0 {
+		scan.Annotations[compv1alpha1.ComplianceScanRescanNodesAnnotation] = strings.Join(nodes, ",")
+	} else {
+		delete(scan.Annotations, compv1alpha1.ComplianceScanRescanNodesAnnotation)
+	}
+	if selector != "" {
+		scan.Annotations[compv1alpha1.ComplianceScanRescanNodeSelectorAnnotation] = selector
+	} else {
+		delete(scan.Annotations, compv1alpha1.ComplianceScanRescanNodeSelectorAnnotation)
+	}
+}
@@ -39,6 +39,12 @@ func init() {
 	rootCmd.AddCommand(manager.ResultcollectorCmd)
 	rootCmd.AddCommand(manager.ResultServerCmd)
 	rootCmd.AddCommand(manager.RerunnerCmd)
+	rootCmd.AddCommand(manager.PreflightCmd)
+	rootCmd.AddCommand(manager.SarifCmd)
+	rootCmd.AddCommand(manager.CardinalityCmd)
+	rootCmd.AddCommand(manager.EvaluateCmd)
+	rootCmd.AddCommand(manager.RBACCmd)
+	rootCmd.AddCommand(manager.ContentDiffCmd)
 }
 
 func main() {
@@ -13,11 +13,22 @@ const ComplianceCheckResultStatusLabel = "compliance.openshift.io/check-status"
 const ComplianceCheckResultSeverityLabel = "compliance.openshift.io/check-severity"
 const ComplianceCheckResultValueLabel = "compliance.openshift.io/check-has-value"
 
+// ComplianceCheckResultChangedLabel is set to "true" on the results whose
+// status differs from the one the previous scan found for the same check.
+// It's not set on the results of checks the previous scan didn't have.
+const ComplianceCheckResultChangedLabel = "compliance.openshift.io/result-changed"
+
 // ComplianceCheckResultLabel defines a label that will be included in the
 // ComplianceCheckResult objects. It indicates whether the result has an automated
 // remediation or not.
 const ComplianceCheckResultHasRemediation = "compliance.openshift.io/automated-remediation"
 
+// ComplianceCheckResultReferenceLabelPrefix prefixes the labels set on the
+// results for each type of reference their rule has, e.g.
+// reference.compliance.openshift.io/nist, so the results of a framework can
+// be selected. The labels have no value.
+const ComplianceCheckResultReferenceLabelPrefix = "reference.compliance.openshift.io/"
+
 // ComplianceCheckInconsistentLabel signifies that the check's results were not consistent
 // across the target nodes
 const ComplianceCheckInconsistentLabel = "compliance.openshift.io/inconsistent-check"
@@ -38,6 +49,48 @@ const ComplianceCheckResultInconsistentSourceAnnotation = "compliance.openshift.
 const ComplianceCheckResultMostCommonAnnotation = "compliance.openshift.io/most-common-status"
 const ComplianceCheckResultErrorAnnotation = "compliance.openshift.io/error-msg"
 
+// ComplianceCheckResultContentDigestAnnotation and
+// ComplianceCheckResultTailoringDigestAnnotation store the SHA-256 digests of
+// the datastream and the tailoring that produced the result, so a result can
+// be tied to the exact content it came from across content updates
+const ComplianceCheckResultContentDigestAnnotation = "compliance.openshift.io/content-digest"
+const ComplianceCheckResultTailoringDigestAnnotation = "compliance.openshift.io/tailoring-digest"
+
+// ComplianceCheckResultPlatformAnnotation carries the infrastructure platform
+// of the cluster the result was produced on, copied from the scan's
+// ComplianceScanPlatformAnnotation
+const ComplianceCheckResultPlatformAnnotation = "compliance.openshift.io/platform"
+
+// ComplianceCheckResultNotApplicableReasonAnnotation tells why a
+// NOT-APPLICABLE result doesn't apply, as one of the NotApplicableReason
+// values
+const ComplianceCheckResultNotApplicableReasonAnnotation = "compliance.openshift.io/not-applicable-reason"
+
+const (
+	// A rule the check requires wasn't selected, so it wasn't evaluated
+	NotApplicableReasonNotSelected = "NotSelected"
+	// A rule the check requires was evaluated, but didn't pass
+	NotApplicableReasonPrerequisiteAbsent = "PrerequisiteAbsent"
+	// The rule only applies to platforms the scanned system isn't
+	NotApplicableReasonPlatformMismatch = "PlatformMismatch"
+	// The check itself found that it doesn't apply
+	NotApplicableReasonCheck = "CheckNotApplicable"
+)
+
+// ComplianceCheckResultLastRemediationAnnotation names the remediation last
+// applied to fix the check, ComplianceCheckResultLastRemediationStateAnnotation
+// the application state applying it ended in, and
+// ComplianceCheckResultLastRemediationTimeAnnotation when, in RFC 3339. They
+// are set by the remediation controller.
+const ComplianceCheckResultLastRemediationAnnotation = "compliance.openshift.io/last-remediation"
+const ComplianceCheckResultLastRemediationStateAnnotation = "compliance.openshift.io/last-remediation-state"
+const ComplianceCheckResultLastRemediationTimeAnnotation = "compliance.openshift.io/last-remediation-time"
+
+// ComplianceCheckResultRemediationVerifiedAnnotation is when the first scan
+// after the last remediation was applied found the check passing, in
+// RFC 3339. It's removed once the check doesn't pass anymore.
+const ComplianceCheckResultRemediationVerifiedAnnotation = "compliance.openshift.io/remediation-verified"
+
 const (
 	// The check ran to completion and passed
 	CheckResultPass ComplianceCheckStatus = "PASS"
@@ -65,14 +118,34 @@ const (
 	CheckResultSeverityLow     ComplianceCheckResultSeverity = "low"
 	CheckResultSeverityMedium  ComplianceCheckResultSeverity = "medium"
 	CheckResultSeverityHigh    ComplianceCheckResultSeverity = "high"
+	// Not part of the XCCDF specification, but used by some frameworks
+	// to single out issues more severe than high
+	CheckResultSeverityCritical ComplianceCheckResultSeverity = "critical"
 )
 
+// IsMoreSevereThan returns whether the severity ranks above the other one.
+// Unrecognized severities rank the same as unknown.
+func (s ComplianceCheckResultSeverity) IsMoreSevereThan(other ComplianceCheckResultSeverity) bool {
+	orderedSeverities := map[ComplianceCheckResultSeverity]int{
+		CheckResultSeverityUnknown:  0,
+		CheckResultSeverityInfo:     1,
+		CheckResultSeverityLow:      2,
+		CheckResultSeverityMedium:   3,
+		CheckResultSeverityHigh:     4,
+		CheckResultSeverityCritical: 5,
+	}
+
+	return orderedSeverities[s] > orderedSeverities[other]
+}
+
 // +kubebuilder:object:root=true
 
 // ComplianceCheckResult represent a result of a single compliance "test"
 // +kubebuilder:resource:path=compliancecheckresults,scope=Namespaced,shortName=ccr;checkresults;checkresult
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status`
 // +kubebuilder:printcolumn:name="Severity",type="string",JSONPath=`.severity`
+// +kubebuilder:printcolumn:name="First Failure",type="date",JSONPath=`.firstObservedFailure`
+// +kubebuilder:printcolumn:name="Last Checked",type="date",JSONPath=`.lastCheckedTime`
 type ComplianceCheckResult struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -93,6 +166,32 @@ type ComplianceCheckResult struct {
 	Warnings []string `json:"warnings,omitempty"`
 	// It stores a list of values used by the check
 	ValuesUsed []string `json:"valuesUsed,omitempty"`
+	// The external references of the rule, e.g. the benchmark sections or
+	// the control pages it implements
+	References []ComplianceCheckReference `json:"references,omitempty"`
+	// The time the check was first seen failing or erroring. It's kept
+	// across rescans while the check keeps failing, and cleared once it
+	// doesn't.
+	// +nullable
+	FirstObservedFailure metav1.Time `json:"firstObservedFailure,omitempty"`
+	// The time the result was last written by the aggregator, i.e. the time
+	// of the latest scan that checked it, whether its status changed or not
+	// +nullable
+	LastCheckedTime metav1.Time `json:"lastCheckedTime,omitempty"`
+}
+
+// ComplianceCheckReference is a citation of the authoritative source of a
+// check, taken from a <reference> element of the rule
+type ComplianceCheckReference struct {
+	// The title the reference is cited with, e.g. the section or control
+	Title string `json:"title,omitempty"`
+	// The framework the reference belongs to, e.g. nist or cis-csc, as told
+	// by its link or identifier. Empty if it isn't known.
+	Type string `json:"type,omitempty"`
+	// The text of the reference, e.g. the section, control or CVE identifier
+	ID string `json:"id,omitempty"`
+	// A link to the referenced document
+	URL string `json:"url,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,6 +24,11 @@ const (
 	RemediationNeedsReview         RemediationApplicationState = "NeedsReview"
 )
 
+// The condition of whether the remediation is applied. Its reason is the
+// application state, and its LastTransitionTime when the remediation last
+// reached or left the Applied state.
+const RemediationConditionApplied ConditionType = "Applied"
+
 // +kubebuilder:validation:Enum=Configuration;Enforcement
 type RemediationType string
 
@@ -143,6 +149,28 @@ type ComplianceRemediationStatus struct {
 	// +kubebuilder:default="NotApplied"
 	ApplicationState RemediationApplicationState `json:"applicationState,omitempty"`
 	ErrorMessage     string                      `json:"errorMessage,omitempty"`
+	// Defines the conditions for the ComplianceRemediation. Valid conditions are:
+	//  - Applied: Indicates if the remediation is applied or not.
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
+	// When applying the remediation was requested. It's cleared once the
+	// remediation is applied, or once applying it is no longer requested.
+	// +optional
+	ApplyRequestedTime *metav1.Time `json:"applyRequestedTime,omitempty"`
+}
+
+// SetConditionApplied sets the Applied condition from the application state
+func (s *ComplianceRemediationStatus) SetConditionApplied() {
+	status := corev1.ConditionFalse
+	if s.ApplicationState == RemediationApplied {
+		status = corev1.ConditionTrue
+	}
+	s.Conditions.SetCondition(Condition{
+		Type:    RemediationConditionApplied,
+		Status:  status,
+		Reason:  ConditionReason(s.ApplicationState),
+		Message: fmt.Sprintf("The remediation is %s", s.ApplicationState),
+	})
 }
 
 // +kubebuilder:object:root=true
@@ -1,9 +1,12 @@
 package v1alpha1
 
 import (
+	"encoding/json"
 	"errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"strconv"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,6 +18,198 @@ import (
 // should be re-run
 const ComplianceScanRescanAnnotation = "compliance.openshift.io/rescan"
 
+// ComplianceScanCancelAnnotation indicates that a running ComplianceScan
+// should be stopped. The scan will be marked as cancelled instead of
+// running to completion.
+const ComplianceScanCancelAnnotation = "compliance.openshift.io/cancel"
+
+// ComplianceScanSkipKubeletConfigAnnotation indicates that a platform
+// ComplianceScan doesn't need the nodes' KubeletConfigs, so the
+// resource collector won't discover nodes nor fetch them
+const ComplianceScanSkipKubeletConfigAnnotation = "compliance.openshift.io/skip-kubelet-config"
+
+// ComplianceScanConsistentSnapshotAnnotation makes the resource collector of
+// a platform scan fetch all the lists at the resourceVersion of the first
+// one, so the scan evaluates a single point in time of the cluster
+const ComplianceScanConsistentSnapshotAnnotation = "compliance.openshift.io/consistent-snapshot"
+
+// ComplianceScanPreferProtobufAnnotation makes the resource collector of a
+// platform scan request the built-in resources as protobuf, which is more
+// compact than JSON for large lists
+const ComplianceScanPreferProtobufAnnotation = "compliance.openshift.io/prefer-protobuf"
+
+// ComplianceScanBatchConfigFetchAnnotation makes the resource collector of a
+// platform scan fetch the OpenShift configuration objects in fewer,
+// concurrent requests before fetching the other resources
+const ComplianceScanBatchConfigFetchAnnotation = "compliance.openshift.io/batch-config-fetch"
+
+// ComplianceScanCompressResourcesAnnotation makes the resource collector of a
+// platform scan gzip the resources it saves, which the scanner decompresses
+// before evaluating them
+const ComplianceScanCompressResourcesAnnotation = "compliance.openshift.io/compress-resources"
+
+// ComplianceScanMachineConfigsToDiskAnnotation makes the resource collector
+// of a platform scan write the MachineConfigs to a temporary file as they're
+// fetched, instead of holding all of them in memory
+const ComplianceScanMachineConfigsToDiskAnnotation = "compliance.openshift.io/machine-configs-to-disk"
+
+// ComplianceScanDriftBaselineAnnotation makes the operator compare the check
+// results of each run of a scan with those of its first run, the baseline,
+// and report the checks that started failing or passing since
+const ComplianceScanDriftBaselineAnnotation = "compliance.openshift.io/drift-baseline"
+
+// ComplianceScanFilterErrorsAnnotation is set by the resource collector of a
+// platform scan to a JSON object counting the errors of the content's filters
+// by kind and dump path, e.g. {"multi":{"/api/v1/nodes":1}}
+const ComplianceScanFilterErrorsAnnotation = "compliance.openshift.io/filter-errors"
+
+// ComplianceScanKeepUnreadyNodesAnnotation makes the resource collector of a
+// platform scan also collect the KubeletConfigs of the nodes that aren't
+// ready or are unschedulable
+const ComplianceScanKeepUnreadyNodesAnnotation = "compliance.openshift.io/keep-unready-nodes"
+
+// ComplianceScanFailOnEmptyAnnotation makes the resource collector of a
+// platform scan fail if it fetched no resources at all
+const ComplianceScanFailOnEmptyAnnotation = "compliance.openshift.io/fail-on-empty"
+
+// ComplianceScanNDJSONResultsAnnotation makes the aggregator of a scan also
+// print each ComplianceCheckResult to its log as a single JSON line
+const ComplianceScanNDJSONResultsAnnotation = "compliance.openshift.io/ndjson-results"
+
+// ComplianceScanAggregatorConcurrencyAnnotation sets how many result
+// ConfigMaps the aggregator of a scan parses, and how many results it
+// creates, at once
+const ComplianceScanAggregatorConcurrencyAnnotation = "compliance.openshift.io/aggregator-concurrency"
+
+// ComplianceScanRedactConfigMapBinaryDataAnnotation makes the resource
+// collector of a platform scan replace the binary data of the ConfigMaps that
+// the content references by name with a placeholder, keeping only their keys
+const ComplianceScanRedactConfigMapBinaryDataAnnotation = "compliance.openshift.io/redact-configmap-binary-data"
+
+// ComplianceScanKubeletConfigAPIVersionAnnotation sets the apiVersion the
+// resource collector of a platform scan labels the nodes' KubeletConfigs
+// with. "auto" keeps the apiVersion returned by the kubelet, if any.
+const ComplianceScanKubeletConfigAPIVersionAnnotation = "compliance.openshift.io/kubelet-config-api-version"
+
+// ComplianceScanDumpPathSchemeAnnotation sets the layout of the resources the
+// resource collector of a platform scan saves, for the scanner images that
+// expect an older one, e.g. "v1" leaves out the KubeletConfigs of the roles
+const ComplianceScanDumpPathSchemeAnnotation = "compliance.openshift.io/dump-path-scheme"
+
+// ComplianceScanContentVersionCheckAnnotation makes the resource collector of
+// a platform scan compare the cluster's version with the versions the
+// content targets. "warn" adds a warning on mismatch, "fail" fails the scan.
+const ComplianceScanContentVersionCheckAnnotation = "compliance.openshift.io/content-version-check"
+
+// ComplianceScanVersionDetectionAnnotation sets what the resource collector
+// of a platform scan does if the OpenShift version can't be detected: "warn"
+// and continue, "fail" the scan, or "version-only" to only detect the
+// Kubernetes version from /version.
+const ComplianceScanVersionDetectionAnnotation = "compliance.openshift.io/version-detection"
+
+// ComplianceScanKeepNodeKubeletConfigsAnnotation makes the resource collector
+// of a platform scan keep the KubeletConfig of every node in its metadata
+// archive, and not just the role summaries the scan evaluates
+const ComplianceScanKeepNodeKubeletConfigsAnnotation = "compliance.openshift.io/keep-node-kubelet-configs"
+
+// ComplianceScanFetchConcurrencyAnnotation sets how many resources the
+// resource collector of a platform scan fetches at a time
+const ComplianceScanFetchConcurrencyAnnotation = "compliance.openshift.io/fetch-concurrency"
+
+// ComplianceScanFetchRetriesAnnotation sets how many times the resource
+// collector of a platform scan retries a fetch the API server was too busy
+// to serve or failed
+const ComplianceScanFetchRetriesAnnotation = "compliance.openshift.io/fetch-retries"
+
+// ComplianceScanFetchRetryDelayAnnotation sets the delay before the first of
+// those retries, like 500ms or 2s
+const ComplianceScanFetchRetryDelayAnnotation = "compliance.openshift.io/fetch-retry-delay"
+
+// ComplianceScanMachineConfigPoolsAnnotation restricts the MachineConfigs a
+// platform scan fetches to those of a comma-separated list of
+// MachineConfigPools
+const ComplianceScanMachineConfigPoolsAnnotation = "compliance.openshift.io/machine-config-pools"
+
+// ComplianceScanMachineConfigSectionsAnnotation sets the comma-separated
+// Ignition sections of the MachineConfigs a platform scan keeps, among
+// passwd, storage and systemd
+const ComplianceScanMachineConfigSectionsAnnotation = "compliance.openshift.io/machine-config-sections"
+
+// ComplianceScanSkipStagedResourcesAnnotation makes the resource collector of
+// a platform scan skip some of the resources every scan fetches, unless a
+// check reads them. It's a comma-separated list of their dump paths.
+const ComplianceScanSkipStagedResourcesAnnotation = "compliance.openshift.io/skip-staged-resources"
+
+// ComplianceScanMinKubeletNodeCoverageAnnotation sets the percentage of the
+// nodes of a role that must return a KubeletConfig for the resource collector
+// of a platform scan to save the role's. Below it, the role's KubeletConfig
+// is saved as an error.
+const ComplianceScanMinKubeletNodeCoverageAnnotation = "compliance.openshift.io/min-kubelet-node-coverage"
+
+// ComplianceScanExpectedContentDigestAnnotation and
+// ComplianceScanExpectedTailoringDigestAnnotation set the SHA-256 the content
+// and tailoring files must have for the resource collector of a platform scan
+// to load them, e.g. as published by the pipeline that built the content.
+const ComplianceScanExpectedContentDigestAnnotation = "compliance.openshift.io/expected-content-digest"
+const ComplianceScanExpectedTailoringDigestAnnotation = "compliance.openshift.io/expected-tailoring-digest"
+
+// ComplianceScanNodeRolesAnnotation maps the nodes to the roles the resource
+// collector of a platform scan aggregates their KubeletConfig under, instead
+// of their node-role.kubernetes.io labels. It's a semicolon-separated list of
+// role=selector pairs.
+const ComplianceScanNodeRolesAnnotation = "compliance.openshift.io/node-roles"
+
+// ComplianceScanEffectiveValuesAnnotation is set by the resource collector
+// of a platform scan to a JSON object holding the XCCDF values that the
+// scanned profile and its tailoring set
+const ComplianceScanEffectiveValuesAnnotation = "compliance.openshift.io/effective-values"
+
+// ComplianceScanUndefinedRulesAnnotation is set by the resource collector of
+// a platform scan to the number of rules the scanned profile selects that
+// aren't defined in the content
+const ComplianceScanUndefinedRulesAnnotation = "compliance.openshift.io/undefined-rules"
+
+// ComplianceScanFetchDurationAnnotation is set by the resource collector of a
+// platform scan to how long it took to fetch the resources, e.g. "42.5s"
+const ComplianceScanFetchDurationAnnotation = "compliance.openshift.io/fetch-duration"
+
+// ComplianceScanDeduplicatedUploadsAnnotation is set by the result server of
+// a scan to how many retried uploads of the current run it had already stored
+const ComplianceScanDeduplicatedUploadsAnnotation = "compliance.openshift.io/deduplicated-uploads"
+
+// ComplianceScanPlatformAnnotation is set by the aggregator to the type of
+// the infrastructure the scanned cluster runs on, e.g. AWS or None, as read
+// from infrastructures/cluster
+const ComplianceScanPlatformAnnotation = "compliance.openshift.io/platform"
+
+// ComplianceScanImpersonateUserAnnotation makes the resource collector of a
+// platform scan fetch the resources as the given user or service account, so
+// the scan shows what that principal is able to see. The user must be listed
+// in the scan's AllowedImpersonatedUsers, and the collector's service account
+// needs to be allowed to impersonate it.
+const ComplianceScanImpersonateUserAnnotation = "compliance.openshift.io/impersonate-user"
+
+// ComplianceScanUserAgentAnnotation replaces the scan-identifying part of the
+// User-Agent the resource collector of a platform scan sends, which defaults
+// to "scan/<name>", so the API server's audit logs attribute its requests.
+const ComplianceScanUserAgentAnnotation = "compliance.openshift.io/user-agent"
+
+// ComplianceScanRescanNodesAnnotation restricts the node-level collection of
+// a ComplianceScan to a comma-separated list of node names. It's set by the
+// suite rerunner to rescan only the nodes that changed.
+const ComplianceScanRescanNodesAnnotation = "compliance.openshift.io/rescan-nodes"
+
+// ComplianceScanRescanNodeSelectorAnnotation restricts the node-level
+// collection of a ComplianceScan to the nodes matching a label selector. If
+// it's set along with ComplianceScanRescanNodesAnnotation, nodes must match
+// both.
+const ComplianceScanRescanNodeSelectorAnnotation = "compliance.openshift.io/rescan-node-selector"
+
+// ComplianceScanRerunnerTickAnnotation records, in RFC 3339 format, when the
+// suite rerunner last ran for the ComplianceScan. The operator exposes it as
+// the rerunner_last_tick_timestamp_seconds metric of the suite.
+const ComplianceScanRerunnerTickAnnotation = "compliance.openshift.io/rerunner-last-tick"
+
 // ComplianceScanLabel serves as an indicator for which ComplianceScan
 // owns the referenced object
 const ComplianceScanLabel = "compliance.openshift.io/scan-name"
@@ -88,18 +283,23 @@ const (
 	ResultNonCompliant ComplianceScanStatusResult = "NON-COMPLIANT"
 	// ResultInconsistent represents checks differing across the machines
 	ResultInconsistent ComplianceScanStatusResult = "INCONSISTENT"
-	ScanTypeNode       ComplianceScanType         = "Node"
-	ScanTypePlatform   ComplianceScanType         = "Platform"
+	// ResultCancelled represents the compliance scan having been stopped before it finished
+	ResultCancelled  ComplianceScanStatusResult = "CANCELLED"
+	ScanTypeNode     ComplianceScanType         = "Node"
+	ScanTypePlatform ComplianceScanType         = "Platform"
 )
 
 func resultCompare(lowResult ComplianceScanStatusResult, scanResult ComplianceScanStatusResult) ComplianceScanStatusResult {
 	orderedResults := make(map[ComplianceScanStatusResult]int)
 	orderedResults[ResultNotAvailable] = 0
+	// An error is worth more attention than a scan that was cancelled on
+	// purpose
 	orderedResults[ResultError] = 1
-	orderedResults[ResultInconsistent] = 2
-	orderedResults[ResultNonCompliant] = 3
-	orderedResults[ResultNotApplicable] = 4
-	orderedResults[ResultCompliant] = 5
+	orderedResults[ResultCancelled] = 2
+	orderedResults[ResultInconsistent] = 3
+	orderedResults[ResultNonCompliant] = 4
+	orderedResults[ResultNotApplicable] = 5
+	orderedResults[ResultCompliant] = 6
 
 	if orderedResults[lowResult] > orderedResults[scanResult] {
 		return scanResult
@@ -199,6 +399,12 @@ type ComplianceScanSettings struct {
 	// optional field, if PriorityClass is invalid or not found, it will be ignored.
 	PriorityClass string `json:"priorityClass,omitempty"`
 
+	// The users and service accounts the compliance.openshift.io/impersonate-user
+	// annotation of a platform scan may name. Scans annotated with any other
+	// user are marked as invalid. Service accounts are given as
+	// system:serviceaccount:<namespace>:<name>.
+	AllowedImpersonatedUsers []string `json:"allowedImpersonatedUsers,omitempty"`
+
 	// ScanLimits allows to set the resource limits that the scan pods are allowed to use.
 	// By default, compliance operator will use sensible defaults (500Mi memory, 100m CPU
 	// for the scanner container and 200Mi memory with 100m CPU for the api-resource-collector
@@ -259,10 +465,42 @@ type ComplianceScanStatus struct {
 	// If there are warnings on the scan, this will be filled up with warning
 	// messages.
 	Warnings string `json:"warnings,omitempty"`
+	// The SHA-256 digest of the datastream that was scanned. Only set for
+	// platform scans.
+	// +optional
+	ContentDigest string `json:"contentDigest,omitempty"`
+	// The SHA-256 digest of the tailoring that was used, if any. Only set
+	// for platform scans.
+	// +optional
+	TailoringDigest string `json:"tailoringDigest,omitempty"`
+	// The OpenShift version the resource collector detected, which the
+	// version-dependent content is evaluated against. Only set for platform
+	// scans of OpenShift clusters.
+	// +optional
+	OpenShiftVersion string `json:"openShiftVersion,omitempty"`
+	// The Kubernetes version the resource collector detected. Only set for
+	// platform scans.
+	// +optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// The number of checks of the last run by result. Set by the aggregator
+	// once it created the results.
+	// +optional
+	CheckCounts *ComplianceCheckCounts `json:"checkCounts,omitempty"`
 	// +optional
 	Conditions Conditions `json:"conditions,omitempty"`
 }
 
+// ComplianceCheckCounts are the number of checks of a scan with each result
+type ComplianceCheckCounts struct {
+	Pass          int `json:"pass"`
+	Fail          int `json:"fail"`
+	Error         int `json:"error"`
+	Info          int `json:"info"`
+	Manual        int `json:"manual"`
+	NotApplicable int `json:"notApplicable"`
+	Inconsistent  int `json:"inconsistent"`
+}
+
 // StorageReference stores a reference to where certain objects are being stored
 type StorageReference struct {
 	// Kind of the referent.
@@ -314,6 +552,216 @@ func (cs *ComplianceScan) NeedsRescan() bool {
 	return needsRescan
 }
 
+// IsCancelled indicates whether a ComplianceScan was requested
+// to be cancelled
+func (cs *ComplianceScan) IsCancelled() bool {
+	annotations := cs.GetAnnotations()
+	if annotations == nil {
+		return false
+	}
+	_, cancelled := annotations[ComplianceScanCancelAnnotation]
+	return cancelled
+}
+
+// SkipsKubeletConfig indicates whether the KubeletConfig collection
+// should be skipped for the ComplianceScan
+func (cs *ComplianceScan) SkipsKubeletConfig() bool {
+	annotations := cs.GetAnnotations()
+	if annotations == nil {
+		return false
+	}
+	_, skip := annotations[ComplianceScanSkipKubeletConfigAnnotation]
+	return skip
+}
+
+// ImpersonatedUser returns the user the ComplianceScan is annotated to fetch
+// the resources as, and whether AllowedImpersonatedUsers lets it do so. The
+// user is empty if the scan isn't annotated.
+func (cs *ComplianceScan) ImpersonatedUser() (string, bool) {
+	user := cs.GetAnnotations()[ComplianceScanImpersonateUserAnnotation]
+	if user == "" {
+		return "", true
+	}
+	for _, allowed := range cs.Spec.AllowedImpersonatedUsers {
+		if allowed == user {
+			return user, true
+		}
+	}
+	return user, false
+}
+
+// KeepsNodeKubeletConfigs tells whether the KubeletConfig of every node should
+// be archived
+func (cs *ComplianceScan) KeepsNodeKubeletConfigs() bool {
+	_, keep := cs.GetAnnotations()[ComplianceScanKeepNodeKubeletConfigsAnnotation]
+	return keep
+}
+
+// RedactsConfigMapBinaryData tells whether the binary data of the ConfigMaps
+// fetched for the scan should be redacted
+func (cs *ComplianceScan) RedactsConfigMapBinaryData() bool {
+	_, redact := cs.GetAnnotations()[ComplianceScanRedactConfigMapBinaryDataAnnotation]
+	return redact
+}
+
+// FetchesConsistentSnapshot tells whether the resources of the scan should be
+// fetched as a consistent snapshot
+func (cs *ComplianceScan) FetchesConsistentSnapshot() bool {
+	_, consistent := cs.GetAnnotations()[ComplianceScanConsistentSnapshotAnnotation]
+	return consistent
+}
+
+// PrefersProtobuf tells whether the resources of the scan should be fetched
+// as protobuf where possible
+func (cs *ComplianceScan) PrefersProtobuf() bool {
+	_, prefer := cs.GetAnnotations()[ComplianceScanPreferProtobufAnnotation]
+	return prefer
+}
+
+// BatchesConfigFetch tells whether the OpenShift configuration objects of the
+// scan should be fetched in fewer requests
+func (cs *ComplianceScan) BatchesConfigFetch() bool {
+	_, batch := cs.GetAnnotations()[ComplianceScanBatchConfigFetchAnnotation]
+	return batch
+}
+
+// CompressesResources tells whether the resources collected for the scan
+// should be saved gzipped
+func (cs *ComplianceScan) CompressesResources() bool {
+	_, compress := cs.GetAnnotations()[ComplianceScanCompressResourcesAnnotation]
+	return compress
+}
+
+// WritesMachineConfigsToDisk tells whether the MachineConfigs of the scan
+// should be written to disk as they're fetched
+func (cs *ComplianceScan) WritesMachineConfigsToDisk() bool {
+	_, toDisk := cs.GetAnnotations()[ComplianceScanMachineConfigsToDiskAnnotation]
+	return toDisk
+}
+
+// ComparesWithBaseline tells whether the check results of the scan should be
+// compared with its baseline
+func (cs *ComplianceScan) ComparesWithBaseline() bool {
+	_, compares := cs.GetAnnotations()[ComplianceScanDriftBaselineAnnotation]
+	return compares
+}
+
+// GetFilterErrors returns the errors of the content's filters the resource
+// collector of the scan counted by kind and dump path, and false if there are
+// none or they can't be parsed
+func (cs *ComplianceScan) GetFilterErrors() (map[string]map[string]int, bool) {
+	value, ok := cs.GetAnnotations()[ComplianceScanFilterErrorsAnnotation]
+	if !ok {
+		return nil, false
+	}
+	counts := map[string]map[string]int{}
+	if err := json.Unmarshal([]byte(value), &counts); err != nil || len(counts) == 0 {
+		return nil, false
+	}
+	return counts, true
+}
+
+// KeepsUnreadyNodes tells whether the KubeletConfigs of the nodes that aren't
+// ready or are unschedulable should be collected for the scan
+func (cs *ComplianceScan) KeepsUnreadyNodes() bool {
+	_, keeps := cs.GetAnnotations()[ComplianceScanKeepUnreadyNodesAnnotation]
+	return keeps
+}
+
+// FailsOnEmptyCollection tells whether the scan should fail if its resource
+// collector fetched nothing
+func (cs *ComplianceScan) FailsOnEmptyCollection() bool {
+	_, fails := cs.GetAnnotations()[ComplianceScanFailOnEmptyAnnotation]
+	return fails
+}
+
+// GetUndefinedRules returns how many of the rules the profile of the scan
+// selects aren't defined in the content, and false if it wasn't recorded
+func (cs *ComplianceScan) GetUndefinedRules() (int, bool) {
+	value, ok := cs.GetAnnotations()[ComplianceScanUndefinedRulesAnnotation]
+	if !ok {
+		return 0, false
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return count, true
+}
+
+// GetFetchDuration returns how long the resource collector of the scan took
+// to fetch the resources, and false if it wasn't recorded
+func (cs *ComplianceScan) GetFetchDuration() (time.Duration, bool) {
+	value, ok := cs.GetAnnotations()[ComplianceScanFetchDurationAnnotation]
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// GetDeduplicatedUploads returns how many retried uploads the result server
+// of the scan had already stored, and false if it wasn't recorded
+func (cs *ComplianceScan) GetDeduplicatedUploads() (int, bool) {
+	value, ok := cs.GetAnnotations()[ComplianceScanDeduplicatedUploadsAnnotation]
+	if !ok {
+		return 0, false
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, false
+	}
+	return count, true
+}
+
+// PrintsNDJSONResults tells whether the aggregator of the scan should print
+// the check results as JSON lines
+func (cs *ComplianceScan) PrintsNDJSONResults() bool {
+	_, prints := cs.GetAnnotations()[ComplianceScanNDJSONResultsAnnotation]
+	return prints
+}
+
+// GetRerunnerLastTick returns when the suite rerunner last ran for the
+// ComplianceScan, and false if it never did or the time can't be parsed
+func (cs *ComplianceScan) GetRerunnerLastTick() (time.Time, bool) {
+	value, ok := cs.GetAnnotations()[ComplianceScanRerunnerTickAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	tick, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return tick, true
+}
+
+// GetRescanNodes returns the names of the nodes the ComplianceScan is
+// restricted to, or nil if it isn't restricted by name
+func (cs *ComplianceScan) GetRescanNodes() []string {
+	var nodes []string
+	for _, name := range strings.Split(cs.GetAnnotations()[ComplianceScanRescanNodesAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			nodes = append(nodes, name)
+		}
+	}
+	return nodes
+}
+
+// GetRescanNodeSelector returns the label selector the nodes of the
+// ComplianceScan are restricted to, if any
+func (cs *ComplianceScan) GetRescanNodeSelector() string {
+	return strings.TrimSpace(cs.GetAnnotations()[ComplianceScanRescanNodeSelectorAnnotation])
+}
+
+// RescansNodeSubset indicates whether the ComplianceScan only covers
+// a subset of its nodes
+func (cs *ComplianceScan) RescansNodeSubset() bool {
+	return len(cs.GetRescanNodes()) > 0 || cs.GetRescanNodeSelector() != ""
+}
+
 // GetScanTypeIfValid returns scan type if the scan has a valid one, else it returns
 // an error
 func (cs *ComplianceScan) GetScanTypeIfValid() (ComplianceScanType, error) {
@@ -386,3 +834,7 @@ func (s *ComplianceScanStatus) SetConditionsProcessing() {
 func (s *ComplianceScanStatus) SetConditionReady() {
 	s.Conditions.SetConditionReady("scan")
 }
+
+func (s *ComplianceScanStatus) SetConditionCancelled() {
+	s.Conditions.SetConditionCancelled("scan")
+}
@@ -0,0 +1,29 @@
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing ComplianceSuite API", func() {
+	When("getting the lowest common result of the scans", func() {
+		suiteWith := func(results ...ComplianceScanStatusResult) *ComplianceSuite {
+			suite := &ComplianceSuite{}
+			for _, result := range results {
+				suite.Status.ScanStatuses = append(suite.Status.ScanStatuses, ComplianceScanStatusWrapper{
+					ComplianceScanStatus: ComplianceScanStatus{Phase: PhaseDone, Result: result},
+				})
+			}
+			return suite
+		}
+
+		It("reports the errors over the cancelled scans", func() {
+			Expect(suiteWith(ResultCancelled, ResultError).LowestCommonResult()).To(Equal(ResultError))
+			Expect(suiteWith(ResultError, ResultCancelled).LowestCommonResult()).To(Equal(ResultError))
+		})
+
+		It("reports the cancelled scans over their results", func() {
+			Expect(suiteWith(ResultCompliant, ResultCancelled, ResultNonCompliant).LowestCommonResult()).To(Equal(ResultCancelled))
+		})
+	})
+})
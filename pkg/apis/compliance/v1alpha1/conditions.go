@@ -221,3 +221,18 @@ func (conditions *Conditions) SetConditionReady(what string) {
 		Message: fmt.Sprintf("Compliance %s run is done running the scans", what),
 	})
 }
+
+func (conditions *Conditions) SetConditionCancelled(what string) {
+	conditions.SetCondition(Condition{
+		Type:    "Ready",
+		Status:  corev1.ConditionFalse,
+		Reason:  "Cancelled",
+		Message: fmt.Sprintf("Compliance %s run was cancelled", what),
+	})
+	conditions.SetCondition(Condition{
+		Type:    "Processing",
+		Status:  corev1.ConditionFalse,
+		Reason:  "NotRunning",
+		Message: fmt.Sprintf("Compliance %s run was stopped before it finished", what),
+	})
+}
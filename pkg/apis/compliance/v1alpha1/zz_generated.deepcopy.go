@@ -27,6 +27,36 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceCheckCounts) DeepCopyInto(out *ComplianceCheckCounts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceCheckCounts.
+func (in *ComplianceCheckCounts) DeepCopy() *ComplianceCheckCounts {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceCheckCounts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComplianceCheckReference) DeepCopyInto(out *ComplianceCheckReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceCheckReference.
+func (in *ComplianceCheckReference) DeepCopy() *ComplianceCheckReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ComplianceCheckReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComplianceCheckResult) DeepCopyInto(out *ComplianceCheckResult) {
 	*out = *in
@@ -42,6 +72,13 @@ func (in *ComplianceCheckResult) DeepCopyInto(out *ComplianceCheckResult) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.References != nil {
+		in, out := &in.References, &out.References
+		*out = make([]ComplianceCheckReference, len(*in))
+		copy(*out, *in)
+	}
+	in.FirstObservedFailure.DeepCopyInto(&out.FirstObservedFailure)
+	in.LastCheckedTime.DeepCopyInto(&out.LastCheckedTime)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceCheckResult.
@@ -100,7 +137,7 @@ func (in *ComplianceRemediation) DeepCopyInto(out *ComplianceRemediation) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceRemediation.
@@ -208,6 +245,17 @@ func (in *ComplianceRemediationSpecMeta) DeepCopy() *ComplianceRemediationSpecMe
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComplianceRemediationStatus) DeepCopyInto(out *ComplianceRemediationStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ApplyRequestedTime != nil {
+		in, out := &in.ApplyRequestedTime, &out.ApplyRequestedTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComplianceRemediationStatus.
@@ -295,6 +343,11 @@ func (in *ComplianceScanSettings) DeepCopyInto(out *ComplianceScanSettings) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.AllowedImpersonatedUsers != nil {
+		in, out := &in.AllowedImpersonatedUsers, &out.AllowedImpersonatedUsers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.ScanLimits != nil {
 		in, out := &in.ScanLimits, &out.ScanLimits
 		*out = make(map[v1.ResourceName]resource.Quantity, len(*in))
@@ -362,6 +415,11 @@ func (in *ComplianceScanSpecWrapper) DeepCopy() *ComplianceScanSpecWrapper {
 func (in *ComplianceScanStatus) DeepCopyInto(out *ComplianceScanStatus) {
 	*out = *in
 	out.ResultsStorage = in.ResultsStorage
+	if in.CheckCounts != nil {
+		in, out := &in.CheckCounts, &out.CheckCounts
+		*out = new(ComplianceCheckCounts)
+		**out = **in
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make(Conditions, len(*in))
@@ -13,6 +13,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -39,6 +40,7 @@ var log = logf.Log.WithName(ctrlName)
 const (
 	remediationNameAnnotationKey = "remediation/"
 	defaultDependencyRequeueTime = time.Second * 20
+	defaultRolloutRequeueTime    = time.Second * 30
 )
 
 func (r *ReconcileComplianceRemediation) SetupWithManager(mgr ctrl.Manager) error {
@@ -129,6 +131,8 @@ func (r *ReconcileComplianceRemediation) Reconcile(ctx context.Context, request
 		reqLogger.Info("Updating remediation due to missing application state")
 		rCopy := remediationInstance.DeepCopy()
 		rCopy.Status.ApplicationState = compv1alpha1.RemediationPending
+		rCopy.Status.SetConditionApplied()
+		markApplyRequested(rCopy, "", metav1.Now())
 		if updErr := r.Client.Status().Update(context.TODO(), rCopy); updErr != nil {
 			// metric remediation error
 			return reconcile.Result{}, fmt.Errorf("updating default remediation application state: %s", updErr)
@@ -184,12 +188,17 @@ func (r *ReconcileComplianceRemediation) Reconcile(ctx context.Context, request
 	}
 
 	// Second, we'll reconcile the status of the Remediation itself
-	statusErr := r.reconcileRemediationStatus(remediationInstance, reqLogger, reconcileErr)
+	rollingOut, statusErr := r.reconcileRemediationStatus(remediationInstance, reqLogger, reconcileErr)
 	// this would have been much nicer with go 1.13 using errors.Is()
 	if statusErr != nil {
 		return common.ReturnWithRetriableError(reqLogger, statusErr)
 	}
 
+	if rollingOut {
+		reqLogger.Info("The pool is still rolling out the remediation. Requeuing")
+		return reconcile.Result{Requeue: true, RequeueAfter: defaultRolloutRequeueTime}, nil
+	}
+
 	if remediationInstance.Spec.Apply && remediationInstance.HasUnmetKubeDependencies() {
 		reqLogger.Info("Has unmet kubernetes object dependencies. Requeuing")
 		return reconcile.Result{Requeue: true, RequeueAfter: defaultDependencyRequeueTime}, nil
@@ -589,21 +598,150 @@ func isRemDepHandled(r *ReconcileComplianceRemediation, rem *compv1alpha1.Compli
 	return true, nil
 }
 
+// reconcileRemediationStatus updates the status of the remediation after
+// reconciling it, and tells whether the pool of an applied MachineConfig
+// remediation is still rolling it out, in which case the remediation needs to
+// be reconciled again to time how long applying it took.
 func (r *ReconcileComplianceRemediation) reconcileRemediationStatus(instance *compv1alpha1.ComplianceRemediation,
-	logger logr.Logger, errorApplying error) error {
+	logger logr.Logger, errorApplying error) (bool, error) {
 	instanceCopy := instance.DeepCopy()
 	logger.Info("Updating status of remediation")
 	r.setRemediationStatus(instanceCopy, errorApplying, logger)
+	instanceCopy.Status.SetConditionApplied()
+
+	now := metav1.Now()
+	markApplyRequested(instanceCopy, instance.Status.ApplicationState, now)
+	var applyDuration time.Duration
+	var applied, rollingOut bool
+	if requested := instanceCopy.Status.ApplyRequestedTime; requested != nil &&
+		instanceCopy.Status.ApplicationState == compv1alpha1.RemediationApplied {
+		rolledOut, err := r.hasRolledOut(instanceCopy, logger)
+		if err != nil {
+			return false, err
+		}
+		if rolledOut {
+			applyDuration = now.Sub(requested.Time)
+			applied = true
+			instanceCopy.Status.ApplyRequestedTime = nil
+		} else {
+			rollingOut = true
+		}
+	}
 
 	if err := r.Client.Status().Update(context.TODO(), instanceCopy); err != nil {
 		// metric remediation error
 		logger.Error(err, "Failed to update the remediation status")
 		// This should be retried
-		return err
+		return false, err
 	}
 	r.Metrics.IncComplianceRemediationStatus(instanceCopy.Name, instanceCopy.Status)
+	// The state the remediation had until now is the one it was read with
+	r.Metrics.IncComplianceRemediationTransition(instanceCopy.Name, instance.Status.ApplicationState, instanceCopy.Status.ApplicationState)
+	if applied {
+		r.Metrics.ObserveComplianceRemediationApplyDuration(instanceCopy.Name, applyDuration)
+	}
 
-	return nil
+	return rollingOut, r.recordRemediationOnCheck(instanceCopy, logger)
+}
+
+// markApplyRequested records on the status of the remediation when applying
+// it was requested, so the time it takes to be applied can be told once it
+// is. The remediations that were and remain applied have nothing left to
+// time, and the time is cleared once applying them is no longer requested.
+func markApplyRequested(rem *compv1alpha1.ComplianceRemediation, wasState compv1alpha1.RemediationApplicationState, now metav1.Time) {
+	switch {
+	case !rem.Spec.Apply:
+		rem.Status.ApplyRequestedTime = nil
+	case rem.Status.ApplyRequestedTime != nil:
+		// The request is already being timed
+	case wasState == compv1alpha1.RemediationApplied && rem.Status.ApplicationState == compv1alpha1.RemediationApplied:
+		// There's nothing left to time
+	default:
+		rem.Status.ApplyRequestedTime = &now
+	}
+}
+
+// hasRolledOut tells whether an applied remediation is in effect. The
+// MachineConfig remediations only are once the pool of their scan has
+// rolled them out to all of its nodes, the others as soon as they're applied.
+func (r *ReconcileComplianceRemediation) hasRolledOut(rem *compv1alpha1.ComplianceRemediation, logger logr.Logger) (bool, error) {
+	obj := getApplicableObject(rem, logger)
+	if obj == nil || !utils.IsMachineConfig(obj) {
+		return true, nil
+	}
+	scan := &compv1alpha1.ComplianceScan{}
+	scanKey := types.NamespacedName{Name: rem.Labels[compv1alpha1.ComplianceScanLabel], Namespace: rem.Namespace}
+	if err := r.Client.Get(context.TODO(), scanKey, scan); err != nil {
+		return false, fmt.Errorf("couldn't get scan for MC remediation: %w", err)
+	}
+	mcfgpools := &mcfgv1.MachineConfigPoolList{}
+	if err := r.Client.List(context.TODO(), mcfgpools); err != nil {
+		return false, fmt.Errorf("couldn't list the pools for the remediation: %w", err)
+	}
+	ok, pool := utils.AnyMcfgPoolLabelMatches(scan.Spec.NodeSelector, mcfgpools)
+	if !ok {
+		// There's no pool left to wait for
+		return true, nil
+	}
+	return poolHasRolledOut(pool, rem.GetMcName()), nil
+}
+
+// poolHasRolledOut tells whether all the nodes of the pool run a rendered
+// configuration that includes the given MachineConfig.
+func poolHasRolledOut(pool *mcfgv1.MachineConfigPool, mcName string) bool {
+	if pool.Status.UpdatedMachineCount != pool.Status.MachineCount {
+		return false
+	}
+	for _, source := range pool.Status.Configuration.Source {
+		if source.Name == mcName {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRemediationOnCheck annotates the check result the remediation fixes
+// with the outcome of applying it, so the remediation history of a check can
+// be seen on its result. Un-applying is only recorded if the remediation was
+// the last one applied.
+func (r *ReconcileComplianceRemediation) recordRemediationOnCheck(rem *compv1alpha1.ComplianceRemediation, logger logr.Logger) error {
+	owner := metav1.GetControllerOf(rem)
+	if owner == nil || owner.Kind != "ComplianceCheckResult" {
+		return nil
+	}
+	check := &compv1alpha1.ComplianceCheckResult{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: owner.Name, Namespace: rem.Namespace}, check)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	annotations := check.GetAnnotations()
+	state := rem.Status.ApplicationState
+	switch {
+	case rem.Spec.Apply && (state == compv1alpha1.RemediationApplied || state == compv1alpha1.RemediationError):
+	case !rem.Spec.Apply && state == compv1alpha1.RemediationNotApplied &&
+		annotations[compv1alpha1.ComplianceCheckResultLastRemediationAnnotation] == rem.Name:
+	default:
+		return nil
+	}
+	if annotations[compv1alpha1.ComplianceCheckResultLastRemediationAnnotation] == rem.Name &&
+		annotations[compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation] == string(state) {
+		return nil
+	}
+
+	logger.Info("Recording the remediation on its check", "ComplianceCheckResult.Name", check.Name)
+	checkCopy := check.DeepCopy()
+	if checkCopy.Annotations == nil {
+		checkCopy.Annotations = make(map[string]string)
+	}
+	checkCopy.Annotations[compv1alpha1.ComplianceCheckResultLastRemediationAnnotation] = rem.Name
+	checkCopy.Annotations[compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation] = string(state)
+	checkCopy.Annotations[compv1alpha1.ComplianceCheckResultLastRemediationTimeAnnotation] = metav1.Now().UTC().Format(time.RFC3339)
+	// The new outcome is yet to be confirmed by a scan
+	delete(checkCopy.Annotations, compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation)
+	return r.Client.Patch(context.TODO(), checkCopy, client.MergeFrom(check))
 }
 
 func (r *ReconcileComplianceRemediation) verifyAndCompleteMC(obj *unstructured.Unstructured, rem *compv1alpha1.ComplianceRemediation) error {
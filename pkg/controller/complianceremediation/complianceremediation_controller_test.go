@@ -3,6 +3,7 @@ package complianceremediation
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/ComplianceAsCode/compliance-operator/pkg/apis"
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
@@ -781,4 +782,197 @@ var _ = Describe("Testing complianceremediation controller", func() {
 			})
 		})
 	})
+
+	Context("recording the remediation on its check", func() {
+		var check *compv1alpha1.ComplianceCheckResult
+
+		getCheckAnnotations := func() map[string]string {
+			found := &compv1alpha1.ComplianceCheckResult{}
+			err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: check.Name}, found)
+			Expect(err).NotTo(HaveOccurred())
+			return found.GetAnnotations()
+		}
+
+		BeforeEach(func() {
+			check = &compv1alpha1.ComplianceCheckResult{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "testCheck",
+					Annotations: map[string]string{
+						compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation: "2022-10-25T10:00:00Z",
+					},
+				},
+			}
+			err := reconciler.Client.Create(context.TODO(), check)
+			Expect(err).NotTo(HaveOccurred())
+			isController := true
+			remediationinstance.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: compv1alpha1.SchemeGroupVersion.String(),
+				Kind:       "ComplianceCheckResult",
+				Name:       check.Name,
+				Controller: &isController,
+			}}
+			remediationinstance.Spec.Apply = true
+			remediationinstance.Status.ApplicationState = compv1alpha1.RemediationApplied
+		})
+
+		It("should record the applied remediation", func() {
+			err := reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			annotations := getCheckAnnotations()
+			Expect(annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationAnnotation, "testRem"))
+			Expect(annotations).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation,
+				string(compv1alpha1.RemediationApplied)))
+			Expect(annotations).To(HaveKey(compv1alpha1.ComplianceCheckResultLastRemediationTimeAnnotation))
+			Expect(annotations).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultRemediationVerifiedAnnotation))
+		})
+
+		It("should record the remediation that failed to apply", func() {
+			remediationinstance.Status.ApplicationState = compv1alpha1.RemediationError
+			err := reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			Expect(getCheckAnnotations()).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation,
+				string(compv1alpha1.RemediationError)))
+		})
+
+		It("should only record un-applying the last applied remediation", func() {
+			remediationinstance.Spec.Apply = false
+			remediationinstance.Status.ApplicationState = compv1alpha1.RemediationNotApplied
+			err := reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			Expect(getCheckAnnotations()).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultLastRemediationAnnotation))
+
+			remediationinstance.Spec.Apply = true
+			remediationinstance.Status.ApplicationState = compv1alpha1.RemediationApplied
+			err = reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			remediationinstance.Spec.Apply = false
+			remediationinstance.Status.ApplicationState = compv1alpha1.RemediationNotApplied
+			err = reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			Expect(getCheckAnnotations()).To(HaveKeyWithValue(compv1alpha1.ComplianceCheckResultLastRemediationStateAnnotation,
+				string(compv1alpha1.RemediationNotApplied)))
+		})
+
+		It("should not record the remediations that aren't owned by a check", func() {
+			remediationinstance.OwnerReferences = nil
+			err := reconciler.recordRemediationOnCheck(remediationinstance, logger)
+			Expect(err).To(BeNil())
+			Expect(getCheckAnnotations()).ToNot(HaveKey(compv1alpha1.ComplianceCheckResultLastRemediationAnnotation))
+		})
+	})
+
+	Context("timing the application of remediations", func() {
+		requestedAt := metav1.NewTime(time.Date(2022, 10, 25, 10, 0, 0, 0, time.UTC))
+
+		remediationIn := func(state compv1alpha1.RemediationApplicationState, apply bool) *compv1alpha1.ComplianceRemediation {
+			rem := remediationinstance.DeepCopy()
+			rem.Spec.Apply = apply
+			rem.Status.ApplicationState = state
+			return rem
+		}
+
+		It("should time a manually applied remediation from when applying it was requested", func() {
+			rem := remediationIn(compv1alpha1.RemediationApplied, true)
+			markApplyRequested(rem, compv1alpha1.RemediationNotApplied, requestedAt)
+			Expect(rem.Status.ApplyRequestedTime).To(Equal(&requestedAt))
+
+			// Applying an outdated remediation is requested again
+			rem = remediationIn(compv1alpha1.RemediationOutdated, true)
+			markApplyRequested(rem, compv1alpha1.RemediationApplied, requestedAt)
+			Expect(rem.Status.ApplyRequestedTime).To(Equal(&requestedAt))
+		})
+
+		It("should keep the time applying the remediation was first requested", func() {
+			rem := remediationIn(compv1alpha1.RemediationError, true)
+			rem.Status.ApplyRequestedTime = requestedAt.DeepCopy()
+			markApplyRequested(rem, compv1alpha1.RemediationPending, metav1.NewTime(requestedAt.Add(time.Hour)))
+			Expect(rem.Status.ApplyRequestedTime).To(Equal(&requestedAt))
+		})
+
+		It("should only time the remediations applying is requested for", func() {
+			rem := remediationIn(compv1alpha1.RemediationApplied, true)
+			markApplyRequested(rem, compv1alpha1.RemediationApplied, requestedAt)
+			Expect(rem.Status.ApplyRequestedTime).To(BeNil())
+
+			rem = remediationIn(compv1alpha1.RemediationNotApplied, false)
+			rem.Status.ApplyRequestedTime = requestedAt.DeepCopy()
+			markApplyRequested(rem, compv1alpha1.RemediationPending, requestedAt)
+			Expect(rem.Status.ApplyRequestedTime).To(BeNil())
+		})
+
+		Context("reconciling the status", func() {
+			getRemediation := func() *compv1alpha1.ComplianceRemediation {
+				found := &compv1alpha1.ComplianceRemediation{}
+				err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: remediationinstance.Name}, found)
+				Expect(err).To(BeNil())
+				return found
+			}
+
+			BeforeEach(func() {
+				remediationinstance.Annotations = nil
+				remediationinstance.Spec.Apply = true
+				remediationinstance.Status.ApplicationState = compv1alpha1.RemediationNotApplied
+				err := reconciler.Client.Update(context.TODO(), remediationinstance)
+				Expect(err).To(BeNil())
+			})
+
+			It("should stop timing the remediations once they're applied", func() {
+				cm := &corev1.ConfigMap{
+					TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+					ObjectMeta: metav1.ObjectMeta{Name: "my-cm", Namespace: "test-ns"},
+				}
+				unstructuredCM, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cm)
+				Expect(err).ToNot(HaveOccurred())
+				remediationinstance.Spec.Current.Object = &unstructured.Unstructured{Object: unstructuredCM}
+
+				rollingOut, err := reconciler.reconcileRemediationStatus(remediationinstance, logger, nil)
+				Expect(err).To(BeNil())
+				Expect(rollingOut).To(BeFalse())
+				status := getRemediation().Status
+				Expect(status.ApplicationState).To(Equal(compv1alpha1.RemediationApplied))
+				Expect(status.ApplyRequestedTime).To(BeNil())
+			})
+
+			It("should time the MachineConfig remediations until their pool has rolled them out", func() {
+				mc := &mcfgv1.MachineConfig{
+					TypeMeta: metav1.TypeMeta{Kind: "MachineConfig", APIVersion: mcfgapi.GroupName + "/v1"},
+					Spec:     mcfgv1.MachineConfigSpec{FIPS: true},
+				}
+				unstructuredMC, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mc)
+				Expect(err).ToNot(HaveOccurred())
+				remediationinstance.Spec.Current.Object = &unstructured.Unstructured{Object: unstructuredMC}
+				remediationinstance.Status.ApplyRequestedTime = requestedAt.DeepCopy()
+
+				By("waiting for the pool to render the remediation")
+				rollingOut, err := reconciler.reconcileRemediationStatus(remediationinstance, logger, nil)
+				Expect(err).To(BeNil())
+				Expect(rollingOut).To(BeTrue())
+				rem := getRemediation()
+				Expect(rem.Status.ApplicationState).To(Equal(compv1alpha1.RemediationApplied))
+				Expect(rem.Status.ApplyRequestedTime.Time).To(BeTemporally("==", requestedAt.Time))
+
+				By("waiting for the nodes of the pool to be updated")
+				mcp.Status.Configuration.Source = append(mcp.Spec.Configuration.Source,
+					corev1.ObjectReference{Kind: "MachineConfig", Name: remediationinstance.GetMcName()})
+				mcp.Status.MachineCount = 3
+				mcp.Status.UpdatedMachineCount = 2
+				err = reconciler.Client.Status().Update(context.TODO(), mcp)
+				Expect(err).To(BeNil())
+				rollingOut, err = reconciler.reconcileRemediationStatus(rem, logger, nil)
+				Expect(err).To(BeNil())
+				Expect(rollingOut).To(BeTrue())
+				rem = getRemediation()
+				Expect(rem.Status.ApplyRequestedTime).ToNot(BeNil())
+
+				By("the pool having rolled out the remediation")
+				mcp.Status.UpdatedMachineCount = 3
+				err = reconciler.Client.Status().Update(context.TODO(), mcp)
+				Expect(err).To(BeNil())
+				rollingOut, err = reconciler.reconcileRemediationStatus(rem, logger, nil)
+				Expect(err).To(BeNil())
+				Expect(rollingOut).To(BeFalse())
+				Expect(getRemediation().Status.ApplyRequestedTime).To(BeNil())
+			})
+		})
+	})
 })
@@ -29,6 +29,19 @@ func (r *ReconcileComplianceScan) newAggregatorPod(scanInstance *compv1alpha1.Co
 		"workload":                       "aggregator",
 	}
 
+	aggregatorCmd := []string{
+		"compliance-operator", "aggregator",
+		"--content=" + absContentPath(scanInstance.Spec.Content),
+		"--scan=" + scanInstance.Name,
+		"--namespace=" + scanInstance.Namespace,
+	}
+	if scanInstance.PrintsNDJSONResults() {
+		aggregatorCmd = append(aggregatorCmd, "--ndjson")
+	}
+	if concurrency := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanAggregatorConcurrencyAnnotation]; concurrency != "" {
+		aggregatorCmd = append(aggregatorCmd, "--concurrency="+concurrency)
+	}
+
 	falseP := false
 	trueP := true
 
@@ -76,14 +89,9 @@ func (r *ReconcileComplianceScan) newAggregatorPod(scanInstance *compv1alpha1.Co
 			},
 			Containers: []corev1.Container{
 				{
-					Name:  "aggregator",
-					Image: utils.GetComponentImage(utils.OPERATOR),
-					Command: []string{
-						"compliance-operator", "aggregator",
-						"--content=" + absContentPath(scanInstance.Spec.Content),
-						"--scan=" + scanInstance.Name,
-						"--namespace=" + scanInstance.Namespace,
-					},
+					Name:    "aggregator",
+					Image:   utils.GetComponentImage(utils.OPERATOR),
+					Command: aggregatorCmd,
 					SecurityContext: &corev1.SecurityContext{
 						AllowPrivilegeEscalation: &falseP,
 						ReadOnlyRootFilesystem:   &trueP,
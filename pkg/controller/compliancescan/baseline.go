@@ -0,0 +1,128 @@
+package compliancescan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+	"github.com/ComplianceAsCode/compliance-operator/pkg/utils"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The key of the baseline ConfigMap holding the check statuses
+	baselineStatusesKey = "statuses"
+	// How many drifted checks an event names
+	maxListedDriftedChecks = 5
+)
+
+func getBaselineCMName(scanName string) string {
+	return utils.DNSLengthName("baseline-", "baseline-%s", scanName)
+}
+
+// compareWithBaseline compares the statuses of the check results of the scan
+// with those of its baseline, and reports the checks that started failing or
+// passing since as events and metrics. The first results of the scan become
+// its baseline, which is kept until the baseline ConfigMap is deleted.
+func (r *ReconcileComplianceScan) compareWithBaseline(scan *compv1alpha1.ComplianceScan, logger logr.Logger) error {
+	checks := &compv1alpha1.ComplianceCheckResultList{}
+	err := r.Client.List(context.TODO(), checks, client.InNamespace(scan.Namespace),
+		client.MatchingLabels{compv1alpha1.ComplianceScanLabel: scan.Name})
+	if err != nil {
+		return err
+	}
+	current := make(map[string]compv1alpha1.ComplianceCheckStatus, len(checks.Items))
+	for i := range checks.Items {
+		current[checks.Items[i].Name] = checks.Items[i].Status
+	}
+
+	baselineCM := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: getBaselineCMName(scan.Name), Namespace: scan.Namespace}
+	err = r.Client.Get(context.TODO(), key, baselineCM)
+	if errors.IsNotFound(err) {
+		logger.Info("Saving the check results as the baseline", "ConfigMap.Name", key.Name)
+		return r.createBaseline(scan, key, current)
+	} else if err != nil {
+		return err
+	}
+
+	baseline := map[string]compv1alpha1.ComplianceCheckStatus{}
+	if err := json.Unmarshal([]byte(baselineCM.Data[baselineStatusesKey]), &baseline); err != nil {
+		return fmt.Errorf("couldn't parse the baseline %s: %w", key, err)
+	}
+	failing, passing := driftedChecks(baseline, current)
+	r.Metrics.SetComplianceScanDriftedChecks(scan.Name, len(failing), len(passing))
+	if r.Recorder == nil {
+		return nil
+	}
+	if len(failing) > 0 {
+		r.Recorder.Eventf(
+			scan, corev1.EventTypeWarning, "ChecksStartedFailing",
+			"%d checks fail that passed in the baseline: %s", len(failing), listDriftedChecks(failing))
+	}
+	if len(passing) > 0 {
+		r.Recorder.Eventf(
+			scan, corev1.EventTypeNormal, "ChecksStartedPassing",
+			"%d checks pass that failed in the baseline: %s", len(passing), listDriftedChecks(passing))
+	}
+	return nil
+}
+
+func (r *ReconcileComplianceScan) createBaseline(scan *compv1alpha1.ComplianceScan, key types.NamespacedName,
+	statuses map[string]compv1alpha1.ComplianceCheckStatus) error {
+	encoded, err := json.Marshal(statuses)
+	if err != nil {
+		return err
+	}
+	// Not labeled with the scan, since the ConfigMaps labeled with it are
+	// deleted before each rescan
+	baselineCM := &corev1.ConfigMap{
+		Data: map[string]string{baselineStatusesKey: string(encoded)},
+	}
+	baselineCM.SetName(key.Name)
+	baselineCM.SetNamespace(key.Namespace)
+	r.Metrics.SetComplianceScanDriftedChecks(scan.Name, 0, 0)
+	return r.Client.Create(context.TODO(), baselineCM)
+}
+
+func (r *ReconcileComplianceScan) deleteBaselineForScan(instance *compv1alpha1.ComplianceScan) error {
+	baselineCM := &corev1.ConfigMap{}
+	baselineCM.SetName(getBaselineCMName(instance.Name))
+	baselineCM.SetNamespace(instance.Namespace)
+	if err := r.Client.Delete(context.TODO(), baselineCM); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// driftedChecks returns the sorted names of the checks that passed in the
+// baseline and fail now, and of those that failed and pass now. The checks
+// that aren't in the baseline are left out.
+func driftedChecks(baseline, current map[string]compv1alpha1.ComplianceCheckStatus) (failing, passing []string) {
+	for name, status := range current {
+		switch {
+		case baseline[name] == compv1alpha1.CheckResultPass && status == compv1alpha1.CheckResultFail:
+			failing = append(failing, name)
+		case baseline[name] == compv1alpha1.CheckResultFail && status == compv1alpha1.CheckResultPass:
+			passing = append(passing, name)
+		}
+	}
+	sort.Strings(failing)
+	sort.Strings(passing)
+	return failing, passing
+}
+
+func listDriftedChecks(names []string) string {
+	if len(names) <= maxListedDriftedChecks {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedDriftedChecks], ", "),
+		len(names)-maxListedDriftedChecks)
+}
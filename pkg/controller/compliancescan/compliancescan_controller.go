@@ -165,6 +165,13 @@ func (r *ReconcileComplianceScan) Reconcile(ctx context.Context, request reconci
 		return r.scanDeleteHandler(instance, reqLogger)
 	}
 
+	if tick, ok := instance.GetRerunnerLastTick(); ok && instance.Labels[compv1alpha1.SuiteLabel] != "" {
+		r.Metrics.SetRerunnerLastTick(instance.Labels[compv1alpha1.SuiteLabel], tick)
+	}
+	if count, ok := instance.GetUndefinedRules(); ok {
+		r.Metrics.SetComplianceScanUndefinedRules(instance.Name, count)
+	}
+
 	// At this point, we make a copy of the instance, so we can modify it in the functions below.
 	scanToBeUpdated := instance.DeepCopy()
 	if cont, err := r.validate(instance, reqLogger); !cont || err != nil {
@@ -186,6 +193,12 @@ func (r *ReconcileComplianceScan) Reconcile(ctx context.Context, request reconci
 		return reconcile.Result{Requeue: true, RequeueAfter: requeueAfterDefault}, nil
 	}
 
+	// A rescan request takes precedence, the Pending phase will clear both annotations
+	if scanToBeUpdated.IsCancelled() && !scanToBeUpdated.NeedsRescan() &&
+		scanToBeUpdated.Status.Phase != compv1alpha1.PhaseDone {
+		return r.scanCancelHandler(scanTypeHandler, scanToBeUpdated, reqLogger)
+	}
+
 	switch scanToBeUpdated.Status.Phase {
 	case compv1alpha1.PhasePending:
 		return r.phasePendingHandler(scanToBeUpdated, reqLogger)
@@ -244,6 +257,24 @@ func (r *ReconcileComplianceScan) validate(instance *compv1alpha1.ComplianceScan
 		return false, nil
 	}
 
+	// validate the user the scan impersonates, if any, before it's launched
+	if user, allowed := instance.ImpersonatedUser(); !allowed && instance.Status.Phase == compv1alpha1.PhasePending {
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, "ImpersonationNotAllowed",
+			"The scan isn't allowed to impersonate %s", user)
+		instanceCopy := instance.DeepCopy()
+		instanceCopy.Status.Result = compv1alpha1.ResultError
+		instanceCopy.Status.ErrorMessage = fmt.Sprintf(
+			"User '%s' is not in the scan's allowedImpersonatedUsers", user)
+		instanceCopy.Status.Phase = compv1alpha1.PhaseDone
+		instanceCopy.Status.SetConditionInvalid()
+		updateErr := r.Client.Status().Update(context.TODO(), instanceCopy)
+		if updateErr != nil {
+			return false, updateErr
+		}
+		r.Metrics.IncComplianceScanStatus(instanceCopy.Name, instanceCopy.Status)
+		return false, nil
+	}
+
 	// Set default storage if missing
 	if instance.Spec.RawResultStorage.Size == "" {
 		instanceCopy := instance.DeepCopy()
@@ -284,6 +315,8 @@ func (r *ReconcileComplianceScan) phasePendingHandler(instance *compv1alpha1.Com
 	if instance.NeedsRescan() {
 		instanceCopy := instance.DeepCopy()
 		delete(instanceCopy.Annotations, compv1alpha1.ComplianceScanRescanAnnotation)
+		// Re-running the scan also clears a previous cancellation
+		delete(instanceCopy.Annotations, compv1alpha1.ComplianceScanCancelAnnotation)
 		err := r.Client.Update(context.TODO(), instanceCopy)
 		return reconcile.Result{}, err
 	}
@@ -291,6 +324,9 @@ func (r *ReconcileComplianceScan) phasePendingHandler(instance *compv1alpha1.Com
 	// Update the scan instance, the next phase is running
 	instance.Status.Phase = compv1alpha1.PhaseLaunching
 	instance.Status.Result = compv1alpha1.ResultNotAvailable
+	// The digests are recorded again once the content is loaded
+	instance.Status.ContentDigest = ""
+	instance.Status.TailoringDigest = ""
 	err := r.Client.Status().Update(context.TODO(), instance)
 	if err != nil {
 		logger.Error(err, "Cannot update the status")
@@ -423,6 +459,15 @@ func (r *ReconcileComplianceScan) phaseAggregatingHandler(h scanTypeHandler, log
 			return reconcile.Result{}, err
 		}
 		r.Metrics.IncComplianceScanStatus(instance.Name, instance.Status)
+		if counts, ok := instance.GetFilterErrors(); ok {
+			r.Metrics.AddFilterErrors(counts)
+		}
+		if d, ok := instance.GetFetchDuration(); ok {
+			r.Metrics.ObserveScanFetchDuration(instance.Name, d)
+		}
+		if count, ok := instance.GetDeduplicatedUploads(); ok {
+			r.Metrics.AddDeduplicatedUploads(instance.Name, count)
+		}
 		return reconcile.Result{}, nil
 	}
 
@@ -482,6 +527,25 @@ func (r *ReconcileComplianceScan) phaseAggregatingHandler(h scanTypeHandler, log
 		return reconcile.Result{}, err
 	}
 	r.Metrics.IncComplianceScanStatus(instance.Name, instance.Status)
+	// Counted once the scan is done, so they're added once per run
+	if counts, ok := instance.GetFilterErrors(); ok {
+		r.Metrics.AddFilterErrors(counts)
+	}
+	if d, ok := instance.GetFetchDuration(); ok {
+		r.Metrics.ObserveScanFetchDuration(instance.Name, d)
+	}
+	if count, ok := instance.GetDeduplicatedUploads(); ok {
+		r.Metrics.AddDeduplicatedUploads(instance.Name, count)
+	}
+	if instance.Status.CheckCounts != nil {
+		r.Metrics.SetComplianceScanCheckCounts(instance.Name, *instance.Status.CheckCounts)
+	}
+	if instance.ComparesWithBaseline() {
+		// Not being able to compare the results shouldn't fail the scan
+		if err := r.compareWithBaseline(instance, logger); err != nil {
+			logger.Error(err, "Cannot compare the check results with the baseline")
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
@@ -573,6 +637,37 @@ func (r *ReconcileComplianceScan) phaseDoneHandler(h scanTypeHandler, instance *
 	return reconcile.Result{}, nil
 }
 
+// scanCancelHandler stops a scan that was annotated for cancellation. The scan
+// pods and the aggregator are removed right away and the scan is moved to the
+// Done phase with a CANCELLED result, the remaining resources are cleaned up
+// by the Done phase handler as usual.
+func (r *ReconcileComplianceScan) scanCancelHandler(h scanTypeHandler, instance *compv1alpha1.ComplianceScan, logger logr.Logger) (reconcile.Result, error) {
+	logger.Info("The scan was cancelled", "Phase", instance.Status.Phase)
+
+	if h != nil {
+		if err := h.cleanup(); err != nil {
+			logger.Error(err, "Cannot clean up scan pods")
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.deleteAggregator(instance, logger); err != nil {
+		logger.Error(err, "Cannot delete aggregator")
+		return reconcile.Result{}, err
+	}
+
+	instance.Status.Phase = compv1alpha1.PhaseDone
+	instance.Status.Result = compv1alpha1.ResultCancelled
+	instance.Status.ErrorMessage = "The scan was cancelled before it finished"
+	instance.Status.SetConditionCancelled()
+	if err := r.updateStatusWithEvent(instance, logger); err != nil {
+		logger.Error(err, "Cannot update the status")
+		return reconcile.Result{}, err
+	}
+	r.Metrics.IncComplianceScanStatus(instance.Name, instance.Status)
+	return reconcile.Result{}, nil
+}
+
 func (r *ReconcileComplianceScan) scanDeleteHandler(instance *compv1alpha1.ComplianceScan, logger logr.Logger) (reconcile.Result, error) {
 	if common.ContainsFinalizer(instance.ObjectMeta.Finalizers, compv1alpha1.ScanFinalizer) {
 		logger.Info("The scan is being deleted")
@@ -605,11 +700,23 @@ func (r *ReconcileComplianceScan) scanDeleteHandler(instance *compv1alpha1.Compl
 			return reconcile.Result{}, err
 		}
 
+		if err := r.deleteBaselineForScan(scanToBeDeleted); err != nil {
+			logger.Error(err, "Cannot delete the baseline")
+			return reconcile.Result{}, err
+		}
+
+		remediations, err := r.remediationNamesForScan(scanToBeDeleted)
+		if err != nil {
+			logger.Error(err, "Cannot list the remediations")
+			return reconcile.Result{}, err
+		}
+
 		// remove our finalizer from the list and update it.
 		scanToBeDeleted.ObjectMeta.Finalizers = common.RemoveFinalizer(scanToBeDeleted.ObjectMeta.Finalizers, compv1alpha1.ScanFinalizer)
 		if err := r.Client.Update(context.TODO(), scanToBeDeleted); err != nil {
 			return reconcile.Result{}, err
 		}
+		r.Metrics.ResetForScan(scanToBeDeleted.Name, remediations...)
 	}
 
 	// Stop reconciliation as the item is being deleted
@@ -672,6 +779,21 @@ func (r *ReconcileComplianceScan) deleteScriptConfigMaps(instance *compv1alpha1.
 	return nil
 }
 
+// remediationNamesForScan returns the names of the remediations the scan
+// produced
+func (r *ReconcileComplianceScan) remediationNamesForScan(instance *compv1alpha1.ComplianceScan) ([]string, error) {
+	remList := &compv1alpha1.ComplianceRemediationList{}
+	withLabel := client.MatchingLabels{compv1alpha1.ComplianceScanLabel: instance.Name}
+	if err := r.Client.List(context.TODO(), remList, client.InNamespace(instance.Namespace), withLabel); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(remList.Items))
+	for _, rem := range remList.Items {
+		names = append(names, rem.Name)
+	}
+	return names, nil
+}
+
 func (r *ReconcileComplianceScan) deleteResultConfigMaps(instance *compv1alpha1.ComplianceScan, logger logr.Logger) error {
 	inNs := client.InNamespace(common.GetComplianceOperatorNamespace())
 	withLabel := client.MatchingLabels{compv1alpha1.ComplianceScanLabel: instance.Name}
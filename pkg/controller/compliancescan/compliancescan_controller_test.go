@@ -1,8 +1,14 @@
 package compliancescan
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 
 	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/metrics"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/controller/metrics/metricsfakes"
@@ -17,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
@@ -178,6 +185,46 @@ var _ = Describe("Testing compliancescan controller phases", func() {
 				Expect(scan.Status.Result).To(Equal(compv1alpha1.ResultError))
 			})
 		})
+
+		Context("With a user to impersonate", func() {
+			var recorder *record.FakeRecorder
+
+			BeforeEach(func() {
+				recorder = record.NewFakeRecorder(10)
+				reconciler.Recorder = recorder
+				compliancescaninstance.Status.Phase = compv1alpha1.PhasePending
+				compliancescaninstance.Annotations = map[string]string{
+					compv1alpha1.ComplianceScanImpersonateUserAnnotation: "system:serviceaccount:team-a:viewer",
+				}
+			})
+
+			It("continues if the user is allowed", func() {
+				compliancescaninstance.Spec.AllowedImpersonatedUsers = []string{"system:serviceaccount:team-a:viewer"}
+				cont, err := reconciler.validate(compliancescaninstance, logger)
+				Expect(err).To(BeNil())
+				Expect(cont).To(BeTrue())
+				Expect(recorder.Events).To(BeEmpty())
+			})
+
+			It("reports an error and moves to phase DONE if the user isn't allowed", func() {
+				compliancescaninstance.Spec.AllowedImpersonatedUsers = []string{"system:serviceaccount:team-b:viewer"}
+				cont, err := reconciler.validate(compliancescaninstance, logger)
+				Expect(cont).To(BeFalse())
+				Expect(err).To(BeNil())
+
+				scan := &compv1alpha1.ComplianceScan{}
+				key := types.NamespacedName{
+					Name:      compliancescaninstance.Name,
+					Namespace: compliancescaninstance.Namespace,
+				}
+				err = reconciler.Client.Get(context.TODO(), key, scan)
+				Expect(err).To(BeNil())
+				Expect(scan.Status.Phase).To(Equal(compv1alpha1.PhaseDone))
+				Expect(scan.Status.Result).To(Equal(compv1alpha1.ResultError))
+				Expect(scan.Status.ErrorMessage).To(ContainSubstring("system:serviceaccount:team-a:viewer"))
+				Expect(recorder.Events).To(Receive(ContainSubstring("ImpersonationNotAllowed")))
+			})
+		})
 	})
 	Context("On the PENDING phase", func() {
 		It("should update the compliancescan instance to phase LAUNCHING", func() {
@@ -333,6 +380,166 @@ var _ = Describe("Testing compliancescan controller phases", func() {
 		})
 	})
 
+	Context("When the scan is cancelled", func() {
+		BeforeEach(func() {
+			createFakeScanPods(reconciler, compliancescaninstance.Name, nodeinstance1.Name, nodeinstance2.Name)
+
+			compliancescaninstance.Annotations = map[string]string{
+				compv1alpha1.ComplianceScanCancelAnnotation: "",
+			}
+			err := reconciler.Client.Update(context.TODO(), compliancescaninstance)
+			Expect(err).To(BeNil())
+
+			// Set state to RUNNING
+			compliancescaninstance.Status.Phase = compv1alpha1.PhaseRunning
+			err = reconciler.Client.Status().Update(context.TODO(), compliancescaninstance)
+			Expect(err).To(BeNil())
+		})
+
+		It("should delete the scan pods and move to DONE with a CANCELLED result", func() {
+			Expect(compliancescaninstance.IsCancelled()).To(BeTrue())
+			result, err := reconciler.scanCancelHandler(handler, compliancescaninstance, logger)
+			Expect(err).To(BeNil())
+			Expect(result).ToNot(BeNil())
+			Expect(compliancescaninstance.Status.Phase).To(Equal(compv1alpha1.PhaseDone))
+			Expect(compliancescaninstance.Status.Result).To(Equal(compv1alpha1.ResultCancelled))
+			Expect(compliancescaninstance.Status.Conditions.GetCondition("Ready").Reason).To(
+				Equal(compv1alpha1.ConditionReason("Cancelled")))
+
+			var pods corev1.PodList
+			err = reconciler.Client.List(context.TODO(), &pods)
+			Expect(err).To(BeNil())
+			Expect(pods.Items).To(BeEmpty())
+		})
+	})
+
+	Context("When comparing with the baseline", func() {
+		var recorder *record.FakeRecorder
+
+		setCheckStatuses := func(statuses map[string]compv1alpha1.ComplianceCheckStatus) {
+			for name, status := range statuses {
+				check := &compv1alpha1.ComplianceCheckResult{}
+				err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, check)
+				if err == nil {
+					check.Status = status
+					Expect(reconciler.Client.Update(context.TODO(), check)).To(Succeed())
+					continue
+				}
+				check = &compv1alpha1.ComplianceCheckResult{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{compv1alpha1.ComplianceScanLabel: compliancescaninstance.Name},
+					},
+					Status: status,
+				}
+				Expect(reconciler.Client.Create(context.TODO(), check)).To(Succeed())
+			}
+		}
+
+		BeforeEach(func() {
+			scheme.Scheme.AddKnownTypes(compv1alpha1.SchemeGroupVersion,
+				&compv1alpha1.ComplianceCheckResult{}, &compv1alpha1.ComplianceCheckResultList{})
+			recorder = record.NewFakeRecorder(10)
+			reconciler.Recorder = recorder
+			setCheckStatuses(map[string]compv1alpha1.ComplianceCheckStatus{
+				"test-check-a": compv1alpha1.CheckResultPass,
+				"test-check-b": compv1alpha1.CheckResultFail,
+				"test-check-c": compv1alpha1.CheckResultPass,
+			})
+		})
+
+		It("saves the first results as the baseline", func() {
+			Expect(reconciler.compareWithBaseline(compliancescaninstance, logger)).To(Succeed())
+			baselineCM := &corev1.ConfigMap{}
+			key := types.NamespacedName{Name: getBaselineCMName(compliancescaninstance.Name)}
+			Expect(reconciler.Client.Get(context.TODO(), key, baselineCM)).To(Succeed())
+			Expect(baselineCM.Data[baselineStatusesKey]).To(MatchJSON(
+				`{"test-check-a":"PASS","test-check-b":"FAIL","test-check-c":"PASS"}`))
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("reports the checks that drifted from the baseline", func() {
+			Expect(reconciler.compareWithBaseline(compliancescaninstance, logger)).To(Succeed())
+			setCheckStatuses(map[string]compv1alpha1.ComplianceCheckStatus{
+				"test-check-a": compv1alpha1.CheckResultFail,
+				"test-check-b": compv1alpha1.CheckResultPass,
+				"test-check-d": compv1alpha1.CheckResultFail,
+			})
+			Expect(reconciler.compareWithBaseline(compliancescaninstance, logger)).To(Succeed())
+			Expect(<-recorder.Events).To(Equal("Warning ChecksStartedFailing 1 checks fail that passed in the baseline: test-check-a"))
+			Expect(<-recorder.Events).To(Equal("Normal ChecksStartedPassing 1 checks pass that failed in the baseline: test-check-b"))
+			Expect(recorder.Events).To(BeEmpty())
+
+			Expect(reconciler.deleteBaselineForScan(compliancescaninstance)).To(Succeed())
+			var cms corev1.ConfigMapList
+			Expect(reconciler.Client.List(context.TODO(), &cms)).To(Succeed())
+			Expect(cms.Items).To(BeEmpty())
+		})
+
+		It("lists the first drifted checks only", func() {
+			Expect(listDriftedChecks([]string{"a", "b"})).To(Equal("a, b"))
+			Expect(listDriftedChecks([]string{"a", "b", "c", "d", "e", "f", "g"})).To(Equal("a, b, c, d, e and 2 more"))
+		})
+	})
+
+	Context("When rescanning a subset of the nodes", func() {
+		BeforeEach(func() {
+			reconciler.Recorder = record.NewFakeRecorder(10)
+		})
+
+		It("should only target the selected nodes", func() {
+			compliancescaninstance.Annotations = map[string]string{
+				compv1alpha1.ComplianceScanRescanNodesAnnotation: "node-2, node-3",
+			}
+			h, err := getScanTypeHandler(&reconciler, compliancescaninstance, logger)
+			Expect(err).To(BeNil())
+			nh := h.(*nodeScanTypeHandler)
+			Expect(nh.nodes).To(HaveLen(1))
+			Expect(nh.nodes[0].Name).To(Equal("node-2"))
+		})
+
+		It("should narrow the nodes down with the selector", func() {
+			compliancescaninstance.Annotations = map[string]string{
+				compv1alpha1.ComplianceScanRescanNodeSelectorAnnotation: "kubernetes.io/os=linux",
+			}
+			h, err := getScanTypeHandler(&reconciler, compliancescaninstance, logger)
+			Expect(err).To(BeNil())
+			Expect(h.(*nodeScanTypeHandler).nodes).To(HaveLen(2))
+
+			compliancescaninstance.Annotations[compv1alpha1.ComplianceScanRescanNodeSelectorAnnotation] = "kubernetes.io/os!=linux"
+			h, err = getScanTypeHandler(&reconciler, compliancescaninstance, logger)
+			Expect(err).To(BeNil())
+			Expect(h.(*nodeScanTypeHandler).nodes).To(BeEmpty())
+		})
+
+		It("should skip the rescan if none of the scan's nodes were selected", func() {
+			compliancescaninstance.Annotations = map[string]string{
+				compv1alpha1.ComplianceScanRescanAnnotation:      "",
+				compv1alpha1.ComplianceScanRescanNodesAnnotation: "node-3",
+			}
+			err := reconciler.Client.Update(context.TODO(), compliancescaninstance)
+			Expect(err).To(BeNil())
+			compliancescaninstance.Status.Phase = compv1alpha1.PhaseDone
+			compliancescaninstance.Status.Result = compv1alpha1.ResultCompliant
+			err = reconciler.Client.Status().Update(context.TODO(), compliancescaninstance)
+			Expect(err).To(BeNil())
+
+			h, err := getScanTypeHandler(&reconciler, compliancescaninstance, logger)
+			Expect(err).To(BeNil())
+			cont, err := h.validate()
+			Expect(err).To(BeNil())
+			Expect(cont).To(BeFalse())
+
+			scan := &compv1alpha1.ComplianceScan{}
+			key := types.NamespacedName{Name: compliancescaninstance.Name, Namespace: compliancescaninstance.Namespace}
+			err = reconciler.Client.Get(context.TODO(), key, scan)
+			Expect(err).To(BeNil())
+			Expect(scan.NeedsRescan()).To(BeFalse())
+			Expect(scan.RescansNodeSubset()).To(BeFalse())
+			Expect(scan.Status.Result).To(Equal(compv1alpha1.ResultCompliant))
+		})
+	})
+
 	Context("On the DONE phase", func() {
 		Context("with delete flag off", func() {
 			BeforeEach(func() {
@@ -449,3 +656,83 @@ var _ = Describe("Testing compliancescan controller phases", func() {
 		})
 	})
 })
+
+var _ = Describe("Running the scanner of a platform scan", func() {
+	var workDir string
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "scanner")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(workDir)
+	})
+
+	It("Evaluates the resources the collector saved gzipped", func() {
+		resourceDir := filepath.Join(workDir, "resources")
+		reportDir := filepath.Join(workDir, "reports")
+		binDir := filepath.Join(workDir, "bin")
+		for _, dir := range []string{resourceDir + "/api/v1/namespaces/a/configmaps", reportDir, binDir} {
+			Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+		}
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		_, err := zw.Write([]byte(`{"items":[]}`))
+		Expect(err).To(BeNil())
+		Expect(zw.Close()).To(Succeed())
+		Expect(ioutil.WriteFile(resourceDir+"/api/v1/nodes.gz", compressed.Bytes(), 0600)).To(Succeed())
+		placeholder := resourceDir + "/api/v1/namespaces/a/configmaps/absent"
+		Expect(ioutil.WriteFile(placeholder, []byte("# kube-api-error=NotFound"), 0600)).To(Succeed())
+
+		// Stands in for oscap, failing unless the nodes can be read
+		// decompressed and writing them as the ARF report
+		Expect(ioutil.WriteFile(filepath.Join(binDir, "oscap"), []byte(`#!/bin/sh
+if [ "$1" = "ds" ]; then
+	mkdir -p "$5" && echo "<report/>" > "$5/report.xml"
+	exit 0
+fi
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--results-arf" ]; then
+		arf="$2"
+	fi
+	shift
+done
+cat "$RESOURCE_DIR/api/v1/nodes" > "$arf"
+`), 0700)).To(Succeed())
+		script := filepath.Join(workDir, OpenScapScriptConfigMapName)
+		Expect(ioutil.WriteFile(script, []byte(defaultOpenScapScriptContents), 0700)).To(Succeed())
+
+		cmd := exec.Command("bash", script)
+		cmd.Env = append(os.Environ(),
+			"PATH="+binDir+":"+os.Getenv("PATH"),
+			OpenScapProfileEnvName+"=xccdf_org.ssgproject.content_profile_cis",
+			OpenScapContentEnvName+"=/content/ssg-ocp4-ds.xml",
+			OpenScapReportDirEnvName+"="+reportDir,
+			OpenScapResourceDirEnvName+"="+resourceDir,
+			DisconnectedInstallEnvName+"=true",
+		)
+		out, err := cmd.CombinedOutput()
+		Expect(err).To(BeNil(), string(out))
+
+		exitCode, err := ioutil.ReadFile(filepath.Join(reportDir, "exit_code"))
+		Expect(err).To(BeNil())
+		Expect(string(exitCode)).To(Equal("0\n"))
+		arf, err := ioutil.ReadFile(filepath.Join(reportDir, "report-arf.xml"))
+		Expect(err).To(BeNil())
+		Expect(string(arf)).To(Equal(`{"items":[]}`))
+		_, err = os.Stat(resourceDir + "/api/v1/nodes.gz")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		kept, err := ioutil.ReadFile(placeholder)
+		Expect(err).To(BeNil())
+		Expect(string(kept)).To(Equal("# kube-api-error=NotFound"))
+	})
+
+	It("Points the scanner to the collected resources", func() {
+		scan := &compv1alpha1.ComplianceScan{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+		cm := platformOpenScapEnvCm(envCmForPlatformScan(scan), scan)
+		Expect(cm.Data).To(HaveKeyWithValue(OpenScapResourceDirEnvName, PlatformScanDataRoot))
+		Expect(defaultOpenScapEnvCm(envCmForScan(scan), scan).Data).ToNot(HaveKey(OpenScapResourceDirEnvName))
+	})
+})
@@ -35,6 +35,7 @@ const (
 	OpenScapTailoringDirEnvName = "TAILORING_DIR"
 	HTTPSProxyEnvName           = "HTTPS_PROXY"
 	DisconnectedInstallEnvName  = "DISCONNECTED"
+	OpenScapResourceDirEnvName  = "RESOURCE_DIR"
 
 	ResultServerPort = int32(8443)
 
@@ -71,6 +72,15 @@ if [ -f "$REPORT_DIR/exit_code" ]; then
 	exit 0
 fi
 
+# The resource collector gzips the resources it saves when asked to, and
+# OpenSCAP can only read them decompressed
+if [ ! -z "$RESOURCE_DIR" ] && [ -d "$RESOURCE_DIR" ]; then
+	if ! find "$RESOURCE_DIR" -type f -name '*.gz' -exec gunzip -f {} +; then
+		echo "Couldn't decompress the resources in $RESOURCE_DIR"
+		exit 1
+	fi
+fi
+
 if [ -z $HOSTROOT ]; then
 	echo "HOSTROOT not set, using normal oscap"
 	cmd=(
@@ -272,9 +282,12 @@ func defaultOpenScapEnvCm(name string, scan *compv1alpha1.ComplianceScan) *corev
 	return cm
 }
 
-// Same as above but without hostroot.
+// Same as above but without hostroot, and with the directory holding the
+// resources the collector saved.
 func platformOpenScapEnvCm(name string, scan *compv1alpha1.ComplianceScan) *corev1.ConfigMap {
-	return commonOpenScapEnvCm(name, scan)
+	cm := commonOpenScapEnvCm(name, scan)
+	cm.Data[OpenScapResourceDirEnvName] = PlatformScanDataRoot
+	return cm
 }
 
 func scriptCmForScan(scan *compv1alpha1.ComplianceScan) string {
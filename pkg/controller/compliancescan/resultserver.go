@@ -208,6 +208,7 @@ func resultServer(scanInstance *compv1alpha1.ComplianceScan, labels map[string]s
 								"--address=0.0.0.0",
 								fmt.Sprintf("--port=%d", ResultServerPort),
 								fmt.Sprintf("--scan-index=%d", scanInstance.Status.CurrentIndex),
+								"--scan=" + scanInstance.Name,
 								fmt.Sprintf("--rotation=%d", scanInstance.Spec.RawResultStorage.Rotation),
 								"--tls-server-cert=/etc/pki/tls/tls.crt",
 								"--tls-server-key=/etc/pki/tls/tls.key",
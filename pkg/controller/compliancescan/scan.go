@@ -24,6 +24,9 @@ const (
 	apiResourceCollectorSA  = "api-resource-collector"
 	tailoringCMVolumeName   = "tailoring"
 	tailoringNotFoundPrefix = "Tailoring ConfigMap not found: "
+	// The archive the api-resource-collector bundles its warnings,
+	// manifest and timing data into
+	platformMetadataArchive = "/reports/collector-metadata.tar.gz"
 )
 
 func (r *ReconcileComplianceScan) launchScanPod(instance *compv1alpha1.ComplianceScan, pod *corev1.Pod, logger logr.Logger) error {
@@ -138,6 +141,8 @@ func newScanPodForNode(scanInstance *compv1alpha1.ComplianceScan, node *corev1.N
 						"--config-map-name=" + cmName,
 						"--node-name=" + node.Name,
 						"--owner=" + scanInstance.Name,
+						"--scan-uid=" + string(scanInstance.UID),
+						fmt.Sprintf("--scan-index=%d", scanInstance.Status.CurrentIndex),
 						"--namespace=" + scanInstance.Namespace,
 						"--resultserveruri=" + getResultServerURI(scanInstance),
 						"--tls-client-cert=/etc/pki/tls/tls.crt",
@@ -311,17 +316,133 @@ func (r *ReconcileComplianceScan) newPlatformScanPod(scanInstance *compv1alpha1.
 		"--resultdir=" + PlatformScanDataRoot,
 		"--profile=" + scanInstance.Spec.Profile,
 		"--warnings-output-file=/reports/warning_output",
+		"--metadata-archive=" + platformMetadataArchive,
+		"--scan=" + scanInstance.Name,
 	}
 	if scanInstance.Spec.TailoringConfigMap != nil {
 		// NOTE(jaosorior): Adding the tailoring volume is handled in the
 		// addTailoringVolume function
 		tailoringArg := fmt.Sprintf("--tailoring=%s/tailoring.xml", OpenScapTailoringDir)
 		collectorCmd = append(collectorCmd, tailoringArg)
+		if digest := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanExpectedTailoringDigestAnnotation]; digest != "" {
+			collectorCmd = append(collectorCmd, "--tailoring-digest="+digest)
+		}
+	}
+
+	if digest := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanExpectedContentDigestAnnotation]; digest != "" {
+		collectorCmd = append(collectorCmd, "--content-digest="+digest)
 	}
 
 	falseP := false
 	trueP := true
 
+	if scanInstance.SkipsKubeletConfig() {
+		collectorCmd = append(collectorCmd, "--skip-kubelet-config")
+	}
+
+	if scanInstance.KeepsNodeKubeletConfigs() {
+		collectorCmd = append(collectorCmd, "--keep-node-kubelet-configs")
+	}
+
+	if scanInstance.KeepsUnreadyNodes() {
+		collectorCmd = append(collectorCmd, "--keep-unready-nodes")
+	}
+
+	if scanInstance.RedactsConfigMapBinaryData() {
+		collectorCmd = append(collectorCmd, "--redact-configmap-binary-data")
+	}
+
+	if scanInstance.FetchesConsistentSnapshot() {
+		collectorCmd = append(collectorCmd, "--consistent-snapshot")
+	}
+
+	if scanInstance.PrefersProtobuf() {
+		collectorCmd = append(collectorCmd, "--prefer-protobuf")
+	}
+
+	if scanInstance.BatchesConfigFetch() {
+		collectorCmd = append(collectorCmd, "--batch-config-fetch")
+	}
+
+	if scanInstance.CompressesResources() {
+		collectorCmd = append(collectorCmd, "--compress-resources")
+	}
+
+	if scanInstance.WritesMachineConfigsToDisk() {
+		collectorCmd = append(collectorCmd, "--machine-configs-to-disk")
+	}
+
+	if scanInstance.FailsOnEmptyCollection() {
+		collectorCmd = append(collectorCmd, "--fail-on-empty")
+	}
+
+	if apiVersion := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanKubeletConfigAPIVersionAnnotation]; apiVersion != "" {
+		collectorCmd = append(collectorCmd, "--kubelet-config-api-version="+apiVersion)
+	}
+
+	if scheme := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanDumpPathSchemeAnnotation]; scheme != "" {
+		collectorCmd = append(collectorCmd, "--dump-path-scheme="+scheme)
+	}
+
+	if check := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanContentVersionCheckAnnotation]; check != "" {
+		collectorCmd = append(collectorCmd, "--content-version-check="+check)
+	}
+
+	if detection := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanVersionDetectionAnnotation]; detection != "" {
+		collectorCmd = append(collectorCmd, "--version-detection="+detection)
+	}
+
+	if concurrency := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanFetchConcurrencyAnnotation]; concurrency != "" {
+		collectorCmd = append(collectorCmd, "--fetch-concurrency="+concurrency)
+	}
+
+	if retries := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanFetchRetriesAnnotation]; retries != "" {
+		collectorCmd = append(collectorCmd, "--fetch-retries="+retries)
+	}
+
+	if delay := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanFetchRetryDelayAnnotation]; delay != "" {
+		collectorCmd = append(collectorCmd, "--fetch-retry-delay="+delay)
+	}
+
+	if pools := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanMachineConfigPoolsAnnotation]; pools != "" {
+		collectorCmd = append(collectorCmd, "--machine-config-pools="+pools)
+	}
+
+	if sections := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanMachineConfigSectionsAnnotation]; sections != "" {
+		collectorCmd = append(collectorCmd, "--machine-config-sections="+sections)
+	}
+
+	if skipped := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanSkipStagedResourcesAnnotation]; skipped != "" {
+		collectorCmd = append(collectorCmd, "--skip-staged="+skipped)
+	}
+
+	if coverage := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanMinKubeletNodeCoverageAnnotation]; coverage != "" {
+		collectorCmd = append(collectorCmd, "--min-kubelet-node-coverage="+coverage)
+	}
+
+	for _, role := range strings.Split(scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanNodeRolesAnnotation], ";") {
+		if role = strings.TrimSpace(role); role != "" {
+			collectorCmd = append(collectorCmd, "--node-role="+role)
+		}
+	}
+
+	if nodes := scanInstance.GetRescanNodes(); len(nodes) > 0 {
+		collectorCmd = append(collectorCmd, "--nodes="+strings.Join(nodes, ","))
+	}
+
+	if selector := scanInstance.GetRescanNodeSelector(); selector != "" {
+		collectorCmd = append(collectorCmd, "--nodes-matching="+selector)
+	}
+
+	// validate marks the scans that aren't allowed to impersonate their user as invalid
+	if user, allowed := scanInstance.ImpersonatedUser(); user != "" && allowed {
+		collectorCmd = append(collectorCmd, "--impersonate-user="+user)
+	}
+
+	if userAgent, ok := scanInstance.GetAnnotations()[compv1alpha1.ComplianceScanUserAgentAnnotation]; ok {
+		collectorCmd = append(collectorCmd, "--user-agent-scan="+userAgent)
+	}
+
 	if scanInstance.Spec.Debug {
 		collectorCmd = append(collectorCmd, "--debug")
 	}
@@ -424,8 +545,11 @@ func (r *ReconcileComplianceScan) newPlatformScanPod(scanInstance *compv1alpha1.
 						"--exit-code-file=/reports/exit_code",
 						"--oscap-output-file=/reports/cmd_output",
 						"--warnings-output-file=/reports/warning_output",
+						"--metadata-archive-file=" + platformMetadataArchive,
 						"--config-map-name=" + cmName,
 						"--owner=" + scanInstance.Name,
+						"--scan-uid=" + string(scanInstance.UID),
+						fmt.Sprintf("--scan-index=%d", scanInstance.Status.CurrentIndex),
 						"--namespace=" + scanInstance.Namespace,
 						"--resultserveruri=" + getResultServerURI(scanInstance),
 						"--tls-client-cert=/etc/pki/tls/tls.crt",
@@ -88,18 +88,58 @@ func (nh *nodeScanTypeHandler) getTargetNodes() ([]corev1.Node, error) {
 		// we only scan Linux nodes
 		nodeScanSelector := map[string]string{"kubernetes.io/os": "linux"}
 		listOpts := client.ListOptions{
-			LabelSelector: labels.SelectorFromSet(labels.Merge(nh.scan.Spec.NodeSelector, nodeScanSelector)),
+			LabelSelector: nh.withRescanNodeSelector(labels.SelectorFromSet(labels.Merge(nh.scan.Spec.NodeSelector, nodeScanSelector))),
 		}
 
 		if err := nh.r.Client.List(context.TODO(), &nodes, &listOpts); err != nil {
 			return nodes.Items, err
 		}
+
+		if names := nh.scan.GetRescanNodes(); len(names) > 0 {
+			return filterNodesByName(nodes.Items, names), nil
+		}
 	}
 
 	return nodes.Items, nil
 }
 
+// withRescanNodeSelector narrows the selector down to the nodes a rescan
+// was restricted to. An invalid selector is reported and ignored, so the
+// scan falls back to all of its nodes rather than getting stuck.
+func (nh *nodeScanTypeHandler) withRescanNodeSelector(selector labels.Selector) labels.Selector {
+	rescanSelector := nh.scan.GetRescanNodeSelector()
+	if rescanSelector == "" {
+		return selector
+	}
+	parsed, err := labels.Parse(rescanSelector)
+	if err != nil {
+		nh.l.Error(err, "Ignoring the invalid rescan node selector", "selector", rescanSelector)
+		nh.r.Recorder.Eventf(nh.scan, corev1.EventTypeWarning, "InvalidRescanNodeSelector",
+			"Ignoring the invalid rescan node selector '%s': %s", rescanSelector, err)
+		return selector
+	}
+	reqs, _ := parsed.Requirements()
+	return selector.Add(reqs...)
+}
+
+func filterNodesByName(nodes []corev1.Node, names []string) []corev1.Node {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	filtered := []corev1.Node{}
+	for _, node := range nodes {
+		if wanted[node.Name] {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
 func (nh *nodeScanTypeHandler) validate() (bool, error) {
+	if len(nh.nodes) == 0 && nh.scan.RescansNodeSubset() {
+		return false, nh.dropNodeSubset()
+	}
 	if len(nh.nodes) == 0 {
 		warning := "No nodes matched the nodeSelector"
 		nh.l.Info(warning)
@@ -125,6 +165,22 @@ func (nh *nodeScanTypeHandler) validate() (bool, error) {
 	return true, nil
 }
 
+// dropNodeSubset handles a scan whose node subset matches none of its nodes.
+// A pending rescan request is dropped, since the results of the previous run
+// are still current, and the scan goes back to covering all of its nodes.
+func (nh *nodeScanTypeHandler) dropNodeSubset() error {
+	scanCopy := nh.scan.DeepCopy()
+	if scanCopy.Status.Phase == compv1alpha1.PhaseDone && scanCopy.NeedsRescan() {
+		nh.l.Info("None of the scan's nodes were selected for the rescan, skipping it")
+		nh.r.Recorder.Event(nh.scan, corev1.EventTypeNormal, "RescanSkipped",
+			"None of the scan's nodes were selected for the rescan")
+		delete(scanCopy.Annotations, compv1alpha1.ComplianceScanRescanAnnotation)
+	}
+	delete(scanCopy.Annotations, compv1alpha1.ComplianceScanRescanNodesAnnotation)
+	delete(scanCopy.Annotations, compv1alpha1.ComplianceScanRescanNodeSelectorAnnotation)
+	return nh.r.Client.Update(context.TODO(), scanCopy)
+}
+
 func (nh *nodeScanTypeHandler) createScanWorkload() error {
 	// On each eligible node..
 	for idx := range nh.nodes {
@@ -207,12 +207,27 @@ func (r *ReconcileComplianceSuite) suiteDeleteHandler(suite *compv1alpha1.Compli
 		return err
 	}
 
+	// The remediations are garbage collected once the suite is gone, so
+	// they're listed now to reset the metrics series they have
+	remList := &compv1alpha1.ComplianceRemediationList{}
+	listOpts := client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{compv1alpha1.SuiteLabel: suite.Name}),
+	}
+	if err := r.Client.List(context.TODO(), remList, &listOpts); err != nil {
+		return err
+	}
+
 	suiteCopy := suite.DeepCopy()
 	// remove our finalizer from the list and update it.
 	suiteCopy.ObjectMeta.Finalizers = common.RemoveFinalizer(suiteCopy.ObjectMeta.Finalizers, compv1alpha1.SuiteFinalizer)
 	if err := r.Client.Update(context.TODO(), suiteCopy); err != nil {
 		return err
 	}
+	remediations := make([]string, 0, len(remList.Items))
+	for _, rem := range remList.Items {
+		remediations = append(remediations, rem.Name)
+	}
+	r.Metrics.ResetForSuite(suite.Name, remediations...)
 	return nil
 }
 
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+)
+
+var scanPhases = []v1alpha1.ComplianceScanStatusPhase{
+	v1alpha1.PhasePending,
+	v1alpha1.PhaseLaunching,
+	v1alpha1.PhaseRunning,
+	v1alpha1.PhaseAggregating,
+	v1alpha1.PhaseDone,
+}
+
+// The scan results a scan may report once it's done. Until then the result
+// is NOT-AVAILABLE.
+var doneScanResults = []v1alpha1.ComplianceScanStatusResult{
+	v1alpha1.ResultCompliant,
+	v1alpha1.ResultNotApplicable,
+	v1alpha1.ResultError,
+	v1alpha1.ResultNonCompliant,
+	v1alpha1.ResultInconsistent,
+	v1alpha1.ResultCancelled,
+}
+
+// The statuses the checks of a scan are counted by
+var checkStatuses = []v1alpha1.ComplianceCheckStatus{
+	v1alpha1.CheckResultPass,
+	v1alpha1.CheckResultFail,
+	v1alpha1.CheckResultError,
+	v1alpha1.CheckResultInfo,
+	v1alpha1.CheckResultManual,
+	v1alpha1.CheckResultNotApplicable,
+	v1alpha1.CheckResultInconsistent,
+}
+
+// The kinds of failures of the content's filters the resource collector
+// counts
+var filterErrorKinds = []string{"parse", "no-result", "multi", "eval", "undefined-variable"}
+
+var remediationStates = []v1alpha1.RemediationApplicationState{
+	v1alpha1.RemediationPending,
+	v1alpha1.RemediationNotApplied,
+	v1alpha1.RemediationApplied,
+	v1alpha1.RemediationOutdated,
+	v1alpha1.RemediationError,
+	v1alpha1.RemediationMissingDependencies,
+	v1alpha1.RemediationNeedsReview,
+}
+
+// CardinalityInput holds the number of objects whose names label the series
+// of the controller metrics
+type CardinalityInput struct {
+	Suites int
+	Scans  int
+	// At most one per rule of each scan
+	Remediations int
+}
+
+// EstimateCardinality returns an upper bound of the number of time series
+// each metric Register registers ends up with for the given objects, keyed
+// by the metric name. The scan errors are counted once per scan, although
+// every distinct error message adds a series. The filter errors are counted
+// once per kind and rule of each scan, as a rule rarely filters more than
+// one resource, and the KubeletConfigs of the nodes of a role share their
+// series. The histograms are counted with the configured buckets.
+func (m *Metrics) EstimateCardinality(in CardinalityInput) map[string]int {
+	series := map[string]int{}
+	for name := range m.collectors() {
+		if n, ok := m.metrics.estimateSeries(name, in); ok {
+			series[metricNamespace+"_"+name] = n
+		}
+	}
+	return series
+}
+
+// estimateSeries returns the number of series of the named metric for the
+// given objects, or false if the metric isn't estimated.
+func (c *ControllerMetrics) estimateSeries(name string, in CardinalityInput) (int, bool) {
+	// A series per bucket and for +Inf, the sum and the count
+	histogramSeries := len(c.histogramBuckets) + 3
+
+	switch name {
+	case metricNameComplianceScanError:
+		return in.Scans, true
+	case metricNameComplianceScanStatus:
+		// Phases before DONE are only reported with the NOT-AVAILABLE result
+		return in.Scans * (len(scanPhases) - 1 + len(doneScanResults)), true
+	case metricNameComplianceRemediationStatus:
+		return in.Remediations * len(remediationStates), true
+	case metricNameComplianceStateGauge:
+		return in.Suites, true
+	case metricNameRemediationTransitions:
+		// A state doesn't change to itself
+		return in.Remediations * len(remediationStates) * (len(remediationStates) - 1), true
+	case metricNameRerunnerLastTick:
+		return in.Suites, true
+	case metricNameUndefinedRules:
+		return in.Scans, true
+	case metricNameDriftedChecks:
+		return in.Scans * 2, true
+	case metricNameScanFetchDuration:
+		return in.Scans * histogramSeries, true
+	case metricNameScanCheckCount:
+		return in.Scans * len(checkStatuses), true
+	case metricNameBuildInfo:
+		return 1, true
+	case metricNameRemediationApplyDuration:
+		return in.Remediations * histogramSeries, true
+	case metricNameDeduplicatedUploads:
+		return in.Scans, true
+	case metricNameFilterErrors:
+		return in.Remediations * len(filterErrorKinds), true
+	}
+	return 0, false
+}
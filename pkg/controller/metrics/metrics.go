@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/go-logr/logr"
 	libgocrypto "github.com/openshift/library-go/pkg/crypto"
@@ -23,6 +25,16 @@ const (
 	metricNameComplianceScanError         = "compliance_scan_error_total"
 	metricNameComplianceRemediationStatus = "compliance_remediation_status_total"
 	metricNameComplianceStateGauge        = "compliance_state"
+	metricNameRemediationTransitions      = "compliance_remediation_state_transitions_total"
+	metricNameRerunnerLastTick            = "rerunner_last_tick_timestamp_seconds"
+	metricNameUndefinedRules              = "compliance_scan_undefined_rules"
+	metricNameFilterErrors                = "filter_errors_total"
+	metricNameDriftedChecks               = "compliance_scan_drifted_checks"
+	metricNameScanFetchDuration           = "compliance_scan_fetch_duration_seconds"
+	metricNameScanCheckCount              = "compliance_scan_check_count"
+	metricNameBuildInfo                   = "build_info"
+	metricNameRemediationApplyDuration    = "compliance_remediation_apply_duration_seconds"
+	metricNameDeduplicatedUploads         = "resultserver_deduplicated_uploads_total"
 
 	metricLabelScanResult       = "result"
 	metricLabelScanName         = "name"
@@ -31,11 +43,26 @@ const (
 	metricLabelScanError        = "error"
 	metricLabelRemediationName  = "name"
 	metricLabelRemediationState = "state"
+	metricLabelTransitionFrom   = "from"
+	metricLabelTransitionTo     = "to"
+	metricLabelFilterErrorKind  = "kind"
+	metricLabelFilterErrorPath  = "path"
+	metricLabelDriftDirection   = "direction"
+	metricLabelCheckStatus      = "status"
+	metricLabelVersion          = "version"
+	metricLabelGitCommit        = "git_commit"
+	metricLabelContentImage     = "content_image"
 
 	HandlerPath                  = "/metrics-co"
 	ControllerMetricsServiceName = "metrics-co"
 	ControllerMetricsPort        = 8585
 	MetricsAddrListen            = ":8585"
+
+	// Where the serving certificate of the metrics Service is mounted
+	DefaultMetricsCertFile = "/var/run/secrets/serving-cert/tls.crt"
+	DefaultMetricsKeyFile  = "/var/run/secrets/serving-cert/tls.key"
+	// How long in-flight scrapes may take to finish once the server stops
+	metricsShutdownTimeout = 10 * time.Second
 )
 
 const (
@@ -45,22 +72,58 @@ const (
 	METRIC_STATE_ERROR
 )
 
-// Metrics is the main structure of this package.
+// Metrics is the main structure of this package. Apart from Register, its
+// methods may be called concurrently: the collectors are set up once by
+// NewMetrics and never replaced, and the Prometheus collectors synchronize
+// their own updates.
 type Metrics struct {
 	impl    impl
 	log     logr.Logger
 	metrics *ControllerMetrics
+	// The address the controller metrics are served on
+	addr string
+	// Paths of the serving certificate and key
+	cert string
+	key  string
+	// Whether the remediation state transitions are counted
+	remediationTransitions bool
+	// Whether INCONSISTENT suites are reported as NON-COMPLIANT
+	inconsistentAsNonCompliant bool
 }
 
+// DefaultHistogramBuckets are the upper bounds, in seconds, of the buckets of
+// the duration histograms. They span the seconds a resource fetch takes up to
+// the tens of minutes a large suite takes.
+var DefaultHistogramBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 900, 1800, 3600}
+
 type ControllerMetrics struct {
 	metricComplianceScanError         *prometheus.CounterVec
 	metricComplianceScanStatus        *prometheus.CounterVec
 	metricComplianceRemediationStatus *prometheus.CounterVec
 	metricComplianceStateGauge        *prometheus.GaugeVec
+	metricRemediationTransitions      *prometheus.CounterVec
+	metricRerunnerLastTick            *prometheus.GaugeVec
+	metricUndefinedRules              *prometheus.GaugeVec
+	metricFilterErrors                *prometheus.CounterVec
+	metricDriftedChecks               *prometheus.GaugeVec
+	metricScanFetchDuration           *prometheus.HistogramVec
+	metricScanCheckCount              *prometheus.GaugeVec
+	metricBuildInfo                   *prometheus.GaugeVec
+	metricRemediationApplyDuration    *prometheus.HistogramVec
+	metricDeduplicatedUploads         *prometheus.CounterVec
+	// The buckets of the histograms created by newHistogramVec
+	histogramBuckets []float64
 }
 
 func DefaultControllerMetrics() *ControllerMetrics {
-	return &ControllerMetrics{
+	return NewControllerMetrics(DefaultHistogramBuckets)
+}
+
+// NewControllerMetrics returns the controller metrics with the given
+// histogram buckets, which must pass ValidateHistogramBuckets.
+func NewControllerMetrics(buckets []float64) *ControllerMetrics {
+	c := &ControllerMetrics{
+		histogramBuckets: buckets,
 		metricComplianceScanError: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name:      metricNameComplianceScanError,
@@ -102,7 +165,138 @@ func DefaultControllerMetrics() *ControllerMetrics {
 				metricLabelSuiteName,
 			},
 		),
+		metricRemediationTransitions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      metricNameRemediationTransitions,
+				Namespace: metricNamespace,
+				Help:      "A counter for the total number of changes of the application state of the ComplianceRemediations",
+			},
+			[]string{
+				metricLabelRemediationName,
+				metricLabelTransitionFrom,
+				metricLabelTransitionTo,
+			},
+		),
+		metricRerunnerLastTick: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      metricNameRerunnerLastTick,
+				Namespace: metricNamespace,
+				Help:      "A gauge for the Unix time the rerunner of a ComplianceSuite last ran",
+			},
+			[]string{
+				metricLabelSuiteName,
+			},
+		),
+		metricUndefinedRules: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      metricNameUndefinedRules,
+				Namespace: metricNamespace,
+				Help:      "A gauge for the number of rules the profile of a ComplianceScan selects that aren't defined in its content",
+			},
+			[]string{
+				metricLabelScanName,
+			},
+		),
+		metricFilterErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      metricNameFilterErrors,
+				Namespace: metricNamespace,
+				Help:      "A counter for the total number of failures of the content's filters while fetching resources",
+			},
+			[]string{
+				metricLabelFilterErrorKind,
+				metricLabelFilterErrorPath,
+			},
+		),
+		metricDriftedChecks: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      metricNameDriftedChecks,
+				Namespace: metricNamespace,
+				Help:      "A gauge for the number of checks of a ComplianceScan that started failing or passing since its baseline",
+			},
+			[]string{
+				metricLabelScanName,
+				metricLabelDriftDirection,
+			},
+		),
+		metricScanCheckCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      metricNameScanCheckCount,
+				Namespace: metricNamespace,
+				Help:      "A gauge for the number of checks of a ComplianceScan with each status in its last run",
+			},
+			[]string{
+				metricLabelScanName,
+				metricLabelCheckStatus,
+			},
+		),
+		metricBuildInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:      metricNameBuildInfo,
+				Namespace: metricNamespace,
+				Help:      "A gauge set to 1, labeled with the version and commit of the running operator and its default content image",
+			},
+			[]string{
+				metricLabelVersion,
+				metricLabelGitCommit,
+				metricLabelContentImage,
+			},
+		),
+		metricDeduplicatedUploads: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      metricNameDeduplicatedUploads,
+				Namespace: metricNamespace,
+				Help:      "A counter for the total number of retried uploads the result server of a ComplianceScan had already stored",
+			},
+			[]string{
+				metricLabelScanName,
+			},
+		),
 	}
+	c.metricScanFetchDuration = c.newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:      metricNameScanFetchDuration,
+			Namespace: metricNamespace,
+			Help:      "A histogram of the time the resource collector of a ComplianceScan took to fetch the resources",
+		},
+		[]string{
+			metricLabelScanName,
+		},
+	)
+	c.metricRemediationApplyDuration = c.newHistogramVec(
+		prometheus.HistogramOpts{
+			Name:      metricNameRemediationApplyDuration,
+			Namespace: metricNamespace,
+			Help:      "A histogram of the time a ComplianceRemediation took to be applied once it was pending or outdated",
+		},
+		[]string{
+			metricLabelRemediationName,
+		},
+	)
+	return c
+}
+
+// ValidateHistogramBuckets checks that the bucket upper bounds are positive
+// and strictly increasing.
+func ValidateHistogramBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return errors.New("at least one bucket is required")
+	}
+	for i, b := range buckets {
+		if b <= 0 {
+			return errors.Errorf("bucket %v is not positive", b)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return errors.Errorf("buckets must be strictly increasing, got %v after %v", b, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// newHistogramVec returns a histogram with the configured buckets
+func (c *ControllerMetrics) newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	opts.Buckets = c.histogramBuckets
+	return prometheus.NewHistogramVec(opts, labels)
 }
 
 func NewMetrics(imp impl) *Metrics {
@@ -110,6 +304,9 @@ func NewMetrics(imp impl) *Metrics {
 		impl:    imp,
 		log:     ctrllog.Log.WithName("metrics"),
 		metrics: DefaultControllerMetrics(),
+		addr:    MetricsAddrListen,
+		cert:    DefaultMetricsCertFile,
+		key:     DefaultMetricsKeyFile,
 	}
 }
 
@@ -118,14 +315,72 @@ func New() *Metrics {
 	return NewMetrics(&defaultImpl{})
 }
 
-// Register iterates over all available metrics and registers them.
-func (m *Metrics) Register() error {
-	for name, collector := range map[string]prometheus.Collector{
+// NewWithBuckets returns a new default Metrics instance whose histograms use
+// the given buckets.
+func NewWithBuckets(buckets []float64) *Metrics {
+	m := New()
+	m.metrics = NewControllerMetrics(buckets)
+	return m
+}
+
+// SetListenAddress sets the address the controller metrics are served on,
+// e.g. ":8585". It must be called before Start.
+func (m *Metrics) SetListenAddress(addr string) {
+	m.addr = addr
+}
+
+// ListenAddress returns the address the controller metrics are served on.
+func (m *Metrics) ListenAddress() string {
+	return m.addr
+}
+
+// SetServingCertificate sets the paths of the certificate and key the
+// controller metrics are served with. It must be called before Start.
+func (m *Metrics) SetServingCertificate(cert, key string) {
+	m.cert = cert
+	m.key = key
+}
+
+// EnableRemediationTransitions makes the metrics count the changes of the
+// remediations' application state. It must be called before Register.
+func (m *Metrics) EnableRemediationTransitions() {
+	m.remediationTransitions = true
+}
+
+// ReportInconsistentAsNonCompliant makes the compliance_state gauge report
+// INCONSISTENT suites as NON-COMPLIANT, for alerts that only tell compliant
+// suites from the others.
+func (m *Metrics) ReportInconsistentAsNonCompliant() {
+	m.inconsistentAsNonCompliant = true
+}
+
+// collectors returns the metrics Register registers, keyed by their name
+// without the namespace.
+func (m *Metrics) collectors() map[string]prometheus.Collector {
+	collectors := map[string]prometheus.Collector{
 		metricNameComplianceScanError:         m.metrics.metricComplianceScanError,
 		metricNameComplianceScanStatus:        m.metrics.metricComplianceScanStatus,
 		metricNameComplianceRemediationStatus: m.metrics.metricComplianceRemediationStatus,
 		metricNameComplianceStateGauge:        m.metrics.metricComplianceStateGauge,
-	} {
+		metricNameRerunnerLastTick:            m.metrics.metricRerunnerLastTick,
+		metricNameUndefinedRules:              m.metrics.metricUndefinedRules,
+		metricNameFilterErrors:                m.metrics.metricFilterErrors,
+		metricNameDriftedChecks:               m.metrics.metricDriftedChecks,
+		metricNameScanFetchDuration:           m.metrics.metricScanFetchDuration,
+		metricNameScanCheckCount:              m.metrics.metricScanCheckCount,
+		metricNameBuildInfo:                   m.metrics.metricBuildInfo,
+		metricNameRemediationApplyDuration:    m.metrics.metricRemediationApplyDuration,
+		metricNameDeduplicatedUploads:         m.metrics.metricDeduplicatedUploads,
+	}
+	if m.remediationTransitions {
+		collectors[metricNameRemediationTransitions] = m.metrics.metricRemediationTransitions
+	}
+	return collectors
+}
+
+// Register iterates over all available metrics and registers them.
+func (m *Metrics) Register() error {
+	for name, collector := range m.collectors() {
 		m.log.Info(fmt.Sprintf("Registering metric: %s", name))
 		if err := m.impl.Register(collector); err != nil {
 			return errors.Wrapf(err, "register collector for %s metric", name)
@@ -134,27 +389,76 @@ func (m *Metrics) Register() error {
 	return nil
 }
 
+// Start serves the controller metrics until ctx is cancelled, then shuts the
+// server down, letting in-flight scrapes finish. A failure to serve is
+// logged but not returned, so that it doesn't stop the operator. The metrics
+// are served over HTTPS, or over plain HTTP if the serving certificate or
+// its key aren't there, e.g. outside of OpenShift.
 func (m *Metrics) Start(ctx context.Context) error {
-	m.log.Info("Starting to serve controller metrics")
-	http.Handle(HandlerPath, promhttp.Handler())
+	m.log.Info("Starting to serve controller metrics", "address", m.addr)
+	mux := http.NewServeMux()
+	mux.Handle(HandlerPath, promhttp.Handler())
 
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 	}
 	tlsConfig = libgocrypto.SecureTLSConfig(tlsConfig)
 	server := &http.Server{
-		Addr:      MetricsAddrListen,
+		Addr:      m.addr,
+		Handler:   mux,
 		TLSConfig: tlsConfig,
 	}
 
-	err := server.ListenAndServeTLS("/var/run/secrets/serving-cert/tls.crt", "/var/run/secrets/serving-cert/tls.key")
-	if err != nil {
+	serve := func() error {
+		return server.ListenAndServeTLS(m.cert, m.key)
+	}
+	if missing := m.missingServingCertificate(); missing != "" {
+		m.log.Error(nil, "The serving certificate isn't available, serving the controller metrics over plain HTTP",
+			"missing", missing)
+		serve = server.ListenAndServe
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve()
+	}()
+
+	select {
+	case err := <-serveErr:
 		// unhandled on purpose, we don't want to exit the operator.
 		m.log.Error(err, "Metrics service failed")
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.log.Info("Shutting down the controller metrics server")
+	// ctx is already done, so give the shutdown a deadline of its own
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "shut down the metrics server")
 	}
 	return nil
 }
 
+// missingServingCertificate returns the path of the certificate or key that
+// doesn't exist, if any
+func (m *Metrics) missingServingCertificate() string {
+	for _, path := range []string{m.cert, m.key} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+	return ""
+}
+
+// SetBuildInfo sets the build_info gauge of the running operator to 1. The
+// series of any earlier call is removed, so there's only ever one.
+func (m *Metrics) SetBuildInfo(version, gitCommit, contentImage string) {
+	m.metrics.metricBuildInfo.Reset()
+	m.metrics.metricBuildInfo.WithLabelValues(version, gitCommit, contentImage).Set(1)
+}
+
 // IncComplianceScanStatus also increments error if necessary
 func (m *Metrics) IncComplianceScanStatus(name string, status v1alpha1.ComplianceScanStatus) {
 	m.metrics.metricComplianceScanStatus.With(prometheus.Labels{
@@ -178,13 +482,131 @@ func (m *Metrics) IncComplianceRemediationStatus(name string, status v1alpha1.Co
 	}).Inc()
 }
 
+// ObserveComplianceRemediationApplyDuration records how long the given
+// ComplianceRemediation took to reach the Applied state in the
+// compliance_remediation_apply_duration_seconds histogram.
+func (m *Metrics) ObserveComplianceRemediationApplyDuration(name string, d time.Duration) {
+	m.metrics.metricRemediationApplyDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// IncComplianceRemediationTransition counts a change of the application
+// state of the given ComplianceRemediation, if enabled. Unchanged states and
+// the initial state aren't transitions and aren't counted.
+func (m *Metrics) IncComplianceRemediationTransition(name string, from, to v1alpha1.RemediationApplicationState) {
+	if !m.remediationTransitions || from == "" || from == to {
+		return
+	}
+	m.metrics.metricRemediationTransitions.With(prometheus.Labels{
+		metricLabelRemediationName: name,
+		metricLabelTransitionFrom:  string(from),
+		metricLabelTransitionTo:    string(to),
+	}).Inc()
+}
+
+// ResetForScan deletes the scan status and error series of the given
+// ComplianceScan, e.g. once it's deleted, and the status, state transition
+// and apply duration series of its remediations.
+func (m *Metrics) ResetForScan(name string, remediations ...string) {
+	m.metrics.metricComplianceScanStatus.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricComplianceScanError.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricUndefinedRules.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricDriftedChecks.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricScanFetchDuration.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricScanCheckCount.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.metrics.metricDeduplicatedUploads.DeletePartialMatch(prometheus.Labels{metricLabelScanName: name})
+	m.resetRemediations(remediations)
+}
+
+// resetRemediations deletes the status, state transition and apply duration
+// series of the given ComplianceRemediations
+func (m *Metrics) resetRemediations(remediations []string) {
+	for _, remediation := range remediations {
+		labels := prometheus.Labels{metricLabelRemediationName: remediation}
+		m.metrics.metricComplianceRemediationStatus.DeletePartialMatch(labels)
+		m.metrics.metricRemediationTransitions.DeletePartialMatch(labels)
+		m.metrics.metricRemediationApplyDuration.DeletePartialMatch(labels)
+	}
+}
+
+// SetComplianceScanDriftedChecks sets the compliance_scan_drifted_checks
+// gauges of the given ComplianceScan to the number of checks that fail, and
+// that pass, although they didn't in its baseline.
+func (m *Metrics) SetComplianceScanDriftedChecks(name string, failing, passing int) {
+	m.metrics.metricDriftedChecks.WithLabelValues(name, "failing").Set(float64(failing))
+	m.metrics.metricDriftedChecks.WithLabelValues(name, "passing").Set(float64(passing))
+}
+
+// ObserveScanFetchDuration records how long the resource collector of the
+// given ComplianceScan took to fetch the resources in the
+// compliance_scan_fetch_duration_seconds histogram.
+func (m *Metrics) ObserveScanFetchDuration(name string, d time.Duration) {
+	m.metrics.metricScanFetchDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// SetCheckCount sets the compliance_scan_check_count gauge of the given
+// ComplianceScan and check status.
+func (m *Metrics) SetCheckCount(scan string, status v1alpha1.ComplianceCheckStatus, count float64) {
+	m.metrics.metricScanCheckCount.WithLabelValues(scan, string(status)).Set(count)
+}
+
+// SetComplianceScanCheckCounts sets the compliance_scan_check_count gauges of
+// the given ComplianceScan to the check counts the aggregator recorded on its
+// status. Every status is set, so the ones no check has anymore drop to 0.
+func (m *Metrics) SetComplianceScanCheckCounts(scan string, counts v1alpha1.ComplianceCheckCounts) {
+	m.SetCheckCount(scan, v1alpha1.CheckResultPass, float64(counts.Pass))
+	m.SetCheckCount(scan, v1alpha1.CheckResultFail, float64(counts.Fail))
+	m.SetCheckCount(scan, v1alpha1.CheckResultError, float64(counts.Error))
+	m.SetCheckCount(scan, v1alpha1.CheckResultInfo, float64(counts.Info))
+	m.SetCheckCount(scan, v1alpha1.CheckResultManual, float64(counts.Manual))
+	m.SetCheckCount(scan, v1alpha1.CheckResultNotApplicable, float64(counts.NotApplicable))
+	m.SetCheckCount(scan, v1alpha1.CheckResultInconsistent, float64(counts.Inconsistent))
+}
+
+// AddDeduplicatedUploads adds the retried uploads the result server of the
+// given ComplianceScan had already stored to the
+// resultserver_deduplicated_uploads_total counter.
+func (m *Metrics) AddDeduplicatedUploads(name string, count int) {
+	m.metrics.metricDeduplicatedUploads.WithLabelValues(name).Add(float64(count))
+}
+
+// SetComplianceScanUndefinedRules sets the compliance_scan_undefined_rules
+// gauge of the given ComplianceScan.
+func (m *Metrics) SetComplianceScanUndefinedRules(name string, count int) {
+	m.metrics.metricUndefinedRules.WithLabelValues(name).Set(float64(count))
+}
+
+// AddFilterErrors adds the filter errors of a scan, counted by kind and dump
+// path, to the filter_errors_total counter.
+func (m *Metrics) AddFilterErrors(counts map[string]map[string]int) {
+	for kind, paths := range counts {
+		for path, count := range paths {
+			m.metrics.metricFilterErrors.WithLabelValues(kind, path).Add(float64(count))
+		}
+	}
+}
+
+// ResetForSuite deletes the compliance_state and rerunner series of the given
+// ComplianceSuite, and the status, state transition and apply duration
+// series of its remediations. The
+// series of its scans are reset by ResetForScan.
+func (m *Metrics) ResetForSuite(name string, remediations ...string) {
+	m.metrics.metricComplianceStateGauge.DeletePartialMatch(prometheus.Labels{metricLabelSuiteName: name})
+	m.metrics.metricRerunnerLastTick.DeletePartialMatch(prometheus.Labels{metricLabelSuiteName: name})
+	m.resetRemediations(remediations)
+}
+
 // SetComplianceStateError sets the compliance_state gauge to 3.
 func (m *Metrics) SetComplianceStateError(name string) {
 	m.metrics.metricComplianceStateGauge.WithLabelValues(name).Set(METRIC_STATE_ERROR)
 }
 
-// SetComplianceStateInconsistent sets the compliance_state gauge to 2.
+// SetComplianceStateInconsistent sets the compliance_state gauge to 2, or to
+// 1 if inconsistent suites are reported as non-compliant.
 func (m *Metrics) SetComplianceStateInconsistent(name string) {
+	if m.inconsistentAsNonCompliant {
+		m.SetComplianceStateOutOfCompliance(name)
+		return
+	}
 	m.metrics.metricComplianceStateGauge.WithLabelValues(name).Set(METRIC_STATE_INCONSISTENT)
 }
 
@@ -197,3 +619,9 @@ func (m *Metrics) SetComplianceStateOutOfCompliance(name string) {
 func (m *Metrics) SetComplianceStateInCompliance(name string) {
 	m.metrics.metricComplianceStateGauge.WithLabelValues(name).Set(METRIC_STATE_COMPLIANT)
 }
+
+// SetRerunnerLastTick sets the rerunner_last_tick_timestamp_seconds gauge of
+// the given ComplianceSuite to the time its rerunner last ran.
+func (m *Metrics) SetRerunnerLastTick(name string, tick time.Time) {
+	m.metrics.metricRerunnerLastTick.WithLabelValues(name).Set(float64(tick.Unix()))
+}
@@ -17,10 +17,29 @@ limitations under the License.
 package metrics
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 
@@ -117,6 +136,20 @@ func TestFileIntegrityMetrics(t *testing.T) {
 				require.Equal(t, 1, getMetricValue(ctr))
 			},
 		},
+		{ // filter errors added up
+			when: func(m *Metrics) {
+				m.AddFilterErrors(map[string]map[string]int{"multi": {"/api/v1/nodes": 2}})
+				m.AddFilterErrors(map[string]map[string]int{"multi": {"/api/v1/nodes": 1}})
+			},
+			then: func(m *Metrics) {
+				ctr, err := m.metrics.metricFilterErrors.GetMetricWith(prometheus.Labels{
+					metricLabelFilterErrorKind: "multi",
+					metricLabelFilterErrorPath: "/api/v1/nodes",
+				})
+				require.Nil(t, err)
+				require.Equal(t, 3, getMetricValue(ctr))
+			},
+		},
 	} {
 		mock := &metricsfakes.FakeImpl{}
 		sut := New()
@@ -126,3 +159,509 @@ func TestFileIntegrityMetrics(t *testing.T) {
 		tc.then(sut)
 	}
 }
+
+// Run with -race to catch unsynchronized access in the wrapper methods
+func TestConcurrentMetricUpdates(t *testing.T) {
+	t.Parallel()
+
+	const (
+		goroutines = 50
+		iterations = 200
+	)
+
+	sut := New()
+	sut.impl = &metricsfakes.FakeImpl{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				sut.IncComplianceScanStatus("scan", v1alpha1.ComplianceScanStatus{
+					Phase:        v1alpha1.PhaseDone,
+					Result:       v1alpha1.ResultError,
+					ErrorMessage: "broken",
+				})
+				sut.IncComplianceRemediationStatus("rem", v1alpha1.ComplianceRemediationStatus{
+					ApplicationState: v1alpha1.RemediationApplied,
+				})
+				if i%2 == 0 {
+					sut.SetComplianceStateInCompliance("suite")
+				} else {
+					sut.SetComplianceStateError("suite")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	getCounterValue := func(vec *prometheus.CounterVec, labels prometheus.Labels) int {
+		ctr, err := vec.GetMetricWith(labels)
+		require.Nil(t, err)
+		m := dto.Metric{}
+		require.Nil(t, ctr.Write(&m))
+		return int(*m.Counter.Value)
+	}
+
+	require.Equal(t, goroutines*iterations, getCounterValue(sut.metrics.metricComplianceScanStatus, prometheus.Labels{
+		metricLabelScanName:   "scan",
+		metricLabelScanPhase:  string(v1alpha1.PhaseDone),
+		metricLabelScanResult: string(v1alpha1.ResultError),
+	}))
+	require.Equal(t, goroutines*iterations, getCounterValue(sut.metrics.metricComplianceScanError, prometheus.Labels{
+		metricLabelScanName:  "scan",
+		metricLabelScanError: "broken",
+	}))
+	require.Equal(t, goroutines*iterations, getCounterValue(sut.metrics.metricComplianceRemediationStatus, prometheus.Labels{
+		metricLabelRemediationName:  "rem",
+		metricLabelRemediationState: string(v1alpha1.RemediationApplied),
+	}))
+
+	gauge, err := sut.metrics.metricComplianceStateGauge.GetMetricWith(prometheus.Labels{metricLabelSuiteName: "suite"})
+	require.Nil(t, err)
+	m := dto.Metric{}
+	require.Nil(t, gauge.Write(&m))
+	require.Contains(t, []float64{METRIC_STATE_COMPLIANT, METRIC_STATE_ERROR}, *m.Gauge.Value)
+}
+
+func TestEstimateCardinality(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	series := sut.EstimateCardinality(CardinalityInput{
+		Suites:       2,
+		Scans:        3,
+		Remediations: 100,
+	})
+
+	require.Equal(t, map[string]int{
+		"compliance_operator_compliance_scan_error_total": 3,
+		// Four phases before DONE, and DONE with six results
+		"compliance_operator_compliance_scan_status_total":         3 * 10,
+		"compliance_operator_compliance_remediation_status_total":  100 * 7,
+		"compliance_operator_compliance_state":                     2,
+		"compliance_operator_rerunner_last_tick_timestamp_seconds": 2,
+		"compliance_operator_compliance_scan_undefined_rules":      3,
+		// Checks that started failing and checks that started passing
+		"compliance_operator_compliance_scan_drifted_checks": 3 * 2,
+		// Eleven buckets, +Inf, the sum and the count
+		"compliance_operator_compliance_scan_fetch_duration_seconds": 3 * 14,
+		// PASS, FAIL, ERROR, INFO, MANUAL, NOT-APPLICABLE and INCONSISTENT
+		"compliance_operator_compliance_scan_check_count":                   3 * 7,
+		"compliance_operator_build_info":                                    1,
+		"compliance_operator_compliance_remediation_apply_duration_seconds": 100 * 14,
+		"compliance_operator_resultserver_deduplicated_uploads_total":       3,
+		// parse, no-result, multi, eval and undefined-variable
+		"compliance_operator_filter_errors_total": 100 * 5,
+	}, series)
+}
+
+func TestEstimateCardinalityWithConfiguredMetrics(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.metrics = NewControllerMetrics([]float64{10, 100})
+	sut.EnableRemediationTransitions()
+	series := sut.EstimateCardinality(CardinalityInput{Scans: 3, Remediations: 100})
+
+	// Two buckets, +Inf, the sum and the count
+	require.Equal(t, 3*5, series["compliance_operator_compliance_scan_fetch_duration_seconds"])
+	require.Equal(t, 100*5, series["compliance_operator_compliance_remediation_apply_duration_seconds"])
+	// Every pair of the seven states of each remediation
+	require.Equal(t, 100*7*6, series["compliance_operator_compliance_remediation_state_transitions_total"])
+}
+
+func TestEstimateCardinalityCountsEveryMetric(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.EnableRemediationTransitions()
+	series := sut.EstimateCardinality(CardinalityInput{Suites: 1, Scans: 1, Remediations: 1})
+
+	for name := range sut.collectors() {
+		require.Contains(t, series, metricNamespace+"_"+name, "metric %s isn't estimated", name)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	require.Equal(t, MetricsAddrListen, sut.ListenAddress())
+
+	sut.SetListenAddress("127.0.0.1:9090")
+	require.Equal(t, "127.0.0.1:9090", sut.ListenAddress())
+}
+
+func TestStartShutsDownWhenCancelled(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.SetServingCertificate(writeTestCertificate(t))
+	sut.SetListenAddress(freeLocalAddress(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan error, 1)
+	go func() {
+		started <- sut.Start(ctx)
+	}()
+
+	client := &http.Client{
+		Timeout: time.Second,
+		Transport: &http.Transport{
+			// The test certificate is self-signed
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	url := "https://" + sut.ListenAddress() + HandlerPath
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 10*time.Second, 50*time.Millisecond)
+	client.CloseIdleConnections()
+
+	cancel()
+	select {
+	case err := <-started:
+		require.Nil(t, err)
+	case <-time.After(metricsShutdownTimeout):
+		t.Fatal("Start didn't return after the context was cancelled")
+	}
+
+	_, err := net.DialTimeout("tcp", sut.ListenAddress(), time.Second)
+	require.NotNil(t, err)
+}
+
+func TestStartWithoutServingCertificate(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	dir := t.TempDir()
+	sut.SetServingCertificate(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	sut.SetListenAddress(freeLocalAddress(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error, 1)
+	go func() {
+		started <- sut.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-started
+	}()
+
+	client := &http.Client{Timeout: time.Second}
+	url := "http://" + sut.ListenAddress() + HandlerPath
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 10*time.Second, 50*time.Millisecond)
+	client.CloseIdleConnections()
+}
+
+// freeLocalAddress returns a loopback address with a port nothing listens on
+func freeLocalAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key, returning their paths
+func writeTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "metrics"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	require.Nil(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certPath, keyPath
+}
+
+func TestValidateHistogramBuckets(t *testing.T) {
+	t.Parallel()
+	require.Nil(t, ValidateHistogramBuckets(DefaultHistogramBuckets))
+	require.Nil(t, ValidateHistogramBuckets([]float64{0.5}))
+	for _, buckets := range [][]float64{
+		nil,
+		{0, 10},
+		{-1, 10},
+		{10, 10},
+		{10, 5},
+	} {
+		require.NotNil(t, ValidateHistogramBuckets(buckets), "%v", buckets)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		sut      *Metrics
+		expected []float64
+	}{
+		{sut: New(), expected: DefaultHistogramBuckets},
+		{sut: NewWithBuckets([]float64{2, 4, 8}), expected: []float64{2, 4, 8}},
+	} {
+		histogram := tc.sut.metrics.newHistogramVec(prometheus.HistogramOpts{
+			Name: "test_duration_seconds",
+		}, []string{"name"})
+		histogram.WithLabelValues("foo").Observe(3)
+
+		m := dto.Metric{}
+		require.Nil(t, histogram.WithLabelValues("foo").(prometheus.Histogram).Write(&m))
+		bounds := []float64{}
+		for _, b := range m.Histogram.Bucket {
+			bounds = append(bounds, b.GetUpperBound())
+		}
+		require.Equal(t, tc.expected, bounds)
+	}
+}
+
+func TestResetForScanAndSuite(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		sut.metrics.metricComplianceScanError,
+		sut.metrics.metricComplianceScanStatus,
+		sut.metrics.metricComplianceRemediationStatus,
+		sut.metrics.metricComplianceStateGauge,
+		sut.metrics.metricRerunnerLastTick,
+		sut.metrics.metricUndefinedRules,
+		sut.metrics.metricDriftedChecks,
+		sut.metrics.metricScanFetchDuration,
+		sut.metrics.metricScanCheckCount,
+		sut.metrics.metricDeduplicatedUploads,
+	)
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	scrape := func() string {
+		resp, err := http.Get(server.URL)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	for _, name := range []string{"scan-a", "scan-b"} {
+		sut.IncComplianceScanStatus(name, v1alpha1.ComplianceScanStatus{Phase: v1alpha1.PhaseRunning})
+		sut.IncComplianceScanStatus(name, v1alpha1.ComplianceScanStatus{
+			Phase:        v1alpha1.PhaseDone,
+			Result:       v1alpha1.ResultError,
+			ErrorMessage: "broken",
+		})
+	}
+	sut.SetComplianceScanUndefinedRules("scan-a", 3)
+	sut.SetComplianceScanUndefinedRules("scan-b", 0)
+	sut.SetComplianceScanDriftedChecks("scan-a", 1, 0)
+	sut.SetComplianceScanDriftedChecks("scan-b", 2, 1)
+	sut.ObserveScanFetchDuration("scan-a", 3*time.Second)
+	sut.ObserveScanFetchDuration("scan-b", 40*time.Second)
+	sut.SetCheckCount("scan-a", v1alpha1.CheckResultFail, 4)
+	sut.SetCheckCount("scan-b", v1alpha1.CheckResultPass, 12)
+	sut.AddDeduplicatedUploads("scan-a", 1)
+	sut.AddDeduplicatedUploads("scan-b", 2)
+	sut.SetComplianceStateInCompliance("suite-a")
+	sut.SetComplianceStateError("suite-b")
+	sut.SetRerunnerLastTick("suite-a", time.Unix(1600000000, 0))
+	sut.SetRerunnerLastTick("suite-b", time.Unix(1600000000, 0))
+	before := scrape()
+	require.Contains(t, before, `name="scan-a"`)
+	require.Contains(t, before, `name="suite-a"`)
+
+	sut.ResetForScan("scan-a")
+	sut.ResetForSuite("suite-a")
+	after := scrape()
+	require.NotContains(t, after, `name="scan-a"`)
+	require.NotContains(t, after, `name="suite-a"`)
+	// The series of other scans and suites are kept
+	require.Equal(t, 2, strings.Count(after, `compliance_operator_compliance_scan_status_total{name="scan-b"`))
+	require.Contains(t, after, `compliance_operator_compliance_scan_error_total{error="broken",name="scan-b"}`)
+	require.Contains(t, after, `compliance_operator_compliance_scan_undefined_rules{name="scan-b"} 0`)
+	require.Contains(t, after, `compliance_operator_compliance_scan_drifted_checks{direction="failing",name="scan-b"} 2`)
+	require.Contains(t, after, `compliance_operator_compliance_scan_fetch_duration_seconds_sum{name="scan-b"} 40`)
+	require.Contains(t, after, `compliance_operator_compliance_scan_check_count{name="scan-b",status="PASS"} 12`)
+	require.Contains(t, after, `compliance_operator_resultserver_deduplicated_uploads_total{name="scan-b"} 2`)
+	require.Contains(t, after, `compliance_operator_compliance_state{name="suite-b"}`)
+	require.Contains(t, after, `compliance_operator_rerunner_last_tick_timestamp_seconds{name="suite-b"} 1.6e+09`)
+}
+
+func TestRemediationTransitions(t *testing.T) {
+	t.Parallel()
+	disabled := NewMetrics(&metricsfakes.FakeImpl{})
+	require.Nil(t, disabled.Register())
+	disabled.IncComplianceRemediationTransition("rem", v1alpha1.RemediationNotApplied, v1alpha1.RemediationApplied)
+	require.Equal(t, 0, countSeries(disabled.metrics.metricRemediationTransitions))
+
+	mock := &metricsfakes.FakeImpl{}
+	sut := NewMetrics(mock)
+	sut.EnableRemediationTransitions()
+	require.Nil(t, sut.Register())
+	require.Equal(t, 14, mock.RegisterCallCount())
+
+	sut.IncComplianceRemediationTransition("rem-a", "", v1alpha1.RemediationPending)
+	sut.IncComplianceRemediationTransition("rem-a", v1alpha1.RemediationPending, v1alpha1.RemediationPending)
+	sut.IncComplianceRemediationTransition("rem-a", v1alpha1.RemediationNotApplied, v1alpha1.RemediationApplied)
+	sut.IncComplianceRemediationTransition("rem-a", v1alpha1.RemediationApplied, v1alpha1.RemediationError)
+	sut.IncComplianceRemediationTransition("rem-a", v1alpha1.RemediationError, v1alpha1.RemediationApplied)
+	sut.IncComplianceRemediationTransition("rem-a", v1alpha1.RemediationApplied, v1alpha1.RemediationError)
+	sut.IncComplianceRemediationTransition("rem-b", v1alpha1.RemediationApplied, v1alpha1.RemediationError)
+	sut.IncComplianceRemediationTransition("rem-c", v1alpha1.RemediationApplied, v1alpha1.RemediationError)
+
+	require.Equal(t, 5, countSeries(sut.metrics.metricRemediationTransitions))
+	m := dto.Metric{}
+	require.Nil(t, sut.metrics.metricRemediationTransitions.With(prometheus.Labels{
+		metricLabelRemediationName: "rem-a",
+		metricLabelTransitionFrom:  string(v1alpha1.RemediationApplied),
+		metricLabelTransitionTo:    string(v1alpha1.RemediationError),
+	}).Write(&m))
+	require.Equal(t, float64(2), m.Counter.GetValue())
+
+	sut.ResetForScan("scan-a", "rem-a")
+	require.Equal(t, 2, countSeries(sut.metrics.metricRemediationTransitions))
+	sut.ResetForSuite("suite-a", "rem-b")
+	require.Equal(t, 1, countSeries(sut.metrics.metricRemediationTransitions))
+}
+
+func TestResetRemediationSeries(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	for _, name := range []string{"rem-a", "rem-b", "rem-c"} {
+		sut.IncComplianceRemediationStatus(name, v1alpha1.ComplianceRemediationStatus{
+			ApplicationState: v1alpha1.RemediationPending,
+		})
+		sut.IncComplianceRemediationStatus(name, v1alpha1.ComplianceRemediationStatus{
+			ApplicationState: v1alpha1.RemediationApplied,
+		})
+		sut.ObserveComplianceRemediationApplyDuration(name, time.Minute)
+	}
+	require.Equal(t, 6, countSeries(sut.metrics.metricComplianceRemediationStatus))
+	require.Equal(t, 3, countSeries(sut.metrics.metricRemediationApplyDuration))
+
+	sut.ResetForScan("scan-a", "rem-a")
+	require.Equal(t, 4, countSeries(sut.metrics.metricComplianceRemediationStatus))
+	require.Equal(t, 2, countSeries(sut.metrics.metricRemediationApplyDuration))
+	sut.ResetForSuite("suite-a", "rem-b")
+	require.Equal(t, 2, countSeries(sut.metrics.metricComplianceRemediationStatus))
+	require.Equal(t, 1, countSeries(sut.metrics.metricRemediationApplyDuration))
+}
+
+// countSeries returns the number of series the collector has
+func countSeries(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	n := 0
+	for range ch {
+		n++
+	}
+	return n
+}
+
+func TestInconsistentAsNonCompliant(t *testing.T) {
+	t.Parallel()
+	gaugeValue := func(m *Metrics) float64 {
+		metric := dto.Metric{}
+		require.Nil(t, m.metrics.metricComplianceStateGauge.WithLabelValues("suite").Write(&metric))
+		return metric.Gauge.GetValue()
+	}
+
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.SetComplianceStateInconsistent("suite")
+	require.Equal(t, float64(METRIC_STATE_INCONSISTENT), gaugeValue(sut))
+
+	sut = NewMetrics(&metricsfakes.FakeImpl{})
+	sut.ReportInconsistentAsNonCompliant()
+	sut.SetComplianceStateInconsistent("suite")
+	require.Equal(t, float64(METRIC_STATE_NON_COMPLIANT), gaugeValue(sut))
+	sut.SetComplianceStateError("suite")
+	require.Equal(t, float64(METRIC_STATE_ERROR), gaugeValue(sut))
+}
+
+func TestObserveScanFetchDuration(t *testing.T) {
+	t.Parallel()
+	sut := NewWithBuckets([]float64{10, 60})
+	sut.ObserveScanFetchDuration("scan-a", 5*time.Second)
+	sut.ObserveScanFetchDuration("scan-a", 30*time.Second)
+	sut.ObserveScanFetchDuration("scan-b", 2*time.Minute)
+
+	require.Equal(t, 2, countSeries(sut.metrics.metricScanFetchDuration))
+	m := dto.Metric{}
+	require.Nil(t, sut.metrics.metricScanFetchDuration.WithLabelValues("scan-a").(prometheus.Histogram).Write(&m))
+	require.Equal(t, uint64(2), m.Histogram.GetSampleCount())
+	require.Equal(t, float64(35), m.Histogram.GetSampleSum())
+	require.Equal(t, uint64(1), m.Histogram.Bucket[0].GetCumulativeCount())
+	require.Equal(t, uint64(2), m.Histogram.Bucket[1].GetCumulativeCount())
+}
+
+func TestObserveComplianceRemediationApplyDuration(t *testing.T) {
+	t.Parallel()
+	sut := NewWithBuckets([]float64{60, 600})
+	sut.ObserveComplianceRemediationApplyDuration("rem-mc", 8*time.Minute)
+	sut.ObserveComplianceRemediationApplyDuration("rem-cm", time.Second)
+
+	require.Equal(t, 2, countSeries(sut.metrics.metricRemediationApplyDuration))
+	m := dto.Metric{}
+	require.Nil(t, sut.metrics.metricRemediationApplyDuration.WithLabelValues("rem-mc").(prometheus.Histogram).Write(&m))
+	require.Equal(t, uint64(1), m.Histogram.GetSampleCount())
+	require.Equal(t, float64(480), m.Histogram.GetSampleSum())
+	require.Equal(t, uint64(0), m.Histogram.Bucket[0].GetCumulativeCount())
+	require.Equal(t, uint64(1), m.Histogram.Bucket[1].GetCumulativeCount())
+}
+
+func TestSetComplianceScanCheckCounts(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.SetComplianceScanCheckCounts("scan-a", v1alpha1.ComplianceCheckCounts{Pass: 10, Fail: 2, Manual: 1})
+	require.Equal(t, 7, countSeries(sut.metrics.metricScanCheckCount))
+
+	value := func(status v1alpha1.ComplianceCheckStatus) float64 {
+		m := dto.Metric{}
+		require.Nil(t, sut.metrics.metricScanCheckCount.WithLabelValues("scan-a", string(status)).Write(&m))
+		return m.Gauge.GetValue()
+	}
+	require.Equal(t, float64(10), value(v1alpha1.CheckResultPass))
+	require.Equal(t, float64(2), value(v1alpha1.CheckResultFail))
+	require.Equal(t, float64(1), value(v1alpha1.CheckResultManual))
+
+	// The statuses no check has anymore drop to 0
+	sut.SetComplianceScanCheckCounts("scan-a", v1alpha1.ComplianceCheckCounts{Pass: 12})
+	require.Equal(t, float64(12), value(v1alpha1.CheckResultPass))
+	require.Equal(t, float64(0), value(v1alpha1.CheckResultFail))
+}
+
+func TestSetBuildInfo(t *testing.T) {
+	t.Parallel()
+	sut := NewMetrics(&metricsfakes.FakeImpl{})
+	sut.SetBuildInfo("0.1.55", "abc123", "quay.io/compliance-operator/compliance-operator-content:old")
+	sut.SetBuildInfo("0.1.56", "def456", "quay.io/compliance-operator/compliance-operator-content:latest")
+	require.Equal(t, 1, countSeries(sut.metrics.metricBuildInfo))
+
+	m := dto.Metric{}
+	require.Nil(t, sut.metrics.metricBuildInfo.WithLabelValues(
+		"0.1.56", "def456", "quay.io/compliance-operator/compliance-operator-content:latest").Write(&m))
+	require.Equal(t, float64(1), m.Gauge.GetValue())
+}
@@ -2,6 +2,7 @@ package scansettingbinding
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -172,72 +173,43 @@ func (r *ReconcileScanSettingBinding) Reconcile(ctx context.Context, request rec
 		return reconcile.Result{}, err
 	}
 
-	var nodeProduct string
-	for i := range instance.Profiles {
-		ss := &instance.Profiles[i]
-
-		key := types.NamespacedName{Namespace: instance.Namespace, Name: ss.Name}
-		profileObj, geterr := getUnstructured(r, instance, key, ss.Kind, ss.APIGroup, reqLogger)
-		if geterr != nil {
-			return reconcile.Result{}, geterr
+	check, err := r.checkBinding(instance, reqLogger)
+	var refErr *referenceError
+	var invalidErr *invalidBindingError
+	if goerrors.As(err, &refErr) {
+		return reconcile.Result{}, refErr.err
+	} else if goerrors.As(err, &invalidErr) {
+		if invalidErr.reason != "" {
+			r.Eventf(instance, corev1.EventTypeWarning, invalidErr.reason, invalidErr.msg)
 		}
-
-		if profileObj.GetKind() == "TailoredProfile" {
-			val, found, nsErr := unstructured.NestedString(
-				profileObj.Object, "status", "state")
-			if nsErr != nil {
-				reqLogger.Error(nsErr, "Fetching state of tailored profile",
-					"TailoredProfile", profileObj.GetName())
-			}
-			if !found {
-				reqLogger.Info("Requeuing as TailoredProfile hasn't been processed",
-					"TailoredProfile", profileObj.GetName())
-				return reconcile.Result{Requeue: true, RequeueAfter: requeueAfterDefault}, nil
-			}
-			if val == string(compliancev1alpha1.TailoredProfileStateError) {
-				msg := "The TailoredProfile referenced has an error and is not usable"
-				ssb := instance.DeepCopy()
-				ssb.Status.SetConditionInvalid(msg)
-				if updateErr := r.Client.Status().Update(context.TODO(), ssb); updateErr != nil {
-					return reconcile.Result{}, fmt.Errorf("couldn't update ScanSettingBinding condition: %w", updateErr)
-				}
-				return reconcile.Result{}, nil
-			}
-			if val != string(compliancev1alpha1.TailoredProfileStateReady) {
-				reqLogger.Info("Requeuing as TailoredProfile isn't yet ready",
-					"TailoredProfile", profileObj.GetName())
-				return reconcile.Result{Requeue: true, RequeueAfter: requeueAfterDefault}, nil
-			}
+		ssb := instance.DeepCopy()
+		ssb.Status.SetConditionInvalid(invalidErr.msg)
+		if updateErr := r.Client.Status().Update(context.TODO(), ssb); updateErr != nil {
+			return reconcile.Result{}, fmt.Errorf("couldn't update ScanSettingBinding condition: %w", updateErr)
 		}
+		// Don't requeue in this case, nothing we can do
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return common.ReturnWithRetriableError(reqLogger, err)
+	}
 
-		scan, product, err := newCompScanFromBindingProfile(r, instance, profileObj, log)
+	if check.pending != "" {
+		reqLogger.Info("Requeuing as TailoredProfile isn't yet ready",
+			"TailoredProfile", check.pending)
+		return reconcile.Result{Requeue: true, RequeueAfter: requeueAfterDefault}, nil
+	}
+
+	for _, reference := range check.profiles {
+		scan, err := newCompScanFromBindingProfile(r, instance, reference)
 		if err != nil {
 			return common.ReturnWithRetriableError(reqLogger, err)
 		}
 
-		nodeProduct = getRelevantProduct(nodeProduct, product)
-
-		if isDifferentProduct(nodeProduct, product) {
-			msg := fmt.Sprintf("ScanSettingBinding defines multiple products: %s and %s", product, nodeProduct)
-			r.Eventf(instance, corev1.EventTypeWarning, "MultipleProducts", msg)
-
-			ssb := instance.DeepCopy()
-			ssb.Status.SetConditionInvalid(msg)
-			if updateErr := r.Client.Status().Update(context.TODO(), ssb); updateErr != nil {
-				return reconcile.Result{}, fmt.Errorf("couldn't update ScanSettingBinding condition: %w", updateErr)
-			}
-			// Don't requeue in this case, nothing we can do
-			return reconcile.Result{}, nil
-		}
-
 		suite.Spec.Scans = append(suite.Spec.Scans, *scan)
 	}
 
-	if instance.SettingsRef != nil {
-		err := r.applyConstraint(instance, &suite, instance.SettingsRef, log)
-		if err != nil {
-			return common.ReturnWithRetriableError(reqLogger, err)
-		}
+	if check.setting != nil {
+		r.applyConstraint(&suite, check.setting, log)
 	}
 
 	found := compliancev1alpha1.ComplianceSuite{}
@@ -331,35 +303,17 @@ func isDifferentProduct(nodeProduct, incomingProduct string) bool {
 }
 
 func (r *ReconcileScanSettingBinding) applyConstraint(
-	instance *compliancev1alpha1.ScanSettingBinding,
 	suite *compliancev1alpha1.ComplianceSuite,
-	constraintRef *compliancev1alpha1.NamedObjectReference,
+	v1setting *compliancev1alpha1.ScanSetting,
 	logger logr.Logger,
-) error {
-	key := types.NamespacedName{Namespace: instance.Namespace, Name: constraintRef.Name}
-	constraint, err := getUnstructured(r, instance, key, constraintRef.Kind, constraintRef.APIGroup, logger)
-	if err != nil {
-		return err
-	}
-
-	if err := isCmpv1Alpha1Gvk(constraint, "ScanSetting"); err != nil {
-		return err
-	}
-	v1setting := compliancev1alpha1.ScanSetting{}
-
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(constraint.Object, &v1setting); err != nil {
-		return common.WrapNonRetriableCtrlError(err)
-	}
-
-	if valErr := r.validateRoles(&v1setting); valErr != nil {
-		return common.NewRetriableCtrlErrorWithCustomHandler(
-			func() (reconcile.Result, error) {
-				return reconcile.Result{}, nil
-			}, "error validating ScanSetting '%s' roles: %w", v1setting.GetName(), valErr)
+) {
+	if len(v1setting.Roles) == 0 {
+		r.Eventf(v1setting, corev1.EventTypeWarning, "EmptyRoles",
+			"The ScanSetting's roles are empty. Node scans won't be scheduled.")
 	}
 
 	// create per-role scans
-	suite.Spec.Scans = r.createScansWithSelector(suite, &v1setting, logger)
+	suite.Spec.Scans = r.createScansWithSelector(suite, v1setting, logger)
 	// apply settings for suite - deep copy to future proof in case there are any slices or so later
 	suite.Spec.ComplianceSuiteSettings = *v1setting.ComplianceSuiteSettings.DeepCopy()
 	// apply settings for scans, need to DeepCopy as ScanSetting contains a slice
@@ -367,14 +321,151 @@ func (r *ReconcileScanSettingBinding) applyConstraint(
 		scan := &suite.Spec.Scans[i]
 		scan.ComplianceScanSettings = *v1setting.ComplianceScanSettings.DeepCopy()
 	}
+}
 
-	return nil
+// bindingCheck is what checkBinding resolved from a ScanSettingBinding.
+type bindingCheck struct {
+	// The profiles and tailored profiles, in the order the binding lists them
+	profiles []*profileReference
+	// The ScanSetting the binding points to, if any
+	setting *compliancev1alpha1.ScanSetting
+	// The name of a TailoredProfile that wasn't processed yet. Nothing after
+	// it is checked, so profiles and setting are unset.
+	pending string
+}
+
+// referenceError is returned by checkBinding when an object the binding
+// names can't be looked up.
+type referenceError struct {
+	ref       *compliancev1alpha1.NamedObjectReference
+	namespace string
+	err       error
+}
+
+func (e *referenceError) Error() string {
+	// getUnstructured only sets a custom handler when the object is missing
+	if common.HasCustomHandler(e.err) {
+		return fmt.Sprintf("%s %s referenced by the binding was not found in namespace %s",
+			e.ref.Kind, e.ref.Name, e.namespace)
+	}
+	return e.err.Error()
+}
+
+func (e *referenceError) Unwrap() error {
+	return e.err
+}
+
+// invalidBindingError is returned by checkBinding when the binding can't be
+// turned into a suite and waiting won't change that.
+type invalidBindingError struct {
+	// The reason of the Warning event Reconcile emits, if any
+	reason string
+	msg    string
+}
+
+func (e *invalidBindingError) Error() string {
+	return e.msg
+}
+
+// checkBinding resolves everything the ScanSettingBinding references and
+// checks that it can be combined into a single suite: the profiles and
+// tailored profiles must resolve to a ProfileBundle, tailored profiles must
+// not be in an error state, node profiles must all target the same product
+// and the ScanSetting roles must be valid.
+//
+// Both Reconcile and the validating webhook call it, so they can't disagree
+// on what a valid binding is. The webhook is declared without side effects
+// and builds its reconciler without an event recorder, so the events the
+// lookups emit through r.Eventf are only recorded by Reconcile.
+func (r *ReconcileScanSettingBinding) checkBinding(
+	instance *compliancev1alpha1.ScanSettingBinding,
+	logger logr.Logger,
+) (*bindingCheck, error) {
+	check := &bindingCheck{}
+
+	var nodeProduct string
+	for i := range instance.Profiles {
+		ss := &instance.Profiles[i]
+
+		key := types.NamespacedName{Namespace: instance.Namespace, Name: ss.Name}
+		profileObj, err := getUnstructured(r, instance, key, ss.Kind, ss.APIGroup, logger)
+		if err != nil {
+			return nil, &referenceError{ref: ss, namespace: instance.Namespace, err: err}
+		}
+
+		if profileObj.GetKind() == "TailoredProfile" {
+			val, found, nsErr := unstructured.NestedString(
+				profileObj.Object, "status", "state")
+			if nsErr != nil {
+				logger.Error(nsErr, "Fetching state of tailored profile",
+					"TailoredProfile", profileObj.GetName())
+			}
+			if val == string(compliancev1alpha1.TailoredProfileStateError) {
+				return nil, &invalidBindingError{
+					msg: fmt.Sprintf("TailoredProfile %s has an error and is not usable", profileObj.GetName()),
+				}
+			}
+			if !found || val != string(compliancev1alpha1.TailoredProfileStateReady) {
+				return &bindingCheck{pending: profileObj.GetName()}, nil
+			}
+		}
+
+		reference, err := resolveProfileReference(r, instance, profileObj, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		if reference.profile != nil {
+			product := getNodeProduct(reference.profile)
+			nodeProduct = getRelevantProduct(nodeProduct, product)
+			if isDifferentProduct(nodeProduct, product) {
+				return nil, &invalidBindingError{
+					reason: "MultipleProducts",
+					msg:    fmt.Sprintf("ScanSettingBinding defines multiple products: %s and %s", product, nodeProduct),
+				}
+			}
+		}
+
+		check.profiles = append(check.profiles, reference)
+	}
+
+	if instance.SettingsRef == nil {
+		return check, nil
+	}
+
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.SettingsRef.Name}
+	constraint, err := getUnstructured(r, instance, key, instance.SettingsRef.Kind, instance.SettingsRef.APIGroup, logger)
+	if err != nil {
+		return nil, &referenceError{ref: instance.SettingsRef, namespace: instance.Namespace, err: err}
+	}
+	if err := isCmpv1Alpha1Gvk(constraint, "ScanSetting"); err != nil {
+		return nil, &invalidBindingError{msg: fmt.Sprintf("settingsRef must point to a ScanSetting: %s", err)}
+	}
+	v1setting := compliancev1alpha1.ScanSetting{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(constraint.Object, &v1setting); err != nil {
+		return nil, common.WrapNonRetriableCtrlError(err)
+	}
+	if err := r.validateRoles(&v1setting); err != nil {
+		return nil, &invalidBindingError{
+			msg: fmt.Sprintf("error validating ScanSetting '%s' roles: %s", v1setting.GetName(), err),
+		}
+	}
+	check.setting = &v1setting
+
+	return check, nil
+}
+
+// Validate runs the checks Reconcile does before creating a suite. Objects
+// that are merely not processed yet are not treated as errors, since
+// Reconcile waits for those.
+func (r *ReconcileScanSettingBinding) Validate(instance *compliancev1alpha1.ScanSettingBinding) error {
+	_, err := r.checkBinding(instance, log)
+	return err
 }
 
 func (r *ReconcileScanSettingBinding) validateRoles(setting *compliancev1alpha1.ScanSetting) error {
+	// Valid, but worth a warning when the binding is reconciled
 	if len(setting.Roles) == 0 {
-		r.Eventf(setting, corev1.EventTypeWarning, "EmptyRoles",
-			"The ScanSetting's roles are empty. Node scans won't be scheduled.")
 		return nil
 	}
 	// This is fine and expected
@@ -433,22 +524,17 @@ func (r *ReconcileScanSettingBinding) sanitizeRoleForName(roleName string) strin
 
 }
 
-func newCompScanFromBindingProfile(r *ReconcileScanSettingBinding, instance *compliancev1alpha1.ScanSettingBinding, profile *unstructured.Unstructured, logger logr.Logger) (*compliancev1alpha1.ComplianceScanSpecWrapper, string, error) {
-	parsedProfReference, err := resolveProfileReference(r, instance, profile, logger)
-	if err != nil {
-		return nil, "", err
-	}
-
-	scan, platform, err := profileReferenceToScan(parsedProfReference)
+func newCompScanFromBindingProfile(r *ReconcileScanSettingBinding, instance *compliancev1alpha1.ScanSettingBinding, reference *profileReference) (*compliancev1alpha1.ComplianceScanSpecWrapper, error) {
+	scan, _, err := profileReferenceToScan(reference)
 	if err != nil {
 		r.Eventf(
 			instance, corev1.EventTypeWarning, "ScanCreateError",
 			"Cannot create scan: %v", err,
 		)
-		return nil, "", err
+		return nil, err
 	}
 
-	return scan, platform, nil
+	return scan, nil
 }
 
 type profileReference struct {
@@ -493,9 +579,7 @@ func profileReferenceToScan(reference *profileReference) (*compliancev1alpha1.Co
 			return nil, "", fmt.Errorf("cannot infer scan type from %s: %v", reference.profile.GetName(), err)
 		}
 
-		if scan.ScanType == compliancev1alpha1.ScanTypeNode {
-			product = reference.profile.GetAnnotations()[compliancev1alpha1.ProductAnnotation]
-		}
+		product = getNodeProduct(reference.profile)
 	} else if reference.tailoredProfile != nil {
 		err = setScanType(&scan, reference.tailoredProfile.GetAnnotations())
 		if err != nil {
@@ -506,6 +590,16 @@ func profileReferenceToScan(reference *profileReference) (*compliancev1alpha1.Co
 	return &scan, product, nil
 }
 
+// getNodeProduct returns the product a node Profile targets, or an empty
+// string for platform profiles.
+func getNodeProduct(profile *unstructured.Unstructured) string {
+	annotations := profile.GetAnnotations()
+	if !strings.EqualFold(annotations[compliancev1alpha1.ProductTypeAnnotation], string(compliancev1alpha1.ScanTypeNode)) {
+		return ""
+	}
+	return annotations[compliancev1alpha1.ProductAnnotation]
+}
+
 func fillContentData(bundle *unstructured.Unstructured, scan *compliancev1alpha1.ComplianceScanSpecWrapper) error {
 	if err := isCmpv1Alpha1Gvk(bundle, "ProfileBundle"); err != nil {
 		return common.WrapNonRetriableCtrlError(err)
@@ -618,7 +712,7 @@ func resolveProfileReference(r *ReconcileScanSettingBinding, instance *complianc
 			return nil, common.NewNonRetriableCtrlError("TailoredProfile must be owned by a Profile or ProfileBundle")
 		}
 	} else {
-		r.Recorder.Eventf(
+		r.Eventf(
 			instance, corev1.EventTypeWarning, "ReferenceError",
 			"unsupported Kind %s, use one of Profile, TailoredProfile", profile.GetKind(),
 		)
@@ -635,7 +729,7 @@ func resolveProfile(r *ReconcileScanSettingBinding, instance *compliancev1alpha1
 func resolveTypedParent(r *ReconcileScanSettingBinding, instance *compliancev1alpha1.ScanSettingBinding, expectedKind string, child *unstructured.Unstructured, logger logr.Logger) (*unstructured.Unstructured, error) {
 	parentReference := ownerReferenceWithKind(child, expectedKind)
 	if parentReference == nil {
-		r.Recorder.Eventf(
+		r.Eventf(
 			instance, corev1.EventTypeWarning, "BadReference",
 			"Couldn't find a %s owning %s %s", expectedKind, child.GetKind(), child.GetName(),
 		)
@@ -2,6 +2,7 @@ package scansettingbinding
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -10,6 +11,8 @@ import (
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -743,6 +746,174 @@ var _ = Describe("Testing scansettingbinding controller", func() {
 		})
 	})
 
+	Context("Reports invalid roles of the ScanSetting", func() {
+		JustBeforeEach(func() {
+			setting.Roles = []string{compv1alpha1.AllRoles, "worker"}
+			err := reconciler.Client.Update(context.TODO(), setting)
+			Expect(err).To(BeNil())
+
+			ssb = &compv1alpha1.ScanSettingBinding{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "invalid-roles",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+				Profiles: []compv1alpha1.NamedObjectReference{
+					{
+						Name:     profRhcosE8.Name,
+						Kind:     profRhcosE8.Kind,
+						APIGroup: profRhcosE8.APIVersion,
+					},
+				},
+				SettingsRef: &compv1alpha1.NamedObjectReference{
+					Name:     setting.Name,
+					Kind:     setting.Kind,
+					APIGroup: setting.APIVersion,
+				},
+			}
+			ssb.Status.SetConditionPending()
+
+			err = reconciler.Client.Create(context.TODO(), ssb)
+			Expect(err).To(BeNil())
+		})
+
+		It("Should mark the binding as invalid and not create a suite", func() {
+			_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: ssb.Namespace,
+					Name:      ssb.Name,
+				},
+			})
+			Expect(err).To(BeNil())
+
+			err = reconciler.Client.Get(context.TODO(), types.NamespacedName{
+				Namespace: ssb.Namespace,
+				Name:      ssb.Name,
+			}, ssb)
+			Expect(err).To(BeNil())
+			cond := ssb.Status.Conditions.GetCondition("Ready")
+			Expect(cond).ToNot(BeNil())
+			Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(compv1alpha1.ConditionReason("Invalid")))
+			Expect(cond.Message).To(Equal(fmt.Sprintf(
+				"error validating ScanSetting '%s' roles: role %s cannot be used alongside other roles",
+				setting.Name, compv1alpha1.AllRoles)))
+
+			err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: ssb.Name, Namespace: ssb.Namespace}, suite)
+			Expect(kerrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	When("Validating a binding at admission time", func() {
+		var validator *scanSettingBindingValidator
+
+		JustBeforeEach(func() {
+			validator = &scanSettingBindingValidator{r: &reconciler}
+			ssb = &compv1alpha1.ScanSettingBinding{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "validated-binding",
+					Namespace: common.GetComplianceOperatorNamespace(),
+				},
+				Profiles: []compv1alpha1.NamedObjectReference{
+					{
+						Name:     profRhcosE8.Name,
+						Kind:     profRhcosE8.Kind,
+						APIGroup: profRhcosE8.APIVersion,
+					},
+				},
+				SettingsRef: &compv1alpha1.NamedObjectReference{
+					Name:     setting.Name,
+					Kind:     setting.Kind,
+					APIGroup: setting.APIVersion,
+				},
+			}
+		})
+
+		It("accepts a binding whose references all exist", func() {
+			Expect(validator.ValidateCreate(context.TODO(), ssb)).To(Succeed())
+		})
+
+		It("rejects a binding referencing a missing profile", func() {
+			ssb.Profiles[0].Name = "unexistent"
+			err := validator.ValidateCreate(context.TODO(), ssb)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("unexistent"))
+			Expect(err.Error()).To(ContainSubstring("not found"))
+		})
+
+		It("rejects a binding referencing a missing ScanSetting", func() {
+			ssb.SettingsRef.Name = "unexistent-setting"
+			err := validator.ValidateUpdate(context.TODO(), ssb.DeepCopy(), ssb)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("unexistent-setting"))
+		})
+
+		It("rejects a binding whose ScanSetting has invalid roles", func() {
+			setting.Roles = []string{"@all", "worker"}
+			Expect(reconciler.Client.Update(context.TODO(), setting)).To(Succeed())
+			err := validator.ValidateCreate(context.TODO(), ssb)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("roles"))
+		})
+
+		It("rejects a binding referencing a TailoredProfile in error", func() {
+			scratchTP.Status.State = compv1alpha1.TailoredProfileStateError
+			Expect(reconciler.Client.Status().Update(context.TODO(), scratchTP)).To(Succeed())
+			ssb.Profiles[0] = compv1alpha1.NamedObjectReference{
+				Name:     scratchTP.Name,
+				Kind:     scratchTP.Kind,
+				APIGroup: scratchTP.APIVersion,
+			}
+			err := validator.ValidateCreate(context.TODO(), ssb)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("is not usable"))
+		})
+
+		It("rejects a binding the reconciler marks as invalid with the same message", func() {
+			profBadProduct := profRhcosE8.DeepCopy()
+			profBadProduct.SetName("e8-other-product")
+			profBadProduct.Annotations = map[string]string{
+				compv1alpha1.ProductTypeAnnotation: string(compv1alpha1.ScanTypeNode),
+				compv1alpha1.ProductAnnotation:     "somethingelse",
+			}
+			profBadProduct.SetResourceVersion("")
+			Expect(reconciler.Client.Create(context.TODO(), profBadProduct)).To(Succeed())
+			ssb.Profiles = append(ssb.Profiles, compv1alpha1.NamedObjectReference{
+				Name:     profBadProduct.Name,
+				Kind:     profBadProduct.Kind,
+				APIGroup: profBadProduct.APIVersion,
+			})
+
+			admissionErr := validator.ValidateCreate(context.TODO(), ssb)
+			Expect(admissionErr).ToNot(BeNil())
+
+			ssb.Status.SetConditionPending()
+			Expect(reconciler.Client.Create(context.TODO(), ssb)).To(Succeed())
+			_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: ssb.Namespace, Name: ssb.Name},
+			})
+			Expect(err).To(BeNil())
+			Expect(reconciler.Client.Get(context.TODO(), types.NamespacedName{
+				Namespace: ssb.Namespace,
+				Name:      ssb.Name,
+			}, ssb)).To(Succeed())
+			cond := ssb.Status.Conditions.GetCondition("Ready")
+			Expect(cond).ToNot(BeNil())
+			Expect(cond.Reason).To(Equal(compv1alpha1.ConditionReason("Invalid")))
+			Expect(admissionErr.Error()).To(ContainSubstring(cond.Message))
+		})
+
+		It("accepts a binding referencing a TailoredProfile that isn't processed yet", func() {
+			scratchTP.Status.State = compv1alpha1.TailoredProfileStatePending
+			Expect(reconciler.Client.Status().Update(context.TODO(), scratchTP)).To(Succeed())
+			ssb.Profiles[0] = compv1alpha1.NamedObjectReference{
+				Name:     scratchTP.Name,
+				Kind:     scratchTP.Kind,
+				APIGroup: scratchTP.APIVersion,
+			}
+			Expect(validator.ValidateCreate(context.TODO(), ssb)).To(Succeed())
+		})
+	})
+
 	When("Validating roles", func() {
 		DescribeTable("Should pass the validation",
 			func(roles []string) {
@@ -0,0 +1,64 @@
+package scansettingbinding
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	compliancev1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
+)
+
+// ValidatingWebhookPath is the path the ScanSettingBinding validating
+// webhook is served on by the manager's webhook server.
+const ValidatingWebhookPath = "/validate-compliance-openshift-io-v1alpha1-scansettingbinding"
+
+//+kubebuilder:webhook:path=/validate-compliance-openshift-io-v1alpha1-scansettingbinding,mutating=false,failurePolicy=ignore,sideEffects=None,groups=compliance.openshift.io,resources=scansettingbindings,verbs=create;update,versions=v1alpha1,name=vscansettingbinding.compliance.openshift.io,admissionReviewVersions=v1
+
+// scanSettingBindingValidator rejects ScanSettingBindings at admission time
+// using the same checks the reconciler would otherwise only report in the
+// binding's status.
+type scanSettingBindingValidator struct {
+	r *ReconcileScanSettingBinding
+}
+
+var _ admission.CustomValidator = &scanSettingBindingValidator{}
+
+// AddWebhook registers the ScanSettingBinding validating webhook with the
+// manager's webhook server. The webhook is declared without side effects, so
+// its reconciler has no event recorder.
+func AddWebhook(mgr manager.Manager) error {
+	r := &ReconcileScanSettingBinding{Client: mgr.GetClient(), Scheme: mgr.GetScheme(),
+		roleVal:     regexp.MustCompile(roleValRegexp),
+		invalidRole: regexp.MustCompile(invalidRoleRegexp),
+	}
+	mgr.GetWebhookServer().Register(ValidatingWebhookPath,
+		admission.WithCustomValidator(&compliancev1alpha1.ScanSettingBinding{}, &scanSettingBindingValidator{r: r}))
+	return nil
+}
+
+func (v *scanSettingBindingValidator) ValidateCreate(_ context.Context, obj runtime.Object) error {
+	return v.validate(obj)
+}
+
+func (v *scanSettingBindingValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) error {
+	return v.validate(newObj)
+}
+
+func (v *scanSettingBindingValidator) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+func (v *scanSettingBindingValidator) validate(obj runtime.Object) error {
+	ssb, ok := obj.(*compliancev1alpha1.ScanSettingBinding)
+	if !ok {
+		return fmt.Errorf("expected a ScanSettingBinding, got %T", obj)
+	}
+	if err := v.r.Validate(ssb); err != nil {
+		return fmt.Errorf("invalid ScanSettingBinding %s: %w", ssb.GetName(), err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -54,6 +55,12 @@ func GetPrefixedName(pbName, objName string) string {
 }
 
 func ParseBundle(contentDom *xmlquery.Node, pb *cmpv1alpha1.ProfileBundle, pcfg *ParserConfig) error {
+	// Lookups by rule id only ever find the first rule, so refuse content
+	// that would make the others silently unreachable
+	if dups := findDuplicateRuleIDs(contentDom); len(dups) > 0 {
+		return LogAndReturnError(fmt.Sprintf("the datastream contains duplicate rule ids: %s", strings.Join(dups, ", ")))
+	}
+
 	// One go routine per type
 	errChan := make(chan error)
 	done := make(chan string)
@@ -725,6 +732,25 @@ func ParseRulesAndDo(contentDom *xmlquery.Node, stdParser *referenceParser, pb *
 	}
 }
 
+// findDuplicateRuleIDs returns the sorted ids used by more than one Rule
+func findDuplicateRuleIDs(contentDom *xmlquery.Node) []string {
+	seen := make(map[string]int)
+	for _, ruleObj := range xmlquery.Find(contentDom, "//xccdf-1.2:Rule") {
+		if id := ruleObj.SelectAttr("id"); id != "" {
+			seen[id]++
+		}
+	}
+
+	var dups []string
+	for id, count := range seen {
+		if count > 1 {
+			dups = append(dups, id)
+		}
+	}
+	sort.Strings(dups)
+	return dups
+}
+
 func isRelevantFix(fix *xmlquery.Node) bool {
 	if fix.SelectAttr("system") == machineConfigFixType {
 		return true
@@ -3,6 +3,7 @@ package profileparser
 import (
 	"context"
 	"os"
+	"strings"
 
 	cmpv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	"github.com/antchfx/xmlquery"
@@ -654,3 +655,31 @@ var _ = Describe("Testing CPE string parsing in isolation", func() {
 		})
 	})
 })
+
+var _ = Describe("Testing duplicate rule id detection", func() {
+	parse := func(rules ...string) *xmlquery.Node {
+		content := `<ds:data-stream-collection xmlns:ds="http://scap.nist.gov/schema/scap/source/1.2" xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">` +
+			`<xccdf-1.2:Benchmark id="xccdf_org.ssgproject.content_benchmark_OCP-4">`
+		for _, id := range rules {
+			content += `<xccdf-1.2:Rule id="` + id + `"/>`
+		}
+		content += `</xccdf-1.2:Benchmark></ds:data-stream-collection>`
+		doc, err := xmlquery.Parse(strings.NewReader(content))
+		Expect(err).To(BeNil())
+		return doc
+	}
+
+	It("Doesn't report content with unique rule ids", func() {
+		Expect(findDuplicateRuleIDs(parse("rule_a", "rule_b"))).To(BeEmpty())
+	})
+
+	It("Reports each duplicate rule id once", func() {
+		doc := parse("rule_b", "rule_a", "rule_b", "rule_c", "rule_a", "rule_b")
+		Expect(findDuplicateRuleIDs(doc)).To(Equal([]string{"rule_a", "rule_b"}))
+	})
+
+	It("Refuses to parse a bundle with duplicate rule ids", func() {
+		err := ParseBundle(parse("rule_a", "rule_a"), &cmpv1alpha1.ProfileBundle{}, &ParserConfig{})
+		Expect(err).To(MatchError(ContainSubstring("duplicate rule ids: rule_a")))
+	})
+})
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net/url"
@@ -16,6 +17,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	"github.com/ComplianceAsCode/compliance-operator/pkg/xccdf"
@@ -64,9 +66,15 @@ const (
 const (
 	endPointTag              = "ocp-api-endpoint"
 	endPointTagKubeletconfig = "ocp-api-endpoint-kubeletconfig"
+	configMapTag             = "ocp-api-configmap"
 	dumpLocationClass        = "ocp-dump-location"
 	filterTypeClass          = "ocp-api-filter"
 	filteredEndpointClass    = "filtered"
+	// The attributes of an endpoint restricting the versions it's fetched on
+	ocpVersionAttr = "ocp-version"
+	k8sVersionAttr = "k8s-version"
+	// The attribute of an endpoint whose filter may return several results
+	allowMultipleAttr = "allow-multiple"
 )
 
 type ParseResult struct {
@@ -79,12 +87,53 @@ type ResourcePath struct {
 	ObjPath  string
 	DumpPath string
 	Filter   string
+	// The OpenShift and Kubernetes version ranges the resource is only
+	// needed on, e.g. ">=4.14.0". It's needed on all versions if empty.
+	OCPVersion string
+	K8SVersion string
+	// Whether all the results of the filter are saved as an array, instead
+	// of only the first with a warning
+	AllowMultiple bool
+}
+
+const (
+	// ConfigMapDataFilter keeps the data of a ConfigMap referenced by name
+	ConfigMapDataFilter = `{data: (.data // {}), binaryData: (.binaryData // {})}`
+	// ConfigMapRedactedDataFilter keeps the keys of the binary data, but
+	// not their values
+	ConfigMapRedactedDataFilter = `{data: (.data // {}), binaryData: (.binaryData // {} | map_values("<redacted>"))}`
+)
+
+// ConfigMapResourcePath returns the path fetching the data of the ConfigMap
+// referenced as namespace/name. The data is dumped to
+// /configmaps/<namespace>/<name>.
+func ConfigMapResourcePath(ref string) (ResourcePath, error) {
+	parts := strings.Split(strings.TrimSpace(ref), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ResourcePath{}, fmt.Errorf("ConfigMap reference '%s' is not of the form namespace/name", ref)
+	}
+	if errs := validation.IsDNS1123Label(parts[0]); len(errs) > 0 {
+		return ResourcePath{}, fmt.Errorf("invalid namespace in ConfigMap reference '%s': %s", ref, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1123Subdomain(parts[1]); len(errs) > 0 {
+		return ResourcePath{}, fmt.Errorf("invalid name in ConfigMap reference '%s': %s", ref, strings.Join(errs, ", "))
+	}
+	return ResourcePath{
+		ObjPath:  fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", parts[0], parts[1]),
+		DumpPath: fmt.Sprintf("/configmaps/%s/%s", parts[0], parts[1]),
+		Filter:   ConfigMapDataFilter,
+	}, nil
 }
 
 // getPathsFromRuleWarning finds the API endpoint from in. The expected structure is:
 //
 //	<warning category="general" lang="en-US"><code class="ocp-api-endpoint">/apis/config.openshift.io/v1/oauths/cluster
 //	</code></warning>
+//
+// A ConfigMap can also be referenced by name, see ConfigMapResourcePath:
+//
+//	<warning category="general" lang="en-US"><code class="ocp-api-configmap">openshift-config/admin-kubeconfig-client-ca
+//	</code></warning>
 func GetPathFromWarningXML(in *xmlquery.Node, valuesList map[string]string) ([]ResourcePath, error) {
 	apiPaths := []ResourcePath{}
 
@@ -92,6 +141,23 @@ func GetPathFromWarningXML(in *xmlquery.Node, valuesList map[string]string) ([]R
 	errMsgs := []string{}
 
 	for _, codeNode := range codeNodes {
+		if codeNode.SelectAttr("class") == configMapTag {
+			ref, _, err := RenderValues(XmlNodeAsMarkdown(codeNode), valuesList)
+			if err != nil {
+				errMsgs = append(errMsgs, err.Error())
+				continue
+			}
+			if len(ref) == 0 {
+				continue
+			}
+			cmPath, err := ConfigMapResourcePath(ref)
+			if err != nil {
+				errMsgs = append(errMsgs, err.Error())
+				continue
+			}
+			apiPaths = append(apiPaths, cmPath)
+			continue
+		}
 		if strings.Contains(codeNode.SelectAttr("class"), endPointTag) {
 			path, _, err := RenderValues(XmlNodeAsMarkdown(codeNode), valuesList)
 			if len(path) == 0 {
@@ -116,7 +182,14 @@ func GetPathFromWarningXML(in *xmlquery.Node, valuesList map[string]string) ([]R
 					dumpPath, _, err = RenderValues(XmlNodeAsMarkdown(dumpNode), valuesList)
 				}
 			}
-			apiPaths = append(apiPaths, ResourcePath{ObjPath: path, DumpPath: dumpPath, Filter: filter})
+			apiPaths = append(apiPaths, ResourcePath{
+				ObjPath:       path,
+				DumpPath:      dumpPath,
+				Filter:        filter,
+				OCPVersion:    strings.TrimSpace(codeNode.SelectAttr(ocpVersionAttr)),
+				K8SVersion:    strings.TrimSpace(codeNode.SelectAttr(k8sVersionAttr)),
+				AllowMultiple: strings.TrimSpace(codeNode.SelectAttr(allowMultipleAttr)) == "true",
+			})
 		}
 	}
 	if len(errMsgs) > 0 {
@@ -130,7 +203,8 @@ func warningHasApiObjects(in *xmlquery.Node) bool {
 	codeNodes := in.SelectElements("//html:code")
 
 	for _, codeNode := range codeNodes {
-		if codeNode.SelectAttr("class") == endPointTag || codeNode.SelectAttr("class") == endPointTagKubeletconfig {
+		switch codeNode.SelectAttr("class") {
+		case endPointTag, endPointTagKubeletconfig, configMapTag:
 			return true
 		}
 	}
@@ -425,6 +499,23 @@ func ParseContent(dsReader io.Reader) (*xmlquery.Node, error) {
 	return dsDom, nil
 }
 
+// ParseContentWithDigest parses the DataStream like ParseContent and also
+// returns the SHA-256 digest of the raw document in the "sha256:<hex>" form
+func ParseContentWithDigest(dsReader io.Reader) (*xmlquery.Node, string, error) {
+	hash := sha256.New()
+	tee := io.TeeReader(dsReader, hash)
+	dsDom, err := ParseContent(tee)
+	if err != nil {
+		return nil, "", err
+	}
+	// The parser might stop before the end of the input, e.g. at trailing
+	// whitespace, which still needs to be part of the digest
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, "", err
+	}
+	return dsDom, fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
+
 func ParseResultsFromContentAndXccdf(scheme *runtime.Scheme, scanName string, namespace string,
 	dsDom *xmlquery.Node, resultsReader io.Reader, manualRules []string) ([]*ParseResult, error) {
 
@@ -448,6 +539,13 @@ func ParseResultsFromContentAndXccdf(scheme *runtime.Scheme, scanName string, na
 	results := resultsDom.SelectElements("//rule-result")
 	parsedResults := make([]*ParseResult, 0)
 	var remErrs string
+	// The results of the rules others may require
+	ruleResults := make(map[string]string, len(results))
+	for _, result := range results {
+		if resultEl := result.SelectElement("result"); resultEl != nil {
+			ruleResults[result.SelectAttr("idref")] = resultEl.InnerText()
+		}
+	}
 
 	for i := range results {
 		result := results[i]
@@ -469,6 +567,11 @@ func ParseResultsFromContentAndXccdf(scheme *runtime.Scheme, scanName string, na
 		}
 
 		if resCheck != nil {
+			if resCheck.Status == compv1alpha1.CheckResultNotApplicable {
+				resCheck.SetAnnotations(map[string]string{
+					compv1alpha1.ComplianceCheckResultNotApplicableReasonAnnotation: notApplicableReason(resultRule, ruleResults),
+				})
+			}
 			pr := &ParseResult{
 				Id:          ruleIDRef,
 				CheckResult: resCheck,
@@ -520,9 +623,45 @@ func newComplianceCheckResult(result *xmlquery.Node, rule *xmlquery.Node, ruleId
 		Description:  complianceCheckResultDescription(rule),
 		Warnings:     GetWarningsForRule(rule),
 		ValuesUsed:   ruleValues,
+		References:   GetReferencesForRule(rule),
 	}, nil
 }
 
+// notApplicableReason tells why the rule was found not applicable, given the
+// results of the other rules: a rule it requires wasn't selected or didn't
+// pass, it's restricted to other platforms, or else its check doesn't apply.
+// The platforms of the benchmark itself are left out, as all of its rules
+// share them.
+func notApplicableReason(rule *xmlquery.Node, ruleResults map[string]string) string {
+	for _, requires := range rule.SelectElements("xccdf-1.2:requires") {
+		// Any of the space-separated items satisfies the requirement
+		idrefs := strings.Fields(requires.SelectAttr("idref"))
+		reason := ""
+		for _, idref := range idrefs {
+			switch ruleResults[idref] {
+			case "pass", "fixed":
+				reason = ""
+			case "", "notselected":
+				reason = compv1alpha1.NotApplicableReasonNotSelected
+			default:
+				reason = compv1alpha1.NotApplicableReasonPrerequisiteAbsent
+			}
+			if reason == "" {
+				break
+			}
+		}
+		if reason != "" {
+			return reason
+		}
+	}
+	for node := rule; node != nil && node.Data != "Benchmark"; node = node.Parent {
+		if node.SelectElement("xccdf-1.2:platform") != nil {
+			return compv1alpha1.NotApplicableReasonPlatformMismatch
+		}
+	}
+	return compv1alpha1.NotApplicableReasonCheck
+}
+
 func getSafeText(nptr *xmlquery.Node, elem string) string {
 	elemNode := nptr.SelectElement(elem)
 	if elemNode == nil {
@@ -563,6 +702,115 @@ func GetWarningsForRule(rule *xmlquery.Node) []string {
 	return warnings
 }
 
+// The reference types, named as in the content's rules, keyed by a part of
+// the link of the framework's document. The first match wins.
+var referenceTypesByURL = []struct {
+	urlPart string
+	refType string
+}{
+	{"public.cyber.mil/stigs/cci", "cci"},
+	{"public.cyber.mil/stigs/downloads", "srg"},
+	{"NIST.SP.800-53", "nist"},
+	{"NIST.SP.800-171", "cui"},
+	{"NIST.CSWP.04162018", "nist-csf"},
+	{"cisecurity.org/benchmark", "cis"},
+	{"cisecurity.org/controls", "cis-csc"},
+	{"Poster_Winter2016_CSCs", "cis-csc"},
+	{"isaca.org/resources/cobit", "cobit5"},
+	{"iso.org/standard/54534", "iso27001-2013"},
+	{"productId=116731", "isa-62443-2009"},
+	{"productId=116785", "isa-62443-2013"},
+	{"CFR-2007-title45", "hipaa"},
+	{"pcisecuritystandards.org", "pcidss"},
+	{"niap-ccevs.org", "ospp"},
+	{"nerc.com", "nerc-cip"},
+	{"ssi.gouv.fr", "anssi"},
+	{"cjis-security-policy", "cjis"},
+	{"cve.mitre.org", "cve"},
+	{"nvd.nist.gov/vuln", "cve"},
+}
+
+// The reference types of the identifiers that name their framework, for the
+// references that aren't linked
+var referenceTypesByIDPrefix = []struct {
+	idPrefix string
+	refType  string
+}{
+	{"CCI-", "cci"},
+	{"CVE-", "cve"},
+	{"SRG-", "srg"},
+}
+
+// referenceType returns the framework of the reference, or "" if neither
+// its link nor its identifier tell
+func referenceType(id, url string) string {
+	for _, t := range referenceTypesByURL {
+		if strings.Contains(url, t.urlPart) {
+			return t.refType
+		}
+	}
+	for _, t := range referenceTypesByIDPrefix {
+		if strings.HasPrefix(id, t.idPrefix) {
+			return t.refType
+		}
+	}
+	return ""
+}
+
+// GetReferencesForRule returns the external references of the rule. The
+// referenced document is linked by the href attribute, while the text holds
+// the section, control or CVE identifier. References consisting of just a
+// link are kept too.
+func GetReferencesForRule(rule *xmlquery.Node) []compv1alpha1.ComplianceCheckReference {
+	var references []compv1alpha1.ComplianceCheckReference
+
+	for _, ref := range rule.SelectElements("xccdf-1.2:reference") {
+		title, id := referenceText(ref)
+		url := strings.TrimSpace(ref.SelectAttr("href"))
+		if url == "" && (strings.HasPrefix(id, "http://") || strings.HasPrefix(id, "https://")) {
+			url, title, id = id, "", ""
+		}
+		if title == "" && id == "" && url == "" {
+			continue
+		}
+		references = append(references, compv1alpha1.ComplianceCheckReference{
+			Title: title,
+			Type:  referenceType(id, url),
+			ID:    id,
+			URL:   url,
+		})
+	}
+
+	return references
+}
+
+// referenceText returns the title and the identifier of the reference. The
+// references holding Dublin Core metadata have them in their dc:title and
+// dc:identifier, each standing for the other if it's missing. The text of
+// the other references is both.
+func referenceText(ref *xmlquery.Node) (string, string) {
+	dcTitle := ref.SelectElement("dc:title")
+	dcID := ref.SelectElement("dc:identifier")
+	if dcTitle == nil && dcID == nil {
+		text := strings.TrimSpace(ref.InnerText())
+		return text, text
+	}
+	var title, id string
+	if dcTitle != nil {
+		title = strings.TrimSpace(dcTitle.InnerText())
+	}
+	if dcID != nil {
+		id = strings.TrimSpace(dcID.InnerText())
+	}
+	if title == "" {
+		title = id
+	}
+	if id == "" {
+		id = title
+	}
+	return title, id
+}
+
 func RuleHasApiObjectWarning(rule *xmlquery.Node) bool {
 	warningObjs := rule.SelectElements("//xccdf-1.2:warning")
 
@@ -597,6 +845,9 @@ func mapComplianceCheckResultSeverity(result *xmlquery.Node) (compv1alpha1.Compl
 		return compv1alpha1.CheckResultSeverityMedium, nil
 	case "high":
 		return compv1alpha1.CheckResultSeverityHigh, nil
+	// Not in the table above, but some content marks rules as critical
+	case "critical":
+		return compv1alpha1.CheckResultSeverityCritical, nil
 	}
 
 	return compv1alpha1.CheckResultSeverityUnknown, nil
@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"strings"
 
+	"github.com/antchfx/xmlquery"
 	igntypes "github.com/coreos/ignition/v2/config/v3_2/types"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -430,6 +432,18 @@ Server 3.fedora.pool.ntp.org`
 			It("Should have the expected instructions", func() {
 				Expect(check.Instructions).To(HavePrefix(expInstructions))
 			})
+
+			It("Should have the expected references", func() {
+				Expect(check.References).To(ContainElement(compv1alpha1.ComplianceCheckReference{
+					Title: "CCI-002165",
+					Type:  "cci",
+					ID:    "CCI-002165",
+					URL:   "https://public.cyber.mil/stigs/cci/",
+				}))
+				for _, ref := range check.References {
+					Expect(ref.ID).ToNot(BeEmpty())
+				}
+			})
 		})
 
 		Context("First remediation type", func() {
@@ -800,4 +814,208 @@ Server 3.fedora.pool.ntp.org`
 		})
 
 	})
+
+	Describe("Parsing rule references", func() {
+		It("Keeps the linked and the link-only references", func() {
+			doc, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Rule xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+  <xccdf-1.2:reference href="https://www.cisecurity.org/benchmark/kubernetes/">1.2.1</xccdf-1.2:reference>
+  <xccdf-1.2:reference> https://nvd.nist.gov/800-53/Rev4/control/CM-6 </xccdf-1.2:reference>
+  <xccdf-1.2:reference></xccdf-1.2:reference>
+</xccdf-1.2:Rule>`))
+			Expect(err).To(BeNil())
+			refs := GetReferencesForRule(xmlquery.FindOne(doc, "//xccdf-1.2:Rule"))
+			Expect(refs).To(Equal([]compv1alpha1.ComplianceCheckReference{
+				{Title: "1.2.1", Type: "cis", ID: "1.2.1", URL: "https://www.cisecurity.org/benchmark/kubernetes/"},
+				{URL: "https://nvd.nist.gov/800-53/Rev4/control/CM-6"},
+			}))
+		})
+
+		It("Tells the framework of the references from their link or identifier", func() {
+			doc, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Rule xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+  <xccdf-1.2:reference href="http://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-53r4.pdf">CM-6(a)</xccdf-1.2:reference>
+  <xccdf-1.2:reference href="https://www.cisecurity.org/wp-content/uploads/2017/03/Poster_Winter2016_CSCs.pdf">11</xccdf-1.2:reference>
+  <xccdf-1.2:reference href="">SRG-APP-000516-CTR-001325</xccdf-1.2:reference>
+  <xccdf-1.2:reference>CVE-2021-25741</xccdf-1.2:reference>
+  <xccdf-1.2:reference href="">5.4.2</xccdf-1.2:reference>
+</xccdf-1.2:Rule>`))
+			Expect(err).To(BeNil())
+			refs := GetReferencesForRule(xmlquery.FindOne(doc, "//xccdf-1.2:Rule"))
+			Expect(refs).To(Equal([]compv1alpha1.ComplianceCheckReference{
+				{Title: "CM-6(a)", Type: "nist", ID: "CM-6(a)", URL: "http://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-53r4.pdf"},
+				{Title: "11", Type: "cis-csc", ID: "11", URL: "https://www.cisecurity.org/wp-content/uploads/2017/03/Poster_Winter2016_CSCs.pdf"},
+				{Title: "SRG-APP-000516-CTR-001325", Type: "srg", ID: "SRG-APP-000516-CTR-001325"},
+				{Title: "CVE-2021-25741", Type: "cve", ID: "CVE-2021-25741"},
+				{Title: "5.4.2", ID: "5.4.2"},
+			}))
+		})
+
+		It("Takes the title and identifier of the references from their Dublin Core metadata", func() {
+			doc, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Rule xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <xccdf-1.2:reference href="https://nvd.nist.gov/vuln/detail/CVE-2021-25741">
+    <dc:title>Symlink exchange can allow host filesystem access</dc:title>
+    <dc:identifier>CVE-2021-25741</dc:identifier>
+  </xccdf-1.2:reference>
+  <xccdf-1.2:reference href="https://www.cisecurity.org/benchmark/kubernetes/">
+    <dc:title>1.2.1</dc:title>
+  </xccdf-1.2:reference>
+</xccdf-1.2:Rule>`))
+			Expect(err).To(BeNil())
+			refs := GetReferencesForRule(xmlquery.FindOne(doc, "//xccdf-1.2:Rule"))
+			Expect(refs).To(Equal([]compv1alpha1.ComplianceCheckReference{
+				{
+					Title: "Symlink exchange can allow host filesystem access",
+					Type:  "cve",
+					ID:    "CVE-2021-25741",
+					URL:   "https://nvd.nist.gov/vuln/detail/CVE-2021-25741",
+				},
+				{Title: "1.2.1", Type: "cis", ID: "1.2.1", URL: "https://www.cisecurity.org/benchmark/kubernetes/"},
+			}))
+		})
+
+		It("Returns no references for rules without any", func() {
+			doc, err := xmlquery.Parse(strings.NewReader(`<Rule severity="low"/>`))
+			Expect(err).To(BeNil())
+			Expect(GetReferencesForRule(xmlquery.FindOne(doc, "//Rule"))).To(BeNil())
+		})
+	})
+
+	Describe("Explaining the not applicable results", func() {
+		doc, _ := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:Benchmark xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2">
+  <xccdf-1.2:platform idref="cpe:/a:redhat:openshift_container_platform:4"/>
+  <xccdf-1.2:Group id="xccdf_org.ssgproject.content_group_hypershift">
+    <xccdf-1.2:platform idref="#hypershift"/>
+    <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_in_platform_group"/>
+  </xccdf-1.2:Group>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_on_platform">
+    <xccdf-1.2:platform idref="#ocp4-on-sdn"/>
+  </xccdf-1.2:Rule>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_requires_failing">
+    <xccdf-1.2:requires idref="xccdf_org.ssgproject.content_rule_failing"/>
+  </xccdf-1.2:Rule>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_requires_unselected">
+    <xccdf-1.2:requires idref="xccdf_org.ssgproject.content_rule_failing xccdf_org.ssgproject.content_rule_unselected"/>
+  </xccdf-1.2:Rule>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_requires_passing">
+    <xccdf-1.2:requires idref="xccdf_org.ssgproject.content_rule_passing xccdf_org.ssgproject.content_rule_failing"/>
+  </xccdf-1.2:Rule>
+  <xccdf-1.2:Rule id="xccdf_org.ssgproject.content_rule_check"/>
+</xccdf-1.2:Benchmark>`))
+		ruleResults := map[string]string{
+			"xccdf_org.ssgproject.content_rule_failing":    "fail",
+			"xccdf_org.ssgproject.content_rule_passing":    "pass",
+			"xccdf_org.ssgproject.content_rule_unselected": "notselected",
+		}
+		reason := func(rule string) string {
+			node := xmlquery.FindOne(doc, "//xccdf-1.2:Rule[@id='xccdf_org.ssgproject.content_rule_"+rule+"']")
+			Expect(node).ToNot(BeNil(), rule)
+			return notApplicableReason(node, ruleResults)
+		}
+
+		It("Tells a missing prerequisite from an unselected one", func() {
+			Expect(reason("requires_failing")).To(Equal(compv1alpha1.NotApplicableReasonPrerequisiteAbsent))
+			Expect(reason("requires_unselected")).To(Equal(compv1alpha1.NotApplicableReasonNotSelected))
+			// Met by the passing rule
+			Expect(reason("requires_passing")).To(Equal(compv1alpha1.NotApplicableReasonCheck))
+		})
+
+		It("Finds the platforms of the rule and its groups", func() {
+			Expect(reason("on_platform")).To(Equal(compv1alpha1.NotApplicableReasonPlatformMismatch))
+			Expect(reason("in_platform_group")).To(Equal(compv1alpha1.NotApplicableReasonPlatformMismatch))
+		})
+
+		It("Falls back to the check not applying", func() {
+			Expect(reason("check")).To(Equal(compv1alpha1.NotApplicableReasonCheck))
+		})
+	})
+
+	Describe("Referencing ConfigMaps by name", func() {
+		parseWarning := func(code string) *xmlquery.Node {
+			doc, err := xmlquery.Parse(strings.NewReader(`<xccdf-1.2:warning xmlns:xccdf-1.2="http://checklists.nist.gov/xccdf/1.2" xmlns:html="http://www.w3.org/1999/xhtml" category="general">` +
+				code + `</xccdf-1.2:warning>`))
+			Expect(err).To(BeNil())
+			return xmlquery.FindOne(doc, "//xccdf-1.2:warning")
+		}
+
+		It("Fetches the data of the ConfigMap to a predictable path", func() {
+			warning := parseWarning(`<html:code class="ocp-api-configmap">openshift-config/{{.var_ca_configmap}}</html:code>`)
+			Expect(warningHasApiObjects(warning)).To(BeTrue())
+			paths, err := GetPathFromWarningXML(warning, map[string]string{"var_ca_configmap": "admin-kubeconfig-client-ca"})
+			Expect(err).To(BeNil())
+			Expect(paths).To(Equal([]ResourcePath{{
+				ObjPath:  "/api/v1/namespaces/openshift-config/configmaps/admin-kubeconfig-client-ca",
+				DumpPath: "/configmaps/openshift-config/admin-kubeconfig-client-ca",
+				Filter:   ConfigMapDataFilter,
+			}}))
+		})
+
+		It("Reads the versions an endpoint is needed on", func() {
+			warning := parseWarning(`<html:code class="ocp-api-endpoint" ocp-version="&gt;=4.14.0" k8s-version=" &gt;=1.27.0 ">/apis/config.openshift.io/v1/nodes/cluster</html:code>`)
+			paths, err := GetPathFromWarningXML(warning, nil)
+			Expect(err).To(BeNil())
+			Expect(paths).To(Equal([]ResourcePath{{
+				ObjPath:    "/apis/config.openshift.io/v1/nodes/cluster",
+				DumpPath:   "/apis/config.openshift.io/v1/nodes/cluster",
+				OCPVersion: ">=4.14.0",
+				K8SVersion: ">=1.27.0",
+			}}))
+		})
+
+		It("Reads whether an endpoint's filter may return several results", func() {
+			warning := parseWarning(`<html:code class="ocp-api-endpoint" allow-multiple="true">/apis/rbac.authorization.k8s.io/v1/clusterrolebindings</html:code>`)
+			paths, err := GetPathFromWarningXML(warning, nil)
+			Expect(err).To(BeNil())
+			Expect(paths).To(Equal([]ResourcePath{{
+				ObjPath:       "/apis/rbac.authorization.k8s.io/v1/clusterrolebindings",
+				DumpPath:      "/apis/rbac.authorization.k8s.io/v1/clusterrolebindings",
+				AllowMultiple: true,
+			}}))
+		})
+
+		It("Rejects references that aren't a namespace and a name", func() {
+			for _, ref := range []string{"admin-kubeconfig-client-ca", "openshift-config/", "a/b/c", "../secrets/x"} {
+				_, err := ConfigMapResourcePath(ref)
+				Expect(err).ToNot(BeNil(), ref)
+			}
+			paths, err := GetPathFromWarningXML(parseWarning(`<html:code class="ocp-api-configmap">a/b/c</html:code>`), nil)
+			Expect(err).ToNot(BeNil())
+			Expect(paths).To(BeEmpty())
+		})
+	})
+
+	Describe("Mapping rule severities", func() {
+		It("Maps every known severity, including critical", func() {
+			expected := map[string]compv1alpha1.ComplianceCheckResultSeverity{
+				"unknown":  compv1alpha1.CheckResultSeverityUnknown,
+				"info":     compv1alpha1.CheckResultSeverityInfo,
+				"low":      compv1alpha1.CheckResultSeverityLow,
+				"medium":   compv1alpha1.CheckResultSeverityMedium,
+				"high":     compv1alpha1.CheckResultSeverityHigh,
+				"critical": compv1alpha1.CheckResultSeverityCritical,
+				"bogus":    compv1alpha1.CheckResultSeverityUnknown,
+			}
+			for attr, severity := range expected {
+				doc, err := xmlquery.Parse(strings.NewReader(fmt.Sprintf(`<Rule severity="%s"/>`, attr)))
+				Expect(err).To(BeNil())
+				mapped, err := mapComplianceCheckResultSeverity(xmlquery.FindOne(doc, "//Rule"))
+				Expect(err).To(BeNil())
+				Expect(mapped).To(Equal(severity), "severity %s", attr)
+			}
+		})
+
+		It("Ranks critical above high", func() {
+			Expect(compv1alpha1.CheckResultSeverityCritical.IsMoreSevereThan(compv1alpha1.CheckResultSeverityHigh)).To(BeTrue())
+			Expect(compv1alpha1.CheckResultSeverityHigh.IsMoreSevereThan(compv1alpha1.CheckResultSeverityCritical)).To(BeFalse())
+			Expect(compv1alpha1.CheckResultSeverityHigh.IsMoreSevereThan(compv1alpha1.CheckResultSeverityMedium)).To(BeTrue())
+		})
+	})
+
+	Describe("Computing the content digest", func() {
+		It("Hashes the whole document, including trailing data", func() {
+			doc := "<Benchmark id=\"test\"/>\n\n"
+			parsed, digest, err := ParseContentWithDigest(strings.NewReader(doc))
+			Expect(err).To(BeNil())
+			Expect(xmlquery.FindOne(parsed, "//Benchmark")).ToNot(BeNil())
+			Expect(digest).To(Equal(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(doc)))))
+		})
+	})
 })
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"math"
+	"sort"
 
 	compv1alpha1 "github.com/ComplianceAsCode/compliance-operator/pkg/apis/compliance/v1alpha1"
 	"github.com/google/go-cmp/cmp"
@@ -162,6 +163,9 @@ func (prCtx *ParseResultContext) reconcileInconsistentResults() {
 	}
 }
 
+// GetConsistentResults returns all the results sorted by ID once the
+// inconsistent ones are reconciled, so that they're always handled and
+// printed in the same order
 func (prCtx *ParseResultContext) GetConsistentResults() []*ParseResultContextItem {
 	prCtx.reconcileInconsistentResults()
 
@@ -170,6 +174,9 @@ func (prCtx *ParseResultContext) GetConsistentResults() []*ParseResultContextIte
 	for _, item := range prCtx.consistent {
 		consistentList = append(consistentList, item)
 	}
+	sort.Slice(consistentList, func(i, j int) bool {
+		return consistentList[i].Id < consistentList[j].Id
+	})
 
 	return consistentList
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
 	dynclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -20,6 +21,7 @@ type FrameworkClient interface {
 	Get(gCtx goctx.Context, key dynclient.ObjectKey, obj dynclient.Object) error
 	List(gCtx goctx.Context, list dynclient.ObjectList, opts ...dynclient.ListOption) error
 	Create(gCtx goctx.Context, obj dynclient.Object, cleanupOptions *CleanupOptions) error
+	Apply(gCtx goctx.Context, obj dynclient.Object, cleanupOptions *CleanupOptions) error
 	Delete(gCtx goctx.Context, obj dynclient.Object, opts ...dynclient.DeleteOption) error
 	Update(gCtx goctx.Context, obj dynclient.Object) error
 }
@@ -37,9 +39,46 @@ func (f *frameworkClient) Create(gCtx goctx.Context, obj dynclient.Object, clean
 	if err != nil {
 		return err
 	}
+	f.addCleanupFn(gCtx, obj, objCopy, cleanupOptions)
+	return nil
+}
+
+// The field manager the fixtures are applied with
+const fixtureFieldManager = "compliance-operator-e2e"
+
+// Apply uses server-side apply to create the object or update it to match,
+// taking over the fields other managers set. Like Create, it adds a cleanup
+// function deleting the object, but only if the object didn't exist before,
+// so fixtures that are kept across test runs are updated in place.
+func (f *frameworkClient) Apply(gCtx goctx.Context, obj dynclient.Object, cleanupOptions *CleanupOptions) error {
+	objCopy := obj.DeepCopyObject()
+	existing, ok := obj.DeepCopyObject().(dynclient.Object)
+	if !ok {
+		return fmt.Errorf("cannot apply %T", obj)
+	}
+	err := f.Client.Get(gCtx, dynclient.ObjectKeyFromObject(obj), existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	created := apierrors.IsNotFound(err)
+	err = f.Client.Patch(gCtx, obj, dynclient.Apply, dynclient.FieldOwner(fixtureFieldManager), dynclient.ForceOwnership)
+	if err != nil {
+		return err
+	}
+	if created {
+		f.addCleanupFn(gCtx, obj, objCopy, cleanupOptions)
+	}
+	return nil
+}
+
+// addCleanupFn adds a cleanup function deleting the object to the test
+// context of the options, if there's one
+func (f *frameworkClient) addCleanupFn(gCtx goctx.Context, obj dynclient.Object, objCopy runtime.Object,
+	cleanupOptions *CleanupOptions) {
+	var err error
 	// if no test context exists, cannot add finalizer function or print to testing log
 	if cleanupOptions == nil || cleanupOptions.TestContext == nil {
-		return nil
+		return
 	}
 	key := dynclient.ObjectKeyFromObject(obj)
 	// this function fails silently if t is nil
@@ -82,7 +121,6 @@ func (f *frameworkClient) Create(gCtx goctx.Context, obj dynclient.Object, clean
 		}
 		return nil
 	})
-	return nil
 }
 
 func (f *frameworkClient) Get(gCtx goctx.Context, key dynclient.ObjectKey, obj dynclient.Object) error {
@@ -14,6 +14,8 @@ import (
 type Context struct {
 	id         string
 	cleanupFns []cleanupFn
+	// run by Cleanup before the cleanup functions if the test failed
+	failureFns []cleanupFn
 	// the  namespace is deprecated
 	// todo: remove before 1.0.0
 	// use operatorNamespace or watchNamespace  instead
@@ -28,6 +30,7 @@ type Context struct {
 	kubeclient         kubernetes.Interface
 	restMapper         *restmapper.DeferredDiscoveryRESTMapper
 	skipCleanupOnError bool
+	serverSideApply    bool
 }
 
 // todo(camilamacedo86): Remove the following line just added for we are able to deprecated TestCtx
@@ -72,6 +75,7 @@ func (f *Framework) newContext(t *testing.T) *Context {
 		kubeclient:         f.KubeClient,
 		restMapper:         f.restMapper,
 		skipCleanupOnError: f.skipCleanupOnError,
+		serverSideApply:    f.serverSideApply,
 		testType:           f.testType,
 	}
 }
@@ -85,6 +89,13 @@ func (ctx *Context) GetID() string {
 }
 
 func (ctx *Context) Cleanup() {
+	if ctx.t != nil && ctx.t.Failed() {
+		for _, fn := range ctx.failureFns {
+			if err := fn(); err != nil {
+				ctx.t.Logf("A function run on the test failure failed with error: (%v)\n", err)
+			}
+		}
+	}
 	if ctx.t != nil {
 		// The cleanup function will be skipped
 		if ctx.t.Failed() && ctx.skipCleanupOnError {
@@ -77,6 +77,7 @@ type Framework struct {
 	schemeMutex        sync.Mutex
 	LocalOperator      bool
 	skipCleanupOnError bool
+	serverSideApply    bool
 }
 
 type frameworkOpts struct {
@@ -88,6 +89,7 @@ type frameworkOpts struct {
 	testType           string
 	isLocalOperator    bool
 	skipCleanupOnError bool
+	serverSideApply    bool
 }
 
 const (
@@ -104,6 +106,7 @@ const (
 	LocalOperatorFlag      = "localOperator"
 	LocalOperatorArgs      = "localOperatorArgs"
 	SkipCleanupOnErrorFlag = "skipCleanupOnError"
+	ServerSideApplyFlag    = "serverSideApply"
 	TestTypeFlag           = "testType"
 
 	TestOperatorNamespaceEnv = "TEST_OPERATOR_NAMESPACE"
@@ -121,6 +124,9 @@ func (opts *frameworkOpts) addToFlagSet(flagset *flag.FlagSet) {
 	flagset.BoolVar(&opts.skipCleanupOnError, SkipCleanupOnErrorFlag, false,
 		"If set as true, the cleanup function responsible to remove all artifacts "+
 			"will be skipped if an error is faced.")
+	flagset.BoolVar(&opts.serverSideApply, ServerSideApplyFlag, false,
+		"If set as true, the manifests are applied server-side, updating the resources that already "+
+			"exist instead of skipping them or failing.")
 	flagset.StringVar(&opts.testType, TestTypeFlag, TestTypeAll,
 		"Defines the type of tests to run. (Options: all, serial, parallel)")
 }
@@ -173,6 +179,7 @@ func newFramework(opts *frameworkOpts) (*Framework, error) {
 		kubeconfigPath:     opts.kubeconfigPath,
 		restMapper:         restMapper,
 		skipCleanupOnError: opts.skipCleanupOnError,
+		serverSideApply:    opts.serverSideApply,
 		testType:           opts.testType,
 	}
 	return framework, nil
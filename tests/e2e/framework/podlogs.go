@@ -0,0 +1,109 @@
+package framework
+
+import (
+	goctx "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ArtifactDirEnv is the directory the logs of the pods are dumped to when a
+// test fails. Nothing is dumped if it isn't set.
+const ArtifactDirEnv = "ARTIFACT_DIR"
+
+// The pods whose logs are dumped: the operator's, and the scanners,
+// collectors and aggregators of the scans
+var podLogSelectors = []string{
+	"name=compliance-operator",
+	"workload in (scanner,aggregator)",
+}
+
+// AddPodLogsOnFailureFn makes Cleanup dump the logs of the operator and scan
+// pods of the namespace to the artifact directory if the test failed. The
+// logs are dumped before anything is cleaned up, even if the cleanup is
+// skipped on errors.
+func (ctx *Context) AddPodLogsOnFailureFn(namespace string) {
+	ctx.failureFns = append(ctx.failureFns, func() error {
+		dir := os.Getenv(ArtifactDirEnv)
+		if dir == "" {
+			return nil
+		}
+		return ctx.DumpPodLogs(namespace, filepath.Join(dir, testDirName(ctx.t.Name())))
+	})
+}
+
+// DumpPodLogs writes the logs of each container of the operator and scan pods
+// of the namespace to dir, as <pod>-<container>.log files
+func (ctx *Context) DumpPodLogs(namespace, dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create the log directory %s: %w", dir, err)
+	}
+	var errs []string
+	for _, selector := range podLogSelectors {
+		pods, err := ctx.kubeclient.CoreV1().Pods(namespace).List(goctx.TODO(),
+			metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("listing the pods matching %s: %v", selector, err))
+			continue
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			for _, container := range podContainerNames(pod) {
+				if err := ctx.dumpContainerLogs(pod, container, dir); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to dump some pod logs: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (ctx *Context) dumpContainerLogs(pod *core.Pod, container, dir string) error {
+	req := ctx.kubeclient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &core.PodLogOptions{Container: container})
+	logs, err := req.Stream(goctx.TODO())
+	if err != nil {
+		return fmt.Errorf("getting the logs of %s/%s: %w", pod.Name, container, err)
+	}
+	defer logs.Close()
+	logFile := filepath.Join(dir, pod.Name+"-"+container+".log")
+	out, err := os.Create(filepath.Clean(logFile))
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", logFile, err)
+	}
+	// #nosec G307
+	defer out.Close()
+	if _, err := io.Copy(out, logs); err != nil {
+		return fmt.Errorf("writing %s: %w", logFile, err)
+	}
+	if ctx.t != nil {
+		ctx.t.Logf("wrote the logs of %s/%s to %s", pod.Name, container, logFile)
+	}
+	return nil
+}
+
+// podContainerNames returns the names of the init containers and containers
+// of the pod
+func podContainerNames(pod *core.Pod) []string {
+	names := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// testDirName returns the name of the directory the artifacts of the test
+// are saved to. The subtests' names are separated with slashes.
+func testDirName(testName string) string {
+	return strings.ReplaceAll(testName, "/", "_")
+}
@@ -174,7 +174,7 @@ func (ctx *Context) createFromYAML(yamlFile []byte, skipIfExists bool, cleanupOp
 			return fmt.Errorf("failed to unmarshal object spec: %w", err)
 		}
 		obj.SetNamespace(operatorNamespace)
-		err = ctx.client.Create(goctx.TODO(), obj, cleanupOptions)
+		err = ctx.createObject(obj, cleanupOptions)
 		if skipIfExists && apierrors.IsAlreadyExists(err) {
 			continue
 		}
@@ -193,7 +193,7 @@ func (ctx *Context) createFromYAML(yamlFile []byte, skipIfExists bool, cleanupOp
 				}
 				return true, nil
 			})
-			err = ctx.client.Create(goctx.TODO(), obj, cleanupOptions)
+			err = ctx.createObject(obj, cleanupOptions)
 			if skipIfExists && apierrors.IsAlreadyExists(err) {
 				continue
 			}
@@ -209,6 +209,15 @@ func (ctx *Context) createFromYAML(yamlFile []byte, skipIfExists bool, cleanupOp
 	return nil
 }
 
+// createObject creates the object of a manifest, or applies it server-side
+// if the framework is set to, in which case an existing object is updated
+func (ctx *Context) createObject(obj *unstructured.Unstructured, cleanupOptions *CleanupOptions) error {
+	if ctx.serverSideApply {
+		return ctx.client.Apply(goctx.TODO(), obj, cleanupOptions)
+	}
+	return ctx.client.Create(goctx.TODO(), obj, cleanupOptions)
+}
+
 func (ctx *Context) InitializeClusterResources(cleanupOptions *CleanupOptions) error {
 	// create namespaced resources
 	namespacedYAML, err := ioutil.ReadFile(ctx.namespacedManPath)
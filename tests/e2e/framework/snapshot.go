@@ -0,0 +1,161 @@
+package framework
+
+import (
+	goctx "context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wI2L/jsondiff"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ObjectSelector picks the objects of a kind a snapshot covers. The
+// namespace is ignored for cluster-scoped kinds, and a nil selector matches
+// all the objects.
+type ObjectSelector struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Selector  labels.Selector
+}
+
+// ObjectSnapshot is the state of the selected objects at the time it was
+// taken, to verify an action, like a scan that should be read-only, didn't
+// change them
+type ObjectSnapshot struct {
+	ctx       *Context
+	selectors []ObjectSelector
+	objects   map[string][]byte
+}
+
+// SnapshotObjects lists the objects picked by the selectors
+func (ctx *Context) SnapshotObjects(selectors ...ObjectSelector) (*ObjectSnapshot, error) {
+	objects, err := ctx.listSnapshotObjects(selectors)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectSnapshot{ctx: ctx, selectors: selectors, objects: objects}, nil
+}
+
+// Diff lists the objects again and returns the changes since the snapshot
+// was taken: the objects that were added or removed, and the JSON patch
+// operations of the fields that changed in the others
+func (s *ObjectSnapshot) Diff() ([]string, error) {
+	current, err := s.ctx.listSnapshotObjects(s.selectors)
+	if err != nil {
+		return nil, err
+	}
+	changes := []string{}
+	for key, before := range s.objects {
+		after, ok := current[key]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s was removed", key))
+			continue
+		}
+		patch, err := jsondiff.CompareJSON(before, after)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compare %s: %w", key, err)
+		}
+		for _, op := range patch {
+			changes = append(changes, fmt.Sprintf("%s changed: %s", key, op))
+		}
+	}
+	for key := range current {
+		if _, ok := s.objects[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s was added", key))
+		}
+	}
+	sort.Strings(changes)
+	return changes, nil
+}
+
+// AssertUnchanged fails the test if any of the objects changed since the
+// snapshot was taken
+func (s *ObjectSnapshot) AssertUnchanged() {
+	changes, err := s.Diff()
+	if err != nil {
+		s.ctx.t.Fatalf("failed to diff the snapshotted objects: %v", err)
+	}
+	if len(changes) > 0 {
+		s.ctx.t.Fatalf("%d changes to the snapshotted objects:\n%s", len(changes), strings.Join(changes, "\n"))
+	}
+}
+
+// VerifyReadOnly runs the action and fails the test if it changed any of the
+// objects picked by the selectors
+func (ctx *Context) VerifyReadOnly(action func() error, selectors ...ObjectSelector) {
+	snapshot, err := ctx.SnapshotObjects(selectors...)
+	if err != nil {
+		ctx.t.Fatalf("failed to snapshot the objects: %v", err)
+	}
+	if err := action(); err != nil {
+		ctx.t.Fatal(err)
+	}
+	snapshot.AssertUnchanged()
+}
+
+func (ctx *Context) listSnapshotObjects(selectors []ObjectSelector) (map[string][]byte, error) {
+	objects := map[string][]byte{}
+	for _, sel := range selectors {
+		mapping, err := ctx.snapshotRESTMapping(sel.GVK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the resource of %s: %w", sel.GVK, err)
+		}
+		opts := []dynclient.ListOption{}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace && sel.Namespace != "" {
+			opts = append(opts, dynclient.InNamespace(sel.Namespace))
+		}
+		if sel.Selector != nil {
+			opts = append(opts, dynclient.MatchingLabelsSelector{Selector: sel.Selector})
+		}
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(sel.GVK.GroupVersion().WithKind(sel.GVK.Kind + "List"))
+		if err := ctx.client.List(goctx.TODO(), list, opts...); err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", sel.GVK, err)
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			key := sel.GVK.Kind + " " + obj.GetName()
+			if obj.GetNamespace() != "" {
+				key = sel.GVK.Kind + " " + obj.GetNamespace() + "/" + obj.GetName()
+			}
+			data, err := snapshotJSON(obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s: %w", key, err)
+			}
+			objects[key] = data
+		}
+	}
+	return objects, nil
+}
+
+// snapshotRESTMapping resolves the kind, resetting the mapper in case the
+// kind's CRD was created after it was last discovered
+func (ctx *Context) snapshotRESTMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := ctx.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil {
+		return mapping, nil
+	}
+	_ = wait.PollImmediate(time.Second*1, time.Second*10, func() (bool, error) {
+		ctx.restMapper.Reset()
+		mapping, err = ctx.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		return err == nil, nil
+	})
+	return mapping, err
+}
+
+// snapshotJSON marshals the object without the metadata the API server
+// updates on every write, so only the changes to its content are reported
+func snapshotJSON(obj *unstructured.Unstructured) ([]byte, error) {
+	content := obj.DeepCopy().Object
+	unstructured.RemoveNestedField(content, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	return json.Marshal(content)
+}
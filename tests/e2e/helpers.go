@@ -398,6 +398,7 @@ func setupComplianceOperatorCluster(t *testing.T, ctx *framework.Context, f *fra
 	if err != nil {
 		t.Fatalf("failed to initialize cluster resources: %v", err)
 	}
+	ctx.AddPodLogsOnFailureFn(namespace)
 
 	err = initializeMetricsTestResources(f, namespace)
 	if err != nil {
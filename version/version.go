@@ -1,5 +1,27 @@
 package version
 
+import "runtime/debug"
+
 var (
 	Version = "0.1.56"
+	// GitCommit is the commit the operator was built from, set at build
+	// time with -ldflags "-X .../version.GitCommit=<commit>"
+	GitCommit = ""
 )
+
+// Commit returns the commit the operator was built from: GitCommit if it was
+// set at build time, or else the revision the Go toolchain stamped the binary
+// with, or "unknown" if neither is known.
+func Commit() string {
+	if GitCommit != "" {
+		return GitCommit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}